@@ -0,0 +1,103 @@
+package catalog
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/discovery"
+)
+
+const (
+	// Meta key of the DNS-SD service type of an announced entry (e.g. "_ipp._tcp").
+	// Defaults to the one of the scheme of the endpoint url
+	MetaDNSSDType = "dnssdType"
+	// Endpoint key of the url of a protocol
+	endpointUrl = "url"
+)
+
+// Announcement of the registered entries over multicast DNS-SD
+// for clients not using the catalog API
+type AnnounceConfig struct {
+	Enabled bool `json:"enabled"`
+	// Interval of the synchronization of the announcements with the catalog (seconds)
+	Interval int `json:"interval"`
+}
+
+func (c AnnounceConfig) Validate() error {
+	if c.Interval < 0 {
+		return fmt.Errorf("announce interval must not be negative")
+	}
+	return nil
+}
+
+// Returns the announcer of the instances configured with the interval
+func (c AnnounceConfig) Announcer(instances func() (map[string]discovery.Instance, error)) *discovery.Announcer {
+	a := discovery.NewAnnouncer(instances)
+	a.Interval = time.Duration(c.Interval) * time.Second
+	return a
+}
+
+// Returns the DNS-SD instance announcing an entry at the url of a protocol endpoint.
+// The other scalar endpoint values and the scalar meta values (later ones take
+// precedence) are published as TXT records in addition to the given records
+func EntryInstance(name string, endpoint map[string]interface{}, records map[string]string, meta ...map[string]interface{}) (discovery.Instance, error) {
+	serviceType, rawurl, txt, err := entryRecords(endpoint, records, meta)
+	if err != nil {
+		return discovery.Instance{}, err
+	}
+	return discovery.NewProxyInstance(name, serviceType, rawurl, txt)
+}
+
+// Same as EntryInstance without resolving the host of the url (see discovery.ParseProxyInstance)
+func ParseEntryInstance(name string, endpoint map[string]interface{}, records map[string]string, meta ...map[string]interface{}) (discovery.Instance, error) {
+	serviceType, rawurl, txt, err := entryRecords(endpoint, records, meta)
+	if err != nil {
+		return discovery.Instance{}, err
+	}
+	return discovery.ParseProxyInstance(name, serviceType, rawurl, txt)
+}
+
+// Returns the service type, url and TXT records of an entry
+func entryRecords(endpoint map[string]interface{}, records map[string]string, meta []map[string]interface{}) (string, string, map[string]string, error) {
+	rawurl, ok := endpoint[endpointUrl].(string)
+	if !ok {
+		return "", "", nil, fmt.Errorf("No url in the endpoint")
+	}
+
+	txt := make(map[string]string)
+	serviceType := ""
+	for _, m := range meta {
+		for k, v := range m {
+			if s, ok := txtValue(v); ok {
+				txt[k] = s
+			}
+		}
+		if t, ok := m[MetaDNSSDType].(string); ok {
+			serviceType = t
+		}
+	}
+	delete(txt, MetaDNSSDType)
+	for k, v := range endpoint {
+		if s, ok := txtValue(v); ok && k != endpointUrl {
+			txt[k] = s
+		}
+	}
+	for k, v := range records {
+		txt[k] = v
+	}
+	return serviceType, rawurl, txt, nil
+}
+
+// Returns the TXT value of a scalar JSON value
+func txtValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
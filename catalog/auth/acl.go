@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/context"
+)
+
+var ErrorForbidden = errors.New("Forbidden")
+
+// Binds a principal to the id prefixes of the entries it may modify.
+// A prefix matches the id itself and ids below it (prefix + "/..."),
+// a trailing "*" matches any id starting with the rest of the prefix.
+type ACLEntry struct {
+	Principal string   `json:"principal"`
+	Prefixes  []string `json:"prefixes"`
+}
+
+// Returns true if the entry allows modifying id
+func (e ACLEntry) allows(id string) bool {
+	for _, prefix := range e.Prefixes {
+		if strings.HasSuffix(prefix, "*") {
+			if strings.HasPrefix(id, strings.TrimSuffix(prefix, "*")) {
+				return true
+			}
+		} else if id == prefix || strings.HasPrefix(id, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the principal may add, update or delete the entry with the given id.
+// Ownership is not enforced when no ACL is configured
+func (self *Authenticator) AuthorizeWrite(p *Principal, id string) error {
+	if !self.config.Enabled || len(self.config.ACL) == 0 {
+		return nil
+	}
+	if p == nil {
+		return ErrorForbidden
+	}
+	if p.HasRole(self.adminRole()) {
+		return nil
+	}
+	for _, e := range self.config.ACL {
+		if e.Principal == p.Name && e.allows(id) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not allowed to modify %s", p.Name, id)
+}
+
+func (self *Authenticator) adminRole() string {
+	if self.config.AdminRole != "" {
+		return self.config.AdminRole
+	}
+	return DefaultAdminRole
+}
+
+// Checks if the principal of the request may modify the entry with the given id.
+// Always succeeds if the request was not processed by an Authenticator
+func AuthorizeWrite(req *http.Request, id string) error {
+	a, ok := context.GetOk(req, authenticatorKey)
+	if !ok {
+		return nil
+	}
+	return a.(*Authenticator).AuthorizeWrite(PrincipalFromRequest(req), id)
+}
+
+// Checks if the principal of the request may perform administrative operations
+// (e.g. reconfigure the catalog). Like ownership, requires the admin role only when an ACL is configured
+func AuthorizeAdmin(req *http.Request) error {
+	a, ok := context.GetOk(req, authenticatorKey)
+	if !ok {
+		return nil
+	}
+	self := a.(*Authenticator)
+	if !self.config.Enabled || len(self.config.ACL) == 0 {
+		return nil
+	}
+	p := PrincipalFromRequest(req)
+	if p == nil || !p.HasRole(self.adminRole()) {
+		return ErrorForbidden
+	}
+	return nil
+}
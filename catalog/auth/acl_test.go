@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestAuthorizeWrite(t *testing.T) {
+	a, err := NewAuthenticator(Config{
+		Enabled: true,
+		Keys:    []KeyConfig{{Algorithm: AlgorithmHS256, Secret: testSecret}},
+		ACL: []ACLEntry{
+			{Principal: "dgw1", Prefixes: []string{"dgw1"}},
+			{Principal: "rd", Prefixes: []string{"rd/node-*"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cases := []struct {
+		principal *Principal
+		id        string
+		allowed   bool
+	}{
+		{&Principal{Name: "dgw1"}, "dgw1/dev1", true},
+		{&Principal{Name: "dgw1"}, "dgw1", true},
+		{&Principal{Name: "dgw1"}, "dgw10/dev1", false},
+		{&Principal{Name: "dgw1"}, "dgw2/dev1", false},
+		{&Principal{Name: "dgw2"}, "dgw2/dev1", false},
+		{&Principal{Name: "rd"}, "rd/node-12", true},
+		{&Principal{Name: "rd"}, "rd/other", false},
+		{&Principal{Name: "ops", Roles: []string{DefaultAdminRole}}, "dgw1/dev1", true},
+		{nil, "dgw1/dev1", false},
+	}
+	for _, c := range cases {
+		err := a.AuthorizeWrite(c.principal, c.id)
+		if (err == nil) != c.allowed {
+			t.Errorf("%+v on %s: expected allowed=%v, got %v", c.principal, c.id, c.allowed, err)
+		}
+	}
+
+	// ownership is not enforced without ACLs
+	open, _ := NewAuthenticator(Config{Enabled: true, Keys: []KeyConfig{{Algorithm: AlgorithmHS256, Secret: testSecret}}})
+	if err := open.AuthorizeWrite(&Principal{Name: "dgw2"}, "dgw1/dev1"); err != nil {
+		t.Errorf("Expected writes to be allowed without ACLs, got %v", err)
+	}
+}
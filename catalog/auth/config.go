@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"fmt"
+)
+
+// Server-side authentication config
+type Config struct {
+	// Enables authentication of write operations (POST, PUT, DELETE)
+	Enabled bool `json:"enabled"`
+	// Also require a token for read operations
+	ProtectReads bool `json:"protectReads"`
+	// Keys to verify JWT signatures
+	Keys []KeyConfig `json:"keys"`
+	// File with static tokens (one "token principal [role,...]" per line)
+	TokenFile string `json:"tokenFile"`
+	// Expected "iss" claim of JWTs (optional)
+	Issuer string `json:"issuer"`
+	// Expected "aud" claim of JWTs (optional)
+	Audience string `json:"audience"`
+	// Ownership of the catalog entries (ids) by principal
+	ACL []ACLEntry `json:"acl"`
+	// Role allowed to modify any entry (default: admin)
+	AdminRole string `json:"adminRole"`
+}
+
+// JWT verification key config.
+// Secret holds an HMAC secret, File a PEM public key or certificate (RS256) or a secret
+type KeyConfig struct {
+	Id        string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Secret    string `json:"secret"`
+	File      string `json:"file"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.Keys) == 0 && c.TokenFile == "" {
+		return fmt.Errorf("auth: either keys or tokenFile must be defined")
+	}
+	for _, k := range c.Keys {
+		if k.Algorithm != AlgorithmHS256 && k.Algorithm != AlgorithmRS256 {
+			return fmt.Errorf("auth: unsupported key algorithm %s", k.Algorithm)
+		}
+		if k.Secret == "" && k.File == "" {
+			return fmt.Errorf("auth: key %s must have either secret or file defined", k.Id)
+		}
+	}
+	for _, e := range c.ACL {
+		if e.Principal == "" || len(e.Prefixes) == 0 {
+			return fmt.Errorf("auth: acl entries must have a principal and prefixes defined")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+package auth
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	BearerScheme   = "Bearer"
+	// Role bypassing the ownership ACLs
+	DefaultAdminRole = "admin"
+	loggerPrefix     = "[auth] "
+)
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Client-side credentials used to access a catalog
+type Credentials struct {
+	// Bearer token (JWT or static token)
+	Token string `json:"token"`
+	// File to read the token from (takes precedence over Token)
+	TokenFile string `json:"tokenFile"`
+	// Client certificate and key for mutual TLS
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// CA to verify the catalog's certificate (system roots if empty)
+	CAFile string `json:"caFile"`
+}
+
+// Returns the bearer token. The token file is read on each call to pick up renewed tokens
+func (c *Credentials) BearerToken() (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	if c.TokenFile != "" {
+		b, err := ioutil.ReadFile(c.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return c.Token, nil
+}
+
+// Sets the Authorization header of the request (no-op for nil or empty credentials)
+func (c *Credentials) Authorize(req *http.Request) error {
+	token, err := c.BearerToken()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", BearerScheme+" "+token)
+	}
+	return nil
+}
+
+// Returns an HTTP client configured with the client certificate and CA of the credentials.
+// http.DefaultClient is returned for nil credentials or when no TLS settings are given
+func (c *Credentials) HTTPClient() (*http.Client, error) {
+	if c == nil || (c.CertFile == "" && c.CAFile == "") {
+		return http.DefaultClient, nil
+	}
+
+	conf := &tls.Config{}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %s", c.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: conf,
+		},
+	}, nil
+}
@@ -0,0 +1,3 @@
+// Package catalog/auth implements bearer token authentication (JWT or static
+// tokens) for the catalog RESTful APIs and credentials for the catalog clients.
+package auth
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorInvalidToken = errors.New("Invalid token")
+	ErrorExpiredToken = errors.New("Token has expired")
+)
+
+// Claims of a JWT used by the catalogs
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Roles     []string `json:"roles"`
+}
+
+// "aud" is either a string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return err
+	}
+	*a = audience(ss)
+	return nil
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyId     string `json:"kid"`
+}
+
+// JWT verification key
+type verificationKey struct {
+	id        string
+	algorithm string
+	secret    []byte
+	publicKey *rsa.PublicKey
+}
+
+// Loads a verification key from the configuration
+func newVerificationKey(conf KeyConfig) (*verificationKey, error) {
+	key := &verificationKey{
+		id:        conf.Id,
+		algorithm: conf.Algorithm,
+	}
+
+	data := []byte(conf.Secret)
+	if conf.File != "" {
+		var err error
+		data, err = ioutil.ReadFile(conf.File)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch conf.Algorithm {
+	case AlgorithmHS256:
+		key.secret = []byte(strings.TrimSpace(string(data)))
+		if len(key.secret) == 0 {
+			return nil, fmt.Errorf("Key %s: empty HMAC secret", conf.Id)
+		}
+	case AlgorithmRS256:
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("Key %s: no PEM data found", conf.Id)
+		}
+		var pub interface{}
+		var err error
+		if block.Type == "CERTIFICATE" {
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				pub = cert.PublicKey
+			}
+		} else {
+			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Key %s: %s", conf.Id, err.Error())
+		}
+		rsaKey, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("Key %s: not an RSA public key", conf.Id)
+		}
+		key.publicKey = rsaKey
+	default:
+		return nil, fmt.Errorf("Key %s: unsupported algorithm %s", conf.Id, conf.Algorithm)
+	}
+	return key, nil
+}
+
+func (self *verificationKey) verify(signingInput, signature []byte) bool {
+	switch self.algorithm {
+	case AlgorithmHS256:
+		mac := hmac.New(sha256.New, self.secret)
+		mac.Write(signingInput)
+		return hmac.Equal(signature, mac.Sum(nil))
+	case AlgorithmRS256:
+		h := sha256.Sum256(signingInput)
+		return rsa.VerifyPKCS1v15(self.publicKey, crypto.SHA256, h[:], signature) == nil
+	}
+	return false
+}
+
+// Verifies a compact serialized JWT with the given keys and returns its claims
+func verifyJWT(token string, keys []*verificationKey, issuer, aud string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrorInvalidToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrorInvalidToken
+	}
+	signature, err := decodeBase64URL(parts[2])
+	if err != nil {
+		return nil, ErrorInvalidToken
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range keys {
+		if k.algorithm != header.Algorithm || (header.KeyId != "" && k.id != "" && k.id != header.KeyId) {
+			continue
+		}
+		if k.verify(signingInput, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrorInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrorInvalidToken
+	}
+	if claims.ExpiresAt != 0 && now.Unix() >= claims.ExpiresAt {
+		return nil, ErrorExpiredToken
+	}
+	if claims.NotBefore != 0 && now.Unix() < claims.NotBefore {
+		return nil, ErrorInvalidToken
+	}
+	if issuer != "" && claims.Issuer != issuer {
+		return nil, ErrorInvalidToken
+	}
+	if aud != "" {
+		found := false
+		for _, a := range claims.Audience {
+			if a == aud {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrorInvalidToken
+		}
+	}
+	return &claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := decodeBase64URL(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Decodes unpadded base64url as used by JWS
+func decodeBase64URL(seg string) ([]byte, error) {
+	if m := len(seg) % 4; m != 0 {
+		seg += strings.Repeat("=", 4-m)
+	}
+	return base64.URLEncoding.DecodeString(seg)
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/context"
+)
+
+type contextKey int
+
+const (
+	principalKey contextKey = iota
+	authenticatorKey
+)
+
+// Authenticated client
+type Principal struct {
+	Name  string
+	Roles []string
+}
+
+// Returns true if the principal has the given role
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the principal authenticated for the request or nil
+func PrincipalFromRequest(req *http.Request) *Principal {
+	if p, ok := context.GetOk(req, principalKey); ok {
+		return p.(*Principal)
+	}
+	return nil
+}
+
+// Negroni middleware verifying bearer tokens
+type Authenticator struct {
+	config Config
+	keys   []*verificationKey
+	tokens []staticToken
+}
+
+// Creates an authenticator with the keys and tokens of the given config
+func NewAuthenticator(conf Config) (*Authenticator, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	a := &Authenticator{
+		config: conf,
+		keys:   make([]*verificationKey, 0, len(conf.Keys)),
+	}
+	for _, kc := range conf.Keys {
+		key, err := newVerificationKey(kc)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = append(a.keys, key)
+	}
+	if conf.TokenFile != "" {
+		tokens, err := loadTokenFile(conf.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		a.tokens = tokens
+		logger.Printf("Loaded %d static tokens from %s", len(tokens), conf.TokenFile)
+	}
+	return a, nil
+}
+
+// Authenticates a bearer token
+func (self *Authenticator) Authenticate(token string) (*Principal, error) {
+	if p, ok := lookupStaticToken(self.tokens, token); ok {
+		return p, nil
+	}
+	if len(self.keys) == 0 {
+		return nil, ErrorInvalidToken
+	}
+	claims, err := verifyJWT(token, self.keys, self.config.Issuer, self.config.Audience, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Name: claims.Subject, Roles: claims.Roles}, nil
+}
+
+// Returns true if the request needs to be authenticated
+func (self *Authenticator) protects(req *http.Request) bool {
+	if !self.config.Enabled {
+		return false
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return self.config.ProtectReads
+	}
+	return true
+}
+
+func (self *Authenticator) ServeHTTP(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	// the rejected requests do not reach the router clearing the context
+	defer context.Clear(req)
+	context.Set(req, authenticatorKey, self)
+	token := bearerToken(req)
+	if token == "" {
+		if self.protects(req) {
+			unauthorized(w, "", "Authorization required")
+			return
+		}
+		next(w, req)
+		return
+	}
+
+	// Authenticate whenever a token is provided to make the principal available
+	principal, err := self.Authenticate(token)
+	if err != nil {
+		if self.protects(req) {
+			logger.Printf("%s %s: %s", req.Method, req.URL.Path, err.Error())
+			unauthorized(w, "invalid_token", err.Error())
+			return
+		}
+		next(w, req)
+		return
+	}
+	context.Set(req, principalKey, principal)
+	next(w, req)
+}
+
+// Extracts the token from the Authorization header
+func bearerToken(req *http.Request) string {
+	h := req.Header.Get("Authorization")
+	if len(h) <= len(BearerScheme)+1 || !strings.EqualFold(h[:len(BearerScheme)], BearerScheme) || h[len(BearerScheme)] != ' ' {
+		return ""
+	}
+	return strings.TrimSpace(h[len(BearerScheme)+1:])
+}
+
+func unauthorized(w http.ResponseWriter, errCode, msg string) {
+	challenge := BearerScheme
+	if errCode != "" {
+		challenge = fmt.Sprintf("%s error=\"%s\"", BearerScheme, errCode)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(msg))
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/context"
+)
+
+const testSecret = "s3cr3t"
+
+func signHS256(claims string) string {
+	enc := func(b []byte) string {
+		return strings.TrimRight(base64.URLEncoding.EncodeToString(b), "=")
+	}
+	input := enc([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(input))
+	return input + "." + enc(mac.Sum(nil))
+}
+
+func doRequest(a *Authenticator, method, token string) (int, *Principal) {
+	var principal *Principal
+	req, _ := http.NewRequest(method, "/dc/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, req, func(w http.ResponseWriter, req *http.Request) {
+		principal = PrincipalFromRequest(req)
+		w.WriteHeader(http.StatusOK)
+	})
+	return w.Code, principal
+}
+
+func TestAuthenticatorJWT(t *testing.T) {
+	a, err := NewAuthenticator(Config{
+		Enabled:  true,
+		Keys:     []KeyConfig{{Id: "k1", Algorithm: AlgorithmHS256, Secret: testSecret}},
+		Issuer:   "patchwork",
+		Audience: "dc",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if code, _ := doRequest(a, "GET", ""); code != http.StatusOK {
+		t.Errorf("Expected reads to be allowed, got %v", code)
+	}
+	if code, _ := doRequest(a, "POST", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %v", code)
+	}
+
+	valid := signHS256(`{"sub":"dgw1","iss":"patchwork","aud":["dc"],"roles":["gateway"]}`)
+	code, p := doRequest(a, "POST", valid)
+	if code != http.StatusOK || p == nil || p.Name != "dgw1" || !p.HasRole("gateway") {
+		t.Errorf("Expected valid token to be accepted, got %v %+v", code, p)
+	}
+
+	expired := signHS256(`{"sub":"dgw1","iss":"patchwork","aud":"dc","exp":` +
+		strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10) + `}`)
+	if code, _ := doRequest(a, "DELETE", expired); code != http.StatusUnauthorized {
+		t.Errorf("Expected expired token to be rejected, got %v", code)
+	}
+	wrongAud := signHS256(`{"sub":"dgw1","iss":"patchwork","aud":"sc"}`)
+	if code, _ := doRequest(a, "PUT", wrongAud); code != http.StatusUnauthorized {
+		t.Errorf("Expected token for another audience to be rejected, got %v", code)
+	}
+	tampered := valid[:len(valid)-2] + "xx"
+	if code, _ := doRequest(a, "PUT", tampered); code != http.StatusUnauthorized {
+		t.Errorf("Expected tampered token to be rejected, got %v", code)
+	}
+}
+
+func TestAuthenticatorStaticTokens(t *testing.T) {
+	f, err := ioutil.TempFile("", "tokens")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# static tokens\nabc123 registrator\nxyz789 admin admin,gateway\n")
+	f.Close()
+
+	a, err := NewAuthenticator(Config{Enabled: true, ProtectReads: true, TokenFile: f.Name()})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if code, _ := doRequest(a, "GET", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected protected reads to require a token, got %v", code)
+	}
+	if code, p := doRequest(a, "GET", "abc123"); code != http.StatusOK || p.Name != "registrator" {
+		t.Errorf("Expected static token to be accepted, got %v", code)
+	}
+	if code, p := doRequest(a, "POST", "xyz789"); code != http.StatusOK || !p.HasRole("admin") {
+		t.Errorf("Expected static token with roles to be accepted, got %v", code)
+	}
+	if code, _ := doRequest(a, "POST", "nope"); code != http.StatusUnauthorized {
+		t.Errorf("Expected unknown token to be rejected, got %v", code)
+	}
+}
+
+func TestCredentialsAuthorize(t *testing.T) {
+	var c *Credentials
+	req, _ := http.NewRequest("GET", "/", nil)
+	if err := c.Authorize(req); err != nil || req.Header.Get("Authorization") != "" {
+		t.Error("Expected nil credentials to leave the request untouched")
+	}
+	c = &Credentials{Token: "abc123"}
+	c.Authorize(req)
+	if h := req.Header.Get("Authorization"); h != "Bearer abc123" {
+		t.Errorf("Unexpected Authorization header: %s", h)
+	}
+}
+
+func TestAuthenticatorClearsContext(t *testing.T) {
+	a, err := NewAuthenticator(Config{Enabled: true, Keys: []KeyConfig{{Id: "k1", Algorithm: AlgorithmHS256, Secret: testSecret}}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, token := range []string{"", "invalid"} {
+		req, _ := http.NewRequest("POST", "/dc/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, req, func(w http.ResponseWriter, req *http.Request) {
+			t.Error("Expected the request to be rejected")
+		})
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %v", w.Code)
+		}
+		if values := context.GetAll(req); len(values) != 0 {
+			t.Errorf("Expected the context of the rejected request to be cleared, got %v", values)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Principal of a static token
+type staticToken struct {
+	token     string
+	principal Principal
+}
+
+// Loads static tokens from a file.
+// Each non-empty line not starting with # has the format: token principal [role,role,...]
+func loadTokenFile(path string) ([]staticToken, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tokens := []staticToken{}
+	scanner := bufio.NewScanner(file)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: expected \"token principal [roles]\"", path, n)
+		}
+		t := staticToken{
+			token:     fields[0],
+			principal: Principal{Name: fields[1]},
+		}
+		if len(fields) == 3 {
+			t.principal.Roles = strings.Split(fields[2], ",")
+		}
+		tokens = append(tokens, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Looks up a static token (in constant time per entry)
+func lookupStaticToken(tokens []staticToken, token string) (*Principal, bool) {
+	for _, t := range tokens {
+		if len(t.token) == len(token) && subtle.ConstantTimeCompare([]byte(t.token), []byte(token)) == 1 {
+			p := t.principal
+			return &p, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,148 @@
+package catalog
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Default time lookups are cached (seconds)
+	DefaultCacheTTL = 30
+	// Default time not-found lookups are cached (seconds)
+	DefaultCacheNegativeTTL = 5
+	// Default maximum number of cached lookups
+	DefaultCacheMaxEntries = 1000
+)
+
+// Configuration of a cache of catalog lookups
+type CacheConfig struct {
+	// Time lookups are cached (seconds)
+	TTL int `json:"ttl"`
+	// Time not-found lookups are cached (seconds)
+	NegativeTTL int `json:"negativeTtl"`
+	// Time expired entries are still served when the catalog is unavailable (seconds).
+	// Zero serves them without limit, a negative value disables serving stale entries
+	MaxStale int `json:"maxStale"`
+	// Maximum number of cached lookups
+	MaxEntries int `json:"maxEntries"`
+}
+
+// Cache of catalog lookups with expiry.
+// Expired entries are kept to be served if a lookup fails, until they are older
+// than maxStale or the cache is full
+type Cache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	maxStale    time.Duration
+	maxEntries  int
+	entries     map[string]cacheEntry
+	mutex       sync.Mutex
+}
+
+type cacheEntry struct {
+	value   interface{}
+	err     error // not-found error of a negative entry
+	expires time.Time
+}
+
+func NewCache(conf CacheConfig) *Cache {
+	c := &Cache{
+		ttl:         DefaultCacheTTL * time.Second,
+		negativeTTL: DefaultCacheNegativeTTL * time.Second,
+		maxStale:    time.Duration(conf.MaxStale) * time.Second,
+		maxEntries:  DefaultCacheMaxEntries,
+		entries:     make(map[string]cacheEntry),
+	}
+	if conf.TTL > 0 {
+		c.ttl = time.Duration(conf.TTL) * time.Second
+	}
+	if conf.NegativeTTL > 0 {
+		c.negativeTTL = time.Duration(conf.NegativeTTL) * time.Second
+	}
+	if conf.MaxEntries > 0 {
+		c.maxEntries = conf.MaxEntries
+	}
+	return c
+}
+
+// Returns the cached value of the key or the one returned by fetch after expiry.
+// Errors for which notFound returns true are cached as well. If fetch fails
+// otherwise, an expired entry is returned instead (if not older than maxStale)
+func (self *Cache) Lookup(key string, fetch func() (interface{}, error), notFound func(error) bool) (interface{}, error) {
+	now := time.Now()
+	self.mutex.Lock()
+	entry, cached := self.entries[key]
+	self.mutex.Unlock()
+	if cached && now.Before(entry.expires) {
+		return entry.value, entry.err
+	}
+
+	value, err := fetch()
+	switch {
+	case err == nil:
+		self.set(key, cacheEntry{value: value, expires: now.Add(self.ttl)})
+		return value, nil
+	case notFound(err):
+		self.set(key, cacheEntry{err: err, expires: now.Add(self.negativeTTL)})
+		return nil, err
+	case cached && self.maxStale >= 0 && (self.maxStale == 0 || now.Sub(entry.expires) < self.maxStale):
+		logger.Printf("Cache.Lookup() Serving stale %s: %s", key, err.Error())
+		return entry.value, entry.err
+	}
+	return nil, err
+}
+
+func (self *Cache) set(key string, entry cacheEntry) {
+	self.mutex.Lock()
+	if _, ok := self.entries[key]; !ok && len(self.entries) >= self.maxEntries {
+		self.evict(time.Now())
+	}
+	self.entries[key] = entry
+	self.mutex.Unlock()
+}
+
+// Makes room for an entry: removes the entries which can no longer be served,
+// or the one expiring first if there are none
+// WARNING: the caller must obtain the lock before calling
+func (self *Cache) evict(now time.Time) {
+	var first string
+	for key, entry := range self.entries {
+		if !now.Before(entry.expires) && (entry.err != nil || self.maxStale < 0 ||
+			self.maxStale > 0 && now.Sub(entry.expires) >= self.maxStale) {
+			delete(self.entries, key)
+			continue
+		}
+		if first == "" || entry.expires.Before(self.entries[first].expires) {
+			first = key
+		}
+	}
+	if len(self.entries) >= self.maxEntries {
+		delete(self.entries, first)
+	}
+}
+
+// Removes the entry of the key
+func (self *Cache) Invalidate(key string) {
+	self.mutex.Lock()
+	delete(self.entries, key)
+	self.mutex.Unlock()
+}
+
+// Removes the entries with keys starting with prefix
+func (self *Cache) InvalidatePrefix(prefix string) {
+	self.mutex.Lock()
+	for key := range self.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(self.entries, key)
+		}
+	}
+	self.mutex.Unlock()
+}
+
+// Removes all entries
+func (self *Cache) Purge() {
+	self.mutex.Lock()
+	self.entries = make(map[string]cacheEntry)
+	self.mutex.Unlock()
+}
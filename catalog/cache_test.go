@@ -0,0 +1,119 @@
+package catalog
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var errorTestNotFound = errors.New("not found")
+
+func isTestNotFound(err error) bool {
+	return err == errorTestNotFound
+}
+
+func TestCacheLookup(t *testing.T) {
+	c := NewCache(CacheConfig{})
+	calls := 0
+	fetch := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		v, err := c.Lookup("key", fetch, isTestNotFound)
+		if err != nil || v.(int) != 1 {
+			t.Errorf("Expected the cached value 1, got %v (%v)", v, err)
+		}
+	}
+
+	c.Invalidate("key")
+	v, _ := c.Lookup("key", fetch, isTestNotFound)
+	if v.(int) != 2 {
+		t.Errorf("Expected a new lookup after invalidation, got %v", v)
+	}
+
+	// entries stored without ttl expire at once
+	c.ttl = 0
+	c.Invalidate("key")
+	c.Lookup("key", fetch, isTestNotFound)
+	v, _ = c.Lookup("key", fetch, isTestNotFound)
+	if v.(int) != 4 {
+		t.Errorf("Expected a new lookup after expiry, got %v", v)
+	}
+}
+
+func TestCacheNegative(t *testing.T) {
+	c := NewCache(CacheConfig{})
+	calls := 0
+	fetch := func() (interface{}, error) {
+		calls++
+		return nil, errorTestNotFound
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := c.Lookup("missing", fetch, isTestNotFound)
+		if err != errorTestNotFound {
+			t.Errorf("Expected the not-found error, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected the not-found lookup to be cached, fetched %v times", calls)
+	}
+}
+
+func TestCacheStale(t *testing.T) {
+	c := NewCache(CacheConfig{})
+	c.ttl = 0
+	unavailable := errors.New("unavailable")
+
+	c.Lookup("key", func() (interface{}, error) { return "value", nil }, isTestNotFound)
+	v, err := c.Lookup("key", func() (interface{}, error) { return nil, unavailable }, isTestNotFound)
+	if err != nil || v.(string) != "value" {
+		t.Errorf("Expected the stale value, got %v (%v)", v, err)
+	}
+
+	c.maxStale = -1
+	_, err = c.Lookup("key", func() (interface{}, error) { return nil, unavailable }, isTestNotFound)
+	if err != unavailable {
+		t.Errorf("Expected the error with stale entries disabled, got %v", err)
+	}
+
+	c.maxStale = time.Millisecond
+	c.set("key", cacheEntry{value: "value", expires: time.Now().Add(-time.Second)})
+	_, err = c.Lookup("key", func() (interface{}, error) { return nil, unavailable }, isTestNotFound)
+	if err != unavailable {
+		t.Errorf("Expected the error for entries older than maxStale, got %v", err)
+	}
+
+	c.Purge()
+	_, err = c.Lookup("key", func() (interface{}, error) { return nil, unavailable }, isTestNotFound)
+	if err != unavailable {
+		t.Errorf("Expected the error without a cached entry, got %v", err)
+	}
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	c := NewCache(CacheConfig{MaxEntries: 2})
+	fetch := func() (interface{}, error) { return "value", nil }
+
+	c.Lookup("a", fetch, isTestNotFound)
+	c.Lookup("b", fetch, isTestNotFound)
+	c.Lookup("c", fetch, isTestNotFound)
+	if len(c.entries) != 2 {
+		t.Errorf("Expected the cache to be bounded to 2 entries, got %v", len(c.entries))
+	}
+	if _, ok := c.entries["a"]; ok {
+		t.Error("Expected the entry expiring first to be evicted")
+	}
+
+	// entries which can no longer be served are removed first
+	c.maxStale = time.Millisecond
+	c.Purge()
+	c.set("expired1", cacheEntry{value: "value", expires: time.Now().Add(-time.Second)})
+	c.set("expired2", cacheEntry{err: errorTestNotFound, expires: time.Now().Add(-time.Second)})
+	c.Lookup("d", fetch, isTestNotFound)
+	if len(c.entries) != 1 {
+		t.Errorf("Expected the expired entries to be swept, got %v", c.entries)
+	}
+}
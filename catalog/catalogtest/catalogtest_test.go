@@ -0,0 +1,92 @@
+package catalogtest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/device"
+	"github.com/patchwork-toolkit/patchwork/catalog/service"
+)
+
+func TestDeviceCatalog(t *testing.T) {
+	dc := NewDeviceCatalog()
+	defer dc.Close()
+
+	d := &device.Device{Id: "dgw1/lamp", Name: "lamp", Ttl: 30}
+	client := dc.Client()
+	if err := device.RegisterDevice(client, d); err != nil {
+		t.Fatalf("Unexpected error on register: %v", err)
+	}
+	if _, ok := dc.Device(d.Id); !ok {
+		t.Fatalf("Device %s is not registered: %v", d.Id, dc.Devices())
+	}
+
+	// an expired registration is added again
+	dc.Expire(d.Id)
+	if len(dc.Devices()) != 0 {
+		t.Fatalf("Expected no devices after expiry: %v", dc.Devices())
+	}
+	dc.ResetRequests()
+	if err := device.RegisterDevice(client, d); err != nil {
+		t.Fatalf("Unexpected error on register: %v", err)
+	}
+	if _, ok := dc.Device(d.Id); !ok {
+		t.Errorf("Device %s is not registered again", d.Id)
+	}
+	if r := dc.Requests(); len(r) != 2 || r[0] != "GET /dc/dgw1/lamp" || r[1] != "POST /dc/" {
+		t.Errorf("Unexpected requests: %v", r)
+	}
+}
+
+func TestServiceCatalog(t *testing.T) {
+	sc := NewServiceCatalog()
+	defer sc.Close()
+
+	s := &service.Service{Id: "host/broker", Name: "broker", Ttl: 30}
+	if err := sc.Client().Add(s); err != nil {
+		t.Fatalf("Unexpected error on add: %v", err)
+	}
+	if got, ok := sc.Service(s.Id); !ok || got.Name != s.Name {
+		t.Errorf("Service %s is not registered: %v", s.Id, sc.Services())
+	}
+}
+
+func TestFaults(t *testing.T) {
+	sc := NewServiceCatalog()
+	defer sc.Close()
+	sc.Client().Add(&service.Service{Id: "host/broker", Name: "broker", Ttl: 30})
+
+	client, _ := service.NewRemoteCatalogClientWithOptions(sc.Endpoint, catalog.ClientOptions{
+		Timeout: 200 * time.Millisecond,
+		Retry:   catalog.RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond},
+	})
+
+	// transient errors are retried
+	sc.Inject(Faults{Status: http.StatusServiceUnavailable, Requests: 2})
+	if _, err := client.Get("host/broker"); err != nil {
+		t.Errorf("Expected the retries to succeed: %v", err)
+	}
+
+	sc.Inject(Faults{Status: http.StatusInternalServerError})
+	_, err := client.Get("host/broker")
+	if serr, ok := err.(*catalog.StatusError); !ok || serr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected the injected status, got %v", err)
+	}
+
+	sc.Inject(Faults{Drop: true})
+	if _, err := client.Get("host/broker"); err == nil {
+		t.Error("Expected an error for dropped connections")
+	}
+
+	sc.Inject(Faults{Latency: 400 * time.Millisecond})
+	if _, err := client.Get("host/broker"); err == nil {
+		t.Error("Expected the requests to time out")
+	}
+
+	sc.Heal()
+	if _, err := client.Get("host/broker"); err != nil {
+		t.Errorf("Unexpected error after healing: %v", err)
+	}
+}
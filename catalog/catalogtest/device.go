@@ -0,0 +1,61 @@
+package catalogtest
+
+import (
+	"encoding/json"
+
+	"github.com/patchwork-toolkit/patchwork/catalog/device"
+	"github.com/patchwork-toolkit/patchwork/catalog/replication"
+)
+
+// Location of the fake device catalog API
+const DeviceLocation = "/dc"
+
+// Device catalog on an httptest server
+type DeviceCatalog struct {
+	*Server
+	// snapshots of the replicated storage expose its state
+	storage *device.ReplicatedStorage
+}
+
+// Starts a writable device catalog. The caller should call Close when finished
+func NewDeviceCatalog() *DeviceCatalog {
+	storage := device.NewReplicatedStorage(device.NewMemoryStorage(), replication.NewLog(1))
+	handler := device.NewHandler(storage, device.HandlerOptions{
+		Location:    DeviceLocation,
+		Description: "Test device catalog",
+		Writable:    true,
+	})
+	return &DeviceCatalog{
+		Server:  newServer(handler, DeviceLocation),
+		storage: storage,
+	}
+}
+
+// Returns a client of the catalog
+func (self *DeviceCatalog) Client() *device.RemoteCatalogClient {
+	return device.NewRemoteCatalogClient(self.Endpoint, nil)
+}
+
+// Returns the registered devices by id
+func (self *DeviceCatalog) Devices() map[string]device.Device {
+	_, entries, _ := self.storage.Snapshot()
+	devices := make(map[string]device.Device, len(entries))
+	for id, data := range entries {
+		var d device.Device
+		if json.Unmarshal(data, &d) == nil {
+			devices[id] = d
+		}
+	}
+	return devices
+}
+
+// Returns the registered device with the given id
+func (self *DeviceCatalog) Device(id string) (device.Device, bool) {
+	d, ok := self.Devices()[id]
+	return d, ok
+}
+
+// Removes the registration as if its ttl expired
+func (self *DeviceCatalog) Expire(id string) error {
+	return self.storage.Delete(id)
+}
@@ -0,0 +1,5 @@
+// Package catalog/catalogtest provides in-process device and service catalogs
+// on httptest servers for testing catalog clients. The registrations of the
+// catalogs can be inspected and faults (latency, error responses, dropped
+// connections, expiry of registrations) injected into their requests.
+package catalogtest
@@ -0,0 +1,103 @@
+package catalogtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Faults injected into the requests of a fake catalog
+type Faults struct {
+	// Delay before each request is handled
+	Latency time.Duration
+	// Status the requests are answered with instead of being handled (e.g. 503)
+	Status int
+	// Close the connections without a response
+	Drop bool
+	// Number of requests the faults apply to (all following ones if zero)
+	Requests int
+}
+
+// HTTP server of a fake catalog
+type Server struct {
+	*httptest.Server
+	// URL of the catalog API
+	Endpoint string
+
+	handler   http.Handler
+	faults    Faults
+	remaining int
+	requests  []string
+	mutex     sync.Mutex
+}
+
+// Starts a server of the catalog API mounted at location
+func newServer(handler http.Handler, location string) *Server {
+	s := &Server{handler: handler}
+	s.Server = httptest.NewServer(s)
+	s.Endpoint = s.Server.URL + location
+	return s
+}
+
+func (self *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	self.mutex.Lock()
+	self.requests = append(self.requests, req.Method+" "+req.URL.Path)
+	faults := self.faults
+	if faults.Requests > 0 {
+		self.remaining--
+		if self.remaining <= 0 {
+			self.faults = Faults{}
+		}
+	}
+	self.mutex.Unlock()
+
+	if faults.Latency > 0 {
+		time.Sleep(faults.Latency)
+	}
+	if faults.Drop {
+		hj, ok := w.(http.Hijacker)
+		if ok {
+			conn, _, err := hj.Hijack()
+			if err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+	if faults.Status != 0 {
+		w.WriteHeader(faults.Status)
+		fmt.Fprintf(w, "Injected fault\n")
+		return
+	}
+	self.handler.ServeHTTP(w, req)
+}
+
+// Injects the faults into the following requests replacing the previous ones
+func (self *Server) Inject(faults Faults) {
+	self.mutex.Lock()
+	self.faults = faults
+	self.remaining = faults.Requests
+	self.mutex.Unlock()
+}
+
+// Removes the injected faults
+func (self *Server) Heal() {
+	self.Inject(Faults{})
+}
+
+// Returns the received requests as "METHOD path"
+func (self *Server) Requests() []string {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return append([]string{}, self.requests...)
+}
+
+// Forgets the received requests
+func (self *Server) ResetRequests() {
+	self.mutex.Lock()
+	self.requests = nil
+	self.mutex.Unlock()
+}
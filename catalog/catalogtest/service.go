@@ -0,0 +1,61 @@
+package catalogtest
+
+import (
+	"encoding/json"
+
+	"github.com/patchwork-toolkit/patchwork/catalog/replication"
+	"github.com/patchwork-toolkit/patchwork/catalog/service"
+)
+
+// Location of the fake service catalog API
+const ServiceLocation = "/sc"
+
+// Service catalog on an httptest server
+type ServiceCatalog struct {
+	*Server
+	// snapshots of the replicated storage expose its state
+	storage *service.ReplicatedStorage
+}
+
+// Starts a writable service catalog. The caller should call Close when finished
+func NewServiceCatalog() *ServiceCatalog {
+	storage := service.NewReplicatedStorage(service.NewMemoryStorage(), replication.NewLog(1))
+	handler := service.NewHandler(storage, service.HandlerOptions{
+		Location:    ServiceLocation,
+		Description: "Test service catalog",
+		Writable:    true,
+	})
+	return &ServiceCatalog{
+		Server:  newServer(handler, ServiceLocation),
+		storage: storage,
+	}
+}
+
+// Returns a client of the catalog
+func (self *ServiceCatalog) Client() *service.RemoteCatalogClient {
+	return service.NewRemoteCatalogClient(self.Endpoint, nil)
+}
+
+// Returns the registered services by id
+func (self *ServiceCatalog) Services() map[string]service.Service {
+	_, entries, _ := self.storage.Snapshot()
+	services := make(map[string]service.Service, len(entries))
+	for id, data := range entries {
+		var s service.Service
+		if json.Unmarshal(data, &s) == nil {
+			services[id] = s
+		}
+	}
+	return services
+}
+
+// Returns the registered service with the given id
+func (self *ServiceCatalog) Service(id string) (service.Service, bool) {
+	s, ok := self.Services()[id]
+	return s, ok
+}
+
+// Removes the registration as if its ttl expired
+func (self *ServiceCatalog) Expire(id string) error {
+	return self.storage.Delete(id)
+}
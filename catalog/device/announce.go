@@ -0,0 +1,57 @@
+package device
+
+import (
+	"fmt"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/discovery"
+)
+
+// Returns the DNS-SD instance announcing the resource of the device at the
+// first protocol endpoint with an url (see catalog.EntryInstance).
+// The meta of the resource takes precedence over the meta of the device
+func ResourceInstance(d Device, r Resource) (discovery.Instance, error) {
+	for _, p := range r.Protocols {
+		if _, ok := p.Endpoint["url"].(string); !ok {
+			continue
+		}
+		return catalog.EntryInstance(d.Name+"/"+r.Name, p.Endpoint, map[string]string{
+			discovery.TxtId: r.Id,
+			"device":        d.Id,
+			"type":          r.Type,
+			"protocol":      p.Type,
+		}, d.Meta, r.Meta)
+	}
+	return discovery.Instance{}, fmt.Errorf("Resource %v has no endpoint url", r.Id)
+}
+
+// Returns the instances announcing the resources in the storage by id
+func storageInstances(storage CatalogStorage) (map[string]discovery.Instance, error) {
+	instances := make(map[string]discovery.Instance)
+	for page := 1; ; page++ {
+		devices, total, err := storage.getMany(page, MaxPerPage)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range devices {
+			for _, r := range d.Resources {
+				i, err := ResourceInstance(d, r)
+				if err != nil {
+					continue
+				}
+				instances[r.Id] = i
+			}
+		}
+		if page*MaxPerPage >= total {
+			break
+		}
+	}
+	return instances, nil
+}
+
+// Creates an announcer of the resources in the storage as multicast DNS-SD instances
+func NewAnnouncer(storage CatalogStorage, config catalog.AnnounceConfig) *discovery.Announcer {
+	return config.Announcer(func() (map[string]discovery.Instance, error) {
+		return storageInstances(storage)
+	})
+}
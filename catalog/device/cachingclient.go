@@ -0,0 +1,184 @@
+package device
+
+import (
+	"fmt"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+const (
+	cacheKeyDevice = "device/"
+	cacheKeyQuery  = "query/"
+)
+
+// Catalog client caching the lookups of another client.
+// Not-found lookups are cached for a shorter time and cached entries
+// are served after expiry while the catalog is unavailable
+type CachingCatalogClient struct {
+	client CatalogClient
+	cache  *catalog.Cache
+}
+
+// Page of a cached collection
+type cachedDevices struct {
+	devices []Device
+	total   int
+}
+
+type cachedResources struct {
+	resources []Resource
+	total     int
+}
+
+func NewCachingCatalogClient(client CatalogClient, conf catalog.CacheConfig) *CachingCatalogClient {
+	return &CachingCatalogClient{
+		client: client,
+		cache:  catalog.NewCache(conf),
+	}
+}
+
+func isNotFound(err error) bool {
+	return err == ErrorNotFound
+}
+
+// Removes the cached device with the given id and all cached queries
+func (self *CachingCatalogClient) Invalidate(id string) {
+	self.cache.Invalidate(cacheKeyDevice + id)
+	self.cache.InvalidatePrefix(cacheKeyQuery)
+}
+
+// Removes all cached lookups
+func (self *CachingCatalogClient) InvalidateAll() {
+	self.cache.Purge()
+}
+
+func (self *CachingCatalogClient) Get(id string) (*Device, error) {
+	return self.lookupDevice(cacheKeyDevice+id, func() (*Device, error) {
+		return self.client.Get(id)
+	})
+}
+
+func (self *CachingCatalogClient) Add(d *Device) error {
+	err := self.client.Add(d)
+	self.Invalidate(d.Id)
+	return err
+}
+
+func (self *CachingCatalogClient) Update(id string, d *Device) error {
+	err := self.client.Update(id, d)
+	self.Invalidate(id)
+	return err
+}
+
+func (self *CachingCatalogClient) Delete(id string) error {
+	err := self.client.Delete(id)
+	self.Invalidate(id)
+	return err
+}
+
+func (self *CachingCatalogClient) GetDevices(page, perPage int) ([]Device, int, error) {
+	key := fmt.Sprintf("%sdevices/%d/%d", cacheKeyQuery, page, perPage)
+	return self.lookupDevices(key, func() ([]Device, int, error) {
+		return self.client.GetDevices(page, perPage)
+	})
+}
+
+func (self *CachingCatalogClient) FindDevice(path, op, value string) (*Device, error) {
+	key := fmt.Sprintf("%sdevice/%s/%s/%s", cacheKeyQuery, path, op, value)
+	return self.lookupDevice(key, func() (*Device, error) {
+		return self.client.FindDevice(path, op, value)
+	})
+}
+
+func (self *CachingCatalogClient) FindDevices(path, op, value string, page, perPage int) ([]Device, int, error) {
+	key := fmt.Sprintf("%sdevices/%s/%s/%s/%d/%d", cacheKeyQuery, path, op, value, page, perPage)
+	return self.lookupDevices(key, func() ([]Device, int, error) {
+		return self.client.FindDevices(path, op, value, page, perPage)
+	})
+}
+
+func (self *CachingCatalogClient) FindResource(path, op, value string) (*Resource, error) {
+	key := fmt.Sprintf("%sresource/%s/%s/%s", cacheKeyQuery, path, op, value)
+	v, err := self.cache.Lookup(key, func() (interface{}, error) {
+		r, err := self.client.FindResource(path, op, value)
+		if err != nil {
+			return nil, err
+		}
+		return r.copy(), nil
+	}, isNotFound)
+	if err != nil {
+		return nil, err
+	}
+	r := v.(Resource)
+	rc := r.copy()
+	return &rc, nil
+}
+
+func (self *CachingCatalogClient) FindResources(path, op, value string, page, perPage int) ([]Resource, int, error) {
+	key := fmt.Sprintf("%sresources/%s/%s/%s/%d/%d", cacheKeyQuery, path, op, value, page, perPage)
+	v, err := self.cache.Lookup(key, func() (interface{}, error) {
+		resources, total, err := self.client.FindResources(path, op, value, page, perPage)
+		if err != nil {
+			return nil, err
+		}
+		return cachedResources{copyResources(resources), total}, nil
+	}, isNotFound)
+	if err == ErrorNotFound {
+		return []Resource{}, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	c := v.(cachedResources)
+	return copyResources(c.resources), c.total, nil
+}
+
+func (self *CachingCatalogClient) lookupDevice(key string, fetch func() (*Device, error)) (*Device, error) {
+	v, err := self.cache.Lookup(key, func() (interface{}, error) {
+		d, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		return d.copy(), nil
+	}, isNotFound)
+	if err != nil {
+		return nil, err
+	}
+	d := v.(Device)
+	dc := d.copy()
+	return &dc, nil
+}
+
+func (self *CachingCatalogClient) lookupDevices(key string, fetch func() ([]Device, int, error)) ([]Device, int, error) {
+	v, err := self.cache.Lookup(key, func() (interface{}, error) {
+		devices, total, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		return cachedDevices{copyDevices(devices), total}, nil
+	}, isNotFound)
+	if err == ErrorNotFound {
+		return []Device{}, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	c := v.(cachedDevices)
+	return copyDevices(c.devices), c.total, nil
+}
+
+// Deep copy of the devices
+func copyDevices(devices []Device) []Device {
+	c := make([]Device, len(devices))
+	for i := range devices {
+		c[i] = devices[i].copy()
+	}
+	return c
+}
+
+// Deep copy of the resources
+func copyResources(resources []Resource) []Resource {
+	c := make([]Resource, len(resources))
+	for i := range resources {
+		c[i] = resources[i].copy()
+	}
+	return c
+}
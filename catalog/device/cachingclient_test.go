@@ -0,0 +1,96 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+func TestCachingCatalogClient(t *testing.T) {
+	ts, storage := setupShard()
+	client := NewCachingCatalogClient(NewRemoteCatalogClient(ts.URL+"/dc", nil), catalog.CacheConfig{})
+
+	d := federationTestDevice("dgw1/d1", "r1")
+	if err := client.Add(&d); err != nil {
+		t.Fatalf("Unexpected error on add: %v", err)
+	}
+	if _, err := client.Get("dgw1/d2"); err != ErrorNotFound {
+		t.Errorf("Expected ErrorNotFound, got %v", err)
+	}
+
+	// cached lookups don't see changes made behind the client
+	got, err := client.Get(d.Id)
+	if err != nil || got.Id != d.Id {
+		t.Fatalf("Unexpected get: %v (%v)", got, err)
+	}
+	storage.delete(d.Id)
+	d2 := federationTestDevice("dgw1/d2", "r1")
+	storage.add(d2)
+	if _, err := client.Get(d.Id); err != nil {
+		t.Errorf("Expected the cached device, got %v", err)
+	}
+	if _, err := client.Get(d2.Id); err != ErrorNotFound {
+		t.Errorf("Expected the cached not-found, got %v", err)
+	}
+
+	client.InvalidateAll()
+	if _, err := client.Get(d.Id); err != ErrorNotFound {
+		t.Errorf("Expected ErrorNotFound after invalidation, got %v", err)
+	}
+	devs, total, err := client.GetDevices(1, 10)
+	if err != nil || total != 1 || len(devs) != 1 || devs[0].Id != d2.Id {
+		t.Errorf("Unexpected devices: %v total %v (%v)", devs, total, err)
+	}
+
+	// writes through the client invalidate the cache
+	if err := client.Delete(d2.Id); err != nil {
+		t.Fatalf("Unexpected error on delete: %v", err)
+	}
+	if _, total, _ := client.GetDevices(1, 10); total != 0 {
+		t.Errorf("Expected no devices after delete, got %v", total)
+	}
+
+	// lookups of the unavailable catalog are answered from the cache
+	client.Add(&d)
+	client.Get(d.Id)
+	ts.Close()
+	if _, err := client.Get(d.Id); err != nil {
+		t.Errorf("Expected the cached device, got %v", err)
+	}
+	if _, err := client.Get("dgw1/d3"); err == nil || err == ErrorNotFound {
+		t.Errorf("Expected a request error for an uncached device, got %v", err)
+	}
+}
+
+func TestCachingCatalogClientCopiesLists(t *testing.T) {
+	ts, storage := setupShard()
+	defer ts.Close()
+	client := NewCachingCatalogClient(NewRemoteCatalogClient(ts.URL+"/dc", nil), catalog.CacheConfig{})
+	d := federationTestDevice("dgw1/d1", "r1")
+	d.Resources[0].Meta = map[string]interface{}{"unit": "C"}
+	if err := storage.add(d); err != nil {
+		t.Fatalf("Unexpected error on add: %v", err)
+	}
+
+	// changes of returned list entries must not reach the cached ones
+	devices, _, err := client.GetDevices(1, 10)
+	if err != nil || len(devices) != 1 {
+		t.Fatalf("Unexpected devices: %v (%v)", devices, err)
+	}
+	devices[0].Meta["floor"] = "changed"
+	devices[0].Resources[0].Meta["unit"] = "changed"
+	devices, _, _ = client.GetDevices(1, 10)
+	if devices[0].Meta["floor"] != 1.0 || devices[0].Resources[0].Meta["unit"] != "C" {
+		t.Errorf("Expected the cached device to be unchanged, got %+v", devices[0])
+	}
+
+	resources, _, err := client.FindResources("name", "equals", "r1", 1, 10)
+	if err != nil || len(resources) != 1 {
+		t.Fatalf("Unexpected resources: %v (%v)", resources, err)
+	}
+	resources[0].Meta["unit"] = "changed"
+	resources, _, _ = client.FindResources("name", "equals", "r1", 1, 10)
+	if resources[0].Meta["unit"] != "C" {
+		t.Errorf("Expected the cached resource to be unchanged, got %+v", resources[0])
+	}
+}
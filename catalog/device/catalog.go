@@ -4,6 +4,8 @@ import (
 	"errors"
 	"strings"
 	"time"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
 )
 
 var ErrorNotFound = errors.New("NotFound")
@@ -47,8 +49,11 @@ type Protocol struct {
 func (self *Device) copy() Device {
 	var dc Device
 	dc = *self
+	dc.Meta = catalog.CopyMap(self.Meta)
 	res := make([]Resource, len(self.Resources))
-	copy(res, self.Resources)
+	for i, r := range self.Resources {
+		res[i] = r.copy()
+	}
 	dc.Resources = res
 	return dc
 }
@@ -60,7 +65,7 @@ func (d *Device) validate() bool {
 	}
 	// validate all resources
 	for _, r := range d.Resources {
-		if !r.validate() {
+		if !r.validate(d.Id) {
 			return false
 		}
 	}
@@ -71,15 +76,35 @@ func (d *Device) validate() bool {
 func (self *Resource) copy() Resource {
 	var rc Resource
 	rc = *self
+	rc.Meta = catalog.CopyMap(self.Meta)
+	rc.Representation = catalog.CopyMap(self.Representation)
 	proto := make([]Protocol, len(self.Protocols))
-	copy(proto, self.Protocols)
+	for i, p := range self.Protocols {
+		proto[i] = p.copy()
+	}
 	rc.Protocols = proto
 	return rc
 }
 
-// Validates the Resource configuration
-func (r *Resource) validate() bool {
-	if r.Id == "" || len(strings.Split(r.Id, "/")) != 3 || r.Name == "" {
+// Deep copy of the protocol
+func (self *Protocol) copy() Protocol {
+	pc := *self
+	pc.Endpoint = catalog.CopyMap(self.Endpoint)
+	if self.Methods != nil {
+		pc.Methods = make([]string, len(self.Methods))
+		copy(pc.Methods, self.Methods)
+	}
+	if self.ContentTypes != nil {
+		pc.ContentTypes = make([]string, len(self.ContentTypes))
+		copy(pc.ContentTypes, self.ContentTypes)
+	}
+	return pc
+}
+
+// Validates the Resource configuration of the device with the given id,
+// whose id must prefix the one of the resource
+func (r *Resource) validate(deviceId string) bool {
+	if r.Id == "" || len(strings.Split(r.Id, "/")) != 3 || r.Name == "" || !strings.HasPrefix(r.Id, deviceId+"/") {
 		return false
 	}
 	return true
@@ -97,8 +122,9 @@ type CatalogStorage interface {
 
 	// Utility functions
 	getMany(page, perPage int) ([]Device, int, error)
-	getDevicesCount() int
+	getDevices(page, perPage int) ([]Device, int, error)
 	getResourcesCount() int
+	countByPrefix(prefix string) (devices int, resources int)
 	getResourceById(id string) (Resource, error)
 	devicesFromResources(resources []Resource) []Device
 	cleanExpired(ts time.Time)
@@ -10,6 +10,7 @@ import (
 
 	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
 	"github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
 )
 
 const (
@@ -329,8 +330,16 @@ func (self WritableCatalogAPI) Add(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if !authorizeWrite(w, req, d.Id, d.Resources...) {
+		return
+	}
+
 	err = self.catalogStorage.add(d)
-	if err != nil {
+	if err == catalog.ErrorQuotaExceeded {
+		w.WriteHeader(catalog.StatusTooManyRequests)
+		fmt.Fprintf(w, "Error creating the registration: %s\n", err.Error())
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, "Error creating the registration: %s\n", err.Error())
 		return
@@ -357,11 +366,19 @@ func (self WritableCatalogAPI) Update(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	if !authorizeWrite(w, req, id, d.Resources...) {
+		return
+	}
+
 	err = self.catalogStorage.update(id, d)
 	if err == ErrorNotFound {
 		w.WriteHeader(http.StatusNotFound)
 		fmt.Fprintf(w, "Not found\n")
 		return
+	} else if err == catalog.ErrorQuotaExceeded {
+		w.WriteHeader(catalog.StatusTooManyRequests)
+		fmt.Fprintf(w, "Error updating the registration: %s\n", err.Error())
+		return
 	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, "Error updating the device: %s\n", err.Error())
@@ -377,6 +394,10 @@ func (self WritableCatalogAPI) Delete(w http.ResponseWriter, req *http.Request)
 	params := mux.Vars(req)
 	id := fmt.Sprintf("%v/%v", params["dgwid"], params["regid"])
 
+	if !authorizeWrite(w, req, id) {
+		return
+	}
+
 	err := self.catalogStorage.delete(id)
 	if err == ErrorNotFound {
 		w.WriteHeader(http.StatusNotFound)
@@ -392,3 +413,25 @@ func (self WritableCatalogAPI) Delete(w http.ResponseWriter, req *http.Request)
 	w.WriteHeader(http.StatusOK)
 	return
 }
+
+// Responds with 403 Forbidden if the principal of the request may not modify the entry
+// or one of the given resources, which must belong to it
+func authorizeWrite(w http.ResponseWriter, req *http.Request, id string, resources ...Resource) bool {
+	err := auth.AuthorizeWrite(req, id)
+	for _, r := range resources {
+		if err != nil {
+			break
+		}
+		if !strings.HasPrefix(r.Id, id+"/") {
+			err = fmt.Errorf("resource %s does not belong to %s", r.Id, id)
+			break
+		}
+		err = auth.AuthorizeWrite(req, r.Id)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "Not allowed to modify the registration: %s\n", err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/codegangsta/negroni"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+)
+
+func TestWriteForeignResources(t *testing.T) {
+	f, err := ioutil.TempFile("", "tokens")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("tokenA dgwA\ntokenB dgwB\n")
+	f.Close()
+
+	a, err := auth.NewAuthenticator(auth.Config{
+		Enabled:   true,
+		TokenFile: f.Name(),
+		ACL: []auth.ACLEntry{
+			{Principal: "dgwA", Prefixes: []string{"dgwA"}},
+			{Principal: "dgwB", Prefixes: []string{"dgwB"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	storage := NewMemoryStorage()
+	n := negroni.New(a)
+	n.UseHandler(NewHandler(storage, HandlerOptions{Location: "/dc", Writable: true}))
+	ts := httptest.NewServer(n)
+	defer ts.Close()
+
+	do := func(method, path, token string, d Device) int {
+		b, _ := json.Marshal(d)
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewReader(b))
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	victim := Device{Id: "dgwB/y", Name: "y", Ttl: 60, Resources: []Resource{{Id: "dgwB/y/r", Name: "r"}}}
+	if code := do("POST", "/dc/", "tokenB", victim); code != http.StatusCreated {
+		t.Fatalf("Expected 201 on add by the owner, got %v", code)
+	}
+
+	own := Device{Id: "dgwA/x", Name: "x", Ttl: 60, Resources: []Resource{{Id: "dgwA/x/r", Name: "r"}}}
+	if code := do("POST", "/dc/", "tokenA", own); code != http.StatusCreated {
+		t.Fatalf("Expected 201 on add by the owner, got %v", code)
+	}
+
+	// resources of B in a device of A
+	foreign := Device{Id: "dgwA/x", Name: "x", Ttl: 60, Resources: []Resource{{Id: "dgwB/y/r", Name: "hijacked"}}}
+	if code := do("PUT", "/dc/dgwA/x", "tokenA", foreign); code != http.StatusForbidden {
+		t.Errorf("Expected 403 on update with a foreign resource, got %v", code)
+	}
+	foreign.Id = "dgwA/z"
+	if code := do("POST", "/dc/", "tokenA", foreign); code != http.StatusForbidden {
+		t.Errorf("Expected 403 on add with a foreign resource, got %v", code)
+	}
+
+	r, err := storage.getResourceById("dgwB/y/r")
+	if err != nil || r.Name != "r" || r.Device != "dgwB/y" {
+		t.Errorf("Expected the resource of B to be unchanged, got %+v (%v)", r, err)
+	}
+	if _, err := storage.get("dgwA/z"); err != ErrorNotFound {
+		t.Errorf("Expected the device with a foreign resource not to be added, got %v", err)
+	}
+}
+
+func TestUpdateWithForeignResource(t *testing.T) {
+	storage := NewMemoryStorage()
+	storage.add(Device{Id: "dgwB/y", Name: "y", Ttl: 60, Resources: []Resource{{Id: "dgwB/y/r", Name: "r"}}})
+	storage.add(Device{Id: "dgwA/x", Name: "x", Ttl: 60})
+
+	err := storage.update("dgwA/x", Device{Name: "x", Ttl: 60, Resources: []Resource{{Id: "dgwB/y/r", Name: "hijacked"}}})
+	if err == nil {
+		t.Error("Expected the storage to reject a resource of another device")
+	}
+	if r, _ := storage.getResourceById("dgwB/y/r"); r.Name != "r" {
+		t.Errorf("Expected the resource of B to be unchanged, got %+v", r)
+	}
+}
@@ -0,0 +1,344 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+)
+
+const (
+	// Meta key of the source attribution of federated devices
+	FederationMetaKey = "federation"
+	// Max pages fetched from an upstream per refresh
+	federationMaxPages = 1000
+)
+
+var ErrorReadOnly = errors.New("Catalog is read-only")
+
+// Upstream catalog of a federation
+type FederationUpstream struct {
+	Name     string            `json:"name"`
+	Endpoint string            `json:"endpoint"`
+	Auth     *auth.Credentials `json:"auth"`
+}
+
+// Status of an upstream as of the last refresh
+type FederationUpstreamStatus struct {
+	FederationUpstream
+	Reachable   bool      `json:"reachable"`
+	Devices     int       `json:"devices"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastRefresh time.Time `json:"lastRefresh"`
+}
+
+// Read-only storage aggregating several upstream catalogs.
+// Upstreams are fetched periodically into a merged snapshot which serves all reads.
+// Devices of an unreachable upstream are served from the last successful
+// refresh until they expire.
+type FederatedStorage struct {
+	snapshot *MemoryStorage
+	// last known devices and status by upstream endpoint
+	devices  map[string][]Device
+	status   map[string]*FederationUpstreamStatus
+	upstream []FederationUpstream
+	timeout  time.Duration
+	mutex    sync.RWMutex
+	// serializes refreshes
+	refreshMutex sync.Mutex
+}
+
+// Creates a federated storage and starts refreshing the snapshot every interval.
+// timeout bounds fetching of each upstream
+func NewFederatedStorage(upstreams []FederationUpstream, interval, timeout time.Duration) *FederatedStorage {
+	storage := &FederatedStorage{
+		snapshot: newSnapshotStorage(),
+		devices:  make(map[string][]Device),
+		status:   make(map[string]*FederationUpstreamStatus),
+		upstream: upstreams,
+		timeout:  timeout,
+	}
+
+	storage.Refresh()
+	t := time.Tick(interval)
+	go func() {
+		for _ = range t {
+			storage.Refresh()
+		}
+	}()
+	return storage
+}
+
+// In-memory storage without the expiry cleaner (snapshots are replaced as a whole)
+func newSnapshotStorage() *MemoryStorage {
+	return &MemoryStorage{
+		devices:   make(map[string]StoredDevice),
+		resources: make(map[string]Resource),
+		index:     []string{},
+	}
+}
+
+// Replaces the upstreams (e.g. after DNS-SD discovery). Applied on the next refresh
+func (self *FederatedStorage) SetUpstreams(upstreams []FederationUpstream) {
+	self.mutex.Lock()
+	self.upstream = upstreams
+	self.mutex.Unlock()
+}
+
+// Returns the status of the upstreams
+func (self *FederatedStorage) Status() []FederationUpstreamStatus {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	status := make([]FederationUpstreamStatus, 0, len(self.upstream))
+	for _, u := range self.upstream {
+		if s, ok := self.status[u.Endpoint]; ok {
+			status = append(status, *s)
+		} else {
+			status = append(status, FederationUpstreamStatus{FederationUpstream: u})
+		}
+	}
+	return status
+}
+
+type federationResult struct {
+	upstream FederationUpstream
+	devices  []Device
+	err      error
+}
+
+// Fetches all upstreams and rebuilds the snapshot
+func (self *FederatedStorage) Refresh() {
+	self.refreshMutex.Lock()
+	defer self.refreshMutex.Unlock()
+
+	self.mutex.RLock()
+	upstreams := make([]FederationUpstream, len(self.upstream))
+	copy(upstreams, self.upstream)
+	self.mutex.RUnlock()
+
+	// fetch concurrently, upstreams not responding within the timeout are skipped
+	// and their requests cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), self.timeout)
+	defer cancel()
+	results := make(chan federationResult, len(upstreams))
+	for _, u := range upstreams {
+		go func(u FederationUpstream) {
+			client, err := NewRemoteCatalogClientWithOptions(u.Endpoint, catalog.ClientOptions{Credentials: u.Auth, Timeout: self.timeout})
+			if err != nil {
+				results <- federationResult{u, nil, err}
+				return
+			}
+			devices, err := collectDevices(func(page, perPage int) ([]Device, int, error) {
+				return client.GetDevicesContext(ctx, page, perPage)
+			})
+			results <- federationResult{u, devices, err}
+		}(u)
+	}
+	fetched := make(map[string]federationResult, len(upstreams))
+collect:
+	for i := 0; i < len(upstreams); i++ {
+		select {
+		case r := <-results:
+			fetched[r.upstream.Endpoint] = r
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	now := time.Now()
+	devices := make(map[string][]Device, len(upstreams))
+	status := make(map[string]*FederationUpstreamStatus, len(upstreams))
+	snapshot := newSnapshotStorage()
+
+	self.mutex.RLock()
+	for _, u := range upstreams {
+		s := &FederationUpstreamStatus{FederationUpstream: u, LastRefresh: now}
+		r, ok := fetched[u.Endpoint]
+		if ok && r.err == nil {
+			s.Reachable = true
+			devices[u.Endpoint] = r.devices
+		} else {
+			if !ok {
+				s.LastError = "timeout"
+			} else {
+				s.LastError = r.err.Error()
+			}
+			logger.Printf("FederatedStorage.Refresh() Upstream %s (%s) unreachable: %s", u.Name, u.Endpoint, s.LastError)
+			// serve the last known devices until they expire
+			for _, d := range self.devices[u.Endpoint] {
+				if d.Ttl < 0 || d.Expires.After(now) {
+					devices[u.Endpoint] = append(devices[u.Endpoint], d)
+				}
+			}
+		}
+
+		for _, d := range devices[u.Endpoint] {
+			if _, err := snapshot.get(d.Id); err == nil {
+				logger.Printf("FederatedStorage.Refresh() Device %s of %s is already provided by another upstream", d.Id, u.Name)
+				continue
+			}
+			s.Devices++
+			snapshot.addFederated(attributeSource(d, u))
+		}
+		status[u.Endpoint] = s
+	}
+	self.mutex.RUnlock()
+	snapshot.reindexResources()
+
+	self.mutex.Lock()
+	self.snapshot = snapshot
+	self.devices = devices
+	self.status = status
+	self.mutex.Unlock()
+}
+
+// Fetches all pages of devices from a catalog.
+// Devices are paginated by resources and merged across pages
+func fetchAllDevices(client CatalogClient) ([]Device, error) {
+	return collectDevices(client.GetDevices)
+}
+
+// Fetches all pages of a paginated device query and merges the devices across pages
+func collectDevices(fetch func(page, perPage int) ([]Device, int, error)) ([]Device, error) {
+	devices := []Device{}
+	index := make(map[string]int)
+	for page := 1; page <= federationMaxPages; page++ {
+		devs, _, err := fetch(page, MaxPerPage)
+		if err != nil {
+			return nil, err
+		}
+		if len(devs) == 0 {
+			break
+		}
+		for _, d := range devs {
+			i, ok := index[d.Id]
+			if !ok {
+				index[d.Id] = len(devices)
+				devices = append(devices, d)
+				continue
+			}
+			devices[i].Resources = append(devices[i].Resources, d.Resources...)
+		}
+	}
+	return devices, nil
+}
+
+// Copies the device with the upstream added to its meta
+func attributeSource(d Device, u FederationUpstream) Device {
+	meta := make(map[string]interface{}, len(d.Meta)+1)
+	for k, v := range d.Meta {
+		meta[k] = v
+	}
+	meta[FederationMetaKey] = map[string]interface{}{
+		"source":   u.Name,
+		"endpoint": u.Endpoint,
+	}
+	d.Meta = meta
+	return d
+}
+
+// Adds a device keeping the upstream timestamps. Resources have to be reindexed afterwards
+func (self *MemoryStorage) addFederated(d Device) {
+	self.mutex.Lock()
+	sd := StoredDevice{
+		&Device{
+			Id:          d.Id,
+			Type:        d.Type,
+			Name:        d.Name,
+			Meta:        d.Meta,
+			Description: d.Description,
+			Ttl:         d.Ttl,
+			Created:     d.Created,
+			Updated:     d.Updated,
+			Expires:     d.Expires,
+		},
+		[]string{},
+	}
+	for _, res := range d.Resources {
+		res.Device = sd.Id
+		sd.Resources = append(sd.Resources, res.Id)
+		self.resources[res.Id] = res
+	}
+	self.devices[sd.Id] = sd
+	self.mutex.Unlock()
+}
+
+func (self *FederatedStorage) current() *MemoryStorage {
+	self.mutex.RLock()
+	s := self.snapshot
+	self.mutex.RUnlock()
+	return s
+}
+
+// CRUD
+func (self *FederatedStorage) add(d Device) error {
+	return ErrorReadOnly
+}
+
+func (self *FederatedStorage) update(id string, d Device) error {
+	return ErrorReadOnly
+}
+
+func (self *FederatedStorage) delete(id string) error {
+	return ErrorReadOnly
+}
+
+func (self *FederatedStorage) get(id string) (Device, error) {
+	return self.current().get(id)
+}
+
+// Utility
+func (self *FederatedStorage) getMany(page, perPage int) ([]Device, int, error) {
+	return self.current().getMany(page, perPage)
+}
+
+func (self *FederatedStorage) getDevices(page, perPage int) ([]Device, int, error) {
+	return self.current().getDevices(page, perPage)
+}
+
+func (self *FederatedStorage) getDevicesCount() int {
+	return self.current().getDevicesCount()
+}
+
+func (self *FederatedStorage) getResourcesCount() int {
+	return self.current().getResourcesCount()
+}
+
+func (self *FederatedStorage) countByPrefix(prefix string) (int, int) {
+	return self.current().countByPrefix(prefix)
+}
+
+func (self *FederatedStorage) getResourceById(id string) (Resource, error) {
+	return self.current().getResourceById(id)
+}
+
+func (self *FederatedStorage) devicesFromResources(resources []Resource) []Device {
+	s := self.current()
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.devicesFromResources(resources)
+}
+
+// Expired devices of unreachable upstreams are dropped on refresh
+func (self *FederatedStorage) cleanExpired(ts time.Time) {}
+
+// Path filtering
+func (self *FederatedStorage) pathFilterDevice(path, op, value string) (Device, error) {
+	return self.current().pathFilterDevice(path, op, value)
+}
+
+func (self *FederatedStorage) pathFilterDevices(path, op, value string, page, perPage int) ([]Device, int, error) {
+	return self.current().pathFilterDevices(path, op, value, page, perPage)
+}
+
+func (self *FederatedStorage) pathFilterResource(path, op, value string) (Resource, error) {
+	return self.current().pathFilterResource(path, op, value)
+}
+
+func (self *FederatedStorage) pathFilterResources(path, op, value string, page, perPage int) ([]Resource, int, error) {
+	return self.current().pathFilterResources(path, op, value, page, perPage)
+}
@@ -0,0 +1,114 @@
+package device
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
+)
+
+func setupFederationUpstream(devices ...Device) *httptest.Server {
+	storage := NewMemoryStorage()
+	for _, d := range devices {
+		storage.add(d)
+	}
+	api := NewReadableCatalogAPI(storage, "/dc", "/static", "upstream")
+	r := mux.NewRouter().StrictSlash(true)
+	r.Methods("GET").Path("/dc").HandlerFunc(api.List)
+	return httptest.NewServer(r)
+}
+
+func federationTestDevice(id string, resources ...string) Device {
+	d := Device{Id: id, Name: id, Ttl: 60, Meta: map[string]interface{}{"floor": 1}}
+	for _, name := range resources {
+		d.Resources = append(d.Resources, Resource{Id: id + "/" + name, Name: name})
+	}
+	return d
+}
+
+func TestFederatedStorage(t *testing.T) {
+	ts1 := setupFederationUpstream(federationTestDevice("dgw1/d1", "r1", "r2"), federationTestDevice("dgw1/d2", "r1"))
+	defer ts1.Close()
+	ts2 := setupFederationUpstream(federationTestDevice("dgw2/d1", "r1"))
+	defer ts2.Close()
+
+	storage := NewFederatedStorage([]FederationUpstream{
+		{Name: "building-a", Endpoint: ts1.URL + "/dc"},
+		{Name: "building-b", Endpoint: ts2.URL + "/dc"},
+		{Name: "offline", Endpoint: "http://127.0.0.1:1/dc"},
+	}, time.Hour, 5*time.Second)
+
+	if n := storage.getDevicesCount(); n != 3 {
+		t.Fatalf("Expected 3 devices, got %v", n)
+	}
+	if n := storage.getResourcesCount(); n != 4 {
+		t.Fatalf("Expected 4 resources, got %v", n)
+	}
+
+	d, err := storage.get("dgw2/d1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	source, _ := d.Meta[FederationMetaKey].(map[string]interface{})
+	if source["source"] != "building-b" || d.Meta["floor"] == nil {
+		t.Errorf("Unexpected meta of a federated device: %v", d.Meta)
+	}
+
+	// merged paging over both upstreams
+	devs, total, _ := storage.getMany(2, 2)
+	if total != 4 || len(devs) != 2 {
+		t.Errorf("Expected 2 devices on page 2 of 4 resources, got %v of %v", len(devs), total)
+	}
+
+	devs, _, _ = storage.pathFilterDevices("meta.federation.source", "equals", "building-a", 1, 10)
+	if len(devs) != 2 {
+		t.Errorf("Expected 2 devices from building-a, got %v", len(devs))
+	}
+
+	for _, s := range storage.Status() {
+		if s.Reachable == (s.Name == "offline") {
+			t.Errorf("Unexpected status of %s: %+v", s.Name, s)
+		}
+	}
+
+	if err := storage.add(federationTestDevice("dgw3/d1")); err != ErrorReadOnly {
+		t.Errorf("Expected read-only storage, got %v", err)
+	}
+
+	// devices of an upstream which became unreachable are kept until expiry
+	ts2.Close()
+	storage.Refresh()
+	if _, err := storage.get("dgw2/d1"); err != nil {
+		t.Errorf("Expected last known device to be served, got %v", err)
+	}
+}
+
+func TestFederatedStorageTimeout(t *testing.T) {
+	cancelled := make(chan bool, 1)
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+		cancelled <- true
+	}))
+	defer hanging.Close()
+	ts := setupFederationUpstream(federationTestDevice("dgw1/d1", "r1"))
+	defer ts.Close()
+
+	start := time.Now()
+	storage := NewFederatedStorage([]FederationUpstream{
+		{Name: "hanging", Endpoint: hanging.URL + "/dc"},
+		{Name: "building-a", Endpoint: ts.URL + "/dc"},
+	}, time.Hour, 200*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the refresh to stop at the timeout, took %v", elapsed)
+	}
+	if n := storage.getDevicesCount(); n != 1 {
+		t.Errorf("Expected the device of the responding upstream, got %v devices", n)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the request to the hanging upstream to be cancelled")
+	}
+}
@@ -0,0 +1,69 @@
+package device
+
+import (
+	"net/http"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+// Options of a catalog API handler
+type HandlerOptions struct {
+	// Location (path) of the API, e.g. /dc
+	Location string
+	// Location of the static files with the JSON-LD context (catalog.StaticLocation by default)
+	StaticLocation string
+	// Description of the catalog in the collection
+	Description string
+	// Devices may be added, updated and deleted through the API
+	Writable bool
+	// Serve the OpenAPI description of the catalog at catalog.OpenAPILocation
+	OpenAPI bool
+	// Prefix of the route names, e.g. dc for dc-list, to mount several catalogs on a router
+	Name string
+}
+
+// Returns the name of the route prefixed by the one of the handler
+func (self *HandlerOptions) routeName(name string) string {
+	if self.Name == "" {
+		return name
+	}
+	return self.Name + "-" + name
+}
+
+// Returns an http.Handler serving the catalog API over the storage
+func NewHandler(storage CatalogStorage, opts HandlerOptions) http.Handler {
+	r := mux.NewRouter().StrictSlash(true)
+	Mount(r, storage, opts)
+	return r
+}
+
+// Mounts the routes of the catalog API over the storage on a router
+func Mount(r *mux.Router, storage CatalogStorage, opts HandlerOptions) {
+	if opts.StaticLocation == "" {
+		opts.StaticLocation = catalog.StaticLocation
+	}
+	writable := NewWritableCatalogAPI(storage, opts.Location, opts.StaticLocation, opts.Description)
+	api := writable.ReadableCatalogAPI
+
+	r.Methods("GET").Path(opts.Location).HandlerFunc(api.List).Name(opts.routeName("list"))
+	r.Methods("GET").Path(opts.Location + "/{type}/{path}/{op}/{value}").HandlerFunc(api.Filter).Name(opts.routeName("filter"))
+	r.Methods("GET").Path(opts.Location + TDPath).HandlerFunc(api.ListThingDescriptions).Name(opts.routeName("td-list"))
+
+	url := opts.Location + "/{dgwid}/{regid}"
+	r.Methods("GET").Path(url).HandlerFunc(api.Get).Name(opts.routeName("get"))
+	// must be mounted before details to take precedence over a resource named "td"
+	r.Methods("GET").Path(url + TDPath).HandlerFunc(api.GetThingDescription).Name(opts.routeName("td"))
+	r.Methods("GET").Path(url + "/{resname}").HandlerFunc(api.GetResource).Name(opts.routeName("details"))
+
+	if opts.Writable {
+		r.Methods("POST").Path(opts.Location + "/").HandlerFunc(writable.Add).Name(opts.routeName("add"))
+		r.Methods("PUT").Path(url).HandlerFunc(writable.Update).Name(opts.routeName("update"))
+		r.Methods("DELETE").Path(url).HandlerFunc(writable.Delete).Name(opts.routeName("delete"))
+	}
+
+	if opts.OpenAPI {
+		doc := NewOpenAPIDocument(opts.Location, opts.Description, opts.Writable)
+		r.Methods("GET").Path(catalog.OpenAPILocation).HandlerFunc(catalog.NewOpenAPIHandler(doc)).Name(opts.routeName("openapi"))
+	}
+}
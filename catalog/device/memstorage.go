@@ -62,7 +62,15 @@ func (self *MemoryStorage) add(d Device) error {
 	return nil
 }
 
+// Replaces the device with the given one: its meta is replaced as a whole and
+// the resources which are not part of the given device are removed
 func (self *MemoryStorage) update(id string, d Device) error {
+	for _, res := range d.Resources {
+		if !res.validate(id) {
+			return errors.New("Invalid Device registration")
+		}
+	}
+
 	self.mutex.Lock()
 
 	sd, ok := self.devices[id]
@@ -73,6 +81,7 @@ func (self *MemoryStorage) update(id string, d Device) error {
 
 	sd.Type = d.Type
 	sd.Name = d.Name
+	sd.Meta = d.Meta
 	sd.Description = d.Description
 	sd.Ttl = d.Ttl
 	sd.Updated = time.Now()
@@ -80,6 +89,10 @@ func (self *MemoryStorage) update(id string, d Device) error {
 		sd.Expires = sd.Updated.Add(time.Duration(sd.Ttl) * time.Second)
 	}
 
+	// drop resources which are no longer part of the device
+	for _, rid := range sd.Resources {
+		delete(self.resources, rid)
+	}
 	sd.Resources = nil
 	for _, res := range d.Resources {
 		res.Device = sd.Id
@@ -163,6 +176,32 @@ func (self *MemoryStorage) getMany(page int, perPage int) ([]Device, int, error)
 	return devs, total, nil
 }
 
+// Returns a page of the devices sorted by id (including the devices without
+// resources) and the total number of devices
+func (self *MemoryStorage) getDevices(page int, perPage int) ([]Device, int, error) {
+	self.mutex.RLock()
+	ids := make([]string, 0, len(self.devices))
+	for id := range self.devices {
+		ids = append(ids, id)
+	}
+	self.mutex.RUnlock()
+	sort.Strings(ids)
+
+	keys := catalog.GetPageOfSlice(ids, page, perPage, MaxPerPage)
+	devs := make([]Device, 0, len(keys))
+	for _, id := range keys {
+		d, err := self.get(id)
+		if err == ErrorNotFound {
+			// deleted meanwhile
+			continue
+		} else if err != nil {
+			return nil, 0, err
+		}
+		devs = append(devs, d)
+	}
+	return devs, len(ids), nil
+}
+
 func (self *MemoryStorage) getDevicesCount() int {
 	self.mutex.RLock()
 	l := len(self.devices)
@@ -281,7 +320,8 @@ func (self *MemoryStorage) pathFilterDevices(path, op, value string, page, perPa
 		}
 	}
 
-	// get the slice of resources as indicated by page
+	// get the slice of resources as indicated by page (in a stable order)
+	sort.Strings(resourceIds)
 	pageResourceIds := catalog.GetPageOfSlice(resourceIds, page, perPage, MaxPerPage)
 	ress := make([]Resource, 0, len(pageResourceIds))
 	for _, i := range pageResourceIds {
@@ -333,6 +373,7 @@ func (self *MemoryStorage) pathFilterResources(path, op, value string, page, per
 		}
 	}
 
+	sort.Strings(resourceIds)
 	pageResourceIds := catalog.GetPageOfSlice(resourceIds, page, perPage, MaxPerPage)
 	ress := make([]Resource, 0, len(pageResourceIds))
 	for _, id := range pageResourceIds {
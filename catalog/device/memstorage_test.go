@@ -148,3 +148,68 @@ func TestGetManyDevices(t *testing.T) {
 		t.Errorf("Wrong number of entries: requested page=4 , perPage=3. Expected: 2, returned: %v", len(p4pp3))
 	}
 }
+
+func TestUpdateDeviceReplacesMetaAndResources(t *testing.T) {
+	d := Device{
+		Id:   "gw1/dev1",
+		Name: "dev1",
+		Meta: map[string]interface{}{"a": "1", "b": "2"},
+		Ttl:  30,
+		Resources: []Resource{
+			{Id: "gw1/dev1/r1", Name: "r1"},
+			{Id: "gw1/dev1/r2", Name: "r2"},
+		},
+	}
+	storage := NewMemoryStorage()
+	if err := storage.add(d); err != nil {
+		t.Fatalf("Unexpected error on add: %v", err)
+	}
+
+	d.Meta = map[string]interface{}{"b": "3"}
+	d.Resources = []Resource{{Id: "gw1/dev1/r2", Name: "r2"}}
+	if err := storage.update(d.Id, d); err != nil {
+		t.Fatalf("Unexpected error on update: %v", err)
+	}
+
+	updated, err := storage.get(d.Id)
+	if err != nil {
+		t.Fatalf("Unexpected error on get: %v", err)
+	}
+	if len(updated.Meta) != 1 || updated.Meta["b"] != "3" {
+		t.Errorf("Expected the meta to be replaced, got %v", updated.Meta)
+	}
+	if len(updated.Resources) != 1 || updated.Resources[0].Id != "gw1/dev1/r2" {
+		t.Errorf("Expected only the resource r2, got %v", updated.Resources)
+	}
+	if _, err := storage.getResourceById("gw1/dev1/r1"); err != ErrorNotFound {
+		t.Errorf("Expected the removed resource to be deleted, got %v", err)
+	}
+	if n := storage.getResourcesCount(); n != 1 {
+		t.Errorf("Expected 1 resource, got %v", n)
+	}
+}
+
+func TestGetDevicesPagesByDevice(t *testing.T) {
+	storage := NewMemoryStorage()
+	storage.add(Device{Id: "gw1/a", Name: "a", Ttl: 30, Resources: []Resource{
+		{Id: "gw1/a/r1", Name: "r1"}, {Id: "gw1/a/r2", Name: "r2"}, {Id: "gw1/a/r3", Name: "r3"},
+	}})
+	// no resources
+	storage.add(Device{Id: "gw1/b", Name: "b", Ttl: 30})
+	storage.add(Device{Id: "gw1/c", Name: "c", Ttl: 30, Resources: []Resource{{Id: "gw1/c/r1", Name: "r1"}}})
+
+	p1, total, err := storage.getDevices(1, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if total != 3 {
+		t.Errorf("Expected total is 3, returned: %v", total)
+	}
+	if len(p1) != 2 || p1[0].Id != "gw1/a" || len(p1[0].Resources) != 3 || p1[1].Id != "gw1/b" {
+		t.Errorf("Unexpected first page: %v", p1)
+	}
+	p2, _, _ := storage.getDevices(2, 2)
+	if len(p2) != 1 || p2[0].Id != "gw1/c" {
+		t.Errorf("Unexpected second page: %v", p2)
+	}
+}
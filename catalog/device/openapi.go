@@ -0,0 +1,210 @@
+package device
+
+import (
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+const (
+	apiMediaType = "application/ld+json"
+)
+
+// OpenAPI schemas of the device catalog entities
+func openAPISchemas() map[string]catalog.OpenAPISchema {
+	object := catalog.OpenAPISchema{"type": "object"}
+	str := catalog.OpenAPISchema{"type": "string"}
+	strs := catalog.OpenAPISchema{"type": "array", "items": str}
+	ts := catalog.OpenAPISchema{"type": "string", "format": "date-time", "readOnly": true}
+
+	return map[string]catalog.OpenAPISchema{
+		"Protocol": {
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type":          str,
+				"endpoint":      object,
+				"methods":       strs,
+				"content-types": strs,
+			},
+		},
+		"Resource": {
+			"type":     "object",
+			"required": []string{"id", "name"},
+			"properties": map[string]interface{}{
+				"id":             catalog.OpenAPISchema{"type": "string", "description": "{dgwid}/{regid}/{resname}"},
+				"type":           str,
+				"name":           str,
+				"meta":           object,
+				"protocols":      catalog.OpenAPISchema{"type": "array", "items": catalog.OpenAPISchemaRef("Protocol")},
+				"representation": object,
+				"device":         str,
+			},
+		},
+		"Device": {
+			"type":     "object",
+			"required": []string{"id", "name", "ttl"},
+			"properties": map[string]interface{}{
+				"id":          catalog.OpenAPISchema{"type": "string", "description": "{dgwid}/{regid}"},
+				"type":        str,
+				"name":        str,
+				"meta":        object,
+				"description": str,
+				"ttl":         catalog.OpenAPISchema{"type": "integer"},
+				"created":     ts,
+				"updated":     ts,
+				"expires":     ts,
+				"resources":   catalog.OpenAPISchema{"type": "array", "items": catalog.OpenAPISchemaRef("Resource")},
+			},
+		},
+		"PaginatedDevice": {
+			"allOf": []interface{}{
+				catalog.OpenAPISchemaRef("Device"),
+				catalog.OpenAPISchema{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"page":     catalog.OpenAPISchema{"type": "integer"},
+						"per_page": catalog.OpenAPISchema{"type": "integer"},
+						"total":    catalog.OpenAPISchema{"type": "integer"},
+					},
+				},
+			},
+		},
+		"Collection": {
+			"type": "object",
+			"properties": map[string]interface{}{
+				"@context":    str,
+				"id":          str,
+				"type":        str,
+				"description": str,
+				"devices":     catalog.OpenAPISchema{"type": "object", "additionalProperties": catalog.OpenAPISchemaRef("Device")},
+				"resources":   catalog.OpenAPISchema{"type": "array", "items": catalog.OpenAPISchemaRef("Resource")},
+				"page":        catalog.OpenAPISchema{"type": "integer"},
+				"per_page":    catalog.OpenAPISchema{"type": "integer"},
+				"total":       catalog.OpenAPISchema{"type": "integer"},
+			},
+		},
+		"ThingDescription": {
+			"type":        "object",
+			"description": "W3C WoT Thing Description",
+		},
+	}
+}
+
+// Creates an OpenAPI document of the catalog api mounted at apiLocation.
+// Write operations are only included for a writable catalog
+func NewOpenAPIDocument(apiLocation, description string, writable bool) *catalog.OpenAPIDocument {
+	doc := catalog.NewOpenAPIDocument("Device Catalog", description, ApiVersion)
+	for name, schema := range openAPISchemas() {
+		doc.AddSchema(name, schema)
+	}
+
+	paging := catalog.OpenAPIPagingParameters(GetParamPage, GetParamPerPage, MaxPerPage)
+	notFound := catalog.OpenAPITextResponse("Not found")
+	devicePath := apiLocation + "/{dgwid}/{regid}"
+	deviceParams := []catalog.OpenAPIParameter{
+		catalog.OpenAPIPathParameter("dgwid", "Device gateway id"),
+		catalog.OpenAPIPathParameter("regid", "Registration id"),
+	}
+
+	doc.AddOperation(apiLocation, "GET", &catalog.OpenAPIOperation{
+		OperationId: "list",
+		Summary:     "Lists devices and their resources",
+		Parameters:  paging,
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPIContentResponse("Catalog collection", catalog.OpenAPISchemaRef("Collection"), apiMediaType),
+		},
+	})
+	doc.AddOperation(apiLocation+"/{type}/{path}/{op}/{value}", "GET", &catalog.OpenAPIOperation{
+		OperationId: "filter",
+		Summary:     "Filters devices or resources by a path in the entries",
+		Parameters:  append(catalog.OpenAPIFilterParameters([]string{FTypeDevice, FTypeDevices, FTypeResource, FTypeResources}), paging...),
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPIContentResponse("Matched entries", catalog.OpenAPISchema{
+				"oneOf": []interface{}{
+					catalog.OpenAPISchemaRef("PaginatedDevice"),
+					catalog.OpenAPISchemaRef("Resource"),
+					catalog.OpenAPISchemaRef("Collection"),
+				},
+			}, apiMediaType),
+			"400": catalog.OpenAPITextResponse("Invalid filter"),
+			"404": catalog.OpenAPITextResponse("No matched entries found"),
+		},
+	})
+	doc.AddOperation(devicePath, "GET", &catalog.OpenAPIOperation{
+		OperationId: "get",
+		Summary:     "Retrieves a device with paginated resources",
+		Parameters:  append(deviceParams, paging...),
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPIContentResponse("Device", catalog.OpenAPISchemaRef("PaginatedDevice"), apiMediaType),
+			"404": notFound,
+		},
+	})
+	doc.AddOperation(devicePath+"/{resname}", "GET", &catalog.OpenAPIOperation{
+		OperationId: "details",
+		Summary:     "Retrieves a resource of a device",
+		Parameters:  append(deviceParams, catalog.OpenAPIPathParameter("resname", "Resource name")),
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPIContentResponse("Resource", catalog.OpenAPISchemaRef("Resource"), apiMediaType),
+			"404": notFound,
+		},
+	})
+	doc.AddOperation(apiLocation+TDPath, "GET", &catalog.OpenAPIOperation{
+		OperationId: "td-list",
+		Summary:     "Lists Thing Descriptions of the devices",
+		Parameters:  paging,
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPIContentResponse("Thing Descriptions",
+				catalog.OpenAPISchema{"type": "array", "items": catalog.OpenAPISchemaRef("ThingDescription")}, "application/json"),
+		},
+	})
+	doc.AddOperation(devicePath+TDPath, "GET", &catalog.OpenAPIOperation{
+		OperationId: "td",
+		Summary:     "Retrieves the Thing Description of a device",
+		Parameters:  deviceParams,
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPIContentResponse("Thing Description", catalog.OpenAPISchemaRef("ThingDescription"), TDMediaType),
+			"404": notFound,
+		},
+	})
+
+	if !writable {
+		return doc
+	}
+
+	body := &catalog.OpenAPIRequestBody{
+		Required: true,
+		Content: map[string]catalog.OpenAPIMediaItem{
+			apiMediaType:       {Schema: catalog.OpenAPISchemaRef("Device")},
+			"application/json": {Schema: catalog.OpenAPISchemaRef("Device")},
+		},
+	}
+	doc.AddOperation(apiLocation+"/", "POST", &catalog.OpenAPIOperation{
+		OperationId: "add",
+		Summary:     "Creates a device registration",
+		RequestBody: body,
+		Responses: map[string]catalog.OpenAPIResponse{
+			"201": catalog.OpenAPITextResponse("Created. The Location header contains the registration URL"),
+			"400": catalog.OpenAPITextResponse("Invalid request body"),
+			"500": catalog.OpenAPITextResponse("Invalid registration"),
+		},
+	})
+	doc.AddOperation(devicePath, "PUT", &catalog.OpenAPIOperation{
+		OperationId: "update",
+		Summary:     "Updates a device registration",
+		Parameters:  deviceParams,
+		RequestBody: body,
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPITextResponse("Updated"),
+			"400": catalog.OpenAPITextResponse("Invalid request body"),
+			"404": notFound,
+		},
+	})
+	doc.AddOperation(devicePath, "DELETE", &catalog.OpenAPIOperation{
+		OperationId: "delete",
+		Summary:     "Deletes a device registration",
+		Parameters:  deviceParams,
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPITextResponse("Deleted"),
+			"404": notFound,
+		},
+	})
+	return doc
+}
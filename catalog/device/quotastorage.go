@@ -0,0 +1,76 @@
+package device
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+// Storage enforcing per-owner quotas on devices and resources.
+// Owner of a device is its gateway id (see catalog.EntryOwner)
+type QuotaStorage struct {
+	CatalogStorage
+	quota catalog.QuotaConfig
+	// serializes quota checks with writes
+	mutex sync.Mutex
+}
+
+func NewQuotaStorage(storage CatalogStorage, quota catalog.QuotaConfig) *QuotaStorage {
+	return &QuotaStorage{
+		CatalogStorage: storage,
+		quota:          quota,
+	}
+}
+
+func (self *QuotaStorage) add(d Device) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	devices, resources := self.countByPrefix(catalog.EntryOwner(d.Id) + "/")
+	devices++
+	resources += len(d.Resources)
+	// a re-added device replaces the stored one
+	if stored, err := self.CatalogStorage.get(d.Id); err == nil {
+		devices--
+		resources -= len(stored.Resources)
+	}
+	if self.exceeded(devices, resources) {
+		return catalog.ErrorQuotaExceeded
+	}
+	return self.CatalogStorage.add(d)
+}
+
+func (self *QuotaStorage) update(id string, d Device) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	stored, err := self.CatalogStorage.get(id)
+	if err != nil {
+		return err
+	}
+	devices, resources := self.countByPrefix(catalog.EntryOwner(id) + "/")
+	if self.exceeded(devices, resources-len(stored.Resources)+len(d.Resources)) {
+		return catalog.ErrorQuotaExceeded
+	}
+	return self.CatalogStorage.update(id, d)
+}
+
+func (self *QuotaStorage) exceeded(devices, resources int) bool {
+	return (self.quota.MaxDevices > 0 && devices > self.quota.MaxDevices) ||
+		(self.quota.MaxResources > 0 && resources > self.quota.MaxResources)
+}
+
+// Returns the number of devices and resources with ids starting with prefix
+func (self *MemoryStorage) countByPrefix(prefix string) (int, int) {
+	self.mutex.RLock()
+	devices, resources := 0, 0
+	for id, sd := range self.devices {
+		if strings.HasPrefix(id, prefix) {
+			devices++
+			resources += len(sd.Resources)
+		}
+	}
+	self.mutex.RUnlock()
+	return devices, resources
+}
@@ -0,0 +1,43 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+func quotaTestDevice(id string, resources ...string) Device {
+	d := Device{Id: id, Name: id, Ttl: 30}
+	for _, name := range resources {
+		d.Resources = append(d.Resources, Resource{Id: id + "/" + name, Name: name})
+	}
+	return d
+}
+
+func TestQuotaStorage(t *testing.T) {
+	storage := NewQuotaStorage(NewMemoryStorage(), catalog.QuotaConfig{MaxDevices: 2, MaxResources: 3})
+
+	if err := storage.add(quotaTestDevice("dgw1/d1", "r1", "r2")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := storage.add(quotaTestDevice("dgw1/d2", "r1", "r2")); err != catalog.ErrorQuotaExceeded {
+		t.Errorf("Expected resources quota to be exceeded, got %v", err)
+	}
+	if err := storage.add(quotaTestDevice("dgw1/d2", "r1")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := storage.add(quotaTestDevice("dgw1/d3")); err != catalog.ErrorQuotaExceeded {
+		t.Errorf("Expected devices quota to be exceeded, got %v", err)
+	}
+	// quotas are per gateway
+	if err := storage.add(quotaTestDevice("dgw2/d1", "r1", "r2", "r3")); err != nil {
+		t.Errorf("Unexpected error for another gateway: %v", err)
+	}
+	// replacing resources of a device counts only the difference
+	if err := storage.update("dgw1/d1", quotaTestDevice("dgw1/d1", "r1")); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := storage.update("dgw1/d2", quotaTestDevice("dgw1/d2", "r1", "r2", "r3")); err != catalog.ErrorQuotaExceeded {
+		t.Errorf("Expected resources quota to be exceeded on update, got %v", err)
+	}
+}
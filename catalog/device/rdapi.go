@@ -0,0 +1,528 @@
+package device
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+// CoRE Resource Directory (RFC 9176) constants
+const (
+	RDWellKnownLocation  = "/.well-known/core"
+	RDLocation           = "/rd"
+	RDLookupLocation     = "/rd-lookup"
+	RDDefaultSector      = "rd"
+	RDDefaultLifetime    = 90000
+	RDProtocolType       = "CoAP"
+	RDMetaKey            = "rd"
+	RDResourceHrefKey    = "href"
+	RDParamEndpoint      = "ep"
+	RDParamSector        = "d"
+	RDParamLifetime      = "lt"
+	RDParamBase          = "base"
+	RDParamEndpointType  = "et"
+	RDParamPage          = "page"
+	RDParamCount         = "count"
+	LinkFormatMediaType  = "application/link-format"
+	rdDefaultCoapPort    = "5683"
+	rdLookupTypeEndpoint = "ep"
+	rdLookupTypeResource = "res"
+)
+
+// CoAP Content-Format registry entries commonly used by constrained devices
+var coapContentFormats = map[string]string{
+	"0":     "text/plain;charset=utf-8",
+	"40":    LinkFormatMediaType,
+	"41":    "application/xml",
+	"42":    "application/octet-stream",
+	"47":    "application/exi",
+	"50":    "application/json",
+	"60":    "application/cbor",
+	"110":   "application/senml+json",
+	"112":   "application/senml+cbor",
+	"11542": "application/vnd.oma.lwm2m+tlv",
+	"11543": "application/vnd.oma.lwm2m+json",
+}
+
+// CoRE Resource Directory api. Translates CoRE Link Format registrations
+// into Devices and their Resources
+type ResourceDirectoryAPI struct {
+	// Only the lookup interface is served (e.g. over a federation)
+	ReadOnly bool
+
+	catalogStorage CatalogStorage
+	defaultSector  string
+}
+
+func NewResourceDirectoryAPI(storage CatalogStorage, defaultSector string) *ResourceDirectoryAPI {
+	if defaultSector == "" {
+		defaultSector = RDDefaultSector
+	}
+	return &ResourceDirectoryAPI{
+		catalogStorage: storage,
+		defaultSector:  defaultSector,
+	}
+}
+
+// Serves /.well-known/core with the RD interfaces
+func (self ResourceDirectoryAPI) WellKnownCore(w http.ResponseWriter, req *http.Request) {
+	links := []catalog.Link{
+		{Target: RDLookupLocation + "/" + rdLookupTypeEndpoint, Params: map[string]string{"rt": "core.rd-lookup-ep", "ct": "40"}},
+		{Target: RDLookupLocation + "/" + rdLookupTypeResource, Params: map[string]string{"rt": "core.rd-lookup-res", "ct": "40"}},
+	}
+	if !self.ReadOnly {
+		links = append([]catalog.Link{{Target: RDLocation, Params: map[string]string{"rt": "core.rd", "ct": "40"}}}, links...)
+	}
+
+	req.ParseForm()
+	filtered := make([]catalog.Link, 0, len(links))
+	for _, l := range links {
+		if linkMatchesQuery(l, req.Form) {
+			filtered = append(filtered, l)
+		}
+	}
+	self.writeLinks(w, filtered)
+}
+
+// Registration interface: POST /rd?ep=...
+func (self ResourceDirectoryAPI) Register(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error processing the request: %s\n", err.Error())
+		return
+	}
+
+	req.ParseForm()
+	ep := req.Form.Get(RDParamEndpoint)
+	sector := req.Form.Get(RDParamSector)
+	if sector == "" {
+		sector = self.defaultSector
+	}
+	if ep == "" || strings.Contains(ep, "/") || strings.Contains(sector, "/") {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid endpoint name or sector\n")
+		return
+	}
+
+	lt := RDDefaultLifetime
+	if v := req.Form.Get(RDParamLifetime); v != "" {
+		lt, err = strconv.Atoi(v)
+		if err != nil || lt <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid lifetime: %s\n", v)
+			return
+		}
+	}
+
+	base := req.Form.Get(RDParamBase)
+	if base == "" {
+		base = rdBaseFromRemoteAddr(req.RemoteAddr)
+	}
+
+	links, err := catalog.ParseLinkFormat(string(body))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error parsing link-format payload: %s\n", err.Error())
+		return
+	}
+
+	d := Device{
+		Id:   sector + "/" + ep,
+		Type: ApiDeviceType,
+		Name: ep,
+		Meta: map[string]interface{}{
+			RDMetaKey: map[string]interface{}{
+				RDParamEndpoint:     ep,
+				RDParamSector:       sector,
+				RDParamBase:         base,
+				RDParamEndpointType: req.Form.Get(RDParamEndpointType),
+			},
+		},
+		Ttl:       lt,
+		Resources: rdResourcesFromLinks(sector+"/"+ep, base, links),
+	}
+
+	if !authorizeWrite(w, req, d.Id, d.Resources...) {
+		return
+	}
+
+	// re-registration of the same endpoint replaces the previous one
+	_, err = self.catalogStorage.get(d.Id)
+	if err == ErrorNotFound {
+		err = self.catalogStorage.add(d)
+	} else if err == nil {
+		err = self.catalogStorage.update(d.Id, d)
+	}
+	if err == catalog.ErrorQuotaExceeded {
+		w.WriteHeader(catalog.StatusTooManyRequests)
+		fmt.Fprintf(w, "Error creating the registration: %s\n", err.Error())
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error creating the registration: %s\n", err.Error())
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", RDLocation, d.Id))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Registration resource: GET /rd/{dgwid}/{regid} returns registered links
+func (self ResourceDirectoryAPI) Get(w http.ResponseWriter, req *http.Request) {
+	d, ok := self.getRegistration(w, req)
+	if !ok {
+		return
+	}
+
+	links := make([]catalog.Link, 0, len(d.Resources))
+	for _, r := range d.Resources {
+		l := rdLinkFromResource(r, "")
+		links = append(links, l)
+	}
+	self.writeLinks(w, links)
+}
+
+// Registration update: POST /rd/{dgwid}/{regid}?lt=...&base=...
+func (self ResourceDirectoryAPI) Update(w http.ResponseWriter, req *http.Request) {
+	d, ok := self.getRegistration(w, req)
+	if !ok || !authorizeWrite(w, req, d.Id) {
+		return
+	}
+
+	req.ParseForm()
+	if v := req.Form.Get(RDParamLifetime); v != "" {
+		lt, err := strconv.Atoi(v)
+		if err != nil || lt <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid lifetime: %s\n", v)
+			return
+		}
+		d.Ttl = lt
+	}
+	if base := req.Form.Get(RDParamBase); base != "" {
+		// stored maps are shared, build new ones
+		meta := map[string]interface{}{}
+		for k, v := range rdMeta(d) {
+			meta[k] = v
+		}
+		meta[RDParamBase] = base
+		dmeta := map[string]interface{}{RDMetaKey: meta}
+		for k, v := range d.Meta {
+			if k != RDMetaKey {
+				dmeta[k] = v
+			}
+		}
+		d.Meta = dmeta
+
+		for i, r := range d.Resources {
+			href := rdString(r.Meta, RDResourceHrefKey)
+			if len(r.Protocols) == 0 || href == "" || strings.Contains(href, "://") {
+				continue
+			}
+			rc := r.copy()
+			rc.Protocols[0].Endpoint = map[string]interface{}{"url": base + href}
+			d.Resources[i] = rc
+		}
+	}
+
+	err := self.catalogStorage.update(d.Id, d)
+	if err == ErrorNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Registration not found\n")
+		return
+	} else if err == catalog.ErrorQuotaExceeded {
+		w.WriteHeader(catalog.StatusTooManyRequests)
+		fmt.Fprintf(w, "Error updating the registration: %s\n", err.Error())
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error updating the registration: %s\n", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Registration removal: DELETE /rd/{dgwid}/{regid}
+func (self ResourceDirectoryAPI) Delete(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	id := fmt.Sprintf("%v/%v", params["dgwid"], params["regid"])
+	if !authorizeWrite(w, req, id) {
+		return
+	}
+
+	err := self.catalogStorage.delete(id)
+	if err == ErrorNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Registration not found\n")
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error deleting the registration: %s\n", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lookup interface: GET /rd-lookup/{type} for endpoints (ep) or resources (res)
+func (self ResourceDirectoryAPI) Lookup(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	page, _ := strconv.Atoi(req.Form.Get(RDParamPage))
+	count, _ := strconv.Atoi(req.Form.Get(RDParamCount))
+
+	// page and count are paging controls, not filters
+	query := url.Values{}
+	for k, v := range req.Form {
+		if k != RDParamPage && k != RDParamCount {
+			query[k] = v
+		}
+	}
+
+	devices, err := self.allDevices()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error requesting the registrations: %s\n", err.Error())
+		return
+	}
+
+	links := []catalog.Link{}
+	switch mux.Vars(req)["type"] {
+	case rdLookupTypeEndpoint:
+		for _, d := range devices {
+			l := rdLinkFromDevice(d)
+			if linkMatchesQuery(l, query) {
+				links = append(links, l)
+			}
+		}
+	case rdLookupTypeResource:
+		for _, d := range devices {
+			ep := rdLinkFromDevice(d)
+			for _, r := range d.Resources {
+				l := rdLinkFromResource(r, rdString(rdMeta(d), RDParamBase))
+				// endpoint attributes can be used to filter resources too
+				if linkMatchesQuery(mergeLinkParams(l, ep), query) {
+					links = append(links, l)
+				}
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Unknown lookup type\n")
+		return
+	}
+
+	// count limits the number of links, page selects the window (starting from 0)
+	if count > 0 {
+		start := page * count
+		if start > len(links) {
+			start = len(links)
+		}
+		end := start + count
+		if end > len(links) {
+			end = len(links)
+		}
+		links = links[start:end]
+	}
+	self.writeLinks(w, links)
+}
+
+func (self ResourceDirectoryAPI) getRegistration(w http.ResponseWriter, req *http.Request) (Device, bool) {
+	params := mux.Vars(req)
+	id := fmt.Sprintf("%v/%v", params["dgwid"], params["regid"])
+
+	d, err := self.catalogStorage.get(id)
+	if err == ErrorNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Registration not found\n")
+		return d, false
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error requesting the registration: %s\n", err.Error())
+		return d, false
+	}
+	return d, true
+}
+
+// Returns all devices sorted by id
+func (self ResourceDirectoryAPI) allDevices() ([]Device, error) {
+	devices := []Device{}
+	for page := 1; ; page++ {
+		devs, total, err := self.catalogStorage.getDevices(page, MaxPerPage)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, devs...)
+		if len(devs) == 0 || page*MaxPerPage >= total {
+			break
+		}
+	}
+	return devices, nil
+}
+
+func (self ResourceDirectoryAPI) writeLinks(w http.ResponseWriter, links []catalog.Link) {
+	w.Header().Set("Content-Type", LinkFormatMediaType)
+	w.Write([]byte(catalog.FormatLinks(links)))
+}
+
+// Converts registered links into catalog resources of a device
+func rdResourcesFromLinks(deviceId, base string, links []catalog.Link) []Resource {
+	resources := make([]Resource, 0, len(links))
+	used := make(map[string]bool)
+	for _, l := range links {
+		name := rdResourceName(l.Target)
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s-%d", rdResourceName(l.Target), i)
+		}
+		used[name] = true
+
+		meta := make(map[string]interface{}, len(l.Params)+1)
+		for k, v := range l.Params {
+			meta[k] = v
+		}
+		meta[RDResourceHrefKey] = l.Target
+
+		contentTypes := []string{}
+		for _, ct := range strings.Fields(l.Params["ct"]) {
+			if mt, ok := coapContentFormats[ct]; ok {
+				contentTypes = append(contentTypes, mt)
+			}
+		}
+
+		target := l.Target
+		if !strings.Contains(target, "://") {
+			target = base + target
+		}
+
+		resources = append(resources, Resource{
+			Id:   deviceId + "/" + name,
+			Type: ApiResourceType,
+			Name: name,
+			Meta: meta,
+			Protocols: []Protocol{{
+				Type:         RDProtocolType,
+				Endpoint:     map[string]interface{}{"url": target},
+				Methods:      []string{"GET"},
+				ContentTypes: contentTypes,
+			}},
+		})
+	}
+	return resources
+}
+
+// Derives a resource name (single path segment) from a link target
+func rdResourceName(target string) string {
+	if u, err := url.Parse(target); err == nil {
+		target = u.Path
+	}
+	name := strings.Replace(strings.Trim(target, "/"), "/", "_", -1)
+	if name == "" {
+		name = "root"
+	}
+	return name
+}
+
+// Link describing a registration for the endpoint lookup
+func rdLinkFromDevice(d Device) catalog.Link {
+	meta := rdMeta(d)
+	l := catalog.Link{
+		Target: fmt.Sprintf("%s/%s", RDLocation, d.Id),
+		Params: map[string]string{
+			RDParamEndpoint: d.Name,
+			RDParamLifetime: strconv.Itoa(d.Ttl),
+		},
+	}
+	if s := rdString(meta, RDParamSector); s != "" {
+		l.Params[RDParamSector] = s
+	}
+	if s := rdString(meta, RDParamBase); s != "" {
+		l.Params[RDParamBase] = s
+	}
+	if s := rdString(meta, RDParamEndpointType); s != "" {
+		l.Params[RDParamEndpointType] = s
+	}
+	return l
+}
+
+// Link describing a resource. If base is given, the target is resolved
+// against it and base is used as anchor
+func rdLinkFromResource(r Resource, base string) catalog.Link {
+	l := catalog.Link{Params: make(map[string]string)}
+	for k, v := range r.Meta {
+		if s, ok := v.(string); ok && k != RDResourceHrefKey {
+			l.Params[k] = s
+		}
+	}
+
+	href := rdString(r.Meta, RDResourceHrefKey)
+	switch {
+	case href != "" && base != "" && !strings.Contains(href, "://"):
+		l.Target = base + href
+		l.Params["anchor"] = base
+	case href != "":
+		l.Target = href
+	case len(r.Protocols) > 0:
+		// registered via the catalog api, not the RD
+		l.Target, _ = r.Protocols[0].Endpoint["url"].(string)
+		if _, ok := l.Params["rt"]; !ok && r.Type != "" {
+			l.Params["rt"] = r.Type
+		}
+	default:
+		l.Target = r.Id
+	}
+	return l
+}
+
+// Returns a copy of a link with params of other added (without overriding)
+func mergeLinkParams(l, other catalog.Link) catalog.Link {
+	m := catalog.Link{Target: l.Target, Params: make(map[string]string)}
+	for k, v := range other.Params {
+		m.Params[k] = v
+	}
+	for k, v := range l.Params {
+		m.Params[k] = v
+	}
+	return m
+}
+
+func linkMatchesQuery(l catalog.Link, query url.Values) bool {
+	for k, values := range query {
+		for _, v := range values {
+			if !l.Matches(k, v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func rdMeta(d Device) map[string]interface{} {
+	if d.Meta == nil {
+		return map[string]interface{}{}
+	}
+	m, ok := d.Meta[RDMetaKey].(map[string]interface{})
+	if !ok {
+		return map[string]interface{}{}
+	}
+	return m
+}
+
+func rdString(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func rdBaseFromRemoteAddr(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return "coap://" + net.JoinHostPort(host, rdDefaultCoapPort)
+}
@@ -0,0 +1,151 @@
+package device
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+func setupRDRouter(storage CatalogStorage) *mux.Router {
+	rd := NewResourceDirectoryAPI(storage, "")
+	r := mux.NewRouter().StrictSlash(true)
+	r.Methods("GET").Path(RDWellKnownLocation).HandlerFunc(rd.WellKnownCore)
+	r.Methods("POST").Path(RDLocation).HandlerFunc(rd.Register)
+	r.Methods("GET").Path(RDLocation + "/{dgwid}/{regid}").HandlerFunc(rd.Get)
+	r.Methods("POST").Path(RDLocation + "/{dgwid}/{regid}").HandlerFunc(rd.Update)
+	r.Methods("DELETE").Path(RDLocation + "/{dgwid}/{regid}").HandlerFunc(rd.Delete)
+	r.Methods("GET").Path(RDLookupLocation + "/{type}").HandlerFunc(rd.Lookup)
+	return r
+}
+
+func TestRDRegisterAndLookup(t *testing.T) {
+	storage := NewMemoryStorage()
+	ts := httptest.NewServer(setupRDRouter(storage))
+	defer ts.Close()
+
+	payload := `</sensors/temp>;rt="temperature-c";if="sensor";ct=50,</3/0>;obs`
+	res, err := http.Post(ts.URL+RDLocation+"?ep=node1&lt=60&base=coap://10.0.0.5", LinkFormatMediaType, strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %v", res.StatusCode)
+	}
+	if loc := res.Header.Get("Location"); loc != RDLocation+"/"+RDDefaultSector+"/node1" {
+		t.Fatalf("Unexpected Location: %s", loc)
+	}
+
+	d, err := storage.get(RDDefaultSector + "/node1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if d.Ttl != 60 || len(d.Resources) != 2 {
+		t.Fatalf("Unexpected registration: ttl=%v, resources=%v", d.Ttl, len(d.Resources))
+	}
+
+	res, err = http.Get(ts.URL + RDLookupLocation + "/res?rt=temperature*")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	links, err := catalog.ParseLinkFormat(string(b))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(links) != 1 || links[0].Target != "coap://10.0.0.5/sensors/temp" {
+		t.Fatalf("Unexpected lookup result: %s", b)
+	}
+	if links[0].Params["anchor"] != "coap://10.0.0.5" {
+		t.Errorf("Expected anchor to be the registration base, got %s", links[0].Params["anchor"])
+	}
+}
+
+func TestRDUpdateAndDelete(t *testing.T) {
+	storage := NewMemoryStorage()
+	ts := httptest.NewServer(setupRDRouter(storage))
+	defer ts.Close()
+
+	res, err := http.Post(ts.URL+RDLocation+"?ep=node2&d=building1", LinkFormatMediaType, strings.NewReader(`</a>`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	loc := res.Header.Get("Location")
+
+	res, err = http.Post(ts.URL+loc+"?lt=120", LinkFormatMediaType, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204 on update, got %v", res.StatusCode)
+	}
+	d, _ := storage.get("building1/node2")
+	if d.Ttl != 120 {
+		t.Errorf("Expected lifetime to be updated to 120, got %v", d.Ttl)
+	}
+
+	req, _ := http.NewRequest("DELETE", ts.URL+loc, nil)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204 on delete, got %v", res.StatusCode)
+	}
+	if _, err = storage.get("building1/node2"); err != ErrorNotFound {
+		t.Error("The registration hasn't been deleted")
+	}
+}
+
+func TestRDLookupEndpointsWithoutResources(t *testing.T) {
+	storage := NewMemoryStorage()
+	ts := httptest.NewServer(setupRDRouter(storage))
+	defer ts.Close()
+
+	storage.add(Device{Id: RDDefaultSector + "/empty", Name: "empty", Ttl: 60})
+	for i := 0; i < MaxPerPage+1; i++ {
+		storage.add(Device{Id: fmt.Sprintf("%s/node%d", RDDefaultSector, i), Name: "node", Ttl: 60, Resources: []Resource{
+			{Id: fmt.Sprintf("%s/node%d/a", RDDefaultSector, i), Name: "a"},
+			{Id: fmt.Sprintf("%s/node%d/b", RDDefaultSector, i), Name: "b"},
+		}})
+	}
+
+	res, err := http.Get(ts.URL + RDLookupLocation + "/ep")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	links, err := catalog.ParseLinkFormat(string(b))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(links) != MaxPerPage+2 {
+		t.Fatalf("Expected %v endpoints, got %v", MaxPerPage+2, len(links))
+	}
+}
+
+func TestRDWellKnownReadOnly(t *testing.T) {
+	rd := NewResourceDirectoryAPI(NewMemoryStorage(), "")
+	rd.ReadOnly = true
+	w := httptest.NewRecorder()
+	rd.WellKnownCore(w, httptest.NewRequest("GET", RDWellKnownLocation, nil))
+	links, err := catalog.ParseLinkFormat(w.Body.String())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, l := range links {
+		if l.Params["rt"] == "core.rd" {
+			t.Errorf("Expected no registration interface on a read-only directory, got %s", w.Body.String())
+		}
+	}
+	if len(links) != 2 {
+		t.Errorf("Expected the 2 lookup interfaces, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,85 @@
+package device
+
+import (
+	"net/url"
+	"time"
+
+	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+	"github.com/patchwork-toolkit/patchwork/catalog/registrar"
+	"github.com/patchwork-toolkit/patchwork/discovery"
+)
+
+// Registration of a device in a catalog, managed by a registrar.Registrar.
+// A catalog can have several equivalent endpoints: the device is registered
+// at the first available one and registered again at the next endpoint
+// when it fails
+type Registration struct {
+	*registrar.CatalogRegistration
+}
+
+// Returns the registration of the device using the client of a catalog.
+// name identifies the catalog in the status of the registrar
+func NewRegistration(client CatalogClient, name string, d Device) *Registration {
+	return &Registration{registrar.NewCatalogRegistration(d.Id, d.Ttl, name, utils.NewFailover([]string{name}, ""),
+		func(string) registrar.EntryClient {
+			return &deviceClient{client, d}
+		})}
+}
+
+// Returns the registration of the device in the remote catalog at endpoint.
+// If discover is set the endpoint is discovered using DNS-SD and
+// discovered again after a failure
+func NewRemoteRegistration(endpoint string, discover bool, d Device, credentials *auth.Credentials) *Registration {
+	if discover {
+		return NewFailoverRegistration(nil, &utils.DiscoveryOptions{}, d, credentials)
+	}
+	return NewFailoverRegistration([]string{endpoint}, nil, d, credentials)
+}
+
+// Returns the registration of the device in a remote catalog with several
+// equivalent endpoints (in order of preference). If discover is not nil an
+// endpoint discovered using DNS-SD is used after all others fail. Unless
+// other requirements are given, only catalogs with the API type and a version
+// compatible with ApiVersion, or announcing neither (older releases), are discovered
+func NewFailoverRegistration(endpoints []string, discover *utils.DiscoveryOptions, d Device, credentials *auth.Credentials) *Registration {
+	name, failover := registrar.CatalogFailover(endpoints, discover, DNSSDServiceType,
+		discovery.Requirements{ApiType: ApiCollectionType, ApiVersion: ApiVersion})
+	return &Registration{registrar.NewCatalogRegistration(d.Id, d.Ttl, name, failover,
+		func(endpoint string) registrar.EntryClient {
+			// bounded requests, Stop of the registrar waits for them
+			client, err := NewRemoteCatalogClientWithOptions(endpoint, utils.ClientOptions{
+				Credentials: credentials,
+				Timeout:     registrar.RequestTimeout * time.Second,
+			})
+			if err != nil {
+				// reported on requests
+				client = &RemoteCatalogClient{serverEndpoint: &url.URL{}, clientErr: err}
+			}
+			return &deviceClient{client, d}
+		})}
+}
+
+// Registers the device with a catalog client
+type deviceClient struct {
+	client CatalogClient
+	device Device
+}
+
+func (self *deviceClient) Register() error {
+	d := self.device.copy()
+	err := self.client.Update(d.Id, &d)
+	if err == ErrorNotFound {
+		d = self.device.copy()
+		err = self.client.Add(&d)
+	}
+	return err
+}
+
+func (self *deviceClient) Unregister() error {
+	err := self.client.Delete(self.device.Id)
+	if err == ErrorNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package device
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Catalog server that can be taken down
+type switchableServer struct {
+	*httptest.Server
+	storage *MemoryStorage
+	down    bool
+	mutex   sync.Mutex
+}
+
+func newSwitchableServer() *switchableServer {
+	s := &switchableServer{storage: NewMemoryStorage()}
+	handler := NewHandler(s.storage, HandlerOptions{Location: "/dc", Writable: true})
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.mutex.Lock()
+		down := s.down
+		s.mutex.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	}))
+	return s
+}
+
+func (self *switchableServer) setDown(down bool) {
+	self.mutex.Lock()
+	self.down = down
+	self.mutex.Unlock()
+}
+
+func TestFailoverRegistration(t *testing.T) {
+	ts1 := newSwitchableServer()
+	defer ts1.Close()
+	ts2 := newSwitchableServer()
+	defer ts2.Close()
+
+	d := federationTestDevice("dgw1/d1", "r1")
+	reg := NewFailoverRegistration([]string{ts1.URL + "/dc", ts2.URL + "/dc"}, nil, d, nil)
+	if reg.Catalog() != ts1.URL+"/dc,"+ts2.URL+"/dc" {
+		t.Errorf("Unexpected catalog name: %v", reg.Catalog())
+	}
+
+	if err := reg.Register(); err != nil {
+		t.Fatalf("Unexpected error on register: %v", err)
+	}
+	if _, err := ts1.storage.get(d.Id); err != nil || reg.Endpoint() != ts1.URL+"/dc" {
+		t.Fatalf("Expected the device in the first catalog: %v", err)
+	}
+
+	// registered again at the next endpoint
+	ts1.setDown(true)
+	if err := reg.Register(); err != nil {
+		t.Fatalf("Unexpected error on failover: %v", err)
+	}
+	if _, err := ts2.storage.get(d.Id); err != nil || reg.Endpoint() != ts2.URL+"/dc" {
+		t.Fatalf("Expected the device in the second catalog: %v", err)
+	}
+	if health := reg.Health(); health[0].Healthy || !health[1].Healthy {
+		t.Errorf("Unexpected health: %+v", health)
+	}
+
+	// removed from all endpoints it was registered at
+	ts1.setDown(false)
+	if err := reg.Unregister(); err != nil {
+		t.Fatalf("Unexpected error on unregister: %v", err)
+	}
+	if _, err := ts1.storage.get(d.Id); err != ErrorNotFound {
+		t.Errorf("Expected the device to be removed from the first catalog, got %v", err)
+	}
+	if _, err := ts2.storage.get(d.Id); err != ErrorNotFound {
+		t.Errorf("Expected the device to be removed from the second catalog, got %v", err)
+	}
+}
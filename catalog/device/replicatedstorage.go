@@ -0,0 +1,173 @@
+package device
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/patchwork-toolkit/patchwork/catalog/replication"
+)
+
+// Memory storage recording its mutations in a replication log.
+// Implements replication.Store to apply the log of a primary
+type ReplicatedStorage struct {
+	*MemoryStorage
+	log *replication.Log
+	// serializes writes with their log entries
+	mutex sync.Mutex
+}
+
+func NewReplicatedStorage(storage *MemoryStorage, log *replication.Log) *ReplicatedStorage {
+	return &ReplicatedStorage{
+		MemoryStorage: storage,
+		log:           log,
+	}
+}
+
+// CRUD
+func (self *ReplicatedStorage) add(d Device) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	err := self.MemoryStorage.add(d)
+	if err != nil {
+		return err
+	}
+	return self.record(d.Id)
+}
+
+func (self *ReplicatedStorage) update(id string, d Device) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	err := self.MemoryStorage.update(id, d)
+	if err != nil {
+		return err
+	}
+	return self.record(id)
+}
+
+func (self *ReplicatedStorage) delete(id string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	err := self.MemoryStorage.delete(id)
+	if err != nil {
+		return err
+	}
+	self.log.Record(replication.OpDelete, id, nil)
+	return nil
+}
+
+// Records the stored state of the device
+func (self *ReplicatedStorage) record(id string) error {
+	d, err := self.MemoryStorage.get(id)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	self.log.Record(replication.OpPut, id, b)
+	return nil
+}
+
+// replication.Store
+func (self *ReplicatedStorage) Put(id string, data []byte) error {
+	var d Device
+	err := json.Unmarshal(data, &d)
+	if err != nil {
+		return err
+	}
+	d.Id = id
+	self.MemoryStorage.put(d)
+	return nil
+}
+
+func (self *ReplicatedStorage) Delete(id string) error {
+	err := self.MemoryStorage.delete(id)
+	if err == ErrorNotFound {
+		return nil
+	}
+	return err
+}
+
+func (self *ReplicatedStorage) Snapshot() (uint64, map[string][]byte, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	entries := make(map[string][]byte)
+	for _, d := range self.MemoryStorage.getAll() {
+		b, err := json.Marshal(d)
+		if err != nil {
+			return 0, nil, err
+		}
+		entries[d.Id] = b
+	}
+	return self.log.Seq(), entries, nil
+}
+
+func (self *ReplicatedStorage) Restore(entries map[string][]byte) error {
+	devices := make([]Device, 0, len(entries))
+	for id, data := range entries {
+		var d Device
+		err := json.Unmarshal(data, &d)
+		if err != nil {
+			return err
+		}
+		d.Id = id
+		devices = append(devices, d)
+	}
+	self.MemoryStorage.reset(devices)
+	return nil
+}
+
+// Stores the device replacing the existing one and keeping its timestamps
+func (self *MemoryStorage) put(d Device) {
+	self.mutex.Lock()
+	if sd, ok := self.devices[d.Id]; ok {
+		for _, rid := range sd.Resources {
+			delete(self.resources, rid)
+		}
+		delete(self.devices, d.Id)
+	}
+	self.mutex.Unlock()
+
+	self.addFederated(d)
+
+	self.mutex.Lock()
+	self.reindexResources()
+	self.mutex.Unlock()
+}
+
+// Replaces all devices keeping their timestamps
+func (self *MemoryStorage) reset(devices []Device) {
+	self.mutex.Lock()
+	self.devices = make(map[string]StoredDevice)
+	self.resources = make(map[string]Resource)
+	self.mutex.Unlock()
+
+	for _, d := range devices {
+		self.addFederated(d)
+	}
+
+	self.mutex.Lock()
+	self.reindexResources()
+	self.mutex.Unlock()
+}
+
+// Returns all devices with their resources
+func (self *MemoryStorage) getAll() []Device {
+	self.mutex.RLock()
+	devices := make([]Device, 0, len(self.devices))
+	for _, sd := range self.devices {
+		d := *sd.Device
+		d.Resources = make([]Resource, 0, len(sd.Resources))
+		for _, rid := range sd.Resources {
+			d.Resources = append(d.Resources, self.resources[rid])
+		}
+		devices = append(devices, d)
+	}
+	self.mutex.RUnlock()
+	return devices
+}
@@ -0,0 +1,72 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/patchwork-toolkit/patchwork/catalog/replication"
+)
+
+func TestReplicatedStorage(t *testing.T) {
+	log := replication.NewLog(10)
+	primary := NewReplicatedStorage(NewMemoryStorage(), log)
+
+	if err := primary.add(quotaTestDevice("dgw1/d1", "r1", "r2")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := primary.add(quotaTestDevice("dgw1/d2", "r1")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := primary.update("dgw1/d1", quotaTestDevice("dgw1/d1", "r3")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := primary.delete("dgw1/d2"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if log.Seq() != 4 {
+		t.Fatalf("Expected 4 log entries, got %v", log.Seq())
+	}
+
+	// apply the log to a replica
+	replica := NewReplicatedStorage(NewMemoryStorage(), replication.NewLog(10))
+	entries, _ := log.Since(0, 0)
+	for _, e := range entries {
+		var err error
+		if e.Op == replication.OpPut {
+			err = replica.Put(e.Id, e.Data)
+		} else {
+			err = replica.Delete(e.Id)
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error applying %v: %v", e.Seq, err)
+		}
+	}
+
+	expected, _ := primary.get("dgw1/d1")
+	d, err := replica.get("dgw1/d1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(d.Resources) != 1 || d.Resources[0].Id != "dgw1/d1/r3" || !d.Expires.Equal(expected.Expires) {
+		t.Errorf("Replicated device differs from the primary: %+v", d)
+	}
+	if replica.getDevicesCount() != 1 || replica.getResourcesCount() != 1 {
+		t.Errorf("Expected 1 device with 1 resource, got %v/%v", replica.getDevicesCount(), replica.getResourcesCount())
+	}
+
+	// restore from a snapshot
+	seq, snapshot, err := primary.Snapshot()
+	if err != nil || seq != 4 || len(snapshot) != 1 {
+		t.Fatalf("Unexpected snapshot: %v %v (%v)", seq, snapshot, err)
+	}
+	restored := NewReplicatedStorage(NewMemoryStorage(), replication.NewLog(10))
+	restored.add(quotaTestDevice("dgw2/d1", "r1"))
+	if err = restored.Restore(snapshot); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err = restored.get("dgw2/d1"); err != ErrorNotFound {
+		t.Errorf("Expected devices missing in the snapshot to be removed")
+	}
+	if _, err = restored.getResourceById("dgw1/d1/r3"); err != nil {
+		t.Errorf("Expected the snapshot resource to be restored: %v", err)
+	}
+}
@@ -0,0 +1,440 @@
+package device
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+)
+
+var ErrorNoShards = errors.New("No shards configured")
+
+// Catalog instance holding a part of the registrations
+type Shard struct {
+	Name     string            `json:"name"`
+	Endpoint string            `json:"endpoint"`
+	Auth     *auth.Credentials `json:"auth"`
+}
+
+// Catalog client sharding registrations across several catalogs by gateway id (dgwid).
+// Devices of a gateway are placed on a shard using consistent hashing, queries
+// over all registrations are fanned out to all shards and their pages merged.
+type ShardedCatalogClient struct {
+	ring    *catalog.HashRing
+	shards  map[string]Shard
+	clients map[string]CatalogClient
+	mutex   sync.RWMutex
+	// serializes rebalancing
+	rebalanceMutex sync.Mutex
+}
+
+// Creates a client of the given shards.
+// virtualNodes is the number of points of each shard on the hash ring (0 for default)
+func NewShardedCatalogClient(shards []Shard, virtualNodes int) *ShardedCatalogClient {
+	c := &ShardedCatalogClient{
+		ring:    catalog.NewHashRing(virtualNodes),
+		shards:  make(map[string]Shard),
+		clients: make(map[string]CatalogClient),
+	}
+	for _, s := range shards {
+		c.AddShard(s)
+	}
+	return c
+}
+
+// Adds a shard. Existing registrations placed on it have to be moved using Rebalance
+func (self *ShardedCatalogClient) AddShard(s Shard) {
+	self.mutex.Lock()
+	self.shards[s.Endpoint] = s
+	self.clients[s.Endpoint] = NewRemoteCatalogClient(s.Endpoint, s.Auth)
+	self.mutex.Unlock()
+	self.ring.Add(s.Endpoint)
+}
+
+// Removes a shard. Its registrations are no longer reachable through the client
+func (self *ShardedCatalogClient) RemoveShard(endpoint string) {
+	self.ring.Remove(endpoint)
+	self.mutex.Lock()
+	delete(self.shards, endpoint)
+	delete(self.clients, endpoint)
+	self.mutex.Unlock()
+}
+
+// Returns the shards sorted by endpoint
+func (self *ShardedCatalogClient) Shards() []Shard {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	shards := make([]Shard, 0, len(self.shards))
+	for _, endpoint := range self.ring.Nodes() {
+		shards = append(shards, self.shards[endpoint])
+	}
+	return shards
+}
+
+// Returns the endpoint of the shard of the given device or resource id
+func (self *ShardedCatalogClient) ShardFor(id string) string {
+	return self.ring.Get(catalog.EntryOwner(id))
+}
+
+// Returns the client of the shard of the given id
+func (self *ShardedCatalogClient) shardClient(id string) (CatalogClient, error) {
+	endpoint := self.ShardFor(id)
+	self.mutex.RLock()
+	c, ok := self.clients[endpoint]
+	self.mutex.RUnlock()
+	if !ok {
+		return nil, ErrorNoShards
+	}
+	return c, nil
+}
+
+// Returns the clients of all shards in the order of Shards()
+func (self *ShardedCatalogClient) shardClients() []CatalogClient {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	clients := make([]CatalogClient, 0, len(self.clients))
+	for _, endpoint := range self.ring.Nodes() {
+		clients = append(clients, self.clients[endpoint])
+	}
+	return clients
+}
+
+// CRUD
+func (self *ShardedCatalogClient) Get(id string) (*Device, error) {
+	c, err := self.shardClient(id)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(id)
+}
+
+func (self *ShardedCatalogClient) Add(d *Device) error {
+	c, err := self.shardClient(d.Id)
+	if err != nil {
+		return err
+	}
+	return c.Add(d)
+}
+
+func (self *ShardedCatalogClient) Update(id string, d *Device) error {
+	c, err := self.shardClient(id)
+	if err != nil {
+		return err
+	}
+	return c.Update(id, d)
+}
+
+func (self *ShardedCatalogClient) Delete(id string) error {
+	c, err := self.shardClient(id)
+	if err != nil {
+		return err
+	}
+	return c.Delete(id)
+}
+
+// Fan-out queries.
+// Pages of devices (paginated by resources as the catalog API does) and of
+// resources are paginated across the shards in the order of Shards()
+func (self *ShardedCatalogClient) GetDevices(page, perPage int) ([]Device, int, error) {
+	return self.pageOfDevices(page, perPage, func(c CatalogClient, page, perPage int) ([]Device, int, error) {
+		return c.GetDevices(page, perPage)
+	})
+}
+
+func (self *ShardedCatalogClient) FindDevice(path, op, value string) (*Device, error) {
+	results, err := self.fanOut(func(c CatalogClient) (interface{}, error) {
+		d, err := c.FindDevice(path, op, value)
+		if err != nil || d.Id == "" {
+			return nil, err
+		}
+		return d, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the first match in shard order
+	for _, r := range results {
+		if r != nil {
+			return r.(*Device), nil
+		}
+	}
+	return nil, ErrorNotFound
+}
+
+func (self *ShardedCatalogClient) FindDevices(path, op, value string, page, perPage int) ([]Device, int, error) {
+	return self.pageOfDevices(page, perPage, func(c CatalogClient, page, perPage int) ([]Device, int, error) {
+		return c.FindDevices(path, op, value, page, perPage)
+	})
+}
+
+func (self *ShardedCatalogClient) FindResource(path, op, value string) (*Resource, error) {
+	results, err := self.fanOut(func(c CatalogClient) (interface{}, error) {
+		r, err := c.FindResource(path, op, value)
+		if err != nil || r.Id == "" {
+			return nil, err
+		}
+		return r, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if r != nil {
+			return r.(*Resource), nil
+		}
+	}
+	return nil, ErrorNotFound
+}
+
+func (self *ShardedCatalogClient) FindResources(path, op, value string, page, perPage int) ([]Resource, int, error) {
+	items, total, err := self.pageAcrossShards(page, perPage, func(c CatalogClient, page, perPage int) ([]interface{}, int, error) {
+		ress, total, err := c.FindResources(path, op, value, page, perPage)
+		items := make([]interface{}, 0, len(ress))
+		for _, r := range ress {
+			items = append(items, r)
+		}
+		return items, total, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	ress := make([]Resource, 0, len(items))
+	for _, item := range items {
+		ress = append(ress, item.(Resource))
+	}
+	return ress, total, nil
+}
+
+// Moves the devices which are not on their shard (e.g. after adding a shard).
+// Returns the number of moved devices
+func (self *ShardedCatalogClient) Rebalance() (int, error) {
+	self.rebalanceMutex.Lock()
+	defer self.rebalanceMutex.Unlock()
+
+	self.mutex.RLock()
+	clients := make(map[string]CatalogClient, len(self.clients))
+	for endpoint, c := range self.clients {
+		clients[endpoint] = c
+	}
+	self.mutex.RUnlock()
+
+	moved := 0
+	for endpoint, c := range clients {
+		devices, err := fetchAllDevices(c)
+		if err != nil {
+			return moved, err
+		}
+		for _, d := range devices {
+			target := self.ShardFor(d.Id)
+			tc, ok := clients[target]
+			if target == endpoint || !ok {
+				continue
+			}
+			d := d
+			err = tc.Add(&d)
+			if err != nil {
+				// already on the target (e.g. an interrupted rebalance)
+				if _, e := tc.Get(d.Id); e != nil {
+					return moved, err
+				}
+				err = tc.Update(d.Id, &d)
+				if err != nil {
+					return moved, err
+				}
+			}
+			err = c.Delete(d.Id)
+			if err != nil && err != ErrorNotFound {
+				return moved, err
+			}
+			logger.Printf("ShardedCatalogClient.Rebalance() Moved %s from %s to %s", d.Id, endpoint, target)
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// Runs the query on all shards concurrently.
+// Results are in the order of Shards(), the first error is returned
+func (self *ShardedCatalogClient) fanOut(query func(c CatalogClient) (interface{}, error)) ([]interface{}, error) {
+	clients := self.shardClients()
+	if len(clients) == 0 {
+		return nil, ErrorNoShards
+	}
+	return fanOutClients(clients, func(i int, c CatalogClient) (interface{}, error) {
+		return query(c)
+	})
+}
+
+// Runs the query on the clients concurrently, given their index.
+// Results are in the order of the clients, the first error is returned
+func fanOutClients(clients []CatalogClient, query func(i int, c CatalogClient) (interface{}, error)) ([]interface{}, error) {
+	results := make([]interface{}, len(clients))
+	errs := make([]error, len(clients))
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c CatalogClient) {
+			results[i], errs[i] = query(i, c)
+			wg.Done()
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil && err != ErrorNotFound {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (self *ShardedCatalogClient) fanOutDevices(query func(c CatalogClient) ([]Device, error)) ([]Device, error) {
+	results, err := self.fanOut(func(c CatalogClient) (interface{}, error) {
+		return query(c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	devices := []Device{}
+	for _, r := range results {
+		if r != nil {
+			devices = append(devices, r.([]Device)...)
+		}
+	}
+	return devices, nil
+}
+
+// Query of a page of the items of a shard, returning the total number of items of the shard
+type shardPageQuery func(c CatalogClient, page, perPage int) ([]interface{}, int, error)
+
+// Returns a page of the items of a query paginated across the shards in the order of
+// Shards() and the total number of items. The totals of the shards are queried first
+// to only fetch the pages of the shards covering the requested page
+func (self *ShardedCatalogClient) pageAcrossShards(page, perPage int, query shardPageQuery) ([]interface{}, int, error) {
+	page, perPage = catalog.ValidatePagingParams(page, perPage, MaxPerPage)
+	clients := self.shardClients()
+	if len(clients) == 0 {
+		return nil, 0, ErrorNoShards
+	}
+	totals, err := fanOutClients(clients, func(i int, c CatalogClient) (interface{}, error) {
+		_, total, err := query(c, 1, 1)
+		return total, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// ranges of the items of the shards on the page
+	offset := (page - 1) * perPage
+	total := 0
+	covering := []CatalogClient{}
+	ranges := [][2]int{}
+	for i, c := range clients {
+		n, _ := totals[i].(int)
+		if from, to := offset-total, offset+perPage-total; from < n && to > 0 {
+			if from < 0 {
+				from = 0
+			}
+			if to > n {
+				to = n
+			}
+			covering = append(covering, c)
+			ranges = append(ranges, [2]int{from, to - from})
+		}
+		total += n
+	}
+
+	results, err := fanOutClients(covering, func(i int, c CatalogClient) (interface{}, error) {
+		return fetchRange(c, query, ranges[i][0], ranges[i][1])
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	items := []interface{}{}
+	for _, r := range results {
+		if r != nil {
+			items = append(items, r.([]interface{})...)
+		}
+	}
+	return items, total, nil
+}
+
+// Fetches count items of a shard starting at offset with at most two page queries
+func fetchRange(c CatalogClient, query shardPageQuery, offset, count int) ([]interface{}, error) {
+	page, skip := offset/count+1, offset%count
+	items, _, err := query(c, page, count)
+	if err != nil {
+		return nil, err
+	}
+	if skip > 0 && len(items) == count {
+		next, _, err := query(c, page+1, count)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, next...)
+	}
+	if skip >= len(items) {
+		return []interface{}{}, nil
+	}
+	if skip+count < len(items) {
+		items = items[:skip+count]
+	}
+	return items[skip:], nil
+}
+
+// Returns a page of the devices of a query paginated by resources across the shards
+// and the total number of resources
+func (self *ShardedCatalogClient) pageOfDevices(page, perPage int, query func(c CatalogClient, page, perPage int) ([]Device, int, error)) ([]Device, int, error) {
+	items, total, err := self.pageAcrossShards(page, perPage, func(c CatalogClient, page, perPage int) ([]interface{}, int, error) {
+		devs, total, err := query(c, page, perPage)
+		// in the order of the resources of the page
+		resources := []Resource{}
+		byId := make(map[string]Device, len(devs))
+		for _, d := range devs {
+			byId[d.Id] = d
+			for _, r := range d.Resources {
+				r.Device = d.Id
+				resources = append(resources, r)
+			}
+		}
+		sort.Sort(resourcesById(resources))
+		items := make([]interface{}, 0, len(resources))
+		for _, r := range resources {
+			items = append(items, deviceResource{byId[r.Device], r})
+		}
+		return items, total, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	devs := []Device{}
+	index := make(map[string]int)
+	for _, item := range items {
+		dr := item.(deviceResource)
+		i, ok := index[dr.device.Id]
+		if !ok {
+			d := dr.device
+			d.Resources = nil
+			index[d.Id] = len(devs)
+			devs = append(devs, d)
+			i = len(devs) - 1
+		}
+		devs[i].Resources = append(devs[i].Resources, dr.resource)
+	}
+	return devs, total, nil
+}
+
+// Resource of a page of devices along with its device
+type deviceResource struct {
+	device   Device
+	resource Resource
+}
+
+type resourcesById []Resource
+
+func (s resourcesById) Len() int           { return len(s) }
+func (s resourcesById) Less(i, j int) bool { return s[i].Id < s[j].Id }
+func (s resourcesById) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
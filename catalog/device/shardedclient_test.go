@@ -0,0 +1,266 @@
+package device
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// Starts a writable catalog
+func setupShard() (*httptest.Server, *MemoryStorage) {
+	storage := NewMemoryStorage()
+	handler := NewHandler(storage, HandlerOptions{Location: "/dc", StaticLocation: "/static", Description: "shard", Writable: true})
+	return httptest.NewServer(handler), storage
+}
+
+func TestShardedCatalogClient(t *testing.T) {
+	ts1, s1 := setupShard()
+	defer ts1.Close()
+	ts2, s2 := setupShard()
+	defer ts2.Close()
+
+	client := NewShardedCatalogClient([]Shard{{Name: "s1", Endpoint: ts1.URL + "/dc"}, {Name: "s2", Endpoint: ts2.URL + "/dc"}}, 0)
+	for i := 0; i < 20; i++ {
+		d := federationTestDevice(fmt.Sprintf("dgw%d/d1", i), "r1", "r2")
+		if err := client.Add(&d); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// devices are placed by gateway
+	if s1.getDevicesCount() == 0 || s2.getDevicesCount() == 0 || s1.getDevicesCount()+s2.getDevicesCount() != 20 {
+		t.Fatalf("Unexpected placement: %d/%d", s1.getDevicesCount(), s2.getDevicesCount())
+	}
+	for _, id := range []string{"dgw3/d1", "dgw17/d1"} {
+		shard := s1
+		if client.ShardFor(id) == ts2.URL+"/dc" {
+			shard = s2
+		}
+		if _, err := shard.get(id); err != nil {
+			t.Errorf("Device %s is not on its shard %s", id, client.ShardFor(id))
+		}
+		d, err := client.Get(id)
+		if err != nil || d.Id != id {
+			t.Errorf("Unexpected get of %s: %v (%v)", id, d, err)
+		}
+	}
+
+	// merged paging across shards
+	seen := make(map[string]bool)
+	for page := 1; page <= 4; page++ {
+		devs, total, err := client.GetDevices(page, 10)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if total != 40 {
+			t.Errorf("Expected 40 resources in total, got %d", total)
+		}
+		n := 0
+		for _, d := range devs {
+			for _, r := range d.Resources {
+				if seen[r.Id] {
+					t.Errorf("Resource %s returned twice", r.Id)
+				}
+				seen[r.Id] = true
+				n++
+			}
+		}
+		if n != 10 {
+			t.Errorf("Expected 10 resources on page %d, got %d", page, n)
+		}
+	}
+
+	devs, total, err := client.FindDevices("name", "prefix", "dgw1", 1, 100)
+	if err != nil || total != 22 || len(devs) != 11 {
+		t.Errorf("Expected 11 devices with 22 resources, got %d/%d (%v)", len(devs), total, err)
+	}
+	lamp := federationTestDevice("dgw7/lamp", "r1")
+	lamp.Name = "lamp"
+	if err = client.Add(&lamp); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d, err := client.FindDevice("name", "equals", "lamp")
+	if err != nil || d.Id != "dgw7/lamp" {
+		t.Errorf("Unexpected device found: %v (%v)", d, err)
+	}
+	if _, err = client.FindDevice("name", "equals", "missing"); err != ErrorNotFound {
+		t.Errorf("Expected ErrorNotFound, got %v", err)
+	}
+}
+
+func TestShardedCatalogClientRebalance(t *testing.T) {
+	ts1, s1 := setupShard()
+	defer ts1.Close()
+	client := NewShardedCatalogClient([]Shard{{Endpoint: ts1.URL + "/dc"}}, 0)
+	for i := 0; i < 30; i++ {
+		d := federationTestDevice(fmt.Sprintf("dgw%d/d1", i), "r1")
+		if err := client.Add(&d); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	ts2, s2 := setupShard()
+	defer ts2.Close()
+	client.AddShard(Shard{Endpoint: ts2.URL + "/dc"})
+	moved, err := client.Rebalance()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if moved == 0 || moved != s2.getDevicesCount() || s1.getDevicesCount()+s2.getDevicesCount() != 30 {
+		t.Errorf("Unexpected rebalance: moved %d, shards %d/%d", moved, s1.getDevicesCount(), s2.getDevicesCount())
+	}
+	for i := 0; i < 30; i++ {
+		id := fmt.Sprintf("dgw%d/d1", i)
+		if _, err := client.Get(id); err != nil {
+			t.Errorf("Device %s not found on its shard after rebalance: %v", id, err)
+		}
+	}
+
+	// nothing left to move
+	if moved, err = client.Rebalance(); moved != 0 || err != nil {
+		t.Errorf("Expected a balanced catalog, moved %d (%v)", moved, err)
+	}
+}
+
+func TestShardedCatalogClientPaging(t *testing.T) {
+	var requests [2]int32
+	var storages [2]*MemoryStorage
+	var shards []Shard
+	for i := range storages {
+		i := i
+		storages[i] = NewMemoryStorage()
+		handler := NewHandler(storages[i], HandlerOptions{Location: "/dc", StaticLocation: "/static", Writable: true})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == "GET" {
+				atomic.AddInt32(&requests[i], 1)
+			}
+			handler.ServeHTTP(w, req)
+		}))
+		defer ts.Close()
+		shards = append(shards, Shard{Name: fmt.Sprintf("s%d", i), Endpoint: ts.URL + "/dc"})
+	}
+	client := NewShardedCatalogClient(shards, 0)
+	for i := 0; i < 30; i++ {
+		d := federationTestDevice(fmt.Sprintf("dgw%02d/d1", i), "r1", "r2", "r3")
+		if err := client.Add(&d); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	first := client.Shards()[0].Endpoint == shards[0].Endpoint
+	n0 := storages[0].getResourcesCount()
+	if !first {
+		n0 = storages[1].getResourcesCount()
+	}
+
+	// all resources exactly once over pages not aligned with the shards
+	seen := make(map[string]bool)
+	for page := 1; page <= 13; page++ {
+		devs, total, err := client.GetDevices(page, 7)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if total != 90 {
+			t.Errorf("Expected 90 resources in total, got %d", total)
+		}
+		n := 0
+		for _, d := range devs {
+			for _, r := range d.Resources {
+				if seen[r.Id] || r.Device != d.Id {
+					t.Errorf("Unexpected resource %s of %s on page %d", r.Id, d.Id, page)
+				}
+				seen[r.Id] = true
+				n++
+			}
+		}
+		if expected := 90 - (page-1)*7; n != 7 && n != expected {
+			t.Errorf("Expected 7 resources on page %d, got %d", page, n)
+		}
+	}
+	if len(seen) != 90 {
+		t.Errorf("Expected 90 distinct resources, got %d", len(seen))
+	}
+
+	// a page within the first shard is fetched from it only, with bounded queries
+	atomic.StoreInt32(&requests[0], 0)
+	atomic.StoreInt32(&requests[1], 0)
+	if _, _, err := client.GetDevices(1, n0/2); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	firstRequests, secondRequests := atomic.LoadInt32(&requests[0]), atomic.LoadInt32(&requests[1])
+	if !first {
+		firstRequests, secondRequests = secondRequests, firstRequests
+	}
+	if firstRequests != 2 || secondRequests != 1 {
+		t.Errorf("Expected the totals and one page from the first shard and the total of the second one, got %d/%d requests", firstRequests, secondRequests)
+	}
+
+	ress, total, err := client.FindResources("name", "equals", "r2", 2, 20)
+	if err != nil || total != 30 || len(ress) != 10 {
+		t.Errorf("Expected 10 resources on the second page of 30, got %d/%d (%v)", len(ress), total, err)
+	}
+}
+
+func TestShardedStorageDevices(t *testing.T) {
+	var requests int32
+	var shards []Shard
+	for i := 0; i < 2; i++ {
+		handler := NewHandler(NewMemoryStorage(), HandlerOptions{Location: "/dc", StaticLocation: "/static", Writable: true})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == "GET" {
+				atomic.AddInt32(&requests, 1)
+			}
+			handler.ServeHTTP(w, req)
+		}))
+		defer ts.Close()
+		shards = append(shards, Shard{Name: fmt.Sprintf("s%d", i), Endpoint: ts.URL + "/dc"})
+	}
+	client := NewShardedCatalogClient(shards, 0)
+	// more resources than a page of each shard, ids sorting apart from their resources
+	ids := []string{"dgw/d", "dgw/d-x"}
+	for i := 0; i < 100; i++ {
+		ids = append(ids, fmt.Sprintf("dgw%02d/d1", i))
+	}
+	for _, id := range ids {
+		d := federationTestDevice(id, "r1", "r2", "r3")
+		if err := client.Add(&d); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	storage := NewShardedStorage(client)
+
+	// the first page is fetched from the first page of resources of each shard
+	atomic.StoreInt32(&requests, 0)
+	devs, total, err := storage.getDevices(1, 5)
+	if err != nil || len(devs) != 5 || total <= 5 {
+		t.Fatalf("Unexpected first page: %d devices of %d (%v)", len(devs), total, err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Expected a single page of resources per shard, got %d requests", n)
+	}
+	if devs[0].Id != "dgw/d-x" || devs[1].Id != "dgw/d" || len(devs[1].Resources) != 3 {
+		t.Errorf("Expected the devices in the order of their resources, got %v, %v", devs[0].Id, devs[1].Id)
+	}
+
+	// all devices exactly once with the total of the last page
+	seen := make(map[string]bool)
+	for page := 1; ; page++ {
+		devs, total, err = storage.getDevices(page, 15)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, d := range devs {
+			if seen[d.Id] || len(d.Resources) != 3 {
+				t.Errorf("Unexpected device %s on page %d", d.Id, page)
+			}
+			seen[d.Id] = true
+		}
+		if page*15 >= total {
+			break
+		}
+	}
+	if len(seen) != len(ids) || total != len(ids) {
+		t.Errorf("Expected %d devices, got %d of %d", len(ids), len(seen), total)
+	}
+}
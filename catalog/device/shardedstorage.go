@@ -0,0 +1,207 @@
+package device
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+// Storage routing registrations to the shards of a sharded catalog.
+// Serves the catalog APIs of a router in front of the shards
+type ShardedStorage struct {
+	client *ShardedCatalogClient
+}
+
+func NewShardedStorage(client *ShardedCatalogClient) *ShardedStorage {
+	return &ShardedStorage{client}
+}
+
+// CRUD
+func (self *ShardedStorage) add(d Device) error {
+	return self.client.Add(&d)
+}
+
+func (self *ShardedStorage) update(id string, d Device) error {
+	return self.client.Update(id, &d)
+}
+
+func (self *ShardedStorage) delete(id string) error {
+	return self.client.Delete(id)
+}
+
+func (self *ShardedStorage) get(id string) (Device, error) {
+	d, err := self.client.Get(id)
+	if err != nil {
+		return Device{}, err
+	}
+	return *d, nil
+}
+
+// Utility
+func (self *ShardedStorage) getMany(page, perPage int) ([]Device, int, error) {
+	return self.client.GetDevices(page, perPage)
+}
+
+// Returns a page of the devices in the order of their resources and the total
+// number of devices. The catalog API of the shards pages by resources sorted by
+// id, so the devices of the page are among the first page*perPage devices of each
+// shard and only those are fetched. The total is exact if all shards are exhausted,
+// otherwise it counts one device beyond the fetched ones
+func (self *ShardedStorage) getDevices(page, perPage int) ([]Device, int, error) {
+	page, perPage = catalog.ValidatePagingParams(page, perPage, MaxPerPage)
+	var (
+		more  bool
+		mutex sync.Mutex
+	)
+	devices, err := self.client.fanOutDevices(func(c CatalogClient) ([]Device, error) {
+		devs, exhausted, err := firstDevices(c, page*perPage)
+		if !exhausted {
+			mutex.Lock()
+			more = true
+			mutex.Unlock()
+		}
+		return devs, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Sort(devicesByResources(devices))
+
+	total := len(devices)
+	if more {
+		total++
+	}
+	from := (page - 1) * perPage
+	if from >= len(devices) {
+		return []Device{}, total, nil
+	}
+	to := from + perPage
+	if to > len(devices) {
+		to = len(devices)
+	}
+	return devices[from:to], total, nil
+}
+
+// Returns the first n devices of a shard in the order of their resources, fetching
+// the pages of resources until the n-th device is complete, and whether the shard
+// has no further devices
+func firstDevices(c CatalogClient, n int) ([]Device, bool, error) {
+	devices := []Device{}
+	index := make(map[string]int)
+	for page := 1; ; page++ {
+		devs, total, err := c.GetDevices(page, MaxPerPage)
+		if err != nil {
+			return nil, false, err
+		}
+		// the devices of a page are unordered
+		sort.Sort(devicesByResources(devs))
+		for _, d := range devs {
+			if i, ok := index[d.Id]; ok {
+				devices[i].Resources = append(devices[i].Resources, d.Resources...)
+				continue
+			}
+			if len(devices) == n {
+				// the n-th device is complete
+				return devices, false, nil
+			}
+			index[d.Id] = len(devices)
+			devices = append(devices, d)
+		}
+		if len(devs) == 0 || page*MaxPerPage >= total {
+			return devices, true, nil
+		}
+	}
+}
+
+// Devices in the order of their resources (their ids followed by the separator)
+type devicesByResources []Device
+
+func (s devicesByResources) Len() int           { return len(s) }
+func (s devicesByResources) Less(i, j int) bool { return s[i].Id+"/" < s[j].Id+"/" }
+func (s devicesByResources) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (self *ShardedStorage) getResourcesCount() int {
+	_, total, err := self.client.GetDevices(1, 1)
+	if err != nil {
+		return 0
+	}
+	return total
+}
+
+// Quotas are enforced by the shards
+func (self *ShardedStorage) countByPrefix(prefix string) (int, int) {
+	return 0, 0
+}
+
+func (self *ShardedStorage) getResourceById(id string) (Resource, error) {
+	// resource ids are prefixed with the device id
+	parts := strings.Split(id, "/")
+	if len(parts) != 3 {
+		return Resource{}, ErrorNotFound
+	}
+	d, err := self.client.Get(parts[0] + "/" + parts[1])
+	if err != nil {
+		return Resource{}, err
+	}
+	for _, r := range d.Resources {
+		if r.Id == id {
+			return r, nil
+		}
+	}
+	return Resource{}, ErrorNotFound
+}
+
+func (self *ShardedStorage) devicesFromResources(resources []Resource) []Device {
+	devs := make([]Device, 0, len(resources))
+	index := make(map[string]int)
+	for _, r := range resources {
+		i, ok := index[r.Device]
+		if !ok {
+			d, err := self.client.Get(r.Device)
+			if err != nil {
+				continue
+			}
+			d.Resources = nil
+			index[r.Device] = len(devs)
+			devs = append(devs, *d)
+			i = len(devs) - 1
+		}
+		devs[i].Resources = append(devs[i].Resources, r)
+	}
+	return devs
+}
+
+// Registrations expire on the shards
+func (self *ShardedStorage) cleanExpired(ts time.Time) {}
+
+// Path filtering
+func (self *ShardedStorage) pathFilterDevice(path, op, value string) (Device, error) {
+	d, err := self.client.FindDevice(path, op, value)
+	if err == ErrorNotFound {
+		return Device{}, nil
+	} else if err != nil {
+		return Device{}, err
+	}
+	return *d, nil
+}
+
+func (self *ShardedStorage) pathFilterDevices(path, op, value string, page, perPage int) ([]Device, int, error) {
+	return self.client.FindDevices(path, op, value, page, perPage)
+}
+
+func (self *ShardedStorage) pathFilterResource(path, op, value string) (Resource, error) {
+	r, err := self.client.FindResource(path, op, value)
+	if err == ErrorNotFound {
+		return Resource{}, nil
+	} else if err != nil {
+		return Resource{}, err
+	}
+	return *r, nil
+}
+
+func (self *ShardedStorage) pathFilterResources(path, op, value string, page, perPage int) ([]Resource, int, error) {
+	return self.client.FindResources(path, op, value, page, perPage)
+}
@@ -0,0 +1,229 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+// W3C Web of Things Thing Description constants
+const (
+	TDPath          = "/td"
+	TDMediaType     = "application/td+json"
+	TDContextURI    = "https://www.w3.org/2022/wot/td/v1.1"
+	TDHttpNamespace = "http://www.w3.org/2011/http#"
+	TDMqttNamespace = "http://www.example.org/mqtt-binding#"
+	tdIdPrefix      = "urn:patchwork:device:"
+	tdNoSecurity    = "nosec_sc"
+)
+
+// Thing Description of a Device
+type ThingDescription struct {
+	Context             []interface{}                `json:"@context"`
+	Id                  string                       `json:"id"`
+	Title               string                       `json:"title"`
+	Description         string                       `json:"description,omitempty"`
+	Created             time.Time                    `json:"created"`
+	Modified            time.Time                    `json:"modified"`
+	SecurityDefinitions map[string]map[string]string `json:"securityDefinitions"`
+	Security            []string                     `json:"security"`
+	Properties          map[string]TDInteraction     `json:"properties,omitempty"`
+	Actions             map[string]TDInteraction     `json:"actions,omitempty"`
+	Links               []TDLink                     `json:"links,omitempty"`
+	Meta                map[string]interface{}       `json:"meta,omitempty"`
+}
+
+// Property or action affordance (derived from a Resource)
+type TDInteraction struct {
+	Title      string   `json:"title,omitempty"`
+	Type       string   `json:"@type,omitempty"`
+	ReadOnly   bool     `json:"readOnly,omitempty"`
+	WriteOnly  bool     `json:"writeOnly,omitempty"`
+	Observable bool     `json:"observable,omitempty"`
+	Forms      []TDForm `json:"forms"`
+}
+
+// Form describing how to perform an operation on an interaction
+type TDForm struct {
+	Href            string   `json:"href"`
+	ContentType     string   `json:"contentType,omitempty"`
+	Op              []string `json:"op"`
+	HttpMethod      string   `json:"htv:methodName,omitempty"`
+	MqttControlPkt  string   `json:"mqv:controlPacket,omitempty"`
+	MqttTopic       string   `json:"mqv:topic,omitempty"`
+	MqttTopicFilter string   `json:"mqv:filter,omitempty"`
+}
+
+// Link to related resources
+type TDLink struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// Converts a Device into a Thing Description
+// apiLocation: catalog api location, used to link back the catalog entry
+func (self *Device) ThingDescription(apiLocation string) ThingDescription {
+	td := ThingDescription{
+		Context: []interface{}{
+			TDContextURI,
+			map[string]string{
+				"htv": TDHttpNamespace,
+				"mqv": TDMqttNamespace,
+			},
+		},
+		Id:          tdIdPrefix + self.Id,
+		Title:       self.Name,
+		Description: self.Description,
+		Created:     self.Created,
+		Modified:    self.Updated,
+		SecurityDefinitions: map[string]map[string]string{
+			tdNoSecurity: {"scheme": "nosec"},
+		},
+		Security:   []string{tdNoSecurity},
+		Properties: make(map[string]TDInteraction),
+		Actions:    make(map[string]TDInteraction),
+		Links: []TDLink{{
+			Href: fmt.Sprintf("%v/%v", apiLocation, self.Id),
+			Rel:  "alternate",
+			Type: "application/ld+json",
+		}},
+		Meta: self.Meta,
+	}
+
+	for _, r := range self.Resources {
+		property := TDInteraction{Title: r.Name, Type: r.Type}
+		action := TDInteraction{Title: r.Name, Type: r.Type}
+		readable, writable := false, false
+
+		for _, p := range r.Protocols {
+			for _, m := range p.Methods {
+				switch strings.ToUpper(p.Type) {
+				case "REST":
+					href, _ := p.Endpoint["url"].(string)
+					switch m {
+					case "GET":
+						readable = true
+						property.Forms = append(property.Forms, tdForms(p, TDForm{Href: href, Op: []string{"readproperty"}, HttpMethod: m})...)
+					case "PUT":
+						writable = true
+						property.Forms = append(property.Forms, tdForms(p, TDForm{Href: href, Op: []string{"writeproperty"}, HttpMethod: m})...)
+					case "POST":
+						action.Forms = append(action.Forms, tdForms(p, TDForm{Href: href, Op: []string{"invokeaction"}, HttpMethod: m})...)
+					}
+				case "MQTT":
+					broker, _ := p.Endpoint["url"].(string)
+					topic, _ := p.Endpoint["topic"].(string)
+					switch m {
+					case "PUB":
+						// the device publishes its readings
+						readable = true
+						property.Observable = true
+						property.Forms = append(property.Forms, tdForms(p, TDForm{
+							Href:            tdMqttHref(broker),
+							Op:              []string{"observeproperty", "unobserveproperty"},
+							MqttControlPkt:  "subscribe",
+							MqttTopicFilter: topic,
+						})...)
+					case "SUB":
+						// the device subscribes to updates
+						writable = true
+						property.Forms = append(property.Forms, tdForms(p, TDForm{
+							Href:           tdMqttHref(broker),
+							Op:             []string{"writeproperty"},
+							MqttControlPkt: "publish",
+							MqttTopic:      topic,
+						})...)
+					}
+				}
+			}
+		}
+
+		if len(property.Forms) > 0 {
+			property.ReadOnly = readable && !writable
+			property.WriteOnly = writable && !readable
+			td.Properties[r.Name] = property
+		}
+		if len(action.Forms) > 0 {
+			td.Actions[r.Name] = action
+		}
+	}
+	return td
+}
+
+// Creates a copy of the form for each of the protocol's content types
+func tdForms(p Protocol, form TDForm) []TDForm {
+	if len(p.ContentTypes) == 0 {
+		return []TDForm{form}
+	}
+	forms := make([]TDForm, 0, len(p.ContentTypes))
+	for _, ct := range p.ContentTypes {
+		f := form
+		f.ContentType = ct
+		forms = append(forms, f)
+	}
+	return forms
+}
+
+// Converts a paho-style broker URL (tcp://, ssl://) into an MQTT URI
+func tdMqttHref(broker string) string {
+	if strings.HasPrefix(broker, "tcp://") {
+		return "mqtt://" + strings.TrimPrefix(broker, "tcp://")
+	}
+	if strings.HasPrefix(broker, "ssl://") {
+		return "mqtts://" + strings.TrimPrefix(broker, "ssl://")
+	}
+	return broker
+}
+
+// Thing Description of a single device: GET {apiLocation}/{dgwid}/{regid}/td
+func (self ReadableCatalogAPI) GetThingDescription(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	id := fmt.Sprintf("%v/%v", params["dgwid"], params["regid"])
+
+	d, err := self.catalogStorage.get(id)
+	if err == ErrorNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Device not found\n")
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error requesting the device: %s\n", err.Error())
+		return
+	}
+
+	b, _ := json.Marshal(d.ThingDescription(self.apiLocation))
+	w.Header().Set("Content-Type", TDMediaType)
+	w.Write(b)
+}
+
+// Thing Description directory: GET {apiLocation}/td returns an array of TDs
+// of the devices on the requested page
+func (self ReadableCatalogAPI) ListThingDescriptions(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	page, _ := strconv.Atoi(req.Form.Get(GetParamPage))
+	perPage, _ := strconv.Atoi(req.Form.Get(GetParamPerPage))
+	page, perPage = catalog.ValidatePagingParams(page, perPage, MaxPerPage)
+
+	devices, _, err := self.catalogStorage.getDevices(page, perPage)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error requesting the devices: %s\n", err.Error())
+		return
+	}
+
+	tds := make([]ThingDescription, 0, len(devices))
+	for _, d := range devices {
+		tds = append(tds, d.ThingDescription(self.apiLocation))
+	}
+
+	b, _ := json.Marshal(tds)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,120 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestThingDescription(t *testing.T) {
+	d := &Device{
+		Id:   "gw1/lamp",
+		Name: "lamp",
+		Ttl:  30,
+		Resources: []Resource{
+			{
+				Id:   "gw1/lamp/state",
+				Name: "state",
+				Protocols: []Protocol{
+					{
+						Type:         "REST",
+						Endpoint:     map[string]interface{}{"url": "http://gw1:8080/rest/lamp/state"},
+						Methods:      []string{"GET", "PUT"},
+						ContentTypes: []string{"application/json", "text/plain"},
+					},
+					{
+						Type:     "MQTT",
+						Endpoint: map[string]interface{}{"url": "tcp://broker:1883", "topic": "/gw1/lamp/state"},
+						Methods:  []string{"PUB"},
+					},
+				},
+			},
+			{
+				Id:   "gw1/lamp/blink",
+				Name: "blink",
+				Protocols: []Protocol{{
+					Type:     "REST",
+					Endpoint: map[string]interface{}{"url": "http://gw1:8080/rest/lamp/blink"},
+					Methods:  []string{"POST"},
+				}},
+			},
+		},
+	}
+
+	td := d.ThingDescription("/dc")
+	if td.Id != tdIdPrefix+d.Id || td.Title != d.Name {
+		t.Errorf("Unexpected TD id/title: %s/%s", td.Id, td.Title)
+	}
+
+	state, ok := td.Properties["state"]
+	if !ok {
+		t.Fatal("Resource with GET/PUT should be mapped to a property")
+	}
+	if state.ReadOnly || state.WriteOnly || !state.Observable {
+		t.Errorf("Unexpected property flags: %+v", state)
+	}
+	// 2 content types x (GET, PUT) + 1 MQTT form
+	if len(state.Forms) != 5 {
+		t.Errorf("Expected 5 forms, got %v", len(state.Forms))
+	}
+	mqttForm := state.Forms[4]
+	if mqttForm.Href != "mqtt://broker:1883" || mqttForm.MqttTopicFilter != "/gw1/lamp/state" {
+		t.Errorf("Unexpected MQTT form: %+v", mqttForm)
+	}
+
+	if _, ok := td.Actions["blink"]; !ok {
+		t.Error("Resource with POST should be mapped to an action")
+	}
+	if _, ok := td.Properties["blink"]; ok {
+		t.Error("Resource with only POST should not be mapped to a property")
+	}
+}
+
+func TestListThingDescriptionsPagesByDevice(t *testing.T) {
+	storage := NewMemoryStorage()
+	for i := 0; i < 3; i++ {
+		d := Device{Id: fmt.Sprintf("gw1/dev%d", i), Name: "dev", Ttl: 30}
+		// the first device has more resources than fit on a page
+		for j := 0; i == 0 && j < 5; j++ {
+			d.Resources = append(d.Resources, Resource{
+				Id:   fmt.Sprintf("%s/r%d", d.Id, j),
+				Name: fmt.Sprintf("r%d", j),
+				Protocols: []Protocol{{
+					Type:     "REST",
+					Endpoint: map[string]interface{}{"url": fmt.Sprintf("http://gw1:8080/rest/r%d", j)},
+					Methods:  []string{"GET"},
+				}},
+			})
+		}
+		storage.add(d)
+	}
+	api := NewReadableCatalogAPI(storage, "/dc", "", "")
+	ts := httptest.NewServer(http.HandlerFunc(api.ListThingDescriptions))
+	defer ts.Close()
+
+	for page, expected := range map[int][]string{1: {"gw1/dev0", "gw1/dev1"}, 2: {"gw1/dev2"}} {
+		res, err := http.Get(fmt.Sprintf("%s?%s=%d&%s=2", ts.URL, GetParamPage, page, GetParamPerPage))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		var tds []ThingDescription
+		err = json.NewDecoder(res.Body).Decode(&tds)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(tds) != len(expected) {
+			t.Fatalf("Expected %v TDs on page %v, got %v", len(expected), page, len(tds))
+		}
+		for i, id := range expected {
+			if tds[i].Id != tdIdPrefix+id {
+				t.Errorf("Expected %v on page %v, got %v", tdIdPrefix+id, page, tds[i].Id)
+			}
+		}
+		if page == 1 && len(tds[0].Properties) != 5 {
+			t.Errorf("Expected all 5 resources of %v, got %+v", tds[0].Id, tds[0])
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// Default time a failed endpoint is passed over after its first failure
+	DefaultFailoverBackoff = 5 * time.Second
+	// Default upper bound of the time a failed endpoint is passed over
+	DefaultFailoverMaxBackoff = 5 * time.Minute
+	// Default time the discovery of an endpoint may take
+	DefaultFailoverDiscoveryTimeout = 10 * time.Second
+)
+
+var ErrorNoEndpoint = errors.New("No catalog endpoint")
+
+// Health of a catalog endpoint
+type EndpointHealth struct {
+	Endpoint   string `json:"endpoint"`
+	Discovered bool   `json:"discovered"`
+	Healthy    bool   `json:"healthy"`
+	Failures   int    `json:"failures"`
+	LastError  string `json:"lastError,omitempty"`
+	// Time until which the failed endpoint is passed over
+	RetryAt time.Time `json:"retryAt"`
+}
+
+// Ordered list of equivalent catalog endpoints. Requests go to the first
+// endpoint in order that has not failed recently, so that they fail over to the
+// next endpoints and fail back once a preferred endpoint recovers.
+// A discovered endpoint comes after the static ones and is discovered
+// again after a failure
+type Failover struct {
+	endpoints        []string
+	serviceType      string
+	discovered       string
+	active           string
+	health           map[string]*EndpointHealth
+	backoff          time.Duration
+	maxBackoff       time.Duration
+	discovery        DiscoveryOptions
+	discover         func(ctx context.Context, serviceType string, opts DiscoveryOptions) (string, error)
+	discoveryTimeout time.Duration
+	mutex            sync.Mutex
+}
+
+// Returns the failover between the static endpoints (in order of preference)
+// and, if serviceType is not empty, an endpoint discovered using DNS-SD
+func NewFailover(endpoints []string, serviceType string) *Failover {
+	return NewDiscoveryFailover(endpoints, serviceType, DiscoveryOptions{})
+}
+
+// Returns the failover between the static endpoints and, if serviceType is
+// not empty, an endpoint of a catalog discovered using the given options
+func NewDiscoveryFailover(endpoints []string, serviceType string, opts DiscoveryOptions) *Failover {
+	f := &Failover{
+		endpoints:        append([]string{}, endpoints...),
+		serviceType:      serviceType,
+		health:           make(map[string]*EndpointHealth),
+		backoff:          DefaultFailoverBackoff,
+		maxBackoff:       DefaultFailoverMaxBackoff,
+		discovery:        opts,
+		discover:         DiscoverCatalogEndpointContext,
+		discoveryTimeout: DefaultFailoverDiscoveryTimeout,
+	}
+	for _, e := range endpoints {
+		f.health[e] = &EndpointHealth{Endpoint: e, Healthy: true}
+	}
+	return f
+}
+
+// Returns the endpoint of the last successful request ("" if none)
+func (self *Failover) Active() string {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.active
+}
+
+// Returns the health of the endpoints in order of preference
+func (self *Failover) Health() []EndpointHealth {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	health := make([]EndpointHealth, 0, len(self.health))
+	for _, e := range self.candidates() {
+		health = append(health, *self.health[e])
+	}
+	return health
+}
+
+// Calls fn with the endpoints until it succeeds and returns the endpoint used.
+// Endpoints that failed recently are tried after all others
+func (self *Failover) Do(fn func(endpoint string) error) (string, error) {
+	now := time.Now()
+	self.mutex.Lock()
+	var due, delayed []string
+	for _, e := range self.candidates() {
+		if self.health[e].RetryAt.After(now) {
+			delayed = append(delayed, e)
+		} else {
+			due = append(due, e)
+		}
+	}
+	self.mutex.Unlock()
+
+	var err error
+	for _, e := range append(due, delayed...) {
+		if err = self.try(e, fn); err == nil {
+			return e, nil
+		}
+	}
+
+	// (re-)discover an endpoint after all others failed
+	if self.serviceType != "" {
+		self.mutex.Lock()
+		discovered := self.discovered
+		self.mutex.Unlock()
+		if discovered == "" {
+			var endpoint string
+			endpoint, err = self.discoverEndpoint()
+			if err != nil {
+				return "", err
+			}
+			self.mutex.Lock()
+			self.discovered = endpoint
+			if _, ok := self.health[endpoint]; !ok {
+				self.health[endpoint] = &EndpointHealth{Endpoint: endpoint, Discovered: true, Healthy: true}
+			}
+			self.mutex.Unlock()
+			if err = self.try(endpoint, fn); err == nil {
+				return endpoint, nil
+			}
+		}
+	}
+	if err == nil {
+		err = ErrorNoEndpoint
+	}
+	return "", err
+}
+
+// Discovers an endpoint, giving up after the discovery timeout
+func (self *Failover) discoverEndpoint() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), self.discoveryTimeout)
+	defer cancel()
+
+	type result struct {
+		endpoint string
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		endpoint, err := self.discover(ctx, self.serviceType, self.discovery)
+		done <- result{endpoint, err}
+	}()
+	select {
+	case r := <-done:
+		return r.endpoint, r.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("Discovery of %s: %v", self.serviceType, ctx.Err())
+	}
+}
+
+// Calls fn with the endpoint and records the result
+func (self *Failover) try(endpoint string, fn func(endpoint string) error) error {
+	err := fn(endpoint)
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	h, ok := self.health[endpoint]
+	if !ok {
+		return err
+	}
+	if err != nil {
+		h.Healthy = false
+		h.Failures++
+		h.LastError = err.Error()
+		h.RetryAt = time.Now().Add(self.retryAfter(h.Failures))
+		if endpoint == self.discovered {
+			// discover again after a failure
+			self.discovered = ""
+			if h.Discovered {
+				delete(self.health, endpoint)
+			}
+		}
+		return err
+	}
+	h.Healthy = true
+	h.Failures = 0
+	h.LastError = ""
+	h.RetryAt = time.Time{}
+	if self.active != endpoint {
+		if self.active != "" {
+			logger.Printf("Failover.Do() Switched from %v to %v", self.active, endpoint)
+		}
+		self.active = endpoint
+	}
+	return nil
+}
+
+// Returns the endpoints in order of preference
+// WARNING: the caller must obtain the lock before calling
+func (self *Failover) candidates() []string {
+	candidates := append([]string{}, self.endpoints...)
+	if self.discovered != "" && !contains(candidates, self.discovered) {
+		candidates = append(candidates, self.discovered)
+	}
+	return candidates
+}
+
+// Returns the time a failed endpoint is passed over after the given number of failures
+// WARNING: the caller must obtain the lock before calling
+func (self *Failover) retryAfter(failures int) time.Duration {
+	d := self.backoff
+	for i := 1; i < failures && d < self.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > self.maxBackoff {
+		d = self.maxBackoff
+	}
+	return d
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
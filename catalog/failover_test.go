@@ -0,0 +1,123 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailover(t *testing.T) {
+	f := NewFailover([]string{"a", "b"}, "")
+	f.backoff = 50 * time.Millisecond
+	down := map[string]bool{}
+	tried := []string{}
+	fn := func(endpoint string) error {
+		tried = append(tried, endpoint)
+		if down[endpoint] {
+			return errors.New("unavailable")
+		}
+		return nil
+	}
+
+	if e, err := f.Do(fn); err != nil || e != "a" || f.Active() != "a" {
+		t.Fatalf("Expected the first endpoint, got %v (%v)", e, err)
+	}
+
+	// fail over to the next endpoint
+	down["a"] = true
+	if e, err := f.Do(fn); err != nil || e != "b" || f.Active() != "b" {
+		t.Fatalf("Expected a failover, got %v (%v)", e, err)
+	}
+	health := f.Health()
+	if len(health) != 2 || health[0].Healthy || health[0].Failures != 1 || !health[1].Healthy {
+		t.Errorf("Unexpected health: %+v", health)
+	}
+
+	// the failed endpoint is passed over until its backoff passes
+	down["a"] = false
+	tried = nil
+	if e, _ := f.Do(fn); e != "b" || len(tried) != 1 {
+		t.Errorf("Expected the failed endpoint to be passed over, got %v (tried %v)", e, tried)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if e, _ := f.Do(fn); e != "a" {
+		t.Errorf("Expected a failback, got %v", e)
+	}
+
+	// all endpoints down
+	down["a"], down["b"] = true, true
+	if _, err := f.Do(fn); err == nil {
+		t.Error("Expected an error with all endpoints down")
+	}
+	if _, err := NewFailover(nil, "").Do(fn); err != ErrorNoEndpoint {
+		t.Errorf("Expected ErrorNoEndpoint, got %v", err)
+	}
+}
+
+func TestFailoverDiscovery(t *testing.T) {
+	f := NewFailover([]string{"a"}, "_test._tcp")
+	discoveries := 0
+	f.discover = func(ctx context.Context, serviceType string, opts DiscoveryOptions) (string, error) {
+		discoveries++
+		return "discovered", nil
+	}
+	down := map[string]bool{"a": true}
+	fn := func(endpoint string) error {
+		if down[endpoint] {
+			return errors.New("unavailable")
+		}
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if e, err := f.Do(fn); err != nil || e != "discovered" {
+			t.Fatalf("Expected the discovered endpoint, got %v (%v)", e, err)
+		}
+	}
+	if discoveries != 1 {
+		t.Errorf("Expected a single discovery, got %v", discoveries)
+	}
+	if health := f.Health(); len(health) != 2 || !health[1].Discovered {
+		t.Errorf("Unexpected health: %+v", health)
+	}
+
+	// discovered again after a failure
+	down["discovered"] = true
+	if _, err := f.Do(fn); err == nil {
+		t.Error("Expected an error with all endpoints down")
+	}
+	if discoveries != 2 {
+		t.Errorf("Expected a new discovery after the failure, got %v", discoveries)
+	}
+}
+
+func TestFailoverDiscoveryTimeout(t *testing.T) {
+	f := NewFailover(nil, "_test._tcp")
+	f.discoveryTimeout = 50 * time.Millisecond
+	// a discovery which never returns by itself
+	release := make(chan struct{})
+	defer close(release)
+	f.discover = func(ctx context.Context, serviceType string, opts DiscoveryOptions) (string, error) {
+		<-release
+		return "discovered", nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.Do(func(endpoint string) error { return nil })
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "deadline") {
+			t.Errorf("Expected the discovery to time out, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Do did not return after the discovery timeout")
+	}
+	if f.Active() != "" {
+		t.Errorf("Expected no active endpoint, got %v", f.Active())
+	}
+}
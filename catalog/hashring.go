@@ -0,0 +1,115 @@
+package catalog
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Default number of points of a node on the ring
+const DefaultVirtualNodes = 100
+
+// Consistent hash ring placing keys on nodes.
+// Adding a node only moves keys from the existing nodes to the new one
+type HashRing struct {
+	virtualNodes int
+	hashes       []uint32 // sorted
+	owners       map[uint32]string
+	nodes        map[string]bool
+	mutex        sync.RWMutex
+}
+
+func NewHashRing(virtualNodes int) *HashRing {
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	return &HashRing{
+		virtualNodes: virtualNodes,
+		owners:       make(map[uint32]string),
+		nodes:        make(map[string]bool),
+	}
+}
+
+// Adds nodes to the ring
+func (self *HashRing) Add(nodes ...string) {
+	self.mutex.Lock()
+	for _, node := range nodes {
+		if self.nodes[node] {
+			continue
+		}
+		self.nodes[node] = true
+		for i := 0; i < self.virtualNodes; i++ {
+			h := ringHash(strconv.Itoa(i) + "#" + node)
+			// on (unlikely) collisions the smaller node name wins to keep placement deterministic
+			if owner, ok := self.owners[h]; ok {
+				if owner < node {
+					continue
+				}
+			} else {
+				self.hashes = append(self.hashes, h)
+			}
+			self.owners[h] = node
+		}
+	}
+	sort.Sort(uint32Slice(self.hashes))
+	self.mutex.Unlock()
+}
+
+// Removes a node from the ring
+func (self *HashRing) Remove(node string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if !self.nodes[node] {
+		return
+	}
+	delete(self.nodes, node)
+
+	hashes := make([]uint32, 0, len(self.hashes))
+	for _, h := range self.hashes {
+		if self.owners[h] == node {
+			delete(self.owners, h)
+			continue
+		}
+		hashes = append(hashes, h)
+	}
+	self.hashes = hashes
+}
+
+// Returns the node of the given key or an empty string if the ring is empty
+func (self *HashRing) Get(key string) string {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	if len(self.hashes) == 0 {
+		return ""
+	}
+
+	h := ringHash(key)
+	i := sort.Search(len(self.hashes), func(i int) bool { return self.hashes[i] >= h })
+	if i == len(self.hashes) {
+		i = 0
+	}
+	return self.owners[self.hashes[i]]
+}
+
+// Returns the nodes of the ring sorted by name
+func (self *HashRing) Nodes() []string {
+	self.mutex.RLock()
+	nodes := make([]string, 0, len(self.nodes))
+	for node := range self.nodes {
+		nodes = append(nodes, node)
+	}
+	self.mutex.RUnlock()
+	sort.Strings(nodes)
+	return nodes
+}
+
+func ringHash(key string) uint32 {
+	return crc32.ChecksumIEEE([]byte(key))
+}
+
+type uint32Slice []uint32
+
+func (s uint32Slice) Len() int           { return len(s) }
+func (s uint32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,53 @@
+package catalog
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHashRing(t *testing.T) {
+	ring := NewHashRing(0)
+	if ring.Get("dgw1") != "" {
+		t.Errorf("Expected no node on an empty ring")
+	}
+	ring.Add("a", "b", "c")
+
+	placement := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("dgw%d", i)
+		placement[key] = ring.Get(key)
+		counts[placement[key]]++
+	}
+	for _, node := range []string{"a", "b", "c"} {
+		if counts[node] < 500 {
+			t.Errorf("Unbalanced placement: %v", counts)
+		}
+	}
+
+	// placement is stable and only moves keys to an added node
+	ring.Add("d")
+	moved := 0
+	for key, node := range placement {
+		n := ring.Get(key)
+		if n != node {
+			if n != "d" {
+				t.Fatalf("Key %s moved from %s to %s instead of the new node", key, node, n)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 1500 {
+		t.Errorf("Expected about a quarter of the keys to move, moved %d", moved)
+	}
+
+	ring.Remove("d")
+	for key, node := range placement {
+		if ring.Get(key) != node {
+			t.Fatalf("Expected %s back on %s after removing the node", key, node)
+		}
+	}
+	if nodes := ring.Nodes(); len(nodes) != 3 || nodes[0] != "a" {
+		t.Errorf("Unexpected nodes: %v", nodes)
+	}
+}
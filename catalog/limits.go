@@ -0,0 +1,308 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+)
+
+const (
+	// JSON key of the meta objects checked against MaxMetaSize
+	metaKey = "meta"
+	// Maximum number of buckets, after which idle ones are dropped
+	// (or the least recently used one if none is idle)
+	maxBuckets = 1024
+	// RFC 6585 (missing in net/http)
+	StatusTooManyRequests = 429
+)
+
+var ErrorQuotaExceeded = errors.New("Quota exceeded")
+
+// Limits on requests to a catalog API. Zero values disable a limit
+type LimitsConfig struct {
+	// Maximum size of a request body (bytes)
+	MaxBodySize int64 `json:"maxBodySize"`
+	// Maximum nesting depth of JSON request bodies
+	MaxDepth int `json:"maxDepth"`
+	// Maximum size of each serialized meta object (bytes)
+	MaxMetaSize int `json:"maxMetaSize"`
+	// Per-owner quotas on the number of entries
+	Quota QuotaConfig `json:"quota"`
+	// Rate limits of write requests
+	RateLimit RateLimitConfig `json:"rateLimit"`
+}
+
+// Quotas on the number of entries per owner.
+// The owner of an entry is the first segment of its id (gateway id or service host),
+// which under ACLs binds the quota to the principal owning the prefix
+type QuotaConfig struct {
+	MaxDevices   int `json:"maxDevices"`
+	MaxResources int `json:"maxResources"`
+	MaxServices  int `json:"maxServices"`
+}
+
+// Token bucket rate limit of write requests per client (principal or remote host)
+type RateLimitConfig struct {
+	// Sustained requests per second
+	Rate float64 `json:"rate"`
+	// Maximum burst of requests
+	Burst int `json:"burst"`
+}
+
+func (c *LimitsConfig) Validate() error {
+	if c.MaxBodySize < 0 || c.MaxDepth < 0 || c.MaxMetaSize < 0 {
+		return fmt.Errorf("limits: negative limits are not allowed")
+	}
+	if c.Quota.MaxDevices < 0 || c.Quota.MaxResources < 0 || c.Quota.MaxServices < 0 {
+		return fmt.Errorf("limits: negative quotas are not allowed")
+	}
+	if c.RateLimit.Rate < 0 || c.RateLimit.Burst < 0 {
+		return fmt.Errorf("limits: negative rate limits are not allowed")
+	}
+	if c.RateLimit.Rate > 0 && c.RateLimit.Burst == 0 {
+		return fmt.Errorf("limits: rateLimit burst must be defined")
+	}
+	return nil
+}
+
+// Returns the owner of an entry with the given id
+func EntryOwner(id string) string {
+	if i := strings.Index(id, "/"); i >= 0 {
+		return id[:i]
+	}
+	return id
+}
+
+// Negroni middleware enforcing body size, JSON structure and rate limits on write requests
+type Limiter struct {
+	config  LimitsConfig
+	buckets map[string]*tokenBucket
+	mutex   sync.Mutex
+}
+
+func NewLimiter(conf LimitsConfig) *Limiter {
+	return &Limiter{
+		config:  conf,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (self *Limiter) ServeHTTP(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS":
+		next(w, req)
+		return
+	}
+
+	if self.config.RateLimit.Rate > 0 {
+		if wait, ok := self.allow(clientKey(req), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+			limitError(w, StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+	}
+
+	if req.Body != nil && (self.config.MaxBodySize > 0 || self.config.MaxDepth > 0 || self.config.MaxMetaSize > 0) {
+		if self.config.MaxBodySize > 0 && req.ContentLength > self.config.MaxBodySize {
+			limitError(w, http.StatusRequestEntityTooLarge, "Request body is too large")
+			return
+		}
+		body, err := self.readBody(req.Body)
+		req.Body.Close()
+		if err != nil {
+			limitError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if err = self.checkStructure(body); err != nil {
+			limitError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	next(w, req)
+}
+
+// Reads the body up to MaxBodySize
+func (self *Limiter) readBody(r io.Reader) ([]byte, error) {
+	if self.config.MaxBodySize <= 0 {
+		return ioutil.ReadAll(r)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r, self.config.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > self.config.MaxBodySize {
+		return nil, fmt.Errorf("Request body exceeds %d bytes", self.config.MaxBodySize)
+	}
+	return body, nil
+}
+
+// Checks nesting depth and meta sizes of JSON bodies. Other bodies are passed as is
+func (self *Limiter) checkStructure(body []byte) error {
+	if self.config.MaxDepth <= 0 && self.config.MaxMetaSize <= 0 {
+		return nil
+	}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return nil
+	}
+	if self.config.MaxDepth > 0 && jsonDepth(trimmed) > self.config.MaxDepth {
+		return fmt.Errorf("Request body exceeds nesting depth of %d", self.config.MaxDepth)
+	}
+	if self.config.MaxMetaSize > 0 {
+		var v interface{}
+		if err := json.Unmarshal(trimmed, &v); err != nil {
+			// malformed bodies are reported by the API
+			return nil
+		}
+		return checkMetaSize(v, self.config.MaxMetaSize)
+	}
+	return nil
+}
+
+// Returns the maximum nesting depth of JSON objects and arrays
+// (without decoding, so that deep documents are rejected cheaply)
+func jsonDepth(data []byte) int {
+	depth, max := 0, 0
+	inString, escaped := false, false
+	for _, c := range data {
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return max
+}
+
+// Checks serialized size of all meta objects in a decoded JSON document
+func checkMetaSize(v interface{}, max int) error {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			if k == metaKey {
+				b, _ := json.Marshal(e)
+				if len(b) > max {
+					return fmt.Errorf("meta exceeds %d bytes", max)
+				}
+			}
+			if err := checkMetaSize(e, max); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, e := range t {
+			if err := checkMetaSize(e, max); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Rate limiting key of the client: authenticated principal or remote host
+func clientKey(req *http.Request) string {
+	if p := auth.PrincipalFromRequest(req); p != nil {
+		return "principal:" + p.Name
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "host:" + host
+}
+
+// Takes a token from the bucket of the client. Returns the time until
+// the next token is available if the bucket is empty
+func (self *Limiter) allow(key string, now time.Time) (time.Duration, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	b, ok := self.buckets[key]
+	if !ok {
+		if len(self.buckets) >= maxBuckets {
+			self.dropIdleBuckets(now)
+		}
+		if len(self.buckets) >= maxBuckets {
+			self.dropLeastRecentBucket()
+		}
+		b = &tokenBucket{tokens: float64(self.config.RateLimit.Burst), last: now}
+		self.buckets[key] = b
+	}
+	return b.take(now, self.config.RateLimit.Rate, float64(self.config.RateLimit.Burst))
+}
+
+// Drops buckets which have been refilled completely
+func (self *Limiter) dropIdleBuckets(now time.Time) {
+	full := time.Duration(float64(self.config.RateLimit.Burst) / self.config.RateLimit.Rate * float64(time.Second))
+	for k, b := range self.buckets {
+		if now.Sub(b.last) >= full {
+			delete(self.buckets, k)
+		}
+	}
+}
+
+// Drops the bucket used least recently
+func (self *Limiter) dropLeastRecentBucket() {
+	var (
+		oldest string
+		last   time.Time
+	)
+	for k, b := range self.buckets {
+		if oldest == "" || b.last.Before(last) {
+			oldest, last = k, b.last
+		}
+	}
+	delete(self.buckets, oldest)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (self *tokenBucket) take(now time.Time, rate, burst float64) (time.Duration, bool) {
+	self.tokens += now.Sub(self.last).Seconds() * rate
+	if self.tokens > burst {
+		self.tokens = burst
+	}
+	self.last = now
+	if self.tokens < 1 {
+		return time.Duration((1 - self.tokens) / rate * float64(time.Second)), false
+	}
+	self.tokens--
+	return 0, true
+}
+
+func limitError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "%s\n", msg)
+}
@@ -0,0 +1,91 @@
+package catalog
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func doLimited(l *Limiter, method, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/dc/", strings.NewReader(body))
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, req, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	return w
+}
+
+func TestLimiterBody(t *testing.T) {
+	l := NewLimiter(LimitsConfig{MaxBodySize: 64, MaxDepth: 3, MaxMetaSize: 16})
+
+	if w := doLimited(l, "POST", `{"id":"a/b","meta":{"k":"v"}}`); w.Code != http.StatusCreated {
+		t.Errorf("Expected request to pass, got %v", w.Code)
+	}
+	if w := doLimited(l, "POST", `{"id":"`+strings.Repeat("x", 64)+`"}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large body, got %v", w.Code)
+	}
+	if w := doLimited(l, "PUT", `{"meta":{"a":{"b":{"c":1}}}}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a deep body, got %v", w.Code)
+	}
+	if w := doLimited(l, "PUT", `{"meta":{"k":"`+strings.Repeat("v", 20)+`"}}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large meta, got %v", w.Code)
+	}
+	// brackets in strings do not count
+	if w := doLimited(l, "PUT", `{"name":"[[[{{{"}`); w.Code != http.StatusCreated {
+		t.Errorf("Expected request to pass, got %v", w.Code)
+	}
+	// reads are not limited
+	if w := doLimited(l, "GET", strings.Repeat("x", 100)); w.Code != http.StatusCreated {
+		t.Errorf("Expected GET to pass, got %v", w.Code)
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	l := NewLimiter(LimitsConfig{RateLimit: RateLimitConfig{Rate: 1, Burst: 2}})
+
+	for i := 0; i < 2; i++ {
+		if w := doLimited(l, "POST", "{}"); w.Code != http.StatusCreated {
+			t.Fatalf("Expected request %d within burst to pass, got %v", i, w.Code)
+		}
+	}
+	w := doLimited(l, "POST", "{}")
+	if w.Code != StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %v", w.Code)
+	}
+
+	// bucket refills with the configured rate
+	now := time.Now()
+	if _, ok := l.allow("host:10.0.0.2", now); !ok {
+		t.Error("Expected new client to be allowed")
+	}
+	l.allow("host:10.0.0.2", now)
+	if _, ok := l.allow("host:10.0.0.2", now); ok {
+		t.Error("Expected empty bucket")
+	}
+	if _, ok := l.allow("host:10.0.0.2", now.Add(1100*time.Millisecond)); !ok {
+		t.Error("Expected refilled bucket")
+	}
+}
+
+func TestLimiterMaxBuckets(t *testing.T) {
+	l := NewLimiter(LimitsConfig{RateLimit: RateLimitConfig{Rate: 1, Burst: 2}})
+
+	// no bucket refills while the clients are active
+	now := time.Now()
+	for i := 0; i < 2*maxBuckets; i++ {
+		l.allow(fmt.Sprintf("host:%d", i), now.Add(time.Duration(i)*time.Microsecond))
+	}
+	if n := len(l.buckets); n > maxBuckets {
+		t.Errorf("Expected at most %d buckets, got %d", maxBuckets, n)
+	}
+	if _, ok := l.buckets[fmt.Sprintf("host:%d", 2*maxBuckets-1)]; !ok {
+		t.Error("Expected the bucket of the most recent client to be kept")
+	}
+	if _, ok := l.buckets["host:0"]; ok {
+		t.Error("Expected the bucket of the least recent client to be dropped")
+	}
+}
@@ -0,0 +1,176 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Link is a single link-value of a CoRE Link Format document (RFC 6690)
+type Link struct {
+	Target string
+	Params map[string]string
+}
+
+// Parses a CoRE Link Format document into a slice of links
+func ParseLinkFormat(data string) ([]Link, error) {
+	links := []Link{}
+	s := strings.TrimSpace(data)
+
+	for len(s) > 0 {
+		if s[0] != '<' {
+			return nil, fmt.Errorf("Invalid link-value: expected '<' at %q", s)
+		}
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return nil, errors.New("Invalid link-value: missing '>'")
+		}
+		link := Link{
+			Target: s[1:end],
+			Params: make(map[string]string),
+		}
+		s = strings.TrimSpace(s[end+1:])
+
+		// link-params
+		for len(s) > 0 && s[0] == ';' {
+			s = strings.TrimSpace(s[1:])
+			i := strings.IndexAny(s, "=;,")
+			if i < 0 {
+				i = len(s)
+			}
+			name := strings.TrimSpace(s[:i])
+			if name == "" {
+				return nil, fmt.Errorf("Invalid link-param in link <%s>", link.Target)
+			}
+			s = strings.TrimSpace(s[i:])
+
+			value := ""
+			if len(s) > 0 && s[0] == '=' {
+				s = strings.TrimSpace(s[1:])
+				var err error
+				value, s, err = parseLinkParamValue(s)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if v, ok := link.Params[name]; ok && v != "" {
+				// repeated parameters are merged as a space-separated list
+				value = v + " " + value
+			}
+			link.Params[name] = value
+			s = strings.TrimSpace(s)
+		}
+		links = append(links, link)
+
+		if len(s) == 0 {
+			break
+		}
+		if s[0] != ',' {
+			return nil, fmt.Errorf("Invalid link-value list: unexpected %q", s)
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+	return links, nil
+}
+
+// Parses a token or a quoted-string, returns the value and the remainder
+func parseLinkParamValue(s string) (string, string, error) {
+	if len(s) > 0 && s[0] == '"' {
+		var b []byte
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				if i+1 < len(s) {
+					i++
+					b = append(b, s[i])
+				}
+			case '"':
+				return string(b), s[i+1:], nil
+			default:
+				b = append(b, s[i])
+			}
+		}
+		return "", "", errors.New("Invalid link-param: unterminated quoted-string")
+	}
+	i := strings.IndexAny(s, ";,")
+	if i < 0 {
+		i = len(s)
+	}
+	return strings.TrimSpace(s[:i]), s[i:], nil
+}
+
+// Serializes the link into CoRE Link Format. Parameters are sorted by name.
+func (l Link) String() string {
+	names := make([]string, 0, len(l.Params))
+	for k := range l.Params {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	parts := []string{"<" + l.Target + ">"}
+	for _, k := range names {
+		v := l.Params[k]
+		if v == "" {
+			parts = append(parts, k)
+		} else if isLinkToken(v) {
+			parts = append(parts, k+"="+v)
+		} else {
+			parts = append(parts, k+"="+quoteLinkParam(v))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// Serializes a slice of links into a CoRE Link Format document
+func FormatLinks(links []Link) string {
+	parts := make([]string, 0, len(links))
+	for _, l := range links {
+		parts = append(parts, l.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// Checks if a link matches the given query filter (RFC 6690, section 4.1).
+// A value ending with '*' is matched as a prefix.
+func (l Link) Matches(name, value string) bool {
+	var v string
+	if name == "href" {
+		v = l.Target
+	} else {
+		var ok bool
+		v, ok = l.Params[name]
+		if !ok {
+			return false
+		}
+	}
+	return MatchLinkParam(v, value)
+}
+
+// Matches a link param value (possibly a space-separated list) against
+// a query value. A query value ending with '*' is matched as a prefix.
+func MatchLinkParam(v, query string) bool {
+	prefix := strings.HasSuffix(query, "*")
+	query = strings.TrimSuffix(query, "*")
+	for _, p := range append(strings.Fields(v), v) {
+		if p == query || (prefix && strings.HasPrefix(p, query)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLinkToken(s string) bool {
+	for _, c := range s {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+func quoteLinkParam(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	return "\"" + s + "\""
+}
@@ -0,0 +1,21 @@
+package catalog
+
+import (
+	"testing"
+)
+
+func TestParseLinkFormat(t *testing.T) {
+	links, err := ParseLinkFormat(`</a/b>;rt="x y";title="c,d;e",</c>;obs;ct=0`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(links) != 2 {
+		t.Fatalf("Expected 2 links, got %v", len(links))
+	}
+	if links[0].Params["title"] != "c,d;e" || !links[0].Matches("rt", "y") {
+		t.Errorf("Unexpected params: %v", links[0].Params)
+	}
+	if _, ok := links[1].Params["obs"]; !ok || links[1].Params["ct"] != "0" {
+		t.Errorf("Unexpected params: %v", links[1].Params)
+	}
+}
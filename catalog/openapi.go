@@ -0,0 +1,183 @@
+package catalog
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	OpenAPIVersion   = "3.0.3"
+	OpenAPILocation  = "/openapi.json"
+	OpenAPIMediaType = "application/vnd.oai.openapi+json;version=3.0"
+)
+
+// OpenAPI 3 document describing a RESTful API
+type OpenAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components *OpenAPIComponents         `json:"components,omitempty"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Operations of a path by lower-case HTTP method
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+type OpenAPIOperation struct {
+	OperationId string                     `json:"operationId,omitempty"`
+	Summary     string                     `json:"summary,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Name        string        `json:"name"`
+	In          string        `json:"in"`
+	Description string        `json:"description,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+	Schema      OpenAPISchema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required,omitempty"`
+	Content  map[string]OpenAPIMediaItem `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaItem `json:"content,omitempty"`
+}
+
+type OpenAPIMediaItem struct {
+	Schema OpenAPISchema `json:"schema,omitempty"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]OpenAPISchema `json:"schemas,omitempty"`
+}
+
+// JSON schema (OpenAPI flavour)
+type OpenAPISchema map[string]interface{}
+
+// Creates an empty document
+func NewOpenAPIDocument(title, description, version string) *OpenAPIDocument {
+	return &OpenAPIDocument{
+		OpenAPI: OpenAPIVersion,
+		Info: OpenAPIInfo{
+			Title:       title,
+			Description: description,
+			Version:     version,
+		},
+		Paths: make(map[string]OpenAPIPathItem),
+	}
+}
+
+// Adds an operation to the document. Method is an HTTP method (e.g. "GET")
+func (self *OpenAPIDocument) AddOperation(path, method string, op *OpenAPIOperation) {
+	item, ok := self.Paths[path]
+	if !ok {
+		item = make(OpenAPIPathItem)
+		self.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+// Adds a named schema to components
+func (self *OpenAPIDocument) AddSchema(name string, schema OpenAPISchema) {
+	if self.Components == nil {
+		self.Components = &OpenAPIComponents{Schemas: make(map[string]OpenAPISchema)}
+	}
+	self.Components.Schemas[name] = schema
+}
+
+// Merges paths and schemas of other document into this one
+func (self *OpenAPIDocument) Merge(other *OpenAPIDocument) {
+	for path, item := range other.Paths {
+		for method, op := range item {
+			self.AddOperation(path, method, op)
+		}
+	}
+	if other.Components != nil {
+		for name, schema := range other.Components.Schemas {
+			self.AddSchema(name, schema)
+		}
+	}
+}
+
+// Serves the given document
+func NewOpenAPIHandler(doc *OpenAPIDocument) http.HandlerFunc {
+	b, _ := json.Marshal(doc)
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", OpenAPIMediaType)
+		w.Write(b)
+	}
+}
+
+// Reference to a schema in components
+func OpenAPISchemaRef(name string) OpenAPISchema {
+	return OpenAPISchema{"$ref": "#/components/schemas/" + name}
+}
+
+// Required path parameter of type string
+func OpenAPIPathParameter(name, description string) OpenAPIParameter {
+	return OpenAPIParameter{
+		Name:        name,
+		In:          "path",
+		Description: description,
+		Required:    true,
+		Schema:      OpenAPISchema{"type": "string"},
+	}
+}
+
+// Paging query parameters
+func OpenAPIPagingParameters(pageParam, perPageParam string, maxPerPage int) []OpenAPIParameter {
+	return []OpenAPIParameter{
+		{
+			Name:        pageParam,
+			In:          "query",
+			Description: "Page of the collection (starting from 1)",
+			Schema:      OpenAPISchema{"type": "integer", "minimum": 1, "default": 1},
+		},
+		{
+			Name:        perPageParam,
+			In:          "query",
+			Description: "Number of entries per page",
+			Schema:      OpenAPISchema{"type": "integer", "minimum": 1, "maximum": maxPerPage, "default": maxPerPage},
+		},
+	}
+}
+
+// Path filtering parameters ({type}/{path}/{op}/{value})
+func OpenAPIFilterParameters(types []string) []OpenAPIParameter {
+	ftype := OpenAPIPathParameter("type", "Type of the returned entries")
+	ftype.Schema = OpenAPISchema{"type": "string", "enum": types}
+	fop := OpenAPIPathParameter("op", "Filter operation")
+	fop.Schema = OpenAPISchema{"type": "string", "enum": []string{FOpEquals, FOpPrefix, FOpSuffix, FOpContains}}
+	return []OpenAPIParameter{
+		ftype,
+		OpenAPIPathParameter("path", "Dot-separated path in the entry (e.g. meta.serviceType)"),
+		fop,
+		OpenAPIPathParameter("value", "Value to match"),
+	}
+}
+
+// Response with a body of the given media types and schema
+func OpenAPIContentResponse(description string, schema OpenAPISchema, mediaTypes ...string) OpenAPIResponse {
+	content := make(map[string]OpenAPIMediaItem, len(mediaTypes))
+	for _, mt := range mediaTypes {
+		content[mt] = OpenAPIMediaItem{Schema: schema}
+	}
+	return OpenAPIResponse{Description: description, Content: content}
+}
+
+// Response without body (or with a plain text error message)
+func OpenAPITextResponse(description string) OpenAPIResponse {
+	return OpenAPIResponse{Description: description}
+}
@@ -0,0 +1,14 @@
+package registrar
+
+const (
+	// Location of the registrations status endpoint in the daemons
+	DefaultLocation = "/registrations"
+
+	// Default backoff after the first failed attempt (seconds)
+	defaultMinBackoff = 1
+	// Default upper bound of the backoff (seconds)
+	defaultMaxBackoff = 60
+	// Timeout of the requests of catalog registrations (seconds)
+	RequestTimeout = 10
+	loggerPrefix   = "[registrar] "
+)
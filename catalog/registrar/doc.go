@@ -0,0 +1,5 @@
+// Package catalog/registrar keeps many device and service registrations alive
+// in many catalogs from a single scheduler. Failed registrations are retried
+// with jittered exponential backoff and the status of every registration is
+// reported to be exposed by the daemons.
+package registrar
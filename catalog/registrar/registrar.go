@@ -0,0 +1,296 @@
+package registrar
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+// Entry kept registered in a catalog by a Registrar
+type Registration interface {
+	// Id of the entry
+	Id() string
+	// Catalog the entry is registered in (e.g. its endpoint)
+	Catalog() string
+	// Ttl of the entry (seconds). Entries with ttl <= 0 are registered once
+	Ttl() int
+	// Adds or updates the entry in the catalog
+	Register() error
+	// Removes the entry from the catalog
+	Unregister() error
+}
+
+// Registration in a catalog with several equivalent endpoints
+type FailoverRegistration interface {
+	Registration
+	// Endpoint the entry was last registered at
+	Endpoint() string
+	// Health of the catalog endpoints
+	Health() []catalog.EndpointHealth
+}
+
+// Status of a registration
+type Status struct {
+	Id             string    `json:"id"`
+	Catalog        string    `json:"catalog"`
+	Registered     bool      `json:"registered"`
+	LastRegistered time.Time `json:"lastRegistered"`
+	Failures       int       `json:"failures"`
+	LastError      string    `json:"lastError,omitempty"`
+	// Time of the next attempt (zero if none is scheduled)
+	Next time.Time `json:"next"`
+	// Endpoint in use and health of the endpoints of a FailoverRegistration
+	Endpoint  string                   `json:"endpoint,omitempty"`
+	Endpoints []catalog.EndpointHealth `json:"endpoints,omitempty"`
+}
+
+type entry struct {
+	reg    Registration
+	status Status
+	busy   bool // an attempt is in progress
+}
+
+// Keeps registrations alive in their catalogs. Registrations are scheduled
+// by a single routine: they are renewed before their ttl expires and failed
+// attempts are retried with jittered exponential backoff
+type Registrar struct {
+	entries    map[string]*entry
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	keepalive  func(ttl int) time.Duration
+	random     *rand.Rand
+	// wakes up the scheduler (buffered, sends never block)
+	changed  chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	inflight sync.WaitGroup
+	mutex    sync.Mutex
+}
+
+func NewRegistrar() *Registrar {
+	return &Registrar{
+		entries:    make(map[string]*entry),
+		minBackoff: defaultMinBackoff * time.Second,
+		maxBackoff: defaultMaxBackoff * time.Second,
+		keepalive:  catalog.KeepAliveDuration,
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		changed:    make(chan struct{}, 1),
+	}
+}
+
+func key(catalog, id string) string {
+	return catalog + " " + id
+}
+
+// Adds the registration (replacing one of the same entry and catalog).
+// It is registered at once if the registrar is running
+func (self *Registrar) Add(reg Registration) {
+	self.mutex.Lock()
+	self.entries[key(reg.Catalog(), reg.Id())] = &entry{
+		reg: reg,
+		status: Status{
+			Id:      reg.Id(),
+			Catalog: reg.Catalog(),
+			Next:    time.Now(),
+		},
+	}
+	self.mutex.Unlock()
+	self.notify()
+}
+
+// Removes the registration and unregisters its entry from the catalog
+func (self *Registrar) Remove(catalog, id string) error {
+	self.mutex.Lock()
+	e, ok := self.entries[key(catalog, id)]
+	delete(self.entries, key(catalog, id))
+	self.mutex.Unlock()
+	if !ok || !e.status.Registered {
+		return nil
+	}
+	return e.reg.Unregister()
+}
+
+// Starts keeping the registrations alive
+func (self *Registrar) Start() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.stop != nil {
+		return
+	}
+	// (re-)register the entries unregistered by Stop
+	now := time.Now()
+	for _, e := range self.entries {
+		if !e.status.Registered {
+			e.status.Next = now
+		}
+	}
+	self.stop = make(chan struct{})
+	self.done = make(chan struct{})
+	go self.run(self.stop, self.done)
+}
+
+// Stops keeping the registrations alive and unregisters all entries
+func (self *Registrar) Stop() {
+	self.mutex.Lock()
+	stop, done := self.stop, self.done
+	self.stop = nil
+	self.mutex.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+	self.inflight.Wait()
+
+	self.mutex.Lock()
+	var wg sync.WaitGroup
+	for _, e := range self.entries {
+		if !e.status.Registered {
+			continue
+		}
+		wg.Add(1)
+		go func(reg Registration) {
+			defer wg.Done()
+			err := reg.Unregister()
+			if err != nil {
+				logger.Printf("Registrar.Stop() Error removing %v from %v: %v", reg.Id(), reg.Catalog(), err)
+			}
+		}(e.reg)
+		e.status.Registered = false
+		e.status.Next = time.Time{}
+	}
+	self.mutex.Unlock()
+	wg.Wait()
+}
+
+// Returns the status of all registrations ordered by catalog and id
+func (self *Registrar) Status() []Status {
+	self.mutex.Lock()
+	keys := make([]string, 0, len(self.entries))
+	for k := range self.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	statuses := make([]Status, 0, len(keys))
+	regs := make([]Registration, 0, len(keys))
+	for _, k := range keys {
+		statuses = append(statuses, self.entries[k].status)
+		regs = append(regs, self.entries[k].reg)
+	}
+	self.mutex.Unlock()
+
+	for i, reg := range regs {
+		if f, ok := reg.(FailoverRegistration); ok {
+			statuses[i].Endpoint = f.Endpoint()
+			statuses[i].Endpoints = f.Health()
+		}
+	}
+	return statuses
+}
+
+// Responds with the status of all registrations
+func (self *Registrar) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b, _ := json.Marshal(self.Status())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (self *Registrar) notify() {
+	select {
+	case self.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Schedules the due registrations until stopped
+func (self *Registrar) run(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		wait := time.Hour
+		now := time.Now()
+		self.mutex.Lock()
+		for _, e := range self.entries {
+			if e.busy || e.status.Next.IsZero() {
+				continue
+			}
+			if d := e.status.Next.Sub(now); d > 0 {
+				if d < wait {
+					wait = d
+				}
+				continue
+			}
+			e.busy = true
+			self.inflight.Add(1)
+			go self.attempt(e)
+		}
+		self.mutex.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-self.changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// Registers the entry and schedules the next attempt
+func (self *Registrar) attempt(e *entry) {
+	defer self.inflight.Done()
+	err := e.reg.Register()
+
+	now := time.Now()
+	self.mutex.Lock()
+	e.busy = false
+	if current, ok := self.entries[key(e.status.Catalog, e.status.Id)]; current != e {
+		// removed or replaced during the attempt: the entry is unregistered
+		// if removed only, a replacement registers it again
+		self.mutex.Unlock()
+		if err == nil && !ok {
+			e.reg.Unregister()
+		}
+		return
+	}
+	if err == nil {
+		if !e.status.Registered || e.status.Failures > 0 {
+			logger.Printf("Registrar.attempt() Registered %v in %v", e.status.Id, e.status.Catalog)
+		}
+		e.status.Registered = true
+		e.status.LastRegistered = now
+		e.status.Failures = 0
+		e.status.LastError = ""
+		e.status.Next = time.Time{}
+		if ttl := e.reg.Ttl(); ttl > 0 {
+			e.status.Next = now.Add(self.keepalive(ttl))
+		}
+	} else {
+		e.status.Failures++
+		e.status.LastError = err.Error()
+		e.status.Next = now.Add(self.backoff(e.status.Failures))
+		logger.Printf("Registrar.attempt() Error registering %v in %v (attempt %d): %v", e.status.Id, e.status.Catalog, e.status.Failures, err)
+	}
+	self.mutex.Unlock()
+	self.notify()
+}
+
+// Returns the jittered backoff after the given number of failures
+// WARNING: the caller must obtain the lock before calling
+func (self *Registrar) backoff(failures int) time.Duration {
+	d := self.minBackoff
+	for i := 1; i < failures && d < self.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > self.maxBackoff {
+		d = self.maxBackoff
+	}
+	// between half and the full backoff
+	return d/2 + time.Duration(self.random.Int63n(int64(d/2)+1))
+}
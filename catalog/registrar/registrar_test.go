@@ -0,0 +1,268 @@
+package registrar
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/discovery"
+)
+
+// Registration counting the calls and failing the first attempts
+type fakeRegistration struct {
+	id, catalog  string
+	ttl          int
+	failures     int
+	registered   int
+	unregistered int
+	// blocks the attempts until closed (if set)
+	block chan struct{}
+	mutex sync.Mutex
+}
+
+func (self *fakeRegistration) Id() string      { return self.id }
+func (self *fakeRegistration) Catalog() string { return self.catalog }
+func (self *fakeRegistration) Ttl() int        { return self.ttl }
+
+func (self *fakeRegistration) Register() error {
+	if self.block != nil {
+		<-self.block
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.failures > 0 {
+		self.failures--
+		return errors.New("catalog unavailable")
+	}
+	self.registered++
+	return nil
+}
+
+func (self *fakeRegistration) Unregister() error {
+	self.mutex.Lock()
+	self.unregistered++
+	self.mutex.Unlock()
+	return nil
+}
+
+func (self *fakeRegistration) counts() (int, int) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.registered, self.unregistered
+}
+
+func newTestRegistrar() *Registrar {
+	r := NewRegistrar()
+	r.minBackoff = 10 * time.Millisecond
+	r.maxBackoff = 20 * time.Millisecond
+	r.keepalive = func(ttl int) time.Duration {
+		return time.Duration(ttl) * 10 * time.Millisecond
+	}
+	return r
+}
+
+// Waits until cond holds or fails the test
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %v", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRegistrarKeepalive(t *testing.T) {
+	r := newTestRegistrar()
+	reg := &fakeRegistration{id: "s1", catalog: "sc1", ttl: 1, failures: 2}
+	once := &fakeRegistration{id: "s2", catalog: "sc1"}
+	r.Add(reg)
+	r.Add(once)
+	r.Start()
+
+	// registered after the failed attempts and then renewed
+	waitFor(t, "the renewals", func() bool {
+		n, _ := reg.counts()
+		return n >= 3
+	})
+	statuses := r.Status()
+	if len(statuses) != 2 || statuses[0].Id != "s1" || !statuses[0].Registered || statuses[0].Failures != 0 {
+		t.Errorf("Unexpected status: %+v", statuses)
+	}
+	if n, _ := once.counts(); n != 1 || !statuses[1].Next.IsZero() {
+		t.Errorf("Expected an entry without ttl to be registered once, got %v (next %v)", n, statuses[1].Next)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", DefaultLocation, nil))
+	var served []Status
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil || len(served) != 2 {
+		t.Errorf("Unexpected status response: %v (%v)", w.Body.String(), err)
+	}
+
+	r.Stop()
+	if _, n := reg.counts(); n != 1 {
+		t.Errorf("Expected the entry to be unregistered on stop, got %v", n)
+	}
+	if _, n := once.counts(); n != 1 {
+		t.Errorf("Expected the entry to be unregistered on stop, got %v", n)
+	}
+	if statuses := r.Status(); statuses[0].Registered {
+		t.Errorf("Expected unregistered entries after stop: %+v", statuses)
+	}
+}
+
+func TestRegistrarFailures(t *testing.T) {
+	r := newTestRegistrar()
+	reg := &fakeRegistration{id: "s1", catalog: "sc1", ttl: 100, failures: 1000}
+	r.Add(reg)
+	r.Start()
+	defer r.Stop()
+
+	waitFor(t, "the retries", func() bool {
+		return r.Status()[0].Failures >= 3
+	})
+	s := r.Status()[0]
+	if s.Registered || s.LastError == "" || s.Next.IsZero() {
+		t.Errorf("Unexpected status: %+v", s)
+	}
+
+	if err := r.Remove("sc1", "s1"); err != nil {
+		t.Fatalf("Unexpected error on remove: %v", err)
+	}
+	if len(r.Status()) != 0 {
+		t.Errorf("Expected no registrations after remove")
+	}
+	if _, n := reg.counts(); n != 0 {
+		t.Errorf("Expected an unregistered entry not to be removed from the catalog, got %v", n)
+	}
+}
+
+func TestRegistrarRemove(t *testing.T) {
+	r := newTestRegistrar()
+	r.Start()
+	defer r.Stop()
+
+	// entries added at runtime are registered at once
+	reg := &fakeRegistration{id: "d1", catalog: "dc1", ttl: 100}
+	r.Add(reg)
+	waitFor(t, "the registration", func() bool {
+		n, _ := reg.counts()
+		return n == 1
+	})
+	waitFor(t, "the status", func() bool {
+		return r.Status()[0].Registered
+	})
+
+	if err := r.Remove("dc1", "d1"); err != nil {
+		t.Fatalf("Unexpected error on remove: %v", err)
+	}
+	if _, n := reg.counts(); n != 1 {
+		t.Errorf("Expected the removed entry to be unregistered, got %v", n)
+	}
+}
+
+func TestRegistrarChangeDuringAttempt(t *testing.T) {
+	r := newTestRegistrar()
+	r.Start()
+	defer r.Stop()
+
+	busy := func() bool {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		e, ok := r.entries[key("dc1", "d1")]
+		return ok && e.busy
+	}
+
+	// an entry replaced during an attempt is not unregistered by it
+	old := &fakeRegistration{id: "d1", catalog: "dc1", ttl: 100, block: make(chan struct{})}
+	r.Add(old)
+	waitFor(t, "the attempt", busy)
+	replacement := &fakeRegistration{id: "d1", catalog: "dc1", ttl: 100}
+	r.Add(replacement)
+	close(old.block)
+	waitFor(t, "the replacement", func() bool {
+		n, _ := replacement.counts()
+		return n == 1
+	})
+	if _, n := old.counts(); n != 0 {
+		t.Errorf("Expected the replaced entry to stay registered, got %v unregistrations", n)
+	}
+
+	// an entry removed during an attempt is unregistered by it
+	removed := &fakeRegistration{id: "d1", catalog: "dc1", ttl: 100, block: make(chan struct{})}
+	r.Add(removed)
+	waitFor(t, "the attempt", busy)
+	if err := r.Remove("dc1", "d1"); err != nil {
+		t.Fatalf("Unexpected error on remove: %v", err)
+	}
+	close(removed.block)
+	waitFor(t, "the unregistration", func() bool {
+		_, n := removed.counts()
+		return n == 1
+	})
+}
+
+func TestRegistrarBackoff(t *testing.T) {
+	r := NewRegistrar()
+	for failures, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: time.Minute} {
+		for i := 0; i < 10; i++ {
+			if b := r.backoff(failures); b < max/2 || b > max {
+				t.Errorf("Backoff after %d failures out of [%v, %v]: %v", failures, max/2, max, b)
+			}
+		}
+	}
+}
+
+// Client of an endpoint which can be taken down
+type fakeEntryClient struct {
+	down         bool
+	registered   int
+	unregistered int
+}
+
+func (self *fakeEntryClient) Register() error {
+	if self.down {
+		return errors.New("endpoint unavailable")
+	}
+	self.registered++
+	return nil
+}
+
+func (self *fakeEntryClient) Unregister() error {
+	self.unregistered++
+	return nil
+}
+
+func TestCatalogRegistration(t *testing.T) {
+	clients := map[string]*fakeEntryClient{"a": {}, "b": {}}
+	name, failover := CatalogFailover([]string{"a", "b"}, nil, "_pw-dc._tcp", discovery.Requirements{})
+	var reg FailoverRegistration = NewCatalogRegistration("dgw1/d1", 60, name, failover, func(endpoint string) EntryClient {
+		return clients[endpoint]
+	})
+	if reg.Catalog() != "a,b" || reg.Id() != "dgw1/d1" || reg.Ttl() != 60 {
+		t.Errorf("Unexpected registration: %v %v %v", reg.Catalog(), reg.Id(), reg.Ttl())
+	}
+
+	if err := reg.Register(); err != nil || reg.Endpoint() != "a" || clients["a"].registered != 1 {
+		t.Fatalf("Expected the entry at the first endpoint, got %v (%v)", reg.Endpoint(), err)
+	}
+	// registered again at the next endpoint
+	clients["a"].down = true
+	if err := reg.Register(); err != nil || reg.Endpoint() != "b" || clients["b"].registered != 1 {
+		t.Fatalf("Expected the entry at the second endpoint, got %v (%v)", reg.Endpoint(), err)
+	}
+	// removed from all endpoints it was registered at
+	if err := reg.Unregister(); err != nil || clients["a"].unregistered != 1 || clients["b"].unregistered != 1 {
+		t.Errorf("Expected the entry to be removed from both endpoints (%v)", err)
+	}
+
+	name, _ = CatalogFailover([]string{"a"}, &catalog.DiscoveryOptions{}, "_pw-dc._tcp", discovery.Requirements{ApiType: "DeviceCatalog"})
+	if name != "a,_pw-dc._tcp" {
+		t.Errorf("Unexpected name of a discovered catalog: %v", name)
+	}
+}
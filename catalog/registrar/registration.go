@@ -0,0 +1,136 @@
+package registrar
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/discovery"
+)
+
+// Client registering an entry at an endpoint of a catalog
+type EntryClient interface {
+	// Updates the entry in the catalog or adds it if not found (e.g. expired
+	// or registered at another endpoint before)
+	Register() error
+	// Deletes the entry from the catalog. Entries which are not found are gone
+	Unregister() error
+}
+
+// Registration of an entry in a catalog which can have several equivalent
+// endpoints: the entry is registered at the first available one and registered
+// again at the next endpoint when it fails
+type CatalogRegistration struct {
+	id       string
+	ttl      int
+	catalog  string
+	failover *catalog.Failover
+	// creates the client of an endpoint
+	newClient func(endpoint string) EntryClient
+	clients   map[string]EntryClient
+	// endpoints the entry was registered at
+	registered map[string]bool
+	mutex      sync.Mutex
+}
+
+// Returns the registration of the entry in the endpoints of the failover.
+// name identifies the catalog in the status of the registrar
+func NewCatalogRegistration(id string, ttl int, name string, failover *catalog.Failover, newClient func(endpoint string) EntryClient) *CatalogRegistration {
+	return &CatalogRegistration{
+		id:         id,
+		ttl:        ttl,
+		catalog:    name,
+		failover:   failover,
+		newClient:  newClient,
+		clients:    make(map[string]EntryClient),
+		registered: make(map[string]bool),
+	}
+}
+
+// Returns the failover between the endpoints (in order of preference) and, if
+// discover is not nil, an endpoint of serviceType discovered using DNS-SD, along
+// with the name of the catalog. Unless other requirements are given, only catalogs
+// meeting the API type and version of require, or announcing neither (older
+// releases), are discovered
+func CatalogFailover(endpoints []string, discover *catalog.DiscoveryOptions, serviceType string, require discovery.Requirements) (string, *catalog.Failover) {
+	name := strings.Join(endpoints, ",")
+	if discover == nil {
+		return name, catalog.NewFailover(endpoints, "")
+	}
+	if name != "" {
+		name += ","
+	}
+	name += serviceType
+	opts := *discover
+	if opts.Require.ApiType == "" && opts.Require.ApiVersion == "" {
+		// catalogs of older releases don't announce them (rolling upgrades)
+		opts.Require.ApiType = require.ApiType
+		opts.Require.ApiVersion = require.ApiVersion
+		opts.Require.AllowUnannounced = true
+	}
+	return name, catalog.NewDiscoveryFailover(endpoints, serviceType, opts)
+}
+
+func (self *CatalogRegistration) Id() string {
+	return self.id
+}
+
+func (self *CatalogRegistration) Catalog() string {
+	return self.catalog
+}
+
+func (self *CatalogRegistration) Ttl() int {
+	return self.ttl
+}
+
+// Returns the endpoint the entry was last registered at
+func (self *CatalogRegistration) Endpoint() string {
+	return self.failover.Active()
+}
+
+// Returns the health of the catalog endpoints
+func (self *CatalogRegistration) Health() []catalog.EndpointHealth {
+	return self.failover.Health()
+}
+
+// Registers the entry at the first available endpoint
+func (self *CatalogRegistration) Register() error {
+	endpoint, err := self.failover.Do(func(endpoint string) error {
+		return self.getClient(endpoint).Register()
+	})
+	if err != nil {
+		return err
+	}
+	self.mutex.Lock()
+	self.registered[endpoint] = true
+	self.mutex.Unlock()
+	return nil
+}
+
+// Deletes the entry from the endpoints it was registered at
+func (self *CatalogRegistration) Unregister() error {
+	self.mutex.Lock()
+	endpoints := self.registered
+	self.registered = make(map[string]bool)
+	self.mutex.Unlock()
+
+	var err error
+	for endpoint := range endpoints {
+		if e := self.getClient(endpoint).Unregister(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Returns the client of the endpoint
+func (self *CatalogRegistration) getClient(endpoint string) EntryClient {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	client, ok := self.clients[endpoint]
+	if !ok {
+		client = self.newClient(endpoint)
+		self.clients[endpoint] = client
+	}
+	return client
+}
@@ -0,0 +1,174 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+)
+
+const (
+	// Default initial backoff between retries
+	DefaultRetryBackoff = 500 * time.Millisecond
+	// Default maximum backoff between retries
+	DefaultRetryMaxBackoff = 10 * time.Second
+	// Maximum length of the error message read from a response
+	maxErrorMessage = 512
+)
+
+// Options of the remote catalog clients
+type ClientOptions struct {
+	// Credentials sent with every request (nil for none)
+	Credentials *auth.Credentials
+	// HTTP client used for requests. Defaults to a client configured
+	// with the TLS settings of the credentials
+	HTTPClient *http.Client
+	// Timeout of each request (none if zero). Not applied to a given HTTPClient
+	Timeout time.Duration
+	// Retries of failed requests
+	Retry RetryPolicy
+	// Headers added to every request
+	Header http.Header
+	// User-Agent header of the requests
+	UserAgent string
+}
+
+// Retries of requests failing with a transport error, 5xx or 429 status.
+// Only idempotent requests (GET, PUT, DELETE) are retried
+type RetryPolicy struct {
+	// Maximum number of retries (none if zero)
+	MaxRetries int
+	// Backoff before the first retry, doubled on every following one
+	Backoff time.Duration
+	// Upper bound of the backoff
+	MaxBackoff time.Duration
+}
+
+// Returns the backoff before the given retry (starting at 1)
+func (self RetryPolicy) backoff(retry int) time.Duration {
+	b, max := self.Backoff, self.MaxBackoff
+	if b <= 0 {
+		b = DefaultRetryBackoff
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxBackoff
+	}
+	for i := 1; i < retry && b < max; i++ {
+		b *= 2
+	}
+	if b > max {
+		b = max
+	}
+	return b
+}
+
+// Unexpected status of a catalog response
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (self *StatusError) Error() string {
+	if self.Message == "" {
+		return fmt.Sprintf("%d %s", self.StatusCode, http.StatusText(self.StatusCode))
+	}
+	return fmt.Sprintf("%d %s: %s", self.StatusCode, http.StatusText(self.StatusCode), self.Message)
+}
+
+// Reads the error of an unexpected response and closes its body
+func ResponseError(res *http.Response) error {
+	defer res.Body.Close()
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorMessage))
+	return &StatusError{
+		StatusCode: res.StatusCode,
+		Message:    strings.TrimSpace(string(b)),
+	}
+}
+
+// Performs the HTTP requests of the remote catalog clients
+type RemoteClient struct {
+	client      *http.Client
+	credentials *auth.Credentials
+	retry       RetryPolicy
+	header      http.Header
+	userAgent   string
+}
+
+func NewRemoteClient(opts ClientOptions) (*RemoteClient, error) {
+	client := opts.HTTPClient
+	if client == nil {
+		var err error
+		client, err = opts.Credentials.HTTPClient()
+		if err != nil {
+			return nil, err
+		}
+		if opts.Timeout > 0 {
+			// don't modify a shared client
+			c := *client
+			c.Timeout = opts.Timeout
+			client = &c
+		}
+	}
+	return &RemoteClient{
+		client:      client,
+		credentials: opts.Credentials,
+		retry:       opts.Retry,
+		header:      opts.Header,
+		userAgent:   opts.UserAgent,
+	}, nil
+}
+
+// Performs a request, retrying it as configured until ctx is done
+func (self *RemoteClient) Do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	idempotent := method == "GET" || method == "PUT" || method == "DELETE"
+	for retry := 0; ; retry++ {
+		res, err := self.do(ctx, method, url, body)
+		if !idempotent || retry >= self.retry.MaxRetries || !retryable(res, err) || ctx.Err() != nil {
+			return res, err
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(self.retry.backoff(retry + 1)):
+		}
+	}
+}
+
+func (self *RemoteClient) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range self.header {
+		req.Header[k] = v
+	}
+	if self.userAgent != "" {
+		req.Header.Set("User-Agent", self.userAgent)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/ld+json")
+	}
+	err = self.credentials.Authorize(req)
+	if err != nil {
+		return nil, err
+	}
+	return self.client.Do(req)
+}
+
+func retryable(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return res.StatusCode >= 500 || res.StatusCode == StatusTooManyRequests
+}
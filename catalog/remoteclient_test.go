@@ -0,0 +1,87 @@
+package catalog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRemoteClientRetry(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Header.Get("User-Agent") != "test-agent" || req.Header.Get("X-Test") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client, err := NewRemoteClient(ClientOptions{
+		Timeout:   time.Second,
+		Retry:     RetryPolicy{MaxRetries: 3, Backoff: time.Millisecond},
+		Header:    http.Header{"X-Test": []string{"1"}},
+		UserAgent: "test-agent",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	res, err := client.Do(context.Background(), "GET", ts.URL, nil)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the request to succeed after retries: %v (%v)", res, err)
+	}
+	res.Body.Close()
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got %v", requests)
+	}
+
+	// POST is not retried
+	requests = 0
+	res, err = client.Do(context.Background(), "POST", ts.URL, []byte("{}"))
+	if err != nil || res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected the failed response: %v (%v)", res, err)
+	}
+	if err := ResponseError(res); err.(*StatusError).StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected a single request, got %v", requests)
+	}
+}
+
+func TestRemoteClientCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client, _ := NewRemoteClient(ClientOptions{Retry: RetryPolicy{MaxRetries: 100, Backoff: time.Hour}})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.Do(ctx, "GET", ts.URL, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected the deadline to be exceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("The retries were not cancelled")
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for retry, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second} {
+		if b := p.backoff(retry); b != expected {
+			t.Errorf("Backoff of retry %d: expected %v, got %v", retry, expected, b)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package replication
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+)
+
+// Replication config of a catalog instance
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// Initial role: primary or replica
+	Role string `json:"role"`
+	// Base URL of the primary instance (replicas only, e.g. http://10.0.0.1:8081)
+	Primary string `json:"primary"`
+	// Credentials to access the primary
+	Auth *auth.Credentials `json:"auth"`
+	// Number of log entries kept for replicas catching up
+	LogSize int `json:"logSize"`
+	// Long-polling timeout of the log (seconds)
+	PollTimeout int `json:"pollTimeout"`
+	// Interval of the anti-entropy resync from a snapshot (seconds)
+	ResyncInterval int `json:"resyncInterval"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	switch c.Role {
+	case RolePrimary:
+	case RoleReplica:
+		if c.Primary == "" {
+			return fmt.Errorf("replication: primary must be defined for replicas")
+		}
+		if _, err := url.Parse(c.Primary); err != nil {
+			return fmt.Errorf("replication: invalid primary: %v", err)
+		}
+	default:
+		return fmt.Errorf("replication: role must be either %s or %s", RolePrimary, RoleReplica)
+	}
+	if c.LogSize < 0 || c.PollTimeout < 0 || c.ResyncInterval < 0 {
+		return fmt.Errorf("replication: negative values are not allowed")
+	}
+	return nil
+}
+
+func (c *Config) pollTimeout() time.Duration {
+	if c.PollTimeout > 0 {
+		return time.Duration(c.PollTimeout) * time.Second
+	}
+	return defaultPollTimeout * time.Second
+}
+
+func (c *Config) resyncInterval() time.Duration {
+	if c.ResyncInterval > 0 {
+		return time.Duration(c.ResyncInterval) * time.Second
+	}
+	return defaultResyncInterval * time.Second
+}
@@ -0,0 +1,21 @@
+package replication
+
+const (
+	RolePrimary = "primary"
+	RoleReplica = "replica"
+
+	OpPut    = "put"
+	OpDelete = "delete"
+
+	// Location of the replication endpoints
+	DefaultLocation = "/replication"
+
+	GetParamSince = "since"
+	GetParamWait  = "wait"
+
+	defaultLogSize        = 10000
+	defaultPollTimeout    = 30
+	defaultResyncInterval = 300
+	retryInterval         = 5
+	loggerPrefix          = "[replication] "
+)
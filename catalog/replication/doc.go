@@ -0,0 +1,4 @@
+// Package catalog/replication implements primary/replica replication of catalog
+// storages: a primary records mutations in a log which replicas follow over HTTP,
+// replicas forward writes to the primary and can be promoted.
+package replication
@@ -0,0 +1,112 @@
+package replication
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+)
+
+// Mounts the replication endpoints at the location of the node
+func (self *Node) Mount(r *mux.Router) {
+	r.Methods("GET").Path(self.location + "/log").HandlerFunc(self.serveLog)
+	r.Methods("GET").Path(self.location + "/snapshot").HandlerFunc(self.serveSnapshot)
+	r.Methods("GET").Path(self.location + "/status").HandlerFunc(self.serveStatus)
+	r.Methods("POST").Path(self.location + "/promote").HandlerFunc(authorizeAdmin(self.servePromote))
+	r.Methods("POST").Path(self.location + "/follow").HandlerFunc(authorizeAdmin(self.serveFollow))
+}
+
+// Responds with 403 Forbidden if the principal of the request may not change the role of the node
+func authorizeAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		err := auth.AuthorizeAdmin(req)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "Not allowed to change the replication role: %s\n", err.Error())
+			return
+		}
+		next(w, req)
+	}
+}
+
+func (self *Node) serveLog(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	since, err := strconv.ParseUint(req.Form.Get(GetParamSince), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error processing the request: invalid %s\n", GetParamSince)
+		return
+	}
+	wait, _ := strconv.Atoi(req.Form.Get(GetParamWait))
+	if max := int(self.config.pollTimeout() / time.Second); wait > max || wait < 0 {
+		wait = max
+	}
+
+	entries, err := self.log.Since(since, time.Duration(wait)*time.Second)
+	if err == ErrorLogTruncated {
+		w.WriteHeader(http.StatusGone)
+		fmt.Fprintf(w, "%s\n", err.Error())
+		return
+	}
+
+	b, _ := json.Marshal(entries)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (self *Node) serveSnapshot(w http.ResponseWriter, req *http.Request) {
+	seq, entries, err := self.store.Snapshot()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error creating the snapshot: %s\n", err.Error())
+		return
+	}
+
+	snapshot := Snapshot{
+		Seq:     seq,
+		Entries: make(map[string]json.RawMessage, len(entries)),
+	}
+	for id, data := range entries {
+		snapshot.Entries[id] = data
+	}
+
+	b, _ := json.Marshal(snapshot)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (self *Node) serveStatus(w http.ResponseWriter, req *http.Request) {
+	b, _ := json.Marshal(self.Status())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (self *Node) servePromote(w http.ResponseWriter, req *http.Request) {
+	self.Promote()
+	self.serveStatus(w, req)
+}
+
+func (self *Node) serveFollow(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Primary string `json:"primary"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	req.Body.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error processing the request: %s\n", err.Error())
+		return
+	}
+
+	err = self.Follow(body.Primary)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error processing the request: %s\n", err.Error())
+		return
+	}
+	self.serveStatus(w, req)
+}
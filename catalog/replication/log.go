@@ -0,0 +1,130 @@
+package replication
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrorLogTruncated = errors.New("Log has been truncated")
+
+// Mutation of a catalog entry
+type Entry struct {
+	Seq  uint64          `json:"seq"`
+	Op   string          `json:"op"`
+	Id   string          `json:"id"`
+	Data json.RawMessage `json:"data,omitempty"`
+	Time time.Time       `json:"time"`
+}
+
+// Bounded in-memory mutation log
+type Log struct {
+	entries []Entry
+	// sequence number of the last entry
+	seq  uint64
+	size int
+	// closed and replaced on every append to wake up waiting readers
+	changed chan struct{}
+	mutex   sync.RWMutex
+}
+
+func NewLog(size int) *Log {
+	if size <= 0 {
+		size = defaultLogSize
+	}
+	return &Log{
+		entries: make([]Entry, 0, size),
+		size:    size,
+		changed: make(chan struct{}),
+	}
+}
+
+// Records a new mutation and returns its entry
+func (self *Log) Record(op, id string, data []byte) Entry {
+	self.mutex.Lock()
+	e := Entry{
+		Seq:  self.seq + 1,
+		Op:   op,
+		Id:   id,
+		Data: data,
+		Time: time.Now(),
+	}
+	self.append(e)
+	self.mutex.Unlock()
+	return e
+}
+
+// Appends an entry received from the primary (keeping its sequence number)
+func (self *Log) Append(e Entry) {
+	self.mutex.Lock()
+	self.append(e)
+	self.mutex.Unlock()
+}
+
+func (self *Log) append(e Entry) {
+	if len(self.entries) == self.size {
+		copy(self.entries, self.entries[1:])
+		self.entries = self.entries[:len(self.entries)-1]
+	}
+	self.entries = append(self.entries, e)
+	self.seq = e.Seq
+	close(self.changed)
+	self.changed = make(chan struct{})
+}
+
+// Drops all entries and continues from the given sequence number (after a resync)
+func (self *Log) Reset(seq uint64) {
+	self.mutex.Lock()
+	self.entries = self.entries[:0]
+	self.seq = seq
+	close(self.changed)
+	self.changed = make(chan struct{})
+	self.mutex.Unlock()
+}
+
+// Sequence number of the last entry
+func (self *Log) Seq() uint64 {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return self.seq
+}
+
+// Returns entries after since. Waits up to timeout if there are none.
+// Returns ErrorLogTruncated if entries after since are no longer available
+func (self *Log) Since(since uint64, timeout time.Duration) ([]Entry, error) {
+	self.mutex.RLock()
+	entries, err := self.since(since)
+	changed := self.changed
+	self.mutex.RUnlock()
+	if err != nil || len(entries) > 0 || timeout <= 0 {
+		return entries, err
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(timeout):
+		return entries, nil
+	}
+
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return self.since(since)
+}
+
+func (self *Log) since(since uint64) ([]Entry, error) {
+	if since > self.seq {
+		// reader is ahead (e.g. follows a promoted replica with a shorter history)
+		return nil, ErrorLogTruncated
+	}
+	if since == self.seq {
+		return []Entry{}, nil
+	}
+	if len(self.entries) == 0 || self.entries[0].Seq > since+1 {
+		return nil, ErrorLogTruncated
+	}
+	i := int(since + 1 - self.entries[0].Seq)
+	entries := make([]Entry, len(self.entries)-i)
+	copy(entries, self.entries[i:])
+	return entries, nil
+}
@@ -0,0 +1,332 @@
+package replication
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Replicated catalog storage
+type Store interface {
+	// Stores the serialized entry with the given id (replacing the existing one)
+	Put(id string, data []byte) error
+	// Deletes the entry with the given id (no error if it does not exist)
+	Delete(id string) error
+	// Returns all entries serialized and the log sequence number they correspond to
+	Snapshot() (uint64, map[string][]byte, error)
+	// Replaces all entries
+	Restore(entries map[string][]byte) error
+}
+
+// Full state of a store
+type Snapshot struct {
+	Seq     uint64                     `json:"seq"`
+	Entries map[string]json.RawMessage `json:"entries"`
+}
+
+// Replication status of a node
+type Status struct {
+	Role       string    `json:"role"`
+	Primary    string    `json:"primary,omitempty"`
+	Seq        uint64    `json:"seq"`
+	Connected  bool      `json:"connected"`
+	LastError  string    `json:"lastError,omitempty"`
+	LastResync time.Time `json:"lastResync,omitempty"`
+}
+
+// Catalog instance taking part in replication
+type Node struct {
+	config   Config
+	log      *Log
+	store    Store
+	location string
+	client   *http.Client
+
+	role    string
+	primary *url.URL
+	proxy   *httputil.ReverseProxy
+	stopCh  chan bool
+	status  Status
+	mutex   sync.RWMutex
+}
+
+// Creates a node with the given store and log.
+// location is the path the replication endpoints are mounted at
+func NewNode(conf Config, store Store, log *Log, location string) (*Node, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := conf.Auth.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{
+		config:   conf,
+		log:      log,
+		store:    store,
+		location: location,
+		client:   client,
+		role:     RolePrimary,
+	}
+	if conf.Role == RoleReplica {
+		if err := n.Follow(conf.Primary); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// Returns the current role
+func (self *Node) Role() string {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return self.role
+}
+
+// Returns the replication status
+func (self *Node) Status() Status {
+	self.mutex.RLock()
+	s := self.status
+	s.Role = self.role
+	if self.primary != nil {
+		s.Primary = self.primary.String()
+	}
+	self.mutex.RUnlock()
+	s.Seq = self.log.Seq()
+	return s
+}
+
+// Makes the node a replica of the given primary (base URL of the primary instance).
+// The state is resynchronized from a snapshot of the primary
+func (self *Node) Follow(primary string) error {
+	u, err := url.Parse(strings.TrimSuffix(primary, "/"))
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("Invalid primary URL: %s", primary)
+	}
+
+	self.mutex.Lock()
+	if self.stopCh != nil {
+		close(self.stopCh)
+	}
+	stopCh := make(chan bool)
+	self.stopCh = stopCh
+	self.role = RoleReplica
+	self.primary = u
+	self.proxy = httputil.NewSingleHostReverseProxy(u)
+	self.proxy.Transport = self.client.Transport
+	self.status = Status{}
+	self.mutex.Unlock()
+
+	logger.Printf("Node.Follow() Following primary %s", u)
+	go self.follow(u, stopCh)
+	return nil
+}
+
+// Promotes a replica to primary. The log continues from the last applied entry
+func (self *Node) Promote() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.role == RolePrimary {
+		return
+	}
+	if self.stopCh != nil {
+		close(self.stopCh)
+		self.stopCh = nil
+	}
+	self.role = RolePrimary
+	self.primary = nil
+	self.proxy = nil
+	self.status = Status{}
+	logger.Printf("Node.Promote() Promoted to primary at seq %v", self.log.Seq())
+}
+
+// Stops following the primary
+func (self *Node) Stop() {
+	self.mutex.Lock()
+	if self.stopCh != nil {
+		close(self.stopCh)
+		self.stopCh = nil
+	}
+	self.mutex.Unlock()
+}
+
+// Follower loop: resyncs from a snapshot and tails the log of the primary.
+// A resync happens on start, after errors (e.g. a partition), when the log
+// of the primary has been truncated and every resync interval (anti-entropy)
+func (self *Node) follow(primary *url.URL, stopCh <-chan bool) {
+	resync := true
+	resyncTicker := time.NewTicker(self.config.resyncInterval())
+	defer resyncTicker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-resyncTicker.C:
+			resync = true
+		default:
+		}
+
+		var err error
+		if resync {
+			err = self.resync(primary)
+			if err == nil {
+				resync = false
+			}
+		} else {
+			err = self.poll(primary, stopCh)
+			if err == ErrorLogTruncated {
+				logger.Printf("Node.follow() Log of the primary has been truncated, will resync")
+				resync = true
+				continue
+			}
+		}
+
+		if !self.setStatus(stopCh, err) {
+			return
+		}
+		if err != nil {
+			logger.Printf("Node.follow() ERROR: %v", err)
+			resync = true
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(retryInterval * time.Second):
+			}
+		}
+	}
+}
+
+// Updates the follower status unless the follower was stopped
+func (self *Node) setStatus(stopCh <-chan bool, err error) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	select {
+	case <-stopCh:
+		return false
+	default:
+	}
+	self.status.Connected = err == nil
+	self.status.LastError = ""
+	if err != nil {
+		self.status.LastError = err.Error()
+	}
+	return true
+}
+
+// Replaces the local state with a snapshot of the primary
+func (self *Node) resync(primary *url.URL) error {
+	var snapshot Snapshot
+	err := self.get(primary.String()+self.location+"/snapshot", &snapshot)
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string][]byte, len(snapshot.Entries))
+	for id, data := range snapshot.Entries {
+		entries[id] = data
+	}
+	err = self.store.Restore(entries)
+	if err != nil {
+		return err
+	}
+	self.log.Reset(snapshot.Seq)
+
+	self.mutex.Lock()
+	self.status.LastResync = time.Now()
+	self.mutex.Unlock()
+	logger.Printf("Node.resync() Restored %d entries at seq %v from %s", len(entries), snapshot.Seq, primary)
+	return nil
+}
+
+// Long-polls the log of the primary and applies new entries
+func (self *Node) poll(primary *url.URL, stopCh <-chan bool) error {
+	since := self.log.Seq()
+	wait := int(self.config.pollTimeout() / time.Second)
+	var entries []Entry
+	err := self.get(fmt.Sprintf("%s%s/log?%s=%d&%s=%d", primary, self.location, GetParamSince, since, GetParamWait, wait), &entries)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		select {
+		case <-stopCh:
+			return nil
+		default:
+		}
+		if e.Seq != self.log.Seq()+1 {
+			return ErrorLogTruncated
+		}
+		err = self.apply(e)
+		if err != nil {
+			return err
+		}
+		self.log.Append(e)
+	}
+	return nil
+}
+
+func (self *Node) apply(e Entry) error {
+	switch e.Op {
+	case OpPut:
+		return self.store.Put(e.Id, e.Data)
+	case OpDelete:
+		return self.store.Delete(e.Id)
+	}
+	return fmt.Errorf("Unknown operation %s", e.Op)
+}
+
+func (self *Node) get(url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	err = self.config.Auth.Authorize(req)
+	if err != nil {
+		return err
+	}
+	res, err := self.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusGone {
+		return ErrorLogTruncated
+	} else if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %v", url, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// Negroni middleware forwarding writes of a replica to the primary
+func (self *Node) ServeHTTP(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS":
+		next(w, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, self.location+"/") {
+		next(w, req)
+		return
+	}
+
+	self.mutex.RLock()
+	proxy := self.proxy
+	self.mutex.RUnlock()
+	if proxy == nil {
+		next(w, req)
+		return
+	}
+	proxy.ServeHTTP(w, req)
+}
@@ -0,0 +1,296 @@
+package replication
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/codegangsta/negroni"
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+)
+
+// Map store recording local writes in the log
+type mapStore struct {
+	log   *Log
+	data  map[string][]byte
+	mutex sync.Mutex
+}
+
+func newMapStore(log *Log) *mapStore {
+	return &mapStore{log: log, data: make(map[string][]byte)}
+}
+
+func (self *mapStore) write(id, data string) {
+	self.mutex.Lock()
+	self.data[id] = []byte(data)
+	self.log.Record(OpPut, id, []byte(data))
+	self.mutex.Unlock()
+}
+
+func (self *mapStore) remove(id string) {
+	self.mutex.Lock()
+	delete(self.data, id)
+	self.log.Record(OpDelete, id, nil)
+	self.mutex.Unlock()
+}
+
+func (self *mapStore) value(id string) string {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return string(self.data[id])
+}
+
+func (self *mapStore) Put(id string, data []byte) error {
+	self.mutex.Lock()
+	self.data[id] = data
+	self.mutex.Unlock()
+	return nil
+}
+
+func (self *mapStore) Delete(id string) error {
+	self.mutex.Lock()
+	delete(self.data, id)
+	self.mutex.Unlock()
+	return nil
+}
+
+func (self *mapStore) Snapshot() (uint64, map[string][]byte, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	entries := make(map[string][]byte, len(self.data))
+	for id, data := range self.data {
+		entries[id] = data
+	}
+	return self.log.Seq(), entries, nil
+}
+
+func (self *mapStore) Restore(entries map[string][]byte) error {
+	self.mutex.Lock()
+	self.data = entries
+	self.mutex.Unlock()
+	return nil
+}
+
+type instance struct {
+	node   *Node
+	store  *mapStore
+	log    *Log
+	server *httptest.Server
+	writes int
+}
+
+// Starts a catalog instance with a handler counting local writes
+func startInstance(t *testing.T, conf Config) *instance {
+	inst := &instance{log: NewLog(conf.LogSize)}
+	inst.store = newMapStore(inst.log)
+	var err error
+	inst.node, err = NewNode(conf, inst.store, inst.log, DefaultLocation)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	r := mux.NewRouter()
+	inst.node.Mount(r)
+	r.Methods("POST").Path("/catalog/{id}").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		inst.writes++
+		inst.store.write(mux.Vars(req)["id"], `"posted"`)
+		w.WriteHeader(http.StatusCreated)
+	})
+	n := negroni.New()
+	n.Use(inst.node)
+	n.UseHandler(r)
+	inst.server = httptest.NewServer(n)
+	return inst
+}
+
+func (self *instance) close() {
+	self.node.Stop()
+	self.server.Close()
+}
+
+// Waits until the condition holds
+func eventually(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLogSince(t *testing.T) {
+	log := NewLog(3)
+	for i := 0; i < 5; i++ {
+		log.Record(OpPut, "a/b", nil)
+	}
+
+	entries, err := log.Since(3, 0)
+	if err != nil || len(entries) != 2 || entries[0].Seq != 4 {
+		t.Errorf("Expected entries 4-5, got %v (%v)", entries, err)
+	}
+	if _, err = log.Since(1, 0); err != ErrorLogTruncated {
+		t.Errorf("Expected truncated log, got %v", err)
+	}
+	if _, err = log.Since(6, 0); err != ErrorLogTruncated {
+		t.Errorf("Expected truncated log for a reader ahead, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		log.Record(OpDelete, "a/b", nil)
+	}()
+	entries, err = log.Since(5, 5*time.Second)
+	if err != nil || len(entries) != 1 || entries[0].Op != OpDelete {
+		t.Errorf("Expected the entry appended while waiting, got %v (%v)", entries, err)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	primary := startInstance(t, Config{Enabled: true, Role: RolePrimary})
+	defer primary.close()
+	primary.store.write("gw/existing", `"before"`)
+
+	replica := startInstance(t, Config{Enabled: true, Role: RoleReplica, Primary: primary.server.URL, PollTimeout: 1})
+	defer replica.close()
+
+	// snapshot on start
+	eventually(t, "initial resync", func() bool {
+		return replica.store.value("gw/existing") == `"before"`
+	})
+
+	// log streaming
+	primary.store.write("gw/new", `"after"`)
+	primary.store.remove("gw/existing")
+	eventually(t, "replicated log", func() bool {
+		return replica.store.value("gw/new") == `"after"` && replica.store.value("gw/existing") == ""
+	})
+
+	// writes to the replica are forwarded to the primary
+	res, err := http.Post(replica.server.URL+"/catalog/forwarded", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("Expected 201 from the forwarded write, got %v", res.StatusCode)
+	}
+	if primary.writes != 1 || replica.writes != 0 {
+		t.Errorf("Expected the write to be handled by the primary only (primary: %d, replica: %d)", primary.writes, replica.writes)
+	}
+	eventually(t, "forwarded write", func() bool {
+		return replica.store.value("forwarded") == `"posted"`
+	})
+
+	status := replica.node.Status()
+	if status.Role != RoleReplica || !status.Connected || status.Seq != primary.log.Seq() {
+		t.Errorf("Unexpected replica status: %+v (primary seq %v)", status, primary.log.Seq())
+	}
+
+	// promotion
+	res, err = http.Post(replica.server.URL+DefaultLocation+"/promote", "application/json", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	res.Body.Close()
+	if replica.node.Role() != RolePrimary {
+		t.Fatalf("Expected the replica to be promoted")
+	}
+	res, err = http.Post(replica.server.URL+"/catalog/local", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	res.Body.Close()
+	if replica.writes != 1 {
+		t.Errorf("Expected the promoted replica to accept writes")
+	}
+}
+
+func TestResyncAfterPartition(t *testing.T) {
+	primary := startInstance(t, Config{Enabled: true, Role: RolePrimary, LogSize: 2})
+	defer primary.close()
+
+	replica := startInstance(t, Config{Enabled: true, Role: RoleReplica, Primary: primary.server.URL, PollTimeout: 1})
+	defer replica.close()
+	eventually(t, "initial resync", func() bool {
+		return replica.node.Status().Connected
+	})
+
+	// partition: the replica misses more entries than the primary keeps
+	replica.node.Stop()
+	for _, id := range []string{"gw/a", "gw/b", "gw/c", "gw/d"} {
+		primary.store.write(id, `"x"`)
+	}
+	primary.store.remove("gw/a")
+
+	err := replica.node.Follow(primary.server.URL)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	eventually(t, "anti-entropy resync", func() bool {
+		return replica.log.Seq() == primary.log.Seq() &&
+			replica.store.value("gw/d") == `"x"` && replica.store.value("gw/a") == ""
+	})
+}
+
+func TestRoleChangeRequiresAdmin(t *testing.T) {
+	f, err := ioutil.TempFile("", "tokens")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("gwtoken dgw1\nadmintoken ops admin\n")
+	f.Close()
+	a, err := auth.NewAuthenticator(auth.Config{
+		Enabled:   true,
+		TokenFile: f.Name(),
+		ACL:       []auth.ACLEntry{{Principal: "dgw1", Prefixes: []string{"dgw1"}}},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	log := NewLog(0)
+	node, err := NewNode(Config{Enabled: true, Role: RoleReplica, Primary: "http://127.0.0.1:1"}, newMapStore(log), log, DefaultLocation)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	r := mux.NewRouter()
+	node.Mount(r)
+	n := negroni.New(a)
+	n.UseHandler(r)
+	ts := httptest.NewServer(n)
+	defer ts.Close()
+
+	promote := func(token string) int {
+		req, _ := http.NewRequest("POST", ts.URL+DefaultLocation+"/promote", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if code := promote("gwtoken"); code != http.StatusForbidden || node.Role() != RoleReplica {
+		t.Errorf("Expected 403 on promotion by a non-admin, got %v (role %v)", code, node.Role())
+	}
+	res, err := http.Post(ts.URL+DefaultLocation+"/follow", "application/json", strings.NewReader(`{"primary":"http://127.0.0.1:2"}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized && res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected an anonymous follow to be rejected, got %v", res.StatusCode)
+	}
+	if code := promote("admintoken"); code != http.StatusOK || node.Role() != RolePrimary {
+		t.Errorf("Expected the admin to promote the node, got %v (role %v)", code, node.Role())
+	}
+	node.Stop()
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/discovery"
+)
+
+// Returns the DNS-SD instance announcing the service at the first protocol
+// endpoint with an url (see catalog.EntryInstance)
+func ServiceInstance(s Service) (discovery.Instance, error) {
+	return serviceInstance(s, catalog.EntryInstance)
+}
+
+// Returns the instance of the service created by the given function
+func serviceInstance(s Service, entryInstance func(string, map[string]interface{}, map[string]string, ...map[string]interface{}) (discovery.Instance, error)) (discovery.Instance, error) {
+	for _, p := range s.Protocols {
+		if _, ok := p.Endpoint["url"].(string); !ok {
+			continue
+		}
+		return entryInstance(s.Name, p.Endpoint, map[string]string{
+			discovery.TxtId: s.Id,
+			"type":          s.Type,
+			"protocol":      p.Type,
+		}, s.Meta)
+	}
+	return discovery.Instance{}, fmt.Errorf("Service %v has no endpoint url", s.Id)
+}
+
+// Returns the instances announcing the services in the storage by id.
+// Services failing their health check or imported from DNS-SD are not announced
+func storageInstances(storage CatalogStorage) (map[string]discovery.Instance, error) {
+	instances := make(map[string]discovery.Instance)
+	for page := 1; ; page++ {
+		services, total, err := storage.getMany(page, MaxPerPage)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range services {
+			if isImported(s.Id) || s.Status == StatusFailing {
+				continue
+			}
+			i, err := ServiceInstance(s)
+			if err != nil {
+				continue
+			}
+			instances[s.Id] = i
+		}
+		if page*MaxPerPage >= total {
+			break
+		}
+	}
+	return instances, nil
+}
+
+// Creates an announcer of the services in the storage as multicast DNS-SD instances
+func NewAnnouncer(storage CatalogStorage, config catalog.AnnounceConfig) *discovery.Announcer {
+	return config.Announcer(func() (map[string]discovery.Instance, error) {
+		return storageInstances(storage)
+	})
+}
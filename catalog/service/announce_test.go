@@ -0,0 +1,61 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+func TestServiceInstance(t *testing.T) {
+	s := Service{
+		Id:   "host/printer",
+		Type: "Service",
+		Name: "Printer",
+		Meta: map[string]interface{}{
+			catalog.MetaDNSSDType: "_ipp._tcp",
+			"color":               true,
+			"location":            map[string]interface{}{"room": "1"},
+		},
+		Protocols: []Protocol{
+			{Type: "WAMP", Endpoint: map[string]interface{}{"realm": "x"}},
+			{Type: "IPP", Endpoint: map[string]interface{}{"url": "http://10.0.0.1:631/ipp", "queue": "main"}},
+		},
+	}
+	i, err := ServiceInstance(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Name != "Printer" || i.Type != "_ipp._tcp" || i.Port != 631 {
+		t.Errorf("Unexpected instance: %+v", i)
+	}
+	for k, v := range map[string]string{"id": "host/printer", "protocol": "IPP", "queue": "main", "color": "true", "path": "/ipp"} {
+		if i.Meta[k] != v {
+			t.Errorf("Expected TXT record %v=%v, got %v", k, v, i.Text)
+		}
+	}
+	if _, ok := i.Meta["location"]; ok {
+		t.Errorf("Unexpected TXT record of an object: %v", i.Text)
+	}
+}
+
+func TestStorageInstances(t *testing.T) {
+	storage := NewMemoryStorage()
+	for id, url := range map[string]string{"host/a": "http://10.0.0.1:8080", "host/b": "http://10.0.0.2:8080", "host/c": ""} {
+		s := Service{Id: id, Name: id, Ttl: 30, Protocols: []Protocol{{Type: "REST", Endpoint: map[string]interface{}{}}}}
+		if url != "" {
+			s.Protocols[0].Endpoint["url"] = url
+		}
+		if err := storage.add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	storage.setStatus("host/b", StatusFailing, "")
+
+	instances, err := storageInstances(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := instances["host/a"]; !ok || len(instances) != 1 {
+		t.Errorf("Expected only the healthy service with an url, got %+v", instances)
+	}
+}
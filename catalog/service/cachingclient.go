@@ -0,0 +1,135 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+const (
+	cacheKeyService = "service/"
+	cacheKeyQuery   = "query/"
+)
+
+// Catalog client caching the lookups of another client.
+// Not-found lookups are cached for a shorter time and cached entries
+// are served after expiry while the catalog is unavailable
+type CachingCatalogClient struct {
+	client CatalogClient
+	cache  *catalog.Cache
+}
+
+// Page of a cached collection
+type cachedServices struct {
+	services []Service
+	total    int
+}
+
+func NewCachingCatalogClient(client CatalogClient, conf catalog.CacheConfig) *CachingCatalogClient {
+	return &CachingCatalogClient{
+		client: client,
+		cache:  catalog.NewCache(conf),
+	}
+}
+
+func isNotFound(err error) bool {
+	return err == ErrorNotFound
+}
+
+// Removes the cached service with the given id and all cached queries
+func (self *CachingCatalogClient) Invalidate(id string) {
+	self.cache.Invalidate(cacheKeyService + id)
+	self.cache.InvalidatePrefix(cacheKeyQuery)
+}
+
+// Removes all cached lookups
+func (self *CachingCatalogClient) InvalidateAll() {
+	self.cache.Purge()
+}
+
+func (self *CachingCatalogClient) Get(id string) (*Service, error) {
+	return self.lookupService(cacheKeyService+id, func() (*Service, error) {
+		return self.client.Get(id)
+	})
+}
+
+func (self *CachingCatalogClient) Add(s *Service) error {
+	err := self.client.Add(s)
+	self.Invalidate(s.Id)
+	return err
+}
+
+func (self *CachingCatalogClient) Update(id string, s *Service) error {
+	err := self.client.Update(id, s)
+	self.Invalidate(id)
+	return err
+}
+
+func (self *CachingCatalogClient) Delete(id string) error {
+	err := self.client.Delete(id)
+	self.Invalidate(id)
+	return err
+}
+
+func (self *CachingCatalogClient) GetServices(page, perPage int) ([]Service, int, error) {
+	key := fmt.Sprintf("%sservices/%d/%d", cacheKeyQuery, page, perPage)
+	return self.lookupServices(key, func() ([]Service, int, error) {
+		return self.client.GetServices(page, perPage)
+	})
+}
+
+func (self *CachingCatalogClient) FindService(path, op, value string) (*Service, error) {
+	key := fmt.Sprintf("%sservice/%s/%s/%s", cacheKeyQuery, path, op, value)
+	return self.lookupService(key, func() (*Service, error) {
+		return self.client.FindService(path, op, value)
+	})
+}
+
+func (self *CachingCatalogClient) FindServices(path, op, value string, page, perPage int) ([]Service, int, error) {
+	key := fmt.Sprintf("%sservices/%s/%s/%s/%d/%d", cacheKeyQuery, path, op, value, page, perPage)
+	return self.lookupServices(key, func() ([]Service, int, error) {
+		return self.client.FindServices(path, op, value, page, perPage)
+	})
+}
+
+func (self *CachingCatalogClient) lookupService(key string, fetch func() (*Service, error)) (*Service, error) {
+	v, err := self.cache.Lookup(key, func() (interface{}, error) {
+		s, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		return s.copy(), nil
+	}, isNotFound)
+	if err != nil {
+		return nil, err
+	}
+	s := v.(Service)
+	sc := s.copy()
+	return &sc, nil
+}
+
+func (self *CachingCatalogClient) lookupServices(key string, fetch func() ([]Service, int, error)) ([]Service, int, error) {
+	v, err := self.cache.Lookup(key, func() (interface{}, error) {
+		services, total, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		return cachedServices{copyServices(services), total}, nil
+	}, isNotFound)
+	if err == ErrorNotFound {
+		return []Service{}, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	c := v.(cachedServices)
+	return copyServices(c.services), c.total, nil
+}
+
+// Deep copy of the services
+func copyServices(services []Service) []Service {
+	c := make([]Service, len(services))
+	for i := range services {
+		c[i] = services[i].copy()
+	}
+	return c
+}
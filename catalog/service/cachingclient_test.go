@@ -0,0 +1,85 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+func TestCachingCatalogClientCopiesMeta(t *testing.T) {
+	storage := NewMemoryStorage()
+	ts := httptest.NewServer(NewHandler(storage, HandlerOptions{Location: "/sc"}))
+	defer ts.Close()
+	client := NewCachingCatalogClient(NewRemoteCatalogClient(ts.URL+"/sc", nil), catalog.CacheConfig{})
+
+	err := storage.add(Service{
+		Id:        "host/svc",
+		Name:      "svc",
+		Ttl:       60,
+		Meta:      map[string]interface{}{"serviceType": "_svc._tcp", "tags": []interface{}{"a"}},
+		Protocols: []Protocol{{Type: "REST", Endpoint: map[string]interface{}{"url": "http://host"}}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error on add: %v", err.Error())
+	}
+
+	// changes of returned services must not reach the cached one
+	s, err := client.Get("host/svc")
+	if err != nil {
+		t.Fatalf("Unexpected error on get: %v", err.Error())
+	}
+	s.Meta["serviceType"] = "changed"
+	s.Meta["tags"].([]interface{})[0] = "changed"
+	s.Protocols[0].Endpoint["url"] = "changed"
+
+	s, err = client.Get("host/svc")
+	if err != nil {
+		t.Fatalf("Unexpected error on get: %v", err.Error())
+	}
+	if s.Meta["serviceType"] != "_svc._tcp" || s.Meta["tags"].([]interface{})[0] != "a" {
+		t.Errorf("Expected the cached meta to be unchanged, got %v", s.Meta)
+	}
+	if s.Protocols[0].Endpoint["url"] != "http://host" {
+		t.Errorf("Expected the cached endpoint to be unchanged, got %v", s.Protocols[0].Endpoint)
+	}
+}
+
+func TestCachingCatalogClientCopiesLists(t *testing.T) {
+	storage := NewMemoryStorage()
+	ts := httptest.NewServer(NewHandler(storage, HandlerOptions{Location: "/sc"}))
+	defer ts.Close()
+	client := NewCachingCatalogClient(NewRemoteCatalogClient(ts.URL+"/sc", nil), catalog.CacheConfig{})
+
+	err := storage.add(Service{
+		Id:        "host/svc",
+		Name:      "svc",
+		Ttl:       60,
+		Meta:      map[string]interface{}{"serviceType": "_svc._tcp"},
+		Protocols: []Protocol{{Type: "REST", Endpoint: map[string]interface{}{"url": "http://host"}}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error on add: %v", err.Error())
+	}
+
+	// changes of returned list entries must not reach the cached ones
+	for _, list := range []func() ([]Service, int, error){
+		func() ([]Service, int, error) { return client.GetServices(1, 10) },
+		func() ([]Service, int, error) { return client.FindServices("name", "equals", "svc", 1, 10) },
+	} {
+		services, _, err := list()
+		if err != nil || len(services) != 1 {
+			t.Fatalf("Unexpected services: %v (%v)", services, err)
+		}
+		services[0].Meta["serviceType"] = "changed"
+		services[0].Protocols[0].Endpoint["url"] = "changed"
+
+		services, _, err = list()
+		if err != nil || len(services) != 1 {
+			t.Fatalf("Unexpected services: %v (%v)", services, err)
+		}
+		if services[0].Meta["serviceType"] != "_svc._tcp" || services[0].Protocols[0].Endpoint["url"] != "http://host" {
+			t.Errorf("Expected the cached service to be unchanged, got %+v", services[0])
+		}
+	}
+}
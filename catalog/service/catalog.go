@@ -4,6 +4,8 @@ import (
 	"errors"
 	"strings"
 	"time"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
 )
 
 var ErrorNotFound = errors.New("NotFound")
@@ -23,6 +25,10 @@ type Service struct {
 	Created        time.Time              `json:"created"`
 	Updated        time.Time              `json:"updated"`
 	Expires        time.Time              `json:"expires"`
+	HealthCheck    *HealthCheck           `json:"healthCheck,omitempty"`
+	// Health status maintained by the catalog (services with a health check only)
+	Status        string         `json:"status,omitempty"`
+	StatusHistory []StatusChange `json:"statusHistory,omitempty"`
 }
 
 // Deep copy of the Service
@@ -30,18 +36,49 @@ func (self *Service) copy() Service {
 	var sc Service
 
 	sc = *self
+	sc.Meta = catalog.CopyMap(self.Meta)
+	sc.Representation = catalog.CopyMap(self.Representation)
 	proto := make([]Protocol, len(self.Protocols))
-	copy(proto, self.Protocols)
+	for i, p := range self.Protocols {
+		proto[i] = p.copy()
+	}
 	sc.Protocols = proto
+	if self.HealthCheck != nil {
+		hc := *self.HealthCheck
+		sc.HealthCheck = &hc
+	}
+	if self.StatusHistory != nil {
+		history := make([]StatusChange, len(self.StatusHistory))
+		copy(history, self.StatusHistory)
+		sc.StatusHistory = history
+	}
 
 	return sc
 }
 
+// Deep copy of the protocol
+func (self *Protocol) copy() Protocol {
+	pc := *self
+	pc.Endpoint = catalog.CopyMap(self.Endpoint)
+	if self.Methods != nil {
+		pc.Methods = make([]string, len(self.Methods))
+		copy(pc.Methods, self.Methods)
+	}
+	if self.ContentTypes != nil {
+		pc.ContentTypes = make([]string, len(self.ContentTypes))
+		copy(pc.ContentTypes, self.ContentTypes)
+	}
+	return pc
+}
+
 // Validates the Service configuration
 func (s *Service) validate() bool {
 	if s.Id == "" || len(strings.Split(s.Id, "/")) != 2 || s.Name == "" || s.Ttl == 0 {
 		return false
 	}
+	if s.HealthCheck != nil && !s.HealthCheck.validate(s) {
+		return false
+	}
 	return true
 }
 
@@ -66,9 +103,12 @@ type CatalogStorage interface {
 	// Utility functions
 	getMany(page, perPage int) ([]Service, int, error)
 	getCount() int
+	countByPrefix(prefix string) int
 	cleanExpired(ts time.Time)
 
 	// Path filtering
-	pathFilterOne(path, op, value string) (Service, error)
-	pathFilter(path, op, value string, page, perPage int) ([]Service, int, error)
+	// Services failing their health check are only matched if unhealthy is set
+	pathFilterOne(path, op, value string, unhealthy bool) (Service, error)
+	pathFilter(path, op, value string, page, perPage int, unhealthy bool) ([]Service, int, error)
+	setStatus(id string, status, output string) error
 }
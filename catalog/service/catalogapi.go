@@ -10,15 +10,17 @@ import (
 
 	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
 	"github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
 )
 
 const (
-	GetParamPage    = "page"
-	GetParamPerPage = "per_page"
-	FTypeService    = "service"
-	FTypeServices   = "services"
-	CtxRootDir      = "/ctx"
-	CtxPathCatalog  = "/catalog.jsonld"
+	GetParamPage      = "page"
+	GetParamPerPage   = "per_page"
+	GetParamUnhealthy = "unhealthy"
+	FTypeService      = "service"
+	FTypeServices     = "services"
+	CtxRootDir        = "/ctx"
+	CtxPathCatalog    = "/catalog.jsonld"
 )
 
 type Collection struct {
@@ -124,13 +126,15 @@ func (self ReadableCatalogAPI) Filter(w http.ResponseWriter, req *http.Request)
 	page, _ := strconv.Atoi(req.Form.Get(GetParamPage))
 	perPage, _ := strconv.Atoi(req.Form.Get(GetParamPerPage))
 	page, perPage = catalog.ValidatePagingParams(page, perPage, MaxPerPage)
+	// services failing their health check are filtered out unless requested
+	unhealthy, _ := strconv.ParseBool(req.Form.Get(GetParamUnhealthy))
 
 	var data interface{}
 	var err error
 
 	switch ftype {
 	case FTypeService:
-		data, err = self.catalogStorage.pathFilterOne(fpath, fop, fvalue)
+		data, err = self.catalogStorage.pathFilterOne(fpath, fop, fvalue, unhealthy)
 		if data.(Service).Id != "" {
 			svc := data.(Service)
 			data = svc.ldify(self.apiLocation)
@@ -140,7 +144,7 @@ func (self ReadableCatalogAPI) Filter(w http.ResponseWriter, req *http.Request)
 
 	case FTypeServices:
 		var total int
-		data, total, err = self.catalogStorage.pathFilter(fpath, fop, fvalue, page, perPage)
+		data, total, err = self.catalogStorage.pathFilter(fpath, fop, fvalue, page, perPage, unhealthy)
 		data = self.collectionFromServices(data.([]Service), page, perPage, total)
 		if data.(*Collection).Total == 0 {
 			data = nil
@@ -198,8 +202,16 @@ func (self WritableCatalogAPI) Add(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if !authorizeWrite(w, req, s.Id) || !rejectImported(w, s.Id, s.Meta) {
+		return
+	}
+
 	err = self.catalogStorage.add(s)
-	if err != nil {
+	if err == catalog.ErrorQuotaExceeded {
+		w.WriteHeader(catalog.StatusTooManyRequests)
+		fmt.Fprintf(w, "Error creating the registration: %s\n", err.Error())
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, "Error creating the service: %s\n", err.Error())
 		return
@@ -226,6 +238,10 @@ func (self WritableCatalogAPI) Update(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	if !authorizeWrite(w, req, id) || !rejectImported(w, id, s.Meta) {
+		return
+	}
+
 	err = self.catalogStorage.update(id, s)
 	if err == ErrorNotFound {
 		w.WriteHeader(http.StatusNotFound)
@@ -246,6 +262,10 @@ func (self WritableCatalogAPI) Delete(w http.ResponseWriter, req *http.Request)
 	params := mux.Vars(req)
 	id := fmt.Sprintf("%v/%v", params["hostid"], params["regid"])
 
+	if !authorizeWrite(w, req, id) || !rejectImported(w, id, nil) {
+		return
+	}
+
 	err := self.catalogStorage.delete(id)
 	if err == ErrorNotFound {
 		w.WriteHeader(http.StatusNotFound)
@@ -261,3 +281,24 @@ func (self WritableCatalogAPI) Delete(w http.ResponseWriter, req *http.Request)
 	w.WriteHeader(http.StatusOK)
 	return
 }
+
+// Responds with 403 Forbidden if the principal of the request may not modify the entry
+func authorizeWrite(w http.ResponseWriter, req *http.Request, id string) bool {
+	err := auth.AuthorizeWrite(req, id)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "Not allowed to modify the registration: %s\n", err.Error())
+		return false
+	}
+	return true
+}
+
+// Responds with 403 Forbidden if the request modifies a service reserved for the importer
+func rejectImported(w http.ResponseWriter, id string, meta map[string]interface{}) bool {
+	if _, ok := meta[MetaImportedFrom]; ok || isImported(id) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "Not allowed to modify the services imported from DNS-SD: %s\n", id)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/discovery"
+)
+
+const (
+	// Meta key of the type of a service, which it is found by in addition to its name
+	MetaServiceType = "serviceType"
+	// TTL of the records of services which do not expire (seconds)
+	DefaultDNSTTL = 30
+	// Interval of the indexing of the services by their labels
+	DefaultDNSIndexInterval = time.Second
+
+	dnsServiceLabel  = "service"
+	dnsInstanceLabel = "instance"
+	maxLabel         = 63
+)
+
+// DNS interface of a catalog answering the A, AAAA, SRV and TXT queries of:
+// <name>.service.<domain> - the healthy services by name or meta.serviceType
+// (also as _<name>._<proto>.service.<domain>)
+// <id>.instance.<domain> - a healthy service by id (the targets of the SRV records)
+// Names and ids are matched as DNS labels: lower case, with the characters
+// other than letters and digits replaced by dashes (e.g. host-mqtt for host/mqtt).
+// Ids with the same label are told apart by a hash of the id (e.g. host-mqtt-1c0e3e6a).
+// The TTL of the records is the time until the registration expires.
+// The services are indexed by label at most once per index interval
+type DNSHandler struct {
+	storage       CatalogStorage
+	domain        string
+	indexInterval time.Duration
+	index         *dnsIndex
+	mutex         sync.Mutex
+}
+
+// Services by label
+type dnsIndex struct {
+	// services by the labels of their names and service types
+	services map[string][]Service
+	// services by their unique instance labels
+	instances map[string]Service
+	// unique instance labels by id
+	labels  map[string]string
+	created time.Time
+}
+
+// Creates the DNS interface of the storage for names in the domain (e.g. pw.local)
+func NewDNSHandler(storage CatalogStorage, domain string) *DNSHandler {
+	return &DNSHandler{
+		storage:       storage,
+		domain:        strings.ToLower(dns.Fqdn(domain)),
+		indexInterval: DefaultDNSIndexInterval,
+	}
+}
+
+func (self *DNSHandler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = true
+
+	index := self.currentIndex()
+	for _, q := range req.Question {
+		services, ok := self.lookup(index, q.Name)
+		if !ok {
+			m.Authoritative = false
+			m.Rcode = dns.RcodeRefused
+			break
+		}
+		if len(services) == 0 {
+			m.Rcode = dns.RcodeNameError
+			continue
+		}
+		now := time.Now()
+		for _, s := range services {
+			i, err := serviceInstance(s, catalog.ParseEntryInstance)
+			if err != nil {
+				continue
+			}
+			answers, extra := self.records(q, s, index.labels[s.Id], i, dnsTTL(s, now))
+			m.Answer = append(m.Answer, answers...)
+			m.Extra = append(m.Extra, extra...)
+		}
+	}
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		truncate(m, req)
+	}
+	w.WriteMsg(m)
+}
+
+// Truncates a UDP response to the size of the request (512 bytes or its EDNS0
+// size), dropping the additional records and then answers and setting the TC bit
+func truncate(m *dns.Msg, req *dns.Msg) {
+	size := dns.MinMsgSize
+	opt := req.IsEdns0()
+	if opt != nil && int(opt.UDPSize()) > size {
+		size = int(opt.UDPSize())
+	}
+	if opt != nil {
+		m.SetEdns0(uint16(size), false)
+	}
+	if packedLen(m) <= size {
+		return
+	}
+	m.Truncated = true
+	m.Extra = nil
+	if opt != nil {
+		m.SetEdns0(uint16(size), false)
+	}
+	for len(m.Answer) > 0 && packedLen(m) > size {
+		m.Answer = m.Answer[:len(m.Answer)-1]
+	}
+}
+
+// Returns the length of the message in wire format
+func packedLen(m *dns.Msg) int {
+	b, err := m.Pack()
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// Returns the index of the services, indexing them again after the index interval
+func (self *DNSHandler) currentIndex() *dnsIndex {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.index != nil && time.Since(self.index.created) < self.indexInterval {
+		return self.index
+	}
+
+	index := &dnsIndex{
+		services:  make(map[string][]Service),
+		instances: make(map[string]Service),
+		labels:    make(map[string]string),
+		created:   time.Now(),
+	}
+	ids := make(map[string][]string)
+	byId := make(map[string]Service)
+	err := self.each(func(s Service) {
+		index.services[dnsLabel(s.Name)] = append(index.services[dnsLabel(s.Name)], s)
+		if serviceType, _ := s.Meta[MetaServiceType].(string); serviceType != "" && dnsLabel(serviceType) != dnsLabel(s.Name) {
+			index.services[dnsLabel(serviceType)] = append(index.services[dnsLabel(serviceType)], s)
+		}
+		ids[dnsLabel(s.Id)] = append(ids[dnsLabel(s.Id)], s.Id)
+		byId[s.Id] = s
+	})
+	if err != nil {
+		logger.Printf("DNSHandler.currentIndex() ERROR: %v", err)
+		if self.index != nil {
+			return self.index
+		}
+	}
+	for label, group := range ids {
+		for _, id := range group {
+			if len(group) == 1 {
+				index.labels[id] = label
+			} else {
+				index.labels[id] = uniqueLabel(label, id)
+			}
+			index.instances[index.labels[id]] = byId[id]
+		}
+	}
+	self.index = index
+	return index
+}
+
+// Returns the services of a name (false if the name is not in the domain)
+func (self *DNSHandler) lookup(index *dnsIndex, name string) ([]Service, bool) {
+	name = strings.ToLower(dns.Fqdn(name))
+	if !strings.HasSuffix(name, "."+self.domain) {
+		return nil, false
+	}
+	labels := dns.SplitDomainName(strings.TrimSuffix(name, "."+self.domain))
+	// _<name>._<proto>.service
+	if len(labels) == 3 && strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_") {
+		labels = []string{strings.TrimPrefix(labels[0], "_"), labels[2]}
+	}
+	if len(labels) != 2 {
+		return nil, true
+	}
+
+	var candidates []Service
+	switch labels[1] {
+	case dnsServiceLabel:
+		candidates = index.services[labels[0]]
+	case dnsInstanceLabel:
+		if s, ok := index.instances[labels[0]]; ok {
+			candidates = []Service{s}
+		}
+	}
+	var services []Service
+	now := time.Now()
+	for _, s := range candidates {
+		// unhealthy or expired
+		if s.Status != StatusFailing && (s.Ttl < 0 || s.Expires.After(now)) {
+			services = append(services, s)
+		}
+	}
+	return services, true
+}
+
+// Calls fn with every service in the storage
+func (self *DNSHandler) each(fn func(s Service)) error {
+	for page := 1; ; page++ {
+		services, total, err := self.storage.getMany(page, MaxPerPage)
+		if err != nil {
+			return err
+		}
+		for _, s := range services {
+			fn(s)
+		}
+		if page*MaxPerPage >= total {
+			return nil
+		}
+	}
+}
+
+// Returns the answers and additional records of the service for the question
+func (self *DNSHandler) records(q dns.Question, s Service, label string, i discovery.Instance, ttl uint32) ([]dns.RR, []dns.RR) {
+	header := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+	}
+	// the addresses of the instance are only known for urls with an IP
+	target := dns.Fqdn(i.Host)
+	var addrs []dns.RR
+	if i.IPv4 != nil || i.IPv6 != nil {
+		target = label + "." + dnsInstanceLabel + "." + self.domain
+		if i.IPv4 != nil {
+			addrs = append(addrs, &dns.A{Hdr: header(target, dns.TypeA), A: i.IPv4})
+		}
+		if i.IPv6 != nil {
+			addrs = append(addrs, &dns.AAAA{Hdr: header(target, dns.TypeAAAA), AAAA: i.IPv6})
+		}
+	}
+
+	switch q.Qtype {
+	case dns.TypeA, dns.TypeAAAA:
+		var answers []dns.RR
+		for _, rr := range addrs {
+			if rr.Header().Rrtype == q.Qtype {
+				rr = dns.Copy(rr)
+				rr.Header().Name = q.Name
+				answers = append(answers, rr)
+			}
+		}
+		return answers, nil
+	case dns.TypeSRV:
+		srv := &dns.SRV{Hdr: header(q.Name, dns.TypeSRV), Priority: 1, Weight: 1, Port: uint16(i.Port), Target: target}
+		return []dns.RR{srv}, addrs
+	case dns.TypeTXT:
+		return []dns.RR{&dns.TXT{Hdr: header(q.Name, dns.TypeTXT), Txt: i.Text}}, nil
+	}
+	return nil, nil
+}
+
+// Returns the TTL of the records of a service: the time until it expires
+func dnsTTL(s Service, now time.Time) uint32 {
+	if s.Ttl < 0 {
+		return DefaultDNSTTL
+	}
+	ttl := s.Expires.Sub(now) / time.Second
+	if ttl < 0 {
+		return 0
+	}
+	return uint32(ttl)
+}
+
+// Returns the string as a DNS label (e.g. host-mqtt for host/mqtt)
+func dnsLabel(s string) string {
+	label := []byte(strings.ToLower(s))
+	for i, c := range label {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			label[i] = '-'
+		}
+	}
+	if len(label) > maxLabel {
+		label = label[:maxLabel]
+	}
+	return strings.Trim(string(label), "-")
+}
+
+// Returns the label made unique by a hash of the id (e.g. host-mqtt-1c0e3e6a)
+func uniqueLabel(label, id string) string {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	suffix := fmt.Sprintf("-%08x", h.Sum32())
+	if label == "" {
+		return suffix[1:]
+	}
+	if len(label) > maxLabel-len(suffix) {
+		label = strings.TrimRight(label[:maxLabel-len(suffix)], "-")
+	}
+	return label + suffix
+}
+
+// Serves the DNS handler on UDP and TCP at the address (host:port) until an error occurs
+func ListenAndServeDNS(addr string, handler dns.Handler) error {
+	errCh := make(chan error, 2)
+	for _, network := range []string{"udp", "tcp"} {
+		go func(network string) {
+			server := &dns.Server{Addr: addr, Net: network, Handler: handler}
+			errCh <- fmt.Errorf("DNS server (%v) error: %v", network, server.ListenAndServe())
+		}(network)
+	}
+	return <-errCh
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/miekg/dns"
+)
+
+func TestDNSHandler(t *testing.T) {
+	storage := NewMemoryStorage()
+	for _, s := range []Service{
+		{Id: "host/mqtt", Name: "MQTT Broker", Ttl: 60, Meta: map[string]interface{}{MetaServiceType: "mqtt"},
+			Protocols: []Protocol{{Type: "MQTT", Endpoint: map[string]interface{}{"url": "mqtt://10.0.0.1:1883"}}}},
+		{Id: "host/backup", Name: "Backup", Ttl: -1, Meta: map[string]interface{}{MetaServiceType: "mqtt"},
+			Protocols: []Protocol{{Type: "MQTT", Endpoint: map[string]interface{}{"url": "mqtt://broker.example.com:1884"}}}},
+		{Id: "host/failing", Name: "Failing", Ttl: 60, Meta: map[string]interface{}{MetaServiceType: "mqtt"},
+			Protocols: []Protocol{{Type: "MQTT", Endpoint: map[string]interface{}{"url": "mqtt://10.0.0.3:1883"}}}},
+	} {
+		if err := storage.add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	storage.setStatus("host/failing", StatusFailing, "")
+
+	query, shutdown := serveDNS(t, storage)
+	defer shutdown()
+
+	// by name
+	r := query(question("mqtt-broker.service.pw.local.", dns.TypeA))
+	if len(r.Answer) != 1 || !r.Answer[0].(*dns.A).A.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Unexpected A answer: %v", r.Answer)
+	} else if ttl := r.Answer[0].Header().Ttl; ttl == 0 || ttl > 60 {
+		t.Errorf("Expected the TTL until the expiry, got %v", ttl)
+	}
+
+	// by type, healthy services only
+	r = query(question("_mqtt._tcp.service.pw.local.", dns.TypeSRV))
+	targets := make(map[string]uint16)
+	for _, rr := range r.Answer {
+		srv := rr.(*dns.SRV)
+		targets[srv.Target] = srv.Port
+	}
+	if len(targets) != 2 || targets["host-mqtt.instance.pw.local."] != 1883 || targets["broker.example.com."] != 1884 {
+		t.Errorf("Unexpected SRV answer: %v", r.Answer)
+	}
+	if len(r.Extra) != 1 || r.Extra[0].Header().Name != "host-mqtt.instance.pw.local." {
+		t.Errorf("Expected the address of the instance, got %v", r.Extra)
+	}
+	r = query(question("host-mqtt.instance.pw.local.", dns.TypeA))
+	if len(r.Answer) != 1 {
+		t.Errorf("Unexpected A answer of the instance: %v", r.Answer)
+	}
+
+	r = query(question("backup.service.pw.local.", dns.TypeTXT))
+	if len(r.Answer) != 1 || r.Answer[0].Header().Ttl != DefaultDNSTTL {
+		t.Fatalf("Unexpected TXT answer: %v", r.Answer)
+	}
+	found := false
+	for _, txt := range r.Answer[0].(*dns.TXT).Txt {
+		found = found || txt == "id=host/backup"
+	}
+	if !found {
+		t.Errorf("Expected the id TXT record, got %v", r.Answer[0])
+	}
+
+	if r = query(question("failing.service.pw.local.", dns.TypeA)); r.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected NXDOMAIN for an unhealthy service, got %v", dns.RcodeToString[r.Rcode])
+	}
+	if r = query(question("example.org.", dns.TypeA)); r.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected a refusal outside the domain, got %v", dns.RcodeToString[r.Rcode])
+	}
+}
+
+func TestDNSHandlerUniqueLabels(t *testing.T) {
+	storage := NewMemoryStorage()
+	addresses := map[string]string{"host/mqtt": "10.0.0.1", "host-/mqtt": "10.0.0.2", "Host/MQTT": "10.0.0.3"}
+	for id, ip := range addresses {
+		err := storage.add(Service{Id: id, Name: "MQTT Broker", Ttl: 60,
+			Protocols: []Protocol{{Type: "MQTT", Endpoint: map[string]interface{}{"url": "mqtt://" + ip + ":1883"}}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	query, shutdown := serveDNS(t, storage)
+	defer shutdown()
+
+	r := query(question("_mqtt-broker._tcp.service.pw.local.", dns.TypeSRV))
+	if len(r.Answer) != len(addresses) {
+		t.Fatalf("Unexpected SRV answer: %v", r.Answer)
+	}
+	found := make(map[string]bool)
+	for _, rr := range r.Answer {
+		target := rr.(*dns.SRV).Target
+		a := query(question(target, dns.TypeA))
+		if len(a.Answer) != 1 {
+			t.Fatalf("Expected a single address of %v, got %v", target, a.Answer)
+		}
+		found[a.Answer[0].(*dns.A).A.String()] = true
+	}
+	if len(found) != len(addresses) {
+		t.Errorf("Expected distinct addresses of the instances, got %v", found)
+	}
+}
+
+func TestDNSHandlerTruncation(t *testing.T) {
+	storage := NewMemoryStorage()
+	for k := 0; k < 20; k++ {
+		err := storage.add(Service{Id: fmt.Sprintf("host/mqtt-%d", k), Name: "MQTT Broker", Ttl: 60,
+			Protocols: []Protocol{{Type: "MQTT", Endpoint: map[string]interface{}{"url": fmt.Sprintf("mqtt://10.0.1.%d:1883", k)}}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	query, shutdown := serveDNS(t, storage)
+	defer shutdown()
+
+	// the client drops the records of a truncated response
+	if r := query(question("_mqtt-broker._tcp.service.pw.local.", dns.TypeSRV)); !r.Truncated {
+		t.Errorf("Expected a truncated response over 512 bytes, got %v answers", len(r.Answer))
+	}
+	m := question("_mqtt-broker._tcp.service.pw.local.", dns.TypeSRV)
+	m.SetEdns0(dns.DefaultMsgSize, false)
+	r := query(m)
+	if r.Truncated || len(r.Answer) != 20 || r.IsEdns0() == nil {
+		t.Errorf("Expected all answers within the EDNS0 size, got %v (TC %v)", len(r.Answer), r.Truncated)
+	}
+
+	// as many answers as fit
+	m = new(dns.Msg)
+	m.SetReply(question("_mqtt-broker._tcp.service.pw.local.", dns.TypeSRV))
+	for k := 0; k < 20; k++ {
+		m.Answer = append(m.Answer, &dns.SRV{Hdr: dns.RR_Header{Name: "_mqtt-broker._tcp.service.pw.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET},
+			Port: 1883, Target: fmt.Sprintf("host-mqtt-%d.instance.pw.local.", k)})
+	}
+	truncate(m, question("_mqtt-broker._tcp.service.pw.local.", dns.TypeSRV))
+	if b, _ := m.Pack(); !m.Truncated || len(m.Answer) == 0 || len(b) > dns.MinMsgSize {
+		t.Errorf("Expected the answers within 512 bytes, got %v in %v bytes", len(m.Answer), len(b))
+	}
+}
+
+// Serves the DNS handler of the storage for pw.local on UDP. Returns the query function and the shutdown
+func serveDNS(t *testing.T, storage CatalogStorage) (func(*dns.Msg) *dns.Msg, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// short read timeout for a quick shutdown
+	server := &dns.Server{PacketConn: conn, Handler: NewDNSHandler(storage, "pw.local"), ReadTimeout: 100 * time.Millisecond}
+	go server.ActivateAndServe()
+	query := func(m *dns.Msg) *dns.Msg {
+		r, _, err := new(dns.Client).Exchange(m, conn.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	return query, func() { server.Shutdown() }
+}
+
+func question(name string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	return m
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+func TestNewHandler(t *testing.T) {
+	storage := NewMemoryStorage()
+	writable := httptest.NewServer(NewHandler(storage, HandlerOptions{Location: "/sc", Writable: true, OpenAPI: true}))
+	defer writable.Close()
+	readable := httptest.NewServer(NewHandler(storage, HandlerOptions{Location: "/sc"}))
+	defer readable.Close()
+
+	s := &Service{Id: "host/ServiceName", Name: "ServiceName", Ttl: 30}
+	if err := NewRemoteCatalogClient(writable.URL+"/sc", nil).Add(s); err != nil {
+		t.Fatalf("Unexpected error on add: %v", err)
+	}
+
+	client := NewRemoteCatalogClient(readable.URL+"/sc", nil)
+	sg, err := client.Get(s.Id)
+	if err != nil || sg.Name != s.Name {
+		t.Errorf("Unexpected service: %v (%v)", sg, err)
+	}
+	if err := client.Delete(s.Id); err == nil {
+		t.Error("Expected the read-only handler to reject the delete")
+	}
+
+	for _, c := range []struct {
+		url    string
+		status int
+	}{
+		{writable.URL + catalog.OpenAPILocation, http.StatusOK},
+		{readable.URL + catalog.OpenAPILocation, http.StatusNotFound},
+	} {
+		res, err := http.Get(c.url)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		res.Body.Close()
+		if res.StatusCode != c.status {
+			t.Errorf("%s: expected status %d, got %d", c.url, c.status, res.StatusCode)
+		}
+	}
+}
+
+func TestMountNamedRoutes(t *testing.T) {
+	r := mux.NewRouter().StrictSlash(true)
+	Mount(r, NewMemoryStorage(), HandlerOptions{Location: "/sc", Name: "sc"})
+	Mount(r, NewMemoryStorage(), HandlerOptions{Location: "/sc2", Name: "sc2"})
+
+	for name, path := range map[string]string{"sc-list": "/sc", "sc2-list": "/sc2"} {
+		route := r.Get(name)
+		if route == nil {
+			t.Errorf("Expected a route named %s", name)
+			continue
+		}
+		if u, err := route.URL(); err != nil || u.Path != path {
+			t.Errorf("Expected the route %s to serve %s, got %v (%v)", name, path, u, err)
+		}
+	}
+}
+
+func TestRejectImported(t *testing.T) {
+	storage := NewMemoryStorage()
+	imported := Service{Id: "dnssd/broker._mqtt._tcp", Name: "Broker", Ttl: 60}
+	if err := storage.add(imported); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(NewHandler(storage, HandlerOptions{Location: "/sc", Writable: true}))
+	defer server.Close()
+	client := NewRemoteCatalogClient(server.URL+"/sc", nil)
+
+	if err := client.Add(&Service{Id: "dnssd/other._mqtt._tcp", Name: "Other", Ttl: 60}); err == nil {
+		t.Error("Expected the add of an imported id to be rejected")
+	}
+	meta := map[string]interface{}{MetaImportedFrom: "_mqtt._tcp"}
+	if err := client.Add(&Service{Id: "host/other", Name: "Other", Ttl: 60, Meta: meta}); err == nil {
+		t.Error("Expected the add with the import meta to be rejected")
+	}
+	if err := client.Update(imported.Id, &Service{Id: imported.Id, Name: "Changed", Ttl: 60}); err == nil {
+		t.Error("Expected the update of an imported service to be rejected")
+	}
+	if err := client.Delete(imported.Id); err == nil {
+		t.Error("Expected the delete of an imported service to be rejected")
+	}
+	if n := storage.getCount(); n != 1 {
+		t.Errorf("Expected only the imported service, got %v services", n)
+	}
+	if s, _ := storage.get(imported.Id); s.Name != imported.Name {
+		t.Errorf("Expected the imported service unchanged, got %+v", s)
+	}
+}
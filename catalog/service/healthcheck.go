@@ -0,0 +1,453 @@
+package service
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	HealthCheckHTTP = "http"
+	HealthCheckTCP  = "tcp"
+	HealthCheckMQTT = "mqtt"
+
+	StatusUnknown = "unknown"
+	StatusPassing = "passing"
+	StatusFailing = "failing"
+
+	defaultHealthCheckInterval = 30
+	defaultHealthCheckTimeout  = 5
+	maxStatusHistory           = 10
+	healthCheckerTick          = time.Second
+	mqttClientId               = "pw-sc-health"
+)
+
+// Health check of a service declared in its registration.
+// The url in the endpoint of the referenced protocol is checked by:
+// http - GET request expecting a 2xx/3xx response
+// tcp  - TCP connect to the host and port of the url
+// mqtt - MQTT CONNECT to the broker expecting an accepted CONNACK
+type HealthCheck struct {
+	Type string `json:"type"`
+	// Index of the protocol in Protocols
+	Protocol int `json:"protocol"`
+	// Check interval (seconds)
+	Interval int `json:"interval"`
+	// Check timeout (seconds)
+	Timeout int `json:"timeout"`
+}
+
+// Change of the health status of a service
+type StatusChange struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+	Output string    `json:"output,omitempty"`
+}
+
+func (self *HealthCheck) validate(s *Service) bool {
+	switch self.Type {
+	case HealthCheckHTTP, HealthCheckTCP, HealthCheckMQTT:
+	default:
+		return false
+	}
+	if self.Protocol < 0 || self.Protocol >= len(s.Protocols) || self.Interval < 0 || self.Timeout < 0 {
+		return false
+	}
+	return true
+}
+
+func (self *HealthCheck) interval() time.Duration {
+	if self.Interval > 0 {
+		return time.Duration(self.Interval) * time.Second
+	}
+	return defaultHealthCheckInterval * time.Second
+}
+
+func (self *HealthCheck) timeout() time.Duration {
+	if self.Timeout > 0 {
+		return time.Duration(self.Timeout) * time.Second
+	}
+	return defaultHealthCheckTimeout * time.Second
+}
+
+// Targets the health checks may connect to, protecting the networks reachable
+// by the catalog from checks of arbitrary hosts. Entries are IP addresses, CIDR
+// ranges (e.g. 169.254.0.0/16) or host names as given in the endpoint urls.
+// Denied targets take precedence, any target is allowed if none are
+type HealthCheckPolicy struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+func (self *HealthCheckPolicy) Validate() error {
+	for _, e := range append(self.Allow, self.Deny...) {
+		if strings.TrimSpace(e) == "" {
+			return fmt.Errorf("healthCheck targets must not be empty")
+		}
+		if strings.Contains(e, "/") {
+			if _, _, err := net.ParseCIDR(e); err != nil {
+				return fmt.Errorf("healthCheck target %s: %v", e, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Checks if the target host, connected at the given address, may be checked
+func (self *HealthCheckPolicy) permits(name string, ip net.IP) bool {
+	if self == nil {
+		return true
+	}
+	for _, e := range self.Deny {
+		if matchesTarget(e, name, ip) {
+			return false
+		}
+	}
+	if len(self.Allow) == 0 {
+		return true
+	}
+	for _, e := range self.Allow {
+		if matchesTarget(e, name, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesTarget(entry, name string, ip net.IP) bool {
+	if _, n, err := net.ParseCIDR(entry); err == nil {
+		return ip != nil && n.Contains(ip)
+	}
+	if eip := net.ParseIP(entry); eip != nil {
+		return eip.Equal(ip)
+	}
+	return strings.EqualFold(strings.TrimSuffix(entry, "."), strings.TrimSuffix(name, "."))
+}
+
+// Returns a dialer of the host which refuses to connect to the targets not
+// permitted by the policy. The resolved addresses are checked when connecting
+func (self *HealthCheckPolicy) dialer(host string, timeout time.Duration) *net.Dialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if self == nil {
+		return dialer
+	}
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		ip, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if !self.permits(host, net.ParseIP(ip)) {
+			return fmt.Errorf("Health check of %s (%s) is not allowed", host, ip)
+		}
+		return nil
+	}
+	return dialer
+}
+
+// Dials the address (host:port) if permitted by the policy
+func (self *HealthCheckPolicy) dial(network, addr string, timeout time.Duration) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	return self.dialer(host, timeout).Dial(network, addr)
+}
+
+// Runs the health check of the service. Returns nil if the service is healthy
+func RunHealthCheck(s *Service) error {
+	return RunHealthCheckWithPolicy(s, nil)
+}
+
+// Runs the health check of the service if its target is permitted by the policy
+// (any target if nil). Returns nil if the service is healthy
+func RunHealthCheckWithPolicy(s *Service, policy *HealthCheckPolicy) error {
+	hc := s.HealthCheck
+	if hc == nil {
+		return fmt.Errorf("Service %s has no health check", s.Id)
+	}
+	if hc.Protocol < 0 || hc.Protocol >= len(s.Protocols) {
+		return fmt.Errorf("Health check protocol %d not found", hc.Protocol)
+	}
+	endpoint, _ := s.Protocols[hc.Protocol].Endpoint["url"].(string)
+	if endpoint == "" {
+		return fmt.Errorf("Protocol %d has no endpoint url", hc.Protocol)
+	}
+
+	switch hc.Type {
+	case HealthCheckHTTP:
+		return checkHTTP(endpoint, hc.timeout(), policy)
+	case HealthCheckTCP:
+		conn, err := dialEndpoint(endpoint, hc.timeout(), policy)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case HealthCheckMQTT:
+		return checkMQTT(endpoint, hc.timeout(), policy)
+	}
+	return fmt.Errorf("Unknown health check type %s", hc.Type)
+}
+
+// Redirects are followed to the targets permitted by the policy only
+func checkHTTP(endpoint string, timeout time.Duration, policy *HealthCheckPolicy) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return policy.dial(network, addr, timeout)
+			},
+			ResponseHeaderTimeout: timeout,
+			DisableKeepAlives:     true,
+		},
+	}
+	res, err := client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("GET %s: %s", endpoint, res.Status)
+	}
+	return nil
+}
+
+// Connects to the host and port of an endpoint url (or host:port).
+// TLS is used for the https, ssl, tls and mqtts schemes
+func dialEndpoint(endpoint string, timeout time.Duration, policy *HealthCheckPolicy) (net.Conn, error) {
+	host := endpoint
+	useTLS := false
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		host = u.Host
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, defaultPort(u.Scheme))
+		}
+		switch u.Scheme {
+		case "https", "ssl", "tls", "mqtts":
+			useTLS = true
+		}
+	}
+
+	name, _, err := net.SplitHostPort(host)
+	if err != nil {
+		return nil, err
+	}
+	dialer := policy.dialer(name, timeout)
+	if useTLS {
+		return tls.DialWithDialer(dialer, "tcp", host, nil)
+	}
+	return dialer.Dial("tcp", host)
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	case "ssl", "tls", "mqtts":
+		return "8883"
+	}
+	return "1883"
+}
+
+// Connects to an MQTT broker (MQTT 3.1.1) and disconnects after the CONNACK
+func checkMQTT(endpoint string, timeout time.Duration, policy *HealthCheckPolicy) error {
+	conn, err := dialEndpoint(endpoint, timeout, policy)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	clientId := fmt.Sprintf("%s-%d", mqttClientId, time.Now().UnixNano()%100000)
+	// variable header: protocol name, level 4, clean session, keepalive 0
+	payload := []byte{0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x00}
+	payload = append(payload, byte(len(clientId)>>8), byte(len(clientId)))
+	payload = append(payload, clientId...)
+	packet := append([]byte{0x10, byte(len(payload))}, payload...)
+	if _, err = conn.Write(packet); err != nil {
+		return err
+	}
+
+	connack := make([]byte, 4)
+	if _, err = io.ReadFull(conn, connack); err != nil {
+		return err
+	}
+	if connack[0] != 0x20 || connack[1] != 0x02 {
+		return fmt.Errorf("Unexpected MQTT response from %s", endpoint)
+	}
+	if connack[3] != 0x00 {
+		return fmt.Errorf("MQTT connection refused by %s (code %d)", endpoint, connack[3])
+	}
+	conn.Write([]byte{0xe0, 0x00})
+	return nil
+}
+
+// Appends a status change keeping the last maxStatusHistory changes
+func appendStatus(history []StatusChange, change StatusChange) []StatusChange {
+	history = append(history, change)
+	if len(history) > maxStatusHistory {
+		history = history[len(history)-maxStatusHistory:]
+	}
+	return history
+}
+
+// Filtering on the status itself requests unhealthy services
+func requestsStatus(path string) bool {
+	return path == "status" || strings.HasPrefix(path, "statusHistory")
+}
+
+// Runs the health checks of the services in a storage on their intervals
+// and maintains their status
+type HealthChecker struct {
+	// Targets the checks may connect to (any if nil)
+	Policy *HealthCheckPolicy
+	// Services are checked only while it returns true (e.g. on the primary
+	// of replicated catalogs), always if nil
+	Active func() bool
+
+	storage     CatalogStorage
+	minInterval time.Duration
+	// time of the last check and checks in progress by service id
+	checked map[string]time.Time
+	running map[string]bool
+	stopCh  chan bool
+	mutex   sync.Mutex
+}
+
+// Creates a health checker of the storage.
+// minInterval (seconds) limits the check interval requested by the services
+func NewHealthChecker(storage CatalogStorage, minInterval int) *HealthChecker {
+	return &HealthChecker{
+		storage:     storage,
+		minInterval: time.Duration(minInterval) * time.Second,
+		checked:     make(map[string]time.Time),
+		running:     make(map[string]bool),
+	}
+}
+
+// Starts checking in the background
+func (self *HealthChecker) Start() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.stopCh != nil {
+		return
+	}
+	self.stopCh = make(chan bool)
+	go func(stopCh chan bool) {
+		ticker := time.NewTicker(healthCheckerTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case now := <-ticker.C:
+				self.checkDue(now, false)
+			}
+		}
+	}(self.stopCh)
+}
+
+// Stops checking
+func (self *HealthChecker) Stop() {
+	self.mutex.Lock()
+	if self.stopCh != nil {
+		close(self.stopCh)
+		self.stopCh = nil
+	}
+	self.mutex.Unlock()
+}
+
+// Checks all services with a health check and waits for the results
+func (self *HealthChecker) CheckAll() {
+	self.checkDue(time.Now(), true)
+}
+
+// Starts the checks which are due (all checks if all is set, waiting for their results)
+func (self *HealthChecker) checkDue(now time.Time, all bool) {
+	if self.Active != nil && !self.Active() {
+		return
+	}
+	var wg sync.WaitGroup
+	seen := make(map[string]bool)
+	for page := 1; ; page++ {
+		services, total, err := self.storage.getMany(page, MaxPerPage)
+		if err != nil || len(services) == 0 {
+			break
+		}
+		for _, s := range services {
+			seen[s.Id] = true
+			if s.HealthCheck == nil || !self.due(s, now, all) {
+				continue
+			}
+			wg.Add(1)
+			go func(s Service) {
+				self.check(s)
+				wg.Done()
+			}(s)
+		}
+		if page*MaxPerPage >= total {
+			break
+		}
+	}
+
+	// forget removed services
+	self.mutex.Lock()
+	for id := range self.checked {
+		if !seen[id] {
+			delete(self.checked, id)
+		}
+	}
+	self.mutex.Unlock()
+
+	if all {
+		wg.Wait()
+	}
+}
+
+// Checks if the service is due and marks it as running
+func (self *HealthChecker) due(s Service, now time.Time, all bool) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.running[s.Id] {
+		return false
+	}
+	interval := s.HealthCheck.interval()
+	if interval < self.minInterval {
+		interval = self.minInterval
+	}
+	if !all && now.Sub(self.checked[s.Id]) < interval {
+		return false
+	}
+	self.running[s.Id] = true
+	return true
+}
+
+func (self *HealthChecker) check(s Service) {
+	status, output := StatusPassing, ""
+	if err := RunHealthCheckWithPolicy(&s, self.Policy); err != nil {
+		status, output = StatusFailing, err.Error()
+	}
+	if status != s.Status {
+		logger.Printf("HealthChecker.check() Service %s is %s %s", s.Id, status, output)
+	}
+	err := self.storage.setStatus(s.Id, status, output)
+	if err != nil && err != ErrorNotFound {
+		logger.Printf("HealthChecker.check() ERROR: %v", err)
+	}
+
+	self.mutex.Lock()
+	self.checked[s.Id] = time.Now()
+	delete(self.running, s.Id)
+	self.mutex.Unlock()
+}
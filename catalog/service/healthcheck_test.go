@@ -0,0 +1,223 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/patchwork-toolkit/patchwork/catalog/replication"
+)
+
+func healthCheckedService(id, checkType, url string) Service {
+	return Service{
+		Id:          id,
+		Name:        id,
+		Ttl:         60,
+		Protocols:   []Protocol{{Type: "REST", Endpoint: map[string]interface{}{"url": url}}},
+		HealthCheck: &HealthCheck{Type: checkType},
+	}
+}
+
+// Accepts a single MQTT connection and answers the CONNECT with the given return code
+func fakeBroker(t *testing.T, code byte) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		header := make([]byte, 2)
+		if _, err := conn.Read(header); err != nil || header[0] != 0x10 {
+			return
+		}
+		conn.Read(make([]byte, header[1]))
+		conn.Write([]byte{0x20, 0x02, 0x00, code})
+	}()
+	return l
+}
+
+func TestRunHealthCheck(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	broker := fakeBroker(t, 0)
+	defer broker.Close()
+	refusing := fakeBroker(t, 5)
+	defer refusing.Close()
+
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed.Close()
+
+	for _, c := range []struct {
+		checkType string
+		url       string
+		healthy   bool
+	}{
+		{HealthCheckHTTP, ts.URL + "/ok", true},
+		{HealthCheckHTTP, ts.URL + "/broken", false},
+		{HealthCheckTCP, ts.URL, true},
+		{HealthCheckTCP, "tcp://" + closed.Addr().String(), false},
+		{HealthCheckMQTT, "tcp://" + broker.Addr().String(), true},
+		{HealthCheckMQTT, "tcp://" + refusing.Addr().String(), false},
+	} {
+		s := healthCheckedService("host/svc", c.checkType, c.url)
+		err := RunHealthCheck(&s)
+		if (err == nil) != c.healthy {
+			t.Errorf("%s check of %s: expected healthy=%v, got %v", c.checkType, c.url, c.healthy, err)
+		}
+	}
+}
+
+func TestRunHealthCheckWithPolicy(t *testing.T) {
+	redirected := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/redirect" {
+			// redirect to another loopback address
+			http.Redirect(w, req, "http://"+strings.Replace(req.Host, "127.0.0.1", "127.0.0.2", 1)+"/ok", http.StatusFound)
+			redirected++
+		}
+	}))
+	defer ts.Close()
+	ts.URL = strings.Replace(ts.URL, "http://", "", 1)
+
+	for _, c := range []struct {
+		policy    *HealthCheckPolicy
+		checkType string
+		url       string
+		allowed   bool
+	}{
+		{nil, HealthCheckHTTP, "http://" + ts.URL, true},
+		{&HealthCheckPolicy{}, HealthCheckHTTP, "http://" + ts.URL, true},
+		{&HealthCheckPolicy{Deny: []string{"127.0.0.0/8"}}, HealthCheckHTTP, "http://" + ts.URL, false},
+		{&HealthCheckPolicy{Deny: []string{"127.0.0.0/8"}}, HealthCheckTCP, "tcp://" + ts.URL, false},
+		{&HealthCheckPolicy{Deny: []string{"127.0.0.1"}}, HealthCheckMQTT, "tcp://" + ts.URL, false},
+		{&HealthCheckPolicy{Allow: []string{"10.0.0.0/8"}}, HealthCheckHTTP, "http://" + ts.URL, false},
+		{&HealthCheckPolicy{Allow: []string{"127.0.0.0/8"}}, HealthCheckHTTP, "http://" + ts.URL, true},
+		{&HealthCheckPolicy{Allow: []string{"127.0.0.0/8"}, Deny: []string{"127.0.0.1"}}, HealthCheckTCP, "tcp://" + ts.URL, false},
+		{&HealthCheckPolicy{Allow: []string{"localhost"}}, HealthCheckHTTP, "http://" + strings.Replace(ts.URL, "127.0.0.1", "localhost", 1), true},
+		{&HealthCheckPolicy{Deny: []string{"LOCALHOST"}}, HealthCheckHTTP, "http://" + strings.Replace(ts.URL, "127.0.0.1", "localhost", 1), false},
+		// the target of a redirect is checked too
+		{&HealthCheckPolicy{Allow: []string{"127.0.0.1"}}, HealthCheckHTTP, "http://" + ts.URL + "/redirect", false},
+	} {
+		s := healthCheckedService("host/svc", c.checkType, c.url)
+		err := RunHealthCheckWithPolicy(&s, c.policy)
+		if c.allowed && err != nil {
+			t.Errorf("%s check of %s with %+v: expected to be allowed, got %v", c.checkType, c.url, c.policy, err)
+		}
+		if !c.allowed && (err == nil || !strings.Contains(err.Error(), "not allowed")) {
+			t.Errorf("%s check of %s with %+v: expected to be refused, got %v", c.checkType, c.url, c.policy, err)
+		}
+	}
+	if redirected == 0 {
+		t.Error("Expected the redirect to be requested")
+	}
+
+	for _, p := range []HealthCheckPolicy{{Allow: []string{"10.0.0.0/33"}}, {Deny: []string{" "}}} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", p)
+		}
+	}
+}
+
+func TestHealthChecker(t *testing.T) {
+	healthy := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	storage := NewMemoryStorage()
+	storage.add(healthCheckedService("host/checked", HealthCheckHTTP, ts.URL))
+	storage.add(Service{Id: "host/unchecked", Name: "unchecked", Ttl: 60})
+
+	s, _ := storage.get("host/checked")
+	if s.Status != StatusUnknown {
+		t.Errorf("Expected a new service to be %s, got %s", StatusUnknown, s.Status)
+	}
+
+	checker := NewHealthChecker(storage, 0)
+	checker.CheckAll()
+	s, _ = storage.get("host/checked")
+	if s.Status != StatusPassing {
+		t.Errorf("Expected %s, got %s", StatusPassing, s.Status)
+	}
+
+	healthy = false
+	checker.CheckAll()
+	s, _ = storage.get("host/checked")
+	if s.Status != StatusFailing || len(s.StatusHistory) != 3 || s.StatusHistory[2].Output == "" {
+		t.Errorf("Expected %s with 3 status changes, got %s %v", StatusFailing, s.Status, s.StatusHistory)
+	}
+	if u, _ := storage.get("host/unchecked"); u.Status != "" {
+		t.Errorf("Expected no status for a service without health check, got %s", u.Status)
+	}
+
+	// unhealthy services are filtered out unless requested
+	_, total, _ := storage.pathFilter("id", "prefix", "host/", 1, 10, false)
+	if total != 1 {
+		t.Errorf("Expected only the healthy service, got %d", total)
+	}
+	_, total, _ = storage.pathFilter("id", "prefix", "host/", 1, 10, true)
+	if total != 2 {
+		t.Errorf("Expected both services when requested, got %d", total)
+	}
+	failing, _ := storage.pathFilterOne("status", "equals", StatusFailing, false)
+	if failing.Id != "host/checked" {
+		t.Errorf("Expected to find the failing service by its status")
+	}
+
+	// status is kept on renewal
+	s.Description = "renewed"
+	storage.update(s.Id, s)
+	s, _ = storage.get("host/checked")
+	if s.Status != StatusFailing || s.Description != "renewed" {
+		t.Errorf("Expected the status to be kept on update, got %s", s.Status)
+	}
+}
+
+func TestHealthCheckerReplicated(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer ts.Close()
+
+	log := replication.NewLog(10)
+	storage := NewReplicatedStorage(NewMemoryStorage(), log)
+	storage.add(healthCheckedService("host/checked", HealthCheckHTTP, ts.URL))
+
+	active := false
+	checker := NewHealthChecker(storage, 0)
+	checker.Active = func() bool { return active }
+	checker.CheckAll()
+	if s, _ := storage.get("host/checked"); s.Status != StatusUnknown {
+		t.Errorf("Expected an inactive checker not to check, got %s", s.Status)
+	}
+
+	// status changes are recorded in the log
+	active = true
+	checker.CheckAll()
+	checker.CheckAll()
+	if log.Seq() != 2 {
+		t.Fatalf("Expected the add and a single status change in the log, got %v entries", log.Seq())
+	}
+	replica := NewReplicatedStorage(NewMemoryStorage(), replication.NewLog(10))
+	entries, _ := log.Since(0, 0)
+	for _, e := range entries {
+		if err := replica.Put(e.Id, e.Data); err != nil {
+			t.Fatalf("Unexpected error applying %v: %v", e.Seq, err)
+		}
+	}
+	if s, _ := replica.get("host/checked"); s.Status != StatusPassing {
+		t.Errorf("Expected the replicated status %s, got %s", StatusPassing, s.Status)
+	}
+}
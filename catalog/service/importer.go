@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/discovery"
+)
+
+const (
+	// Meta key of the services imported from DNS-SD, set to their DNS-SD service type
+	MetaImportedFrom = "importedFrom"
+	// TTL of the imported services (seconds)
+	DefaultImportTtl = 120
+	// Host id of the imported services (the first segment of their ids),
+	// reserved for the importer
+	importHostId = "dnssd"
+)
+
+// Options of an Importer
+type ImporterOptions struct {
+	// Provider of the instances (defaults to multicast DNS)
+	Provider discovery.Provider
+	// Interval between browse queries (defaults to discovery.DefaultBrowseInterval)
+	Interval time.Duration
+	// TTL of the imported services (seconds, defaults to DefaultImportTtl)
+	Ttl int
+	// Address of the imported endpoints: hostname (default), ipv4 or ipv6
+	Prefer discovery.AddressPreference
+}
+
+// Imports the instances of DNS-SD service types as services in a storage.
+// The imported services are refreshed while their instances are announced
+// and deleted when the instances are withdrawn (or expire with their TTL
+// if the importer stops). Instances announcing services of the storage
+// (e.g. by an Announcer) are not imported
+type Importer struct {
+	// Instances are imported only while it returns true (e.g. on the primary
+	// of replicated catalogs), always if nil
+	Active func() bool
+
+	storage  CatalogStorage
+	opts     ImporterOptions
+	browsers []*discovery.Browser
+	// signals changes of the discovered instances
+	changed chan struct{}
+	// serializes the synchronizations
+	mutex sync.Mutex
+}
+
+func NewImporter(storage CatalogStorage, serviceTypes []string, opts ImporterOptions) *Importer {
+	if opts.Ttl <= 0 {
+		opts.Ttl = DefaultImportTtl
+	}
+	self := &Importer{
+		storage: storage,
+		opts:    opts,
+		changed: make(chan struct{}, 1),
+	}
+	for _, serviceType := range serviceTypes {
+		self.browsers = append(self.browsers, discovery.NewBrowser(serviceType, discovery.BrowserOptions{
+			Provider: opts.Provider,
+			Interval: opts.Interval,
+			Handler: func(discovery.Event) {
+				select {
+				case self.changed <- struct{}{}:
+				default:
+				}
+			},
+		}))
+	}
+	return self
+}
+
+// Browses and imports until ctx is done (blocking call)
+func (self *Importer) Run(ctx context.Context) {
+	for _, b := range self.browsers {
+		go b.Run(ctx)
+	}
+	// refresh the imported services well before they expire
+	ticker := time.NewTicker(time.Duration(self.opts.Ttl) * time.Second / 3)
+	defer ticker.Stop()
+	// import as soon as the importer becomes active
+	interval := self.opts.Interval
+	if interval <= 0 {
+		interval = discovery.DefaultBrowseInterval
+	}
+	check := time.NewTicker(interval)
+	defer check.Stop()
+	active := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-self.changed:
+		case <-ticker.C:
+		case <-check.C:
+			if self.active() == active {
+				continue
+			}
+		}
+		active = self.active()
+		self.Sync()
+	}
+}
+
+func (self *Importer) active() bool {
+	return self.Active == nil || self.Active()
+}
+
+// Creates, updates and deletes the imported services after the discovered instances
+func (self *Importer) Sync() error {
+	if !self.active() {
+		return nil
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	imported := make(map[string]Service)
+	registered := make(map[string]bool)
+	for page := 1; ; page++ {
+		services, total, err := self.storage.getMany(page, MaxPerPage)
+		if err != nil {
+			logger.Printf("Importer.Sync() ERROR: %v", err)
+			return err
+		}
+		for _, s := range services {
+			if isImported(s.Id) {
+				imported[s.Id] = s
+			} else {
+				registered[s.Id] = true
+			}
+		}
+		if page*MaxPerPage >= total {
+			break
+		}
+	}
+
+	now := time.Now()
+	discovered := make(map[string]bool)
+	for _, b := range self.browsers {
+		for _, i := range b.Instances() {
+			if id, _ := i.TxtValue(discovery.TxtId); registered[id] {
+				// announced by the catalog
+				continue
+			}
+			s := self.service(i)
+			discovered[s.Id] = true
+			old, ok := imported[s.Id]
+			var err error
+			switch {
+			case !ok:
+				logger.Printf("Importer.Sync() Importing %v", s.Id)
+				err = self.storage.add(s)
+			case !old.sameImport(s) || old.Expires.Sub(now) < time.Duration(s.Ttl)*time.Second/2:
+				err = self.storage.update(s.Id, s)
+			}
+			if err != nil {
+				logger.Printf("Importer.Sync() ERROR importing %v: %v", s.Id, err)
+			}
+		}
+	}
+
+	for id := range imported {
+		if !discovered[id] {
+			logger.Printf("Importer.Sync() Deleting %v", id)
+			err := self.storage.delete(id)
+			if err != nil && err != ErrorNotFound {
+				logger.Printf("Importer.Sync() ERROR deleting %v: %v", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the service of a discovered instance
+func (self *Importer) service(i discovery.Instance) Service {
+	name := serviceTypeName(i.Type)
+	meta := make(map[string]interface{}, len(i.Meta)+2)
+	for k, v := range i.Meta {
+		meta[k] = v
+	}
+	meta[MetaServiceType] = name
+	meta[MetaImportedFrom] = strings.Trim(i.Type, ".")
+
+	scheme, ok := i.TxtValue(discovery.TxtScheme)
+	if !ok {
+		scheme = name
+	}
+	path, ok := i.TxtValue("path")
+	if !ok {
+		path, _ = i.TxtValue(discovery.TxtUri)
+	}
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	url := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(i.Address(self.opts.Prefer), strconv.Itoa(i.Port)), path)
+
+	return Service{
+		Id:          importHostId + "/" + importId(i),
+		Type:        ApiRegistrationType,
+		Name:        i.Name,
+		Description: fmt.Sprintf("Imported from DNS-SD (%v)", meta[MetaImportedFrom]),
+		Meta:        meta,
+		Protocols: []Protocol{{
+			Type:     strings.ToUpper(name),
+			Endpoint: map[string]interface{}{"url": url},
+		}},
+		Ttl: self.opts.Ttl,
+	}
+}
+
+// Checks if the imported service is unchanged
+func (self *Service) sameImport(s Service) bool {
+	return self.Name == s.Name && self.Ttl == s.Ttl &&
+		reflect.DeepEqual(self.Meta, s.Meta) && reflect.DeepEqual(self.Protocols, s.Protocols)
+}
+
+// Checks if the id is of an imported service (e.g. dnssd/office-printer._ipp._tcp)
+func isImported(id string) bool {
+	return strings.HasPrefix(id, importHostId+"/")
+}
+
+// Returns the id of the service of an instance (e.g. office-printer-302c4bf5._ipp._tcp).
+// Names which are not labels themselves are told apart by a hash of the name
+func importId(i discovery.Instance) string {
+	label := dnsLabel(i.Name)
+	if label != i.Name {
+		label = uniqueLabel(label, i.Name)
+	}
+	return label + "." + strings.ToLower(strings.Trim(i.Type, "."))
+}
+
+// Returns the name of a DNS-SD service type (e.g. mqtt for _mqtt._tcp)
+func serviceTypeName(serviceType string) string {
+	name := strings.SplitN(strings.Trim(serviceType, "."), ".", 2)[0]
+	return strings.ToLower(strings.TrimPrefix(name, "_"))
+}
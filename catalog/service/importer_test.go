@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/discovery"
+	"github.com/patchwork-toolkit/patchwork/discovery/discoverytest"
+)
+
+func TestImporter(t *testing.T) {
+	server, err := discoverytest.NewDNSServer("example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	storage := NewMemoryStorage()
+	registered := Service{Id: "host/broker", Name: "Registered", Ttl: 60, Protocols: []Protocol{{Type: "MQTT", Endpoint: map[string]interface{}{"url": "mqtt://10.0.0.2:1883"}}}}
+	// imported services are told apart by their ids only
+	unrelated := Service{Id: "host/unrelated", Name: "Unrelated", Ttl: 60, Meta: map[string]interface{}{MetaImportedFrom: "_mqtt._tcp"}}
+	for _, s := range []Service{registered, unrelated} {
+		if err := storage.add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// instances are withdrawn when their records expire
+	broker := discovery.Instance{Name: "Office Broker", Type: "_mqtt._tcp", Host: "broker.example.test", Port: 1883, Text: []string{"version=3.1.1"}, TTL: 1}
+	announced := discovery.Instance{Name: "Registered", Type: "_mqtt._tcp", Host: "10-0-0-2", Port: 1883, Text: []string{"id=host/broker"}, TTL: 1}
+	server.Announce(broker)
+	server.Announce(announced)
+
+	importer := NewImporter(storage, []string{"_mqtt._tcp"}, ImporterOptions{
+		Provider: server.Provider(),
+		Interval: 20 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go importer.Run(ctx)
+
+	id := "dnssd/office-broker-cb7869fe._mqtt._tcp"
+	eventually(t, "import", func() bool {
+		_, err := storage.get(id)
+		return err == nil
+	})
+	s, _ := storage.get(id)
+	if s.Name != "Office Broker" || s.Ttl != DefaultImportTtl || s.Protocols[0].Endpoint["url"] != "mqtt://broker.example.test:1883" {
+		t.Errorf("Unexpected imported service: %+v", s)
+	}
+	for k, v := range map[string]string{MetaServiceType: "mqtt", MetaImportedFrom: "_mqtt._tcp", "version": "3.1.1"} {
+		if s.Meta[k] != v {
+			t.Errorf("Expected meta %v=%v, got %v", k, v, s.Meta)
+		}
+	}
+	if n := storage.getCount(); n != 3 {
+		t.Errorf("Expected the instance of the registered service not to be imported, got %v services", n)
+	}
+
+	server.Withdraw(broker)
+	eventually(t, "deletion", func() bool {
+		_, err := storage.get(id)
+		return err == ErrorNotFound
+	})
+	for _, id := range []string{registered.Id, unrelated.Id} {
+		if _, err := storage.get(id); err != nil {
+			t.Errorf("Expected the registered service %v to be kept: %v", id, err)
+		}
+	}
+}
+
+func TestImportId(t *testing.T) {
+	ids := make(map[string]string)
+	for _, name := range []string{"office-printer", "Office Printer", "office_printer", "Büro", "打印机", "プリンター"} {
+		id := importId(discovery.Instance{Name: name, Type: "_ipp._tcp"})
+		if other, ok := ids[id]; ok {
+			t.Errorf("Expected distinct ids of %q and %q, got %v", name, other, id)
+		}
+		ids[id] = name
+	}
+	if id := importId(discovery.Instance{Name: "office-printer", Type: "_ipp._tcp"}); id != "office-printer._ipp._tcp" {
+		t.Errorf("Expected the name as label, got %v", id)
+	}
+}
+
+func TestImporterInactive(t *testing.T) {
+	server, err := discoverytest.NewDNSServer("example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.Announce(discovery.Instance{Name: "Office Broker", Type: "_mqtt._tcp", Host: "broker.example.test", Port: 1883})
+
+	storage := NewMemoryStorage()
+	importer := NewImporter(storage, []string{"_mqtt._tcp"}, ImporterOptions{
+		Provider: server.Provider(),
+		Interval: 20 * time.Millisecond,
+	})
+	active := false
+	var mutex sync.Mutex
+	importer.Active = func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return active
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go importer.Run(ctx)
+
+	time.Sleep(200 * time.Millisecond)
+	if n := storage.getCount(); n != 0 {
+		t.Fatalf("Expected an inactive importer not to import, got %v services", n)
+	}
+	mutex.Lock()
+	active = true
+	mutex.Unlock()
+	eventually(t, "import", func() bool {
+		return storage.getCount() == 1
+	})
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the %v", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
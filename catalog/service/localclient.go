@@ -0,0 +1,53 @@
+package service
+
+// Client of a catalog storage in the same process
+type LocalCatalogClient struct {
+	localStorage CatalogStorage
+}
+
+func (self *LocalCatalogClient) Add(s *Service) error {
+	// set ttl to -1
+	s.Ttl = -1
+	return self.localStorage.add(*s)
+}
+
+func (self *LocalCatalogClient) Update(id string, s *Service) error {
+	return self.localStorage.update(id, *s)
+}
+
+func (self *LocalCatalogClient) Delete(id string) error {
+	return self.localStorage.delete(id)
+}
+
+func (self *LocalCatalogClient) Get(id string) (*Service, error) {
+	s, err := self.localStorage.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (self *LocalCatalogClient) GetServices(page, perPage int) ([]Service, int, error) {
+	return self.localStorage.getMany(page, perPage)
+}
+
+func (self *LocalCatalogClient) FindService(path, op, value string) (*Service, error) {
+	s, err := self.localStorage.pathFilterOne(path, op, value, false)
+	if err != nil {
+		return nil, err
+	}
+	if s.Id == "" {
+		return nil, ErrorNotFound
+	}
+	return &s, nil
+}
+
+func (self *LocalCatalogClient) FindServices(path, op, value string, page, perPage int) ([]Service, int, error) {
+	return self.localStorage.pathFilter(path, op, value, page, perPage, false)
+}
+
+func NewLocalCatalogClient(storage CatalogStorage) *LocalCatalogClient {
+	return &LocalCatalogClient{
+		localStorage: storage,
+	}
+}
@@ -28,6 +28,13 @@ func (self *MemoryStorage) add(s Service) error {
 	if s.Ttl >= 0 {
 		s.Expires = s.Created.Add(time.Duration(s.Ttl) * time.Second)
 	}
+	// status is maintained by the catalog
+	s.Status = ""
+	s.StatusHistory = nil
+	if s.HealthCheck != nil {
+		s.Status = StatusUnknown
+		s.StatusHistory = []StatusChange{{Status: StatusUnknown, Time: s.Created}}
+	}
 
 	self.mutex.Lock()
 	self.data[s.Id] = s
@@ -37,6 +44,9 @@ func (self *MemoryStorage) add(s Service) error {
 	return nil
 }
 
+// Replaces the registration with the given service: besides the name, type and
+// ttl, its meta, protocols and representation are replaced as a whole (omitted
+// ones are removed). The health status is kept unless the health check changed
 func (self *MemoryStorage) update(id string, s Service) error {
 	self.mutex.Lock()
 
@@ -49,11 +59,23 @@ func (self *MemoryStorage) update(id string, s Service) error {
 	su.Type = s.Type
 	su.Name = s.Name
 	su.Description = s.Description
+	su.Meta = s.Meta
+	su.Protocols = s.Protocols
+	su.Representation = s.Representation
 	su.Ttl = s.Ttl
 	su.Updated = time.Now()
 	if s.Ttl >= 0 {
 		su.Expires = su.Updated.Add(time.Duration(s.Ttl) * time.Second)
 	}
+	// a changed health check starts over
+	if s.HealthCheck == nil {
+		su.Status = ""
+		su.StatusHistory = nil
+	} else if su.HealthCheck == nil || *su.HealthCheck != *s.HealthCheck {
+		su.Status = StatusUnknown
+		su.StatusHistory = appendStatus(su.StatusHistory, StatusChange{Status: StatusUnknown, Time: su.Updated})
+	}
+	su.HealthCheck = s.HealthCheck
 	self.data[id] = su
 	self.mutex.Unlock()
 
@@ -125,14 +147,35 @@ func (self *MemoryStorage) cleanExpired(timestamp time.Time) {
 	self.mutex.Unlock()
 }
 
+// Sets the health status of a service, recording changes in its status history
+func (self *MemoryStorage) setStatus(id string, status, output string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	s, ok := self.data[id]
+	if !ok {
+		return ErrorNotFound
+	}
+	if s.Status != status {
+		s.StatusHistory = appendStatus(s.StatusHistory, StatusChange{Status: status, Time: time.Now(), Output: output})
+		s.Status = status
+		self.data[id] = s
+	}
+	return nil
+}
+
 // Path filtering
 // Filter one registration
-func (self *MemoryStorage) pathFilterOne(path string, op string, value string) (Service, error) {
+func (self *MemoryStorage) pathFilterOne(path string, op string, value string, unhealthy bool) (Service, error) {
 	pathTknz := strings.Split(path, ".")
+	unhealthy = unhealthy || requestsStatus(path)
 
 	self.mutex.RLock()
 	// return the first one found
 	for _, svc := range self.data {
+		if !unhealthy && svc.Status == StatusFailing {
+			continue
+		}
 		matched, err := catalog.MatchObject(svc, pathTknz, op, value)
 		if err != nil {
 			self.mutex.RUnlock()
@@ -148,12 +191,16 @@ func (self *MemoryStorage) pathFilterOne(path string, op string, value string) (
 }
 
 // Filter multiple registrations
-func (self *MemoryStorage) pathFilter(path, op, value string, page, perPage int) ([]Service, int, error) {
+func (self *MemoryStorage) pathFilter(path, op, value string, page, perPage int, unhealthy bool) ([]Service, int, error) {
 	matchedIds := []string{}
 	pathTknz := strings.Split(path, ".")
+	unhealthy = unhealthy || requestsStatus(path)
 
 	self.mutex.RLock()
 	for _, svc := range self.data {
+		if !unhealthy && svc.Status == StatusFailing {
+			continue
+		}
 		matched, err := catalog.MatchObject(svc, pathTknz, op, value)
 		if err != nil {
 			self.mutex.RUnlock()
@@ -164,6 +211,7 @@ func (self *MemoryStorage) pathFilter(path, op, value string, page, perPage int)
 		}
 	}
 
+	sort.Strings(matchedIds)
 	keys := catalog.GetPageOfSlice(matchedIds, page, perPage, MaxPerPage)
 	if len(keys) == 0 {
 		self.mutex.RUnlock()
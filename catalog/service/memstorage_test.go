@@ -11,6 +11,47 @@ func TestNewStorage(t *testing.T) {
 	}
 }
 
+func TestNewLocalCatalogClient(t *testing.T) {
+	storage := NewMemoryStorage()
+	catalogClient := NewLocalCatalogClient(storage)
+	if catalogClient == nil {
+		t.Fail()
+	}
+}
+
+func TestLocalCatalogClient(t *testing.T) {
+	client := NewLocalCatalogClient(NewMemoryStorage())
+	s := &Service{Id: "host/ServiceName", Name: "ServiceName", Ttl: 30}
+	err := client.Add(s)
+	if err != nil {
+		t.Fatalf("Unexpected error on add: %v", err.Error())
+	}
+
+	sg, err := client.Get(s.Id)
+	if err != nil || sg.Name != s.Name || sg.Ttl != -1 {
+		t.Errorf("Unexpected service: %v (%v)", sg, err)
+	}
+	sf, err := client.FindService("name", "equals", s.Name)
+	if err != nil || sf.Id != s.Id {
+		t.Errorf("Unexpected service: %v (%v)", sf, err)
+	}
+	if _, err = client.FindService("name", "equals", "Other"); err != ErrorNotFound {
+		t.Errorf("Expected ErrorNotFound, got %v", err)
+	}
+	ss, total, err := client.FindServices("name", "prefix", "Service", 1, 10)
+	if err != nil || total != 1 || len(ss) != 1 {
+		t.Errorf("Unexpected services: %v total %v (%v)", ss, total, err)
+	}
+
+	err = client.Delete(s.Id)
+	if err != nil {
+		t.Errorf("Unexpected error on delete: %v", err.Error())
+	}
+	if _, err = client.Get(s.Id); err != ErrorNotFound {
+		t.Errorf("Expected ErrorNotFound, got %v", err)
+	}
+}
+
 func TestAddService(t *testing.T) {
 	r := &Service{}
 	uuid := "E9203BE9-D705-42A8-8B12-F28E7EA2FC99"
@@ -54,6 +95,45 @@ func TestUpdateService(t *testing.T) {
 	}
 }
 
+func TestUpdateServiceReplacesMetaAndProtocols(t *testing.T) {
+	storage := NewMemoryStorage()
+	err := storage.add(Service{
+		Id:             "host/svc",
+		Name:           "svc",
+		Ttl:            30,
+		Meta:           map[string]interface{}{"a": "1", "b": "2"},
+		Protocols:      []Protocol{{Type: "REST"}, {Type: "MQTT"}},
+		Representation: map[string]interface{}{"application/json": ""},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error on add: %v", err.Error())
+	}
+
+	err = storage.update("host/svc", Service{
+		Name:      "svc",
+		Ttl:       30,
+		Meta:      map[string]interface{}{"a": "3"},
+		Protocols: []Protocol{{Type: "MQTT"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error on update: %v", err.Error())
+	}
+
+	s, err := storage.get("host/svc")
+	if err != nil {
+		t.Fatalf("Unexpected error on get: %v", err.Error())
+	}
+	if len(s.Meta) != 1 || s.Meta["a"] != "3" {
+		t.Errorf("Expected the meta to be replaced, got %v", s.Meta)
+	}
+	if len(s.Protocols) != 1 || s.Protocols[0].Type != "MQTT" {
+		t.Errorf("Expected the protocols to be replaced, got %v", s.Protocols)
+	}
+	if len(s.Representation) != 0 {
+		t.Errorf("Expected the omitted representation to be removed, got %v", s.Representation)
+	}
+}
+
 func TestGetService(t *testing.T) {
 	r := &Service{
 		Name: "TestName",
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+const (
+	apiMediaType = "application/ld+json"
+)
+
+// OpenAPI schemas of the service catalog entities
+func openAPISchemas() map[string]catalog.OpenAPISchema {
+	object := catalog.OpenAPISchema{"type": "object"}
+	str := catalog.OpenAPISchema{"type": "string"}
+	strs := catalog.OpenAPISchema{"type": "array", "items": str}
+	ts := catalog.OpenAPISchema{"type": "string", "format": "date-time", "readOnly": true}
+
+	return map[string]catalog.OpenAPISchema{
+		"Protocol": {
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type":          str,
+				"endpoint":      object,
+				"methods":       strs,
+				"content-types": strs,
+			},
+		},
+		"Service": {
+			"type":     "object",
+			"required": []string{"id", "name", "ttl"},
+			"properties": map[string]interface{}{
+				"id":             catalog.OpenAPISchema{"type": "string", "description": "{hostid}/{regid}"},
+				"type":           str,
+				"name":           str,
+				"description":    str,
+				"meta":           object,
+				"protocols":      catalog.OpenAPISchema{"type": "array", "items": catalog.OpenAPISchemaRef("Protocol")},
+				"representation": object,
+				"ttl":            catalog.OpenAPISchema{"type": "integer"},
+				"created":        ts,
+				"updated":        ts,
+				"expires":        ts,
+				"healthCheck":    catalog.OpenAPISchemaRef("HealthCheck"),
+				"status": catalog.OpenAPISchema{
+					"type":     "string",
+					"enum":     []string{StatusUnknown, StatusPassing, StatusFailing},
+					"readOnly": true,
+				},
+				"statusHistory": catalog.OpenAPISchema{
+					"type":     "array",
+					"items":    catalog.OpenAPISchemaRef("StatusChange"),
+					"readOnly": true,
+				},
+			},
+		},
+		"HealthCheck": {
+			"type":     "object",
+			"required": []string{"type"},
+			"properties": map[string]interface{}{
+				"type":     catalog.OpenAPISchema{"type": "string", "enum": []string{HealthCheckHTTP, HealthCheckTCP, HealthCheckMQTT}},
+				"protocol": catalog.OpenAPISchema{"type": "integer", "description": "Index of the protocol with the checked endpoint url"},
+				"interval": catalog.OpenAPISchema{"type": "integer", "default": defaultHealthCheckInterval},
+				"timeout":  catalog.OpenAPISchema{"type": "integer", "default": defaultHealthCheckTimeout},
+			},
+		},
+		"StatusChange": {
+			"type": "object",
+			"properties": map[string]interface{}{
+				"status": str,
+				"time":   catalog.OpenAPISchema{"type": "string", "format": "date-time"},
+				"output": str,
+			},
+		},
+		"Collection": {
+			"type": "object",
+			"properties": map[string]interface{}{
+				"@context":    str,
+				"id":          str,
+				"type":        str,
+				"description": str,
+				"services":    catalog.OpenAPISchema{"type": "array", "items": catalog.OpenAPISchemaRef("Service")},
+				"page":        catalog.OpenAPISchema{"type": "integer"},
+				"per_page":    catalog.OpenAPISchema{"type": "integer"},
+				"total":       catalog.OpenAPISchema{"type": "integer"},
+			},
+		},
+	}
+}
+
+// Creates an OpenAPI document of the catalog api mounted at apiLocation.
+// Write operations are only included for a writable catalog
+func NewOpenAPIDocument(apiLocation, description string, writable bool) *catalog.OpenAPIDocument {
+	doc := catalog.NewOpenAPIDocument("Service Catalog", description, ApiVersion)
+	for name, schema := range openAPISchemas() {
+		doc.AddSchema(name, schema)
+	}
+
+	paging := catalog.OpenAPIPagingParameters(GetParamPage, GetParamPerPage, MaxPerPage)
+	notFound := catalog.OpenAPITextResponse("Not found")
+	servicePath := apiLocation + "/{hostid}/{regid}"
+	serviceParams := []catalog.OpenAPIParameter{
+		catalog.OpenAPIPathParameter("hostid", "Host id"),
+		catalog.OpenAPIPathParameter("regid", "Registration id"),
+	}
+
+	doc.AddOperation(apiLocation, "GET", &catalog.OpenAPIOperation{
+		OperationId: "list",
+		Summary:     "Lists services",
+		Parameters:  paging,
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPIContentResponse("Catalog collection", catalog.OpenAPISchemaRef("Collection"), apiMediaType),
+		},
+	})
+	doc.AddOperation(apiLocation+"/{type}/{path}/{op}/{value}", "GET", &catalog.OpenAPIOperation{
+		OperationId: "filter",
+		Summary:     "Filters services by a path in the entries",
+		Parameters: append(append(catalog.OpenAPIFilterParameters([]string{FTypeService, FTypeServices}), paging...),
+			catalog.OpenAPIParameter{
+				Name:        GetParamUnhealthy,
+				In:          "query",
+				Description: "Include services failing their health check",
+				Schema:      catalog.OpenAPISchema{"type": "boolean", "default": false},
+			}),
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPIContentResponse("Matched entries", catalog.OpenAPISchema{
+				"oneOf": []interface{}{
+					catalog.OpenAPISchemaRef("Service"),
+					catalog.OpenAPISchemaRef("Collection"),
+				},
+			}, apiMediaType),
+			"400": catalog.OpenAPITextResponse("Invalid filter"),
+			"404": catalog.OpenAPITextResponse("No matched entries found"),
+		},
+	})
+	doc.AddOperation(servicePath, "GET", &catalog.OpenAPIOperation{
+		OperationId: "get",
+		Summary:     "Retrieves a service",
+		Parameters:  serviceParams,
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPIContentResponse("Service", catalog.OpenAPISchemaRef("Service"), apiMediaType),
+			"404": notFound,
+		},
+	})
+
+	if !writable {
+		return doc
+	}
+
+	body := &catalog.OpenAPIRequestBody{
+		Required: true,
+		Content: map[string]catalog.OpenAPIMediaItem{
+			apiMediaType:       {Schema: catalog.OpenAPISchemaRef("Service")},
+			"application/json": {Schema: catalog.OpenAPISchemaRef("Service")},
+		},
+	}
+	doc.AddOperation(apiLocation+"/", "POST", &catalog.OpenAPIOperation{
+		OperationId: "add",
+		Summary:     "Creates a service registration",
+		RequestBody: body,
+		Responses: map[string]catalog.OpenAPIResponse{
+			"201": catalog.OpenAPITextResponse("Created. The Location header contains the registration URL"),
+			"400": catalog.OpenAPITextResponse("Invalid request body"),
+			"500": catalog.OpenAPITextResponse("Invalid registration"),
+		},
+	})
+	doc.AddOperation(servicePath, "PUT", &catalog.OpenAPIOperation{
+		OperationId: "update",
+		Summary:     "Updates a service registration",
+		Parameters:  serviceParams,
+		RequestBody: body,
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPITextResponse("Updated"),
+			"400": catalog.OpenAPITextResponse("Invalid request body"),
+			"404": notFound,
+		},
+	})
+	doc.AddOperation(servicePath, "DELETE", &catalog.OpenAPIOperation{
+		OperationId: "delete",
+		Summary:     "Deletes a service registration",
+		Parameters:  serviceParams,
+		Responses: map[string]catalog.OpenAPIResponse{
+			"200": catalog.OpenAPITextResponse("Deleted"),
+			"404": notFound,
+		},
+	})
+	return doc
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+)
+
+// Storage enforcing per-owner quotas on services.
+// Owner of a service is its host id (see catalog.EntryOwner)
+type QuotaStorage struct {
+	CatalogStorage
+	quota catalog.QuotaConfig
+	// serializes quota checks with writes
+	mutex sync.Mutex
+}
+
+func NewQuotaStorage(storage CatalogStorage, quota catalog.QuotaConfig) *QuotaStorage {
+	return &QuotaStorage{
+		CatalogStorage: storage,
+		quota:          quota,
+	}
+}
+
+func (self *QuotaStorage) add(s Service) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.quota.MaxServices > 0 {
+		n := self.countByPrefix(catalog.EntryOwner(s.Id) + "/")
+		// a re-added service replaces the stored one
+		if _, err := self.CatalogStorage.get(s.Id); err != nil {
+			n++
+		}
+		if n > self.quota.MaxServices {
+			return catalog.ErrorQuotaExceeded
+		}
+	}
+	return self.CatalogStorage.add(s)
+}
+
+// Returns the number of services with ids starting with prefix
+func (self *MemoryStorage) countByPrefix(prefix string) int {
+	self.mutex.RLock()
+	n := 0
+	for id := range self.data {
+		if strings.HasPrefix(id, prefix) {
+			n++
+		}
+	}
+	self.mutex.RUnlock()
+	return n
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"net/url"
+	"time"
+
+	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+	"github.com/patchwork-toolkit/patchwork/catalog/registrar"
+	"github.com/patchwork-toolkit/patchwork/discovery"
+)
+
+// Registration of a service in a catalog, managed by a registrar.Registrar.
+// A catalog can have several equivalent endpoints: the service is registered
+// at the first available one and registered again at the next endpoint
+// when it fails
+type Registration struct {
+	*registrar.CatalogRegistration
+}
+
+// Returns the registration of the service using the client of a catalog.
+// name identifies the catalog in the status of the registrar
+func NewRegistration(client CatalogClient, name string, s Service) *Registration {
+	return &Registration{registrar.NewCatalogRegistration(s.Id, s.Ttl, name, utils.NewFailover([]string{name}, ""),
+		func(string) registrar.EntryClient {
+			return &serviceClient{client, s}
+		})}
+}
+
+// Returns the registration of the service in the remote catalog at endpoint.
+// If discover is set the endpoint is discovered using DNS-SD and
+// discovered again after a failure
+func NewRemoteRegistration(endpoint string, discover bool, s Service, credentials *auth.Credentials) *Registration {
+	if discover {
+		return NewFailoverRegistration(nil, &utils.DiscoveryOptions{}, s, credentials)
+	}
+	return NewFailoverRegistration([]string{endpoint}, nil, s, credentials)
+}
+
+// Returns the registration of the service in a remote catalog with several
+// equivalent endpoints (in order of preference). If discover is not nil an
+// endpoint discovered using DNS-SD is used after all others fail. Unless
+// other requirements are given, only catalogs with the API type and a version
+// compatible with ApiVersion, or announcing neither (older releases), are discovered
+func NewFailoverRegistration(endpoints []string, discover *utils.DiscoveryOptions, s Service, credentials *auth.Credentials) *Registration {
+	name, failover := registrar.CatalogFailover(endpoints, discover, DNSSDServiceType,
+		discovery.Requirements{ApiType: ApiCollectionType, ApiVersion: ApiVersion})
+	return &Registration{registrar.NewCatalogRegistration(s.Id, s.Ttl, name, failover,
+		func(endpoint string) registrar.EntryClient {
+			// bounded requests, Stop of the registrar waits for them
+			client, err := NewRemoteCatalogClientWithOptions(endpoint, utils.ClientOptions{
+				Credentials: credentials,
+				Timeout:     registrar.RequestTimeout * time.Second,
+			})
+			if err != nil {
+				// reported on requests
+				client = &RemoteCatalogClient{serverEndpoint: &url.URL{}, clientErr: err}
+			}
+			return &serviceClient{client, s}
+		})}
+}
+
+// Registers the service with a catalog client
+type serviceClient struct {
+	client  CatalogClient
+	service Service
+}
+
+func (self *serviceClient) Register() error {
+	s := self.service.copy()
+	err := self.client.Update(s.Id, &s)
+	if err == ErrorNotFound {
+		s = self.service.copy()
+		err = self.client.Add(&s)
+	}
+	return err
+}
+
+func (self *serviceClient) Unregister() error {
+	err := self.client.Delete(self.service.Id)
+	if err == ErrorNotFound {
+		return nil
+	}
+	return err
+}
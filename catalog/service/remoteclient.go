@@ -1,15 +1,20 @@
 package service
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+
+	"github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
 )
 
 type RemoteCatalogClient struct {
 	serverEndpoint *url.URL
+	client         *catalog.RemoteClient
+	clientErr      error
 }
 
 func serviceFromResponse(res *http.Response, apiLocation string) (*Service, error) {
@@ -40,117 +45,174 @@ func servicesFromResponse(res *http.Response, apiLocation string) ([]Service, in
 		svcs = append(svcs, v.unLdify(apiLocation))
 	}
 
-	return svcs, len(svcs), nil
+	return svcs, coll.Total, nil
 }
 
-func NewRemoteCatalogClient(serverEndpoint string) *RemoteCatalogClient {
-	// Check if serverEndpoint is a correct URL
-	endpointUrl, err := url.Parse(serverEndpoint)
+// Creates a client of the catalog at serverEndpoint.
+// credentials are sent with every request (nil for none)
+func NewRemoteCatalogClient(serverEndpoint string, credentials *auth.Credentials) *RemoteCatalogClient {
+	client, err := NewRemoteCatalogClientWithOptions(serverEndpoint, catalog.ClientOptions{Credentials: credentials})
 	if err != nil {
-		return &RemoteCatalogClient{}
+		// errors of the endpoint or TLS client config are reported on requests
+		return &RemoteCatalogClient{serverEndpoint: &url.URL{}, clientErr: err}
 	}
+	return client
+}
 
+// Creates a client of the catalog at serverEndpoint with the given options
+func NewRemoteCatalogClientWithOptions(serverEndpoint string, opts catalog.ClientOptions) (*RemoteCatalogClient, error) {
+	endpointUrl, err := url.Parse(serverEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	client, err := catalog.NewRemoteClient(opts)
+	if err != nil {
+		return nil, err
+	}
 	return &RemoteCatalogClient{
 		serverEndpoint: endpointUrl,
+		client:         client,
+	}, nil
+}
+
+func (self *RemoteCatalogClient) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	if self.clientErr != nil {
+		return nil, self.clientErr
+	}
+	return self.client.Do(ctx, method, url, body)
+}
+
+// Checks the status of the response. The body is closed unless the status is the expected one
+func checkStatus(res *http.Response, expected int) error {
+	if res.StatusCode == expected {
+		return nil
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return ErrorNotFound
 	}
+	return catalog.ResponseError(res)
+}
+
+// Returns the url of a filter of the given type
+func (self *RemoteCatalogClient) filterUrl(ftype, path, op, value string) string {
+	return fmt.Sprintf("%v/%v/%v/%v/%v", self.serverEndpoint, ftype, path, op, value)
+}
+
+// Returns the url with the paging parameters
+func pagedUrl(url string, page, perPage int) string {
+	return fmt.Sprintf("%v?%v=%v&%v=%v", url, GetParamPage, page, GetParamPerPage, perPage)
 }
 
 func (self *RemoteCatalogClient) Get(id string) (*Service, error) {
-	res, err := http.Get(fmt.Sprintf("%v/%v", self.serverEndpoint, id))
+	return self.GetContext(context.Background(), id)
+}
+
+func (self *RemoteCatalogClient) GetContext(ctx context.Context, id string) (*Service, error) {
+	res, err := self.do(ctx, "GET", fmt.Sprintf("%v/%v", self.serverEndpoint, id), nil)
 	if err != nil {
 		return nil, err
 	}
-
-	if res.StatusCode == http.StatusNotFound {
-		return nil, ErrorNotFound
-	} else if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%v", res.StatusCode)
+	if err = checkStatus(res, http.StatusOK); err != nil {
+		return nil, err
 	}
 	return serviceFromResponse(res, self.serverEndpoint.Path)
 }
 
 func (self *RemoteCatalogClient) Add(s *Service) error {
+	return self.AddContext(context.Background(), s)
+}
+
+func (self *RemoteCatalogClient) AddContext(ctx context.Context, s *Service) error {
 	b, _ := json.Marshal(s)
-	_, err := http.Post(self.serverEndpoint.String()+"/", "application/ld+json", bytes.NewReader(b))
+	res, err := self.do(ctx, "POST", self.serverEndpoint.String()+"/", b)
 	if err != nil {
 		return err
 	}
+	if err = checkStatus(res, http.StatusCreated); err != nil {
+		return err
+	}
+	res.Body.Close()
 	return nil
 }
 
 func (self *RemoteCatalogClient) Update(id string, s *Service) error {
+	return self.UpdateContext(context.Background(), id, s)
+}
+
+func (self *RemoteCatalogClient) UpdateContext(ctx context.Context, id string, s *Service) error {
 	b, _ := json.Marshal(s)
-	req, err := http.NewRequest("PUT", fmt.Sprintf("%v/%v", self.serverEndpoint, id), bytes.NewReader(b))
+	res, err := self.do(ctx, "PUT", fmt.Sprintf("%v/%v", self.serverEndpoint, id), b)
 	if err != nil {
 		return err
 	}
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
+	if err = checkStatus(res, http.StatusOK); err != nil {
 		return err
 	}
-
-	if res.StatusCode == http.StatusNotFound {
-		return ErrorNotFound
-	} else if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("%v", res.StatusCode)
-	}
+	res.Body.Close()
 	return nil
 }
 
 func (self *RemoteCatalogClient) Delete(id string) error {
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("%v/%v", self.serverEndpoint, id), bytes.NewReader([]byte{}))
-	if err != nil {
-		return err
-	}
+	return self.DeleteContext(context.Background(), id)
+}
 
-	res, err := http.DefaultClient.Do(req)
+func (self *RemoteCatalogClient) DeleteContext(ctx context.Context, id string) error {
+	res, err := self.do(ctx, "DELETE", fmt.Sprintf("%v/%v", self.serverEndpoint, id), nil)
 	if err != nil {
 		return err
 	}
-
-	if res.StatusCode == http.StatusNotFound {
-		return ErrorNotFound
-	} else if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("%v", res.StatusCode)
+	if err = checkStatus(res, http.StatusOK); err != nil {
+		return err
 	}
-
+	res.Body.Close()
 	return nil
 }
 
 func (self *RemoteCatalogClient) GetServices(page, perPage int) ([]Service, int, error) {
-	res, err := http.Get(
-		fmt.Sprintf("%v?%v=%v&%v=%v",
-			self.serverEndpoint, GetParamPage, page, GetParamPerPage, perPage))
+	return self.GetServicesContext(context.Background(), page, perPage)
+}
+
+func (self *RemoteCatalogClient) GetServicesContext(ctx context.Context, page, perPage int) ([]Service, int, error) {
+	res, err := self.do(ctx, "GET", pagedUrl(self.serverEndpoint.String(), page, perPage), nil)
 	if err != nil {
 		return nil, 0, err
 	}
-
+	if err = checkStatus(res, http.StatusOK); err != nil {
+		return nil, 0, err
+	}
 	return servicesFromResponse(res, self.serverEndpoint.Path)
 }
 
 func (self *RemoteCatalogClient) FindService(path, op, value string) (*Service, error) {
-	res, err := http.Get(fmt.Sprintf("%v/%v/%v/%v/%v", self.serverEndpoint, FTypeService, path, op, value))
+	return self.FindServiceContext(context.Background(), path, op, value)
+}
+
+func (self *RemoteCatalogClient) FindServiceContext(ctx context.Context, path, op, value string) (*Service, error) {
+	res, err := self.do(ctx, "GET", self.filterUrl(FTypeService, path, op, value), nil)
 	if err != nil {
 		return nil, err
 	}
-
-	if res.StatusCode == http.StatusNotFound {
-		return nil, ErrorNotFound
-	} else if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%v", res.StatusCode)
+	if err = checkStatus(res, http.StatusOK); err != nil {
+		return nil, err
 	}
-
 	return serviceFromResponse(res, self.serverEndpoint.Path)
 }
 
 func (self *RemoteCatalogClient) FindServices(path, op, value string, page, perPage int) ([]Service, int, error) {
-	res, err := http.Get(
-		fmt.Sprintf("%v/%v/%v/%v/%v?%v=%v&%v=%v",
-			self.serverEndpoint, FTypeServices, path, op, value, GetParamPage, page, GetParamPerPage, perPage))
+	return self.FindServicesContext(context.Background(), path, op, value, page, perPage)
+}
+
+func (self *RemoteCatalogClient) FindServicesContext(ctx context.Context, path, op, value string, page, perPage int) ([]Service, int, error) {
+	res, err := self.do(ctx, "GET", pagedUrl(self.filterUrl(FTypeServices, path, op, value), page, perPage), nil)
 	if err != nil {
 		return nil, 0, err
 	}
-
+	// the catalog responds with 404 if nothing matched
+	if err = checkStatus(res, http.StatusOK); err == ErrorNotFound {
+		return []Service{}, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
 	return servicesFromResponse(res, self.serverEndpoint.Path)
 }
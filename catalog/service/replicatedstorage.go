@@ -0,0 +1,153 @@
+package service
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/patchwork-toolkit/patchwork/catalog/replication"
+)
+
+// Memory storage recording its mutations in a replication log.
+// Implements replication.Store to apply the log of a primary
+type ReplicatedStorage struct {
+	*MemoryStorage
+	log *replication.Log
+	// serializes writes with their log entries
+	mutex sync.Mutex
+}
+
+func NewReplicatedStorage(storage *MemoryStorage, log *replication.Log) *ReplicatedStorage {
+	return &ReplicatedStorage{
+		MemoryStorage: storage,
+		log:           log,
+	}
+}
+
+// CRUD
+func (self *ReplicatedStorage) add(s Service) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	err := self.MemoryStorage.add(s)
+	if err != nil {
+		return err
+	}
+	return self.record(s.Id)
+}
+
+func (self *ReplicatedStorage) update(id string, s Service) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	err := self.MemoryStorage.update(id, s)
+	if err != nil {
+		return err
+	}
+	return self.record(id)
+}
+
+func (self *ReplicatedStorage) delete(id string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	err := self.MemoryStorage.delete(id)
+	if err != nil {
+		return err
+	}
+	self.log.Record(replication.OpDelete, id, nil)
+	return nil
+}
+
+// Records the changes of the health status
+func (self *ReplicatedStorage) setStatus(id string, status, output string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	s, err := self.MemoryStorage.get(id)
+	if err != nil {
+		return err
+	}
+	err = self.MemoryStorage.setStatus(id, status, output)
+	if err != nil || s.Status == status {
+		return err
+	}
+	return self.record(id)
+}
+
+// Records the stored state of the service
+func (self *ReplicatedStorage) record(id string) error {
+	s, err := self.MemoryStorage.get(id)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	self.log.Record(replication.OpPut, id, b)
+	return nil
+}
+
+// replication.Store
+func (self *ReplicatedStorage) Put(id string, data []byte) error {
+	var s Service
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+	s.Id = id
+	self.MemoryStorage.put(s)
+	return nil
+}
+
+func (self *ReplicatedStorage) Delete(id string) error {
+	err := self.MemoryStorage.delete(id)
+	if err == ErrorNotFound {
+		return nil
+	}
+	return err
+}
+
+func (self *ReplicatedStorage) Snapshot() (uint64, map[string][]byte, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.MemoryStorage.mutex.RLock()
+	defer self.MemoryStorage.mutex.RUnlock()
+	entries := make(map[string][]byte, len(self.MemoryStorage.data))
+	for id, s := range self.MemoryStorage.data {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return 0, nil, err
+		}
+		entries[id] = b
+	}
+	return self.log.Seq(), entries, nil
+}
+
+func (self *ReplicatedStorage) Restore(entries map[string][]byte) error {
+	data := make(map[string]Service, len(entries))
+	for id, b := range entries {
+		var s Service
+		err := json.Unmarshal(b, &s)
+		if err != nil {
+			return err
+		}
+		s.Id = id
+		data[id] = s
+	}
+
+	self.MemoryStorage.mutex.Lock()
+	self.MemoryStorage.data = data
+	self.MemoryStorage.reindexEntries()
+	self.MemoryStorage.mutex.Unlock()
+	return nil
+}
+
+// Stores the service replacing the existing one and keeping its timestamps
+func (self *MemoryStorage) put(s Service) {
+	self.mutex.Lock()
+	self.data[s.Id] = s
+	self.reindexEntries()
+	self.mutex.Unlock()
+}
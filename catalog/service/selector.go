@@ -0,0 +1,294 @@
+package service
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Rotates over the endpoints
+	StrategyRoundRobin = "round-robin"
+	// Picks endpoints in random order
+	StrategyRandom = "random"
+	// Prefers endpoints on this host, then rotates
+	StrategyPreferLocal = "prefer-local"
+	// Prefers services passing their health check, then rotates (the catalog
+	// does not return the services failing it)
+	StrategyHealthAware = "health-aware"
+
+	defaultSelectorRefresh        = 60
+	defaultSelectorFailureTimeout = 30
+	selectorMetaServiceType       = "meta.serviceType"
+)
+
+var ErrorNoEndpoints = errors.New("No endpoints found")
+
+// Endpoint of a service resolved by a Selector
+type Endpoint struct {
+	URL      string
+	Service  Service
+	Protocol Protocol
+}
+
+// Configuration of a Selector
+type SelectorConfig struct {
+	// Service type (meta.serviceType) to resolve
+	ServiceType string `json:"serviceType"`
+	// Protocol type the endpoints must have (any if empty)
+	Protocol string `json:"protocol"`
+	// Method the protocols must support (any if empty)
+	Method string `json:"method"`
+	// One of the Strategy* constants (round-robin by default)
+	Strategy string `json:"strategy"`
+	// Interval of refreshing the endpoints from the catalog (seconds)
+	RefreshInterval int `json:"refreshInterval"`
+	// Time an endpoint is avoided after a failure (seconds)
+	FailureTimeout int `json:"failureTimeout"`
+}
+
+// Resolves a service type to endpoints using the service catalog.
+// Endpoints are cached and ordered by a selection strategy, failed endpoints
+// are avoided for a while to fail over to the others
+type Selector struct {
+	client   CatalogClient
+	config   SelectorConfig
+	refresh  time.Duration
+	failTime time.Duration
+
+	endpoints []Endpoint
+	fetched   time.Time
+	failed    map[string]time.Time
+	next      int
+	random    *rand.Rand
+	mutex     sync.Mutex
+}
+
+func NewSelector(client CatalogClient, config SelectorConfig) *Selector {
+	s := &Selector{
+		client:   client,
+		config:   config,
+		refresh:  defaultSelectorRefresh * time.Second,
+		failTime: defaultSelectorFailureTimeout * time.Second,
+		failed:   make(map[string]time.Time),
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if config.RefreshInterval > 0 {
+		s.refresh = time.Duration(config.RefreshInterval) * time.Second
+	}
+	if config.FailureTimeout > 0 {
+		s.failTime = time.Duration(config.FailureTimeout) * time.Second
+	}
+	return s
+}
+
+// Fetches the endpoints from the catalog
+func (self *Selector) Refresh() error {
+	endpoints := []Endpoint{}
+	for page := 1; ; page++ {
+		services, total, err := self.client.FindServices(selectorMetaServiceType, "equals", self.config.ServiceType, page, MaxPerPage)
+		if err == ErrorNotFound {
+			break
+		} else if err != nil {
+			return err
+		}
+		for _, s := range services {
+			endpoints = append(endpoints, self.match(s)...)
+		}
+		if len(services) == 0 || page*MaxPerPage >= total {
+			break
+		}
+	}
+
+	self.mutex.Lock()
+	self.endpoints = endpoints
+	self.fetched = time.Now()
+	self.mutex.Unlock()
+	return nil
+}
+
+// Returns the endpoints of the service matching the protocol and method
+func (self *Selector) match(s Service) []Endpoint {
+	endpoints := []Endpoint{}
+	for _, p := range s.Protocols {
+		if self.config.Protocol != "" && !strings.EqualFold(p.Type, self.config.Protocol) {
+			continue
+		}
+		if self.config.Method != "" && !hasMethod(p, self.config.Method) {
+			continue
+		}
+		u, _ := p.Endpoint["url"].(string)
+		if u == "" {
+			continue
+		}
+		endpoints = append(endpoints, Endpoint{URL: u, Service: s, Protocol: p})
+	}
+	return endpoints
+}
+
+func hasMethod(p Protocol, method string) bool {
+	for _, m := range p.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the endpoints ordered by the strategy.
+// Endpoints which failed recently come last
+func (self *Selector) Endpoints() ([]Endpoint, error) {
+	self.mutex.Lock()
+	stale := self.fetched.IsZero() || time.Since(self.fetched) >= self.refresh
+	self.mutex.Unlock()
+	if stale {
+		err := self.Refresh()
+		if err != nil {
+			self.mutex.Lock()
+			cached := !self.fetched.IsZero()
+			self.mutex.Unlock()
+			if !cached {
+				return nil, err
+			}
+			logger.Printf("Selector.Endpoints() Using cached endpoints of %s: %v", self.config.ServiceType, err)
+		}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if len(self.endpoints) == 0 {
+		return nil, ErrorNoEndpoints
+	}
+
+	ordered := self.order()
+	now := time.Now()
+	available := make([]Endpoint, 0, len(ordered))
+	failed := []Endpoint{}
+	for _, e := range ordered {
+		if t, ok := self.failed[e.URL]; ok && now.Sub(t) < self.failTime {
+			failed = append(failed, e)
+			continue
+		}
+		available = append(available, e)
+	}
+	return append(available, failed...), nil
+}
+
+// Returns the preferred endpoint
+func (self *Selector) Select() (Endpoint, error) {
+	endpoints, err := self.Endpoints()
+	if err != nil {
+		return Endpoint{}, err
+	}
+	return endpoints[0], nil
+}
+
+// Marks the endpoint as failed (e.g. after a connection failure)
+func (self *Selector) Fail(url string) {
+	self.mutex.Lock()
+	self.failed[url] = time.Now()
+	self.mutex.Unlock()
+}
+
+// Calls f with the endpoints in order until it succeeds, marking the failed ones.
+// Returns the error of the last endpoint if all of them failed
+func (self *Selector) Do(f func(e Endpoint) error) error {
+	endpoints, err := self.Endpoints()
+	if err != nil {
+		return err
+	}
+	for _, e := range endpoints {
+		err = f(e)
+		if err == nil {
+			return nil
+		}
+		logger.Printf("Selector.Do() Endpoint %s failed: %v", e.URL, err)
+		self.Fail(e.URL)
+	}
+	return err
+}
+
+// Orders the endpoints by the strategy
+// WARNING: the caller must obtain the lock before calling
+func (self *Selector) order() []Endpoint {
+	endpoints := make([]Endpoint, len(self.endpoints))
+	switch self.config.Strategy {
+	case StrategyRandom:
+		for i, j := range self.random.Perm(len(self.endpoints)) {
+			endpoints[i] = self.endpoints[j]
+		}
+		return endpoints
+	case StrategyPreferLocal:
+		return preferred(self.rotate(), isLocalEndpoint)
+	case StrategyHealthAware:
+		return preferred(self.rotate(), func(e Endpoint) bool { return e.Service.Status == StatusPassing })
+	}
+	return self.rotate()
+}
+
+// Returns the endpoints rotated by one on every call
+// WARNING: the caller must obtain the lock before calling
+func (self *Selector) rotate() []Endpoint {
+	n := len(self.endpoints)
+	endpoints := make([]Endpoint, 0, n)
+	start := self.next % n
+	endpoints = append(endpoints, self.endpoints[start:]...)
+	endpoints = append(endpoints, self.endpoints[:start]...)
+	self.next = (start + 1) % n
+	return endpoints
+}
+
+// Moves the endpoints matching pref to the front keeping the order
+func preferred(endpoints []Endpoint, pref func(e Endpoint) bool) []Endpoint {
+	first := make([]Endpoint, 0, len(endpoints))
+	rest := []Endpoint{}
+	for _, e := range endpoints {
+		if pref(e) {
+			first = append(first, e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+	return append(first, rest...)
+}
+
+// Checks if the host of the endpoint url is this host
+func isLocalEndpoint(e Endpoint) bool {
+	host := e.URL
+	if u, err := url.Parse(e.URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	if hostname, err := os.Hostname(); err == nil && strings.EqualFold(host, hostname) {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
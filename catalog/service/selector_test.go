@@ -0,0 +1,155 @@
+package service
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+// Catalog client answering FindServices from a fixed slice
+type fakeFindClient struct {
+	CatalogClient
+	services []Service
+	calls    int
+	err      error
+}
+
+func (self *fakeFindClient) FindServices(path, op, value string, page, perPage int) ([]Service, int, error) {
+	self.calls++
+	if self.err != nil {
+		return nil, 0, self.err
+	}
+	return self.services, len(self.services), nil
+}
+
+func brokerService(id, url, status string) Service {
+	return Service{
+		Id:     id,
+		Name:   id,
+		Meta:   map[string]interface{}{"serviceType": "_mqtt._tcp"},
+		Status: status,
+		Protocols: []Protocol{
+			{Type: "MQTT", Endpoint: map[string]interface{}{"url": url}, Methods: []string{"PUB", "SUB"}},
+			{Type: "REST", Endpoint: map[string]interface{}{"url": url + "/rest"}},
+		},
+	}
+}
+
+func urls(endpoints []Endpoint) []string {
+	us := make([]string, 0, len(endpoints))
+	for _, e := range endpoints {
+		us = append(us, e.URL)
+	}
+	return us
+}
+
+func TestSelectorRoundRobin(t *testing.T) {
+	client := &fakeFindClient{services: []Service{
+		brokerService("a/broker", "tcp://a:1883", ""),
+		brokerService("b/broker", "tcp://b:1883", ""),
+	}}
+	s := NewSelector(client, SelectorConfig{ServiceType: "_mqtt._tcp", Protocol: "MQTT", Method: "PUB"})
+
+	var selected []string
+	for i := 0; i < 3; i++ {
+		e, err := s.Select()
+		if err != nil {
+			t.Fatalf("Unexpected error on select: %v", err.Error())
+		}
+		selected = append(selected, e.URL)
+	}
+	if selected[0] != "tcp://a:1883" || selected[1] != "tcp://b:1883" || selected[2] != "tcp://a:1883" {
+		t.Errorf("Unexpected round-robin order: %v", selected)
+	}
+	// cached until the refresh interval
+	if client.calls != 1 {
+		t.Errorf("Expected a single catalog lookup, got %v", client.calls)
+	}
+}
+
+func TestSelectorHealthAware(t *testing.T) {
+	storage := NewMemoryStorage()
+	ts := httptest.NewServer(NewHandler(storage, HandlerOptions{Location: "/sc"}))
+	defer ts.Close()
+
+	for _, b := range []struct {
+		id, url, status string
+	}{
+		{"a/broker", "tcp://a:1883", StatusFailing},
+		{"b/broker", "tcp://b:1883", StatusUnknown},
+		{"c/broker", "tcp://c:1883", StatusPassing},
+	} {
+		s := brokerService(b.id, b.url, "")
+		s.Ttl = 60
+		s.HealthCheck = &HealthCheck{Type: HealthCheckTCP}
+		if err := storage.add(s); err != nil {
+			t.Fatalf("Unexpected error on add: %v", err.Error())
+		}
+		if err := storage.setStatus(b.id, b.status, ""); err != nil {
+			t.Fatalf("Unexpected error on setStatus: %v", err.Error())
+		}
+	}
+	s := NewSelector(NewRemoteCatalogClient(ts.URL+"/sc", nil), SelectorConfig{ServiceType: "_mqtt._tcp", Protocol: "MQTT", Strategy: StrategyHealthAware})
+
+	for i := 0; i < 2; i++ {
+		endpoints, err := s.Endpoints()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err.Error())
+		}
+		// the failing service is not returned by the catalog
+		us := urls(endpoints)
+		if len(us) != 2 || us[0] != "tcp://c:1883" || us[1] != "tcp://b:1883" {
+			t.Errorf("Unexpected health-aware order: %v", us)
+		}
+	}
+}
+
+func TestSelectorFailover(t *testing.T) {
+	client := &fakeFindClient{services: []Service{
+		brokerService("a/broker", "tcp://a:1883", ""),
+		brokerService("b/broker", "tcp://b:1883", ""),
+	}}
+	s := NewSelector(client, SelectorConfig{ServiceType: "_mqtt._tcp", Protocol: "MQTT"})
+
+	var tried []string
+	err := s.Do(func(e Endpoint) error {
+		tried = append(tried, e.URL)
+		if e.URL == "tcp://a:1883" {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected the failover to succeed: %v", err.Error())
+	}
+	if len(tried) != 2 {
+		t.Errorf("Expected both endpoints to be tried, got %v", tried)
+	}
+
+	// the failed endpoint is avoided
+	for i := 0; i < 2; i++ {
+		e, _ := s.Select()
+		if e.URL != "tcp://b:1883" {
+			t.Errorf("Expected the failed endpoint to come last, selected %v", e.URL)
+		}
+	}
+
+	err = s.Do(func(e Endpoint) error { return errors.New("down") })
+	if err == nil {
+		t.Error("Expected an error when all endpoints fail")
+	}
+}
+
+func TestSelectorNoEndpoints(t *testing.T) {
+	client := &fakeFindClient{services: []Service{brokerService("a/broker", "tcp://a:1883", "")}}
+	s := NewSelector(client, SelectorConfig{ServiceType: "_mqtt._tcp", Protocol: "MQTT", Method: "DELETE"})
+	if _, err := s.Select(); err != ErrorNoEndpoints {
+		t.Errorf("Expected ErrorNoEndpoints, got %v", err)
+	}
+
+	client = &fakeFindClient{err: errors.New("catalog unreachable")}
+	s = NewSelector(client, SelectorConfig{ServiceType: "_mqtt._tcp"})
+	if _, err := s.Select(); err == nil {
+		t.Error("Expected an error if the catalog is unreachable")
+	}
+}
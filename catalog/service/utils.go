@@ -1,15 +1,10 @@
 package service
 
 import (
-	"fmt"
 	"sync"
-	"time"
 
-	utils "github.com/patchwork-toolkit/patchwork/catalog"
-)
-
-const (
-	keepaliveRetries = 5
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+	"github.com/patchwork-toolkit/patchwork/catalog/registrar"
 )
 
 // Registers service given a configured Catalog Client
@@ -37,116 +32,19 @@ func RegisterService(client CatalogClient, s *Service) error {
 	return nil
 }
 
-// Registers service in the remote catalog
+// Registers service in the remote catalog and keeps the registration alive until signalled
 // endpoint: catalog endpoint. If empty - will be discovered using DNS-SD
 // s: service registration
 // sigCh: channel for shutdown signalisation from upstream
-func RegisterServiceWithKeepalive(endpoint string, discover bool, s Service, sigCh <-chan bool, wg *sync.WaitGroup) {
+// credentials: credentials for the remote catalog (nil for none)
+// Use a registrar.Registrar to manage many registrations
+func RegisterServiceWithKeepalive(endpoint string, discover bool, s Service, sigCh <-chan bool, wg *sync.WaitGroup, credentials *auth.Credentials) {
 	defer wg.Done()
-	var err error
-	if discover {
-		endpoint, err = utils.DiscoverCatalogEndpoint(DNSSDServiceType)
-		if err != nil {
-			logger.Printf("RegisterServiceWithKeepalive() ERROR: Failed to discover the endpoint: %v", err.Error())
-			return
-		}
-	}
-
-	// Configure client
-	client := NewRemoteCatalogClient(endpoint)
-
-	// Will not keepalive registration with a negative TTL
-	if s.Ttl <= 0 {
-		logger.Println("RegisterServiceWithKeepalive() WARNING: Registration has ttl <= 0. Will not start the keepalive routine")
-		RegisterService(client, &s)
-		return
-	}
-	logger.Printf("RegisterServiceWithKeepalive() Will register and update registration periodically: %v/%v", endpoint, s.Id)
-
-	// Configure & start the keepalive routine
-	ksigCh := make(chan bool)
-	kerrCh := make(chan error)
-	go keepAlive(client, &s, ksigCh, kerrCh)
-
-	for {
-		select {
-		// catch an error from the keepAlive routine
-		case e := <-kerrCh:
-			logger.Println("RegisterServiceWithKeepalive() ERROR:", e)
-			// Re-discover the endpoint if needed and start over
-			if discover {
-				endpoint, err = utils.DiscoverCatalogEndpoint(DNSSDServiceType)
-				if err != nil {
-					logger.Println("RegisterServiceWithKeepalive() ERROR:", err.Error())
-					return
-				}
-			}
-			logger.Println("RegisterServiceWithKeepalive() Will use the new endpoint: ", endpoint)
-			client := NewRemoteCatalogClient(endpoint)
-			go keepAlive(client, &s, ksigCh, kerrCh)
-
-		// catch a shutdown signal from the upstream
-		case <-sigCh:
-			logger.Printf("RegisterServiceWithKeepalive() Removing the registration %v/%v...", endpoint, s.Id)
-			// signal shutdown to the keepAlive routine & close channels
-			select {
-			case ksigCh <- true:
-				// delete entry in the remote catalog
-				client.Delete(s.Id)
-			case <-time.After(1 * time.Second):
-				logger.Printf("RegisterDeviceWithKeepalive(): timeout removing registration %v/%v: catalog unreachable", endpoint, s.Id)
-			}
+	r := registrar.NewRegistrar()
+	r.Add(NewRemoteRegistration(endpoint, discover, s, credentials))
+	r.Start()
 
-			close(ksigCh)
-			close(kerrCh)
-			return
-		}
-	}
-}
-
-// Keep a given registration alive
-// client: configured client for the remote catalog
-// s: registration to be kept alive
-// sigCh: channel for shutdown signalisation from upstream
-// errCh: channel for error signalisation to upstream
-func keepAlive(client CatalogClient, s *Service, sigCh <-chan bool, errCh chan<- error) {
-	dur := utils.KeepAliveDuration(s.Ttl)
-	ticker := time.NewTicker(dur)
-	errTries := 0
-
-	// Register
-	RegisterService(client, s)
-
-	for {
-		select {
-		case <-ticker.C:
-			err := client.Update(s.Id, s)
-
-			if err == ErrorNotFound {
-				logger.Printf("keepAlive() ERROR: Registration %v not found in the remote catalog. TTL expired?", s.Id)
-				err = client.Add(s)
-				if err != nil {
-					logger.Printf("keepAlive() ERROR: %v", err)
-					errTries += 1
-				} else {
-					logger.Printf("keepAlive() Added Service registration %v", s.Id)
-					errTries = 0
-				}
-			} else if err != nil {
-				logger.Printf("keepAlive() ERROR: %v", err)
-				errTries += 1
-			} else {
-				logger.Printf("keepAlive() Updated Service registration %v", s.Id)
-				errTries = 0
-			}
-			if errTries >= keepaliveRetries {
-				errCh <- fmt.Errorf("Number of retries exceeded")
-				ticker.Stop()
-				return
-			}
-		case <-sigCh:
-			// logger.Println("keepAlive routine shutdown signalled by the upstream")
-			return
-		}
-	}
+	<-sigCh
+	logger.Printf("RegisterServiceWithKeepalive() Removing the registration %v", s.Id)
+	r.Stop()
 }
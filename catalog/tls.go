@@ -0,0 +1,85 @@
+package catalog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+// TLS config of an HTTP listener
+type TLSConfig struct {
+	Enabled  bool   `json:"enabled"`
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// CA to verify client certificates. If set, clients must present a valid certificate (mTLS)
+	ClientCAFile string `json:"clientCaFile"`
+}
+
+func (c *TLSConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return fmt.Errorf("tls: certFile and keyFile must be defined")
+	}
+	return nil
+}
+
+// Returns the URL scheme of the listener
+func (c *TLSConfig) Scheme() string {
+	if c != nil && c.Enabled {
+		return "https"
+	}
+	return "http"
+}
+
+// Creates the server-side tls.Config
+func (c *TLSConfig) ServerConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates found in %s", c.ClientCAFile)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return conf, nil
+}
+
+// Starts an HTTP or (if enabled in tlsConf) HTTPS listener (blocking call)
+func ListenAndServe(addr string, handler http.Handler, tlsConf *TLSConfig) error {
+	if tlsConf == nil || !tlsConf.Enabled {
+		return http.ListenAndServe(addr, handler)
+	}
+
+	conf, err := tlsConf.ServerConfig()
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: conf,
+	}
+	return server.Serve(tls.NewListener(ln, conf))
+}
@@ -0,0 +1,231 @@
+package catalog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+)
+
+// Test PKI: a CA issuing a server certificate for 127.0.0.1 and a client certificate
+type testPKI struct {
+	dir                   string
+	caFile                string
+	serverCert, serverKey string
+	clientCert, clientKey string
+}
+
+func newTestPKI(t *testing.T, dir, name string) *testPKI {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name + " CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	pki := &testPKI{dir: dir, caFile: filepath.Join(dir, name+"-ca.pem")}
+	writePEM(t, pki.caFile, "CERTIFICATE", caDER)
+	pki.serverCert, pki.serverKey = pki.issue(t, name+"-server", ca, caKey, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	pki.clientCert, pki.clientKey = pki.issue(t, name+"-client", ca, caKey, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "dgw1"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return pki
+}
+
+// Issues a certificate signed by the CA, returning the certificate and key files
+func (self *testPKI) issue(t *testing.T, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, template *x509.Certificate) (string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	certFile, keyFile := filepath.Join(self.dir, name+".pem"), filepath.Join(self.dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+// Starts an HTTPS server with the TLS config
+func startTLSServer(t *testing.T, conf *TLSConfig) *httptest.Server {
+	tlsConf, err := conf.ServerConfig()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.TLS = tlsConf
+	ts.StartTLS()
+	return ts
+}
+
+func get(client *http.Client, url string) error {
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func TestTLSScheme(t *testing.T) {
+	var none *TLSConfig
+	if s := none.Scheme(); s != "http" {
+		t.Errorf("Expected http without TLS config, got %s", s)
+	}
+	if s := (&TLSConfig{}).Scheme(); s != "http" {
+		t.Errorf("Expected http with TLS disabled, got %s", s)
+	}
+	if s := (&TLSConfig{Enabled: true}).Scheme(); s != "https" {
+		t.Errorf("Expected https with TLS enabled, got %s", s)
+	}
+}
+
+func TestTLSServerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	pki := newTestPKI(t, dir, "test")
+
+	conf, err := (&TLSConfig{Enabled: true, CertFile: pki.serverCert, KeyFile: pki.serverKey}).ServerConfig()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(conf.Certificates) != 1 || conf.ClientAuth != tls.NoClientCert {
+		t.Errorf("Expected a server certificate without client auth, got %+v", conf)
+	}
+
+	conf, err = (&TLSConfig{Enabled: true, CertFile: pki.serverCert, KeyFile: pki.serverKey, ClientCAFile: pki.caFile}).ServerConfig()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if conf.ClientAuth != tls.RequireAndVerifyClientCert || conf.ClientCAs == nil {
+		t.Errorf("Expected client certificates to be required, got %+v", conf)
+	}
+
+	if _, err = (&TLSConfig{Enabled: true, CertFile: pki.serverCert, KeyFile: pki.caFile}).ServerConfig(); err == nil {
+		t.Error("Expected an error for a mismatching key")
+	}
+	if _, err = (&TLSConfig{Enabled: true, CertFile: pki.serverCert, KeyFile: pki.serverKey, ClientCAFile: pki.serverKey}).ServerConfig(); err == nil {
+		t.Error("Expected an error for a client CA file without certificates")
+	}
+}
+
+func TestTLSClientCAPinning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	pki := newTestPKI(t, dir, "test")
+	other := newTestPKI(t, dir, "other")
+
+	ts := startTLSServer(t, &TLSConfig{Enabled: true, CertFile: pki.serverCert, KeyFile: pki.serverKey})
+	defer ts.Close()
+
+	client, err := (&auth.Credentials{CAFile: pki.caFile}).HTTPClient()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := get(client, ts.URL); err != nil {
+		t.Errorf("Expected the server to be trusted with its CA, got %v", err)
+	}
+
+	client, err = (&auth.Credentials{CAFile: other.caFile}).HTTPClient()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := get(client, ts.URL); err == nil {
+		t.Error("Expected the server to be rejected with another CA")
+	}
+
+	if _, err = (&auth.Credentials{CAFile: filepath.Join(dir, "missing.pem")}).HTTPClient(); err == nil {
+		t.Error("Expected an error for a missing CA file")
+	}
+	if client, _ := (*auth.Credentials)(nil).HTTPClient(); client != http.DefaultClient {
+		t.Error("Expected the default client for nil credentials")
+	}
+}
+
+func TestTLSClientCertificateAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	pki := newTestPKI(t, dir, "test")
+	other := newTestPKI(t, dir, "other")
+
+	ts := startTLSServer(t, &TLSConfig{Enabled: true, CertFile: pki.serverCert, KeyFile: pki.serverKey, ClientCAFile: pki.caFile})
+	defer ts.Close()
+
+	cases := []struct {
+		name    string
+		creds   *auth.Credentials
+		allowed bool
+	}{
+		{"client certificate", &auth.Credentials{CAFile: pki.caFile, CertFile: pki.clientCert, KeyFile: pki.clientKey}, true},
+		{"no client certificate", &auth.Credentials{CAFile: pki.caFile}, false},
+		{"certificate of another CA", &auth.Credentials{CAFile: pki.caFile, CertFile: other.clientCert, KeyFile: other.clientKey}, false},
+	}
+	for _, c := range cases {
+		client, err := c.creds.HTTPClient()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		err = get(client, ts.URL)
+		if (err == nil) != c.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", c.name, c.allowed, err)
+		}
+	}
+
+	if _, err = (&auth.Credentials{CertFile: pki.clientCert, KeyFile: pki.serverKey}).HTTPClient(); err == nil {
+		t.Error("Expected an error for a mismatching client key")
+	}
+}
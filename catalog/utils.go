@@ -1,87 +1,49 @@
 package catalog
 
 import (
-	"fmt"
-	"os"
-	"os/signal"
-	"strings"
-	"syscall"
+	"context"
 	"time"
 
-	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/oleksandr/bonjour"
+	"github.com/patchwork-toolkit/patchwork/discovery"
 )
 
 const (
-	discoveryTimeoutSec = 30
-	minKeepaliveSec     = 5
+	minKeepaliveSec = 5
 )
 
-// Discovers a catalog endpoint given the serviceType
-func DiscoverCatalogEndpoint(serviceType string) (endpoint string, err error) {
-	sysSig := make(chan os.Signal, 1)
-	signal.Notify(sysSig,
-		syscall.SIGHUP,
-		syscall.SIGINT,
-		syscall.SIGTERM,
-		syscall.SIGQUIT)
-
-	for {
-		// create resolver
-		resolver, err := bonjour.NewResolver(nil)
-		if err != nil {
-			logger.Println("Failed to initialize DNS-SD resolver:", err.Error())
-			break
-		}
-		// init the channel for results
-		results := make(chan *bonjour.ServiceEntry)
-
-		// send query and listen for answers
-		logger.Println("Browsing...")
-		err = resolver.Browse(serviceType, "", results)
-		if err != nil {
-			logger.Println("Unable to browse DNS-SD services: ", err)
-			break
-		}
+// Options of the discovery of catalog endpoints
+type DiscoveryOptions struct {
+	// Provider of the catalog instances (defaults to multicast DNS)
+	Provider discovery.Provider
+	// Requirements on the discovered catalogs
+	Require discovery.Requirements
+	// Address used in the discovered endpoints
+	Prefer discovery.AddressPreference
+}
 
-		// if not found - block with timeout
-		var foundService *bonjour.ServiceEntry
-		select {
-		case foundService = <-results:
-			logger.Printf("[DiscoverCatalogEndpoint] Discovered service: %v\n", foundService.ServiceInstanceName())
-		case <-time.After(time.Duration(discoveryTimeoutSec) * time.Second):
-			logger.Println("[DiscoverCatalogEndpoint] Timeout looking for a service")
-		case <-sysSig:
-			logger.Println("[DiscoverCatalogEndpoint] System interrupt signal received. Aborting the discovery")
-			return endpoint, fmt.Errorf("Aborted by system interrupt")
-		}
+// Discovers a catalog endpoint given the serviceType, browsing until one is found
+func DiscoverCatalogEndpoint(serviceType string) (endpoint string, err error) {
+	return DiscoverCatalogEndpointWithOptions(serviceType, DiscoveryOptions{})
+}
 
-		// check if something found
-		if foundService == nil {
-			logger.Printf("[DiscoverCatalogEndpoint] Could not discover a service %v withing the timeout. Starting from scratch...", serviceType)
-			// stop resolver
-			resolver.Exit <- true
-			// start the new iteration
-			continue
-		}
+// Discovers an endpoint of a catalog meeting the requirements of opts,
+// browsing until one is found
+func DiscoverCatalogEndpointWithOptions(serviceType string, opts DiscoveryOptions) (endpoint string, err error) {
+	return DiscoverCatalogEndpointContext(context.Background(), serviceType, opts)
+}
 
-		// stop the resolver and close the channel
-		resolver.Exit <- true
-		close(results)
-
-		uri := ""
-		for _, s := range foundService.Text {
-			if strings.HasPrefix(s, "uri=") {
-				tmp := strings.Split(s, "=")
-				if len(tmp) == 2 {
-					uri = tmp[1]
-					break
-				}
-			}
-		}
-		endpoint = fmt.Sprintf("http://%s:%v%s", foundService.HostName, foundService.Port, uri)
-		break
+// Discovers an endpoint of a catalog meeting the requirements of opts,
+// browsing until ctx is done
+func DiscoverCatalogEndpointContext(ctx context.Context, serviceType string, opts DiscoveryOptions) (string, error) {
+	instance, err := discovery.DiscoverFirst(ctx, serviceType, discovery.BrowserOptions{
+		Provider: opts.Provider,
+		Require:  opts.Require,
+	})
+	if err != nil {
+		return "", err
 	}
-	return endpoint, err
+	logger.Printf("[DiscoverCatalogEndpoint] Discovered service: %v\n", instance.Name)
+	return instance.Endpoint(opts.Prefer), nil
 }
 
 // Returns a 'slice' of the given slice based on the requested 'page'
@@ -137,3 +99,31 @@ func KeepAliveDuration(ttl int) time.Duration {
 	}
 	return d
 }
+
+// Deep copy of a map decoded from JSON (nested maps and slices are copied)
+func CopyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	mc := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		mc[k] = copyValue(v)
+	}
+	return mc
+}
+
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return CopyMap(v)
+	case []interface{}:
+		vc := make([]interface{}, len(v))
+		for i := range v {
+			vc[i] = copyValue(v[i])
+		}
+		return vc
+	case []string:
+		return append([]string(nil), v...)
+	}
+	return v
+}
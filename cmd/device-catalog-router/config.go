@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+	catalog "github.com/patchwork-toolkit/patchwork/catalog/device"
+)
+
+type Config struct {
+	Description  string             `json:"description"`
+	BindAddr     string             `json:"bindAddr"`
+	BindPort     int                `json:"bindPort"`
+	DnssdEnabled bool               `json:"dnssdEnabled"`
+	StaticDir    string             `json:"staticDir"`
+	ApiLocation  string             `json:"apiLocation"`
+	Shards       []catalog.Shard    `json:"shards"`
+	VirtualNodes int                `json:"virtualNodes"`
+	Auth         auth.Config        `json:"auth"`
+	TLS          utils.TLSConfig    `json:"tls"`
+	Limits       utils.LimitsConfig `json:"limits"`
+}
+
+func (c *Config) Validate() error {
+	var err error
+	if c.BindAddr == "" && c.BindPort == 0 {
+		err = fmt.Errorf("Empty host or port")
+	}
+	if c.ApiLocation == "" {
+		err = fmt.Errorf("apiLocation must be defined")
+	}
+	if c.StaticDir == "" {
+		err = fmt.Errorf("staticDir must be defined")
+	}
+	if strings.HasSuffix(c.ApiLocation, "/") {
+		err = fmt.Errorf("apiLocation must not have a training slash")
+	}
+	if strings.HasSuffix(c.StaticDir, "/") {
+		err = fmt.Errorf("staticDir must not have a training slash")
+	}
+	if len(c.Shards) == 0 {
+		err = fmt.Errorf("At least one shard must be defined")
+	}
+	for _, s := range c.Shards {
+		if s.Endpoint == "" {
+			err = fmt.Errorf("All shards must have an endpoint defined")
+		}
+	}
+	if c.VirtualNodes < 0 {
+		err = fmt.Errorf("virtualNodes must not be negative")
+	}
+	if e := c.Auth.Validate(); e != nil {
+		err = e
+	}
+	if e := c.TLS.Validate(); e != nil {
+		err = e
+	}
+	if e := c.Limits.Validate(); e != nil {
+		err = e
+	}
+	return err
+}
+
+func loadConfig(path string) (*Config, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Config)
+	err = json.Unmarshal(file, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/codegangsta/negroni"
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/oleksandr/bonjour"
+	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+	catalog "github.com/patchwork-toolkit/patchwork/catalog/device"
+	"github.com/patchwork-toolkit/patchwork/discovery"
+)
+
+var (
+	confPath = flag.String("conf", "conf/device-catalog-router.json", "Device catalog router configuration file path")
+)
+
+func main() {
+	flag.Parse()
+
+	config, err := loadConfig(*confPath)
+	if err != nil {
+		logger.Fatalf("Error reading config file %v: %v", *confPath, err)
+	}
+
+	r, err := setupRouter(config)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	// Announce the router as a device catalog using DNS-SD
+	var bonjourCh chan<- bool
+	if config.DnssdEnabled {
+		bonjourCh, err = bonjour.Register(config.Description,
+			catalog.DNSSDServiceType,
+			"",
+			config.BindPort,
+			discovery.Txt(map[string]string{
+				discovery.TxtUri:        config.ApiLocation,
+				discovery.TxtApiVersion: catalog.ApiVersion,
+				discovery.TxtApiType:    catalog.ApiCollectionType,
+				discovery.TxtScheme:     config.TLS.Scheme(),
+				discovery.TxtId:         discovery.DefaultInstanceId(config.BindPort),
+			}),
+			nil)
+		if err != nil {
+			logger.Printf("Failed to register DNS-SD service: %s", err.Error())
+		} else {
+			logger.Println("Registered service via DNS-SD using type", catalog.DNSSDServiceType)
+			defer func(ch chan<- bool) {
+				ch <- true
+			}(bonjourCh)
+		}
+	}
+
+	// Setup signal catcher for the server's proper shutdown
+	c := make(chan os.Signal, 1)
+	signal.Notify(c,
+		syscall.SIGHUP,
+		syscall.SIGINT,
+		syscall.SIGTERM,
+		syscall.SIGQUIT)
+	go func() {
+		for _ = range c {
+			logger.Println("Stopped")
+			os.Exit(0)
+		}
+	}()
+
+	err = mime.AddExtensionType(".jsonld", "application/ld+json")
+	if err != nil {
+		logger.Println("ERROR: ", err.Error())
+	}
+
+	// Configure the middleware
+	n := negroni.New(
+		negroni.NewRecovery(),
+		negroni.NewLogger(),
+		&negroni.Static{
+			Dir:       http.Dir(config.StaticDir),
+			Prefix:    utils.StaticLocation,
+			IndexFile: "index.html",
+		},
+	)
+	// Authenticate requests to the API
+	if config.Auth.Enabled {
+		authenticator, err := auth.NewAuthenticator(config.Auth)
+		if err != nil {
+			logger.Fatalf("Error configuring authentication: %v", err)
+		}
+		n.Use(authenticator)
+	}
+	// Enforce request limits (after authentication to rate limit by principal)
+	n.Use(utils.NewLimiter(config.Limits))
+	// Mount router
+	n.UseHandler(r)
+
+	// Start listener
+	endpoint := fmt.Sprintf("%s:%s", config.BindAddr, strconv.Itoa(config.BindPort))
+	logger.Printf("Starting Device Catalog Router at %v://%v%v", config.TLS.Scheme(), endpoint, config.ApiLocation)
+	err = utils.ListenAndServe(endpoint, n, &config.TLS)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+}
+
+func setupRouter(config *Config) (*mux.Router, error) {
+	client := catalog.NewShardedCatalogClient(config.Shards, config.VirtualNodes)
+	shards := &ShardsAPI{client}
+
+	// Configure routers
+	r := mux.NewRouter().StrictSlash(true)
+	catalog.Mount(r, catalog.NewShardedStorage(client), catalog.HandlerOptions{
+		Location:    config.ApiLocation,
+		Description: config.Description,
+		Writable:    true,
+		OpenAPI:     true,
+	})
+
+	// Shard management
+	r.Methods("GET").Path(ShardsLocation).HandlerFunc(shards.List).Name("shards")
+	r.Methods("POST").Path(ShardsLocation).HandlerFunc(shards.Add).Name("shards-add")
+	r.Methods("POST").Path(ShardsLocation + "/rebalance").HandlerFunc(shards.Rebalance).Name("shards-rebalance")
+	r.Methods("GET").Path(ShardsLocation + "/{dgwid}").HandlerFunc(shards.Locate).Name("shards-locate")
+
+	return r, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
+	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	catalog "github.com/patchwork-toolkit/patchwork/catalog/device"
+)
+
+func setupShard() *httptest.Server {
+	api := catalog.NewWritableCatalogAPI(catalog.NewMemoryStorage(), "/dc", utils.StaticLocation, "shard")
+	r := mux.NewRouter().StrictSlash(true)
+	r.Methods("GET").Path("/dc").HandlerFunc(api.List)
+	r.Methods("POST").Path("/dc/").HandlerFunc(api.Add)
+	r.Methods("GET").Path("/dc/{type}/{path}/{op}/{value}").HandlerFunc(api.Filter)
+	r.Methods("GET").Path("/dc/{dgwid}/{regid}").HandlerFunc(api.Get)
+	r.Methods("PUT").Path("/dc/{dgwid}/{regid}").HandlerFunc(api.Update)
+	r.Methods("DELETE").Path("/dc/{dgwid}/{regid}").HandlerFunc(api.Delete)
+	return httptest.NewServer(r)
+}
+
+func TestRouter(t *testing.T) {
+	shard1 := setupShard()
+	defer shard1.Close()
+	shard2 := setupShard()
+	defer shard2.Close()
+
+	config := &Config{
+		ApiLocation: "/dc",
+		StaticDir:   "static",
+		Shards:      []catalog.Shard{{Name: "s1", Endpoint: shard1.URL + "/dc"}},
+	}
+	router, err := setupRouter(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("dgw%d/d1", i)
+		b, _ := json.Marshal(catalog.Device{
+			Id:        id,
+			Name:      "d1",
+			Ttl:       60,
+			Resources: []catalog.Resource{{Id: id + "/r1", Name: "r1"}},
+		})
+		res, err := http.Post(ts.URL+"/dc/", "application/ld+json", bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected 201 on add, got %v", res.StatusCode)
+		}
+	}
+
+	// add a shard and rebalance
+	b, _ := json.Marshal(catalog.Shard{Name: "s2", Endpoint: shard2.URL + "/dc"})
+	res, err := http.Post(ts.URL+ShardsLocation, "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var rebalanced struct {
+		Moved int `json:"moved"`
+	}
+	json.NewDecoder(res.Body).Decode(&rebalanced)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || rebalanced.Moved == 0 {
+		t.Fatalf("Expected devices to be moved to the new shard, got %v (moved %d)", res.StatusCode, rebalanced.Moved)
+	}
+
+	// all devices are listed and routed
+	res, err = http.Get(ts.URL + "/dc?per_page=4&page=3")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var coll catalog.Collection
+	json.NewDecoder(res.Body).Decode(&coll)
+	res.Body.Close()
+	if coll.Total != 10 || len(coll.Resources) != 2 {
+		t.Errorf("Expected the last page with 2 of 10 resources, got %d of %d", len(coll.Resources), coll.Total)
+	}
+	for i := 0; i < 10; i++ {
+		res, err = http.Get(fmt.Sprintf("%s/dc/dgw%d/d1/r1", ts.URL, i))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("Expected resource of dgw%d to be found, got %v", i, res.StatusCode)
+		}
+	}
+}
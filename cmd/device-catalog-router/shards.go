@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+	catalog "github.com/patchwork-toolkit/patchwork/catalog/device"
+)
+
+// Location of the shard management API
+const ShardsLocation = "/shards"
+
+// Shard management api
+type ShardsAPI struct {
+	client *catalog.ShardedCatalogClient
+}
+
+// Shard without its credentials
+type shardInfo struct {
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint"`
+}
+
+func (self *ShardsAPI) shards() []shardInfo {
+	shards := []shardInfo{}
+	for _, s := range self.client.Shards() {
+		shards = append(shards, shardInfo{s.Name, s.Endpoint})
+	}
+	return shards
+}
+
+func (self *ShardsAPI) List(w http.ResponseWriter, req *http.Request) {
+	b, _ := json.Marshal(self.shards())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// Adds a shard and moves the devices placed on it
+func (self *ShardsAPI) Add(w http.ResponseWriter, req *http.Request) {
+	if !authorizeAdmin(w, req) {
+		return
+	}
+
+	var s catalog.Shard
+	err := json.NewDecoder(req.Body).Decode(&s)
+	req.Body.Close()
+	if err != nil || s.Endpoint == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error processing the request: shard endpoint must be defined\n")
+		return
+	}
+
+	logger.Printf("ShardsAPI.Add() Adding shard %s", s.Endpoint)
+	self.client.AddShard(s)
+	self.rebalance(w)
+}
+
+// Moves the devices which are not on their shard
+func (self *ShardsAPI) Rebalance(w http.ResponseWriter, req *http.Request) {
+	if !authorizeAdmin(w, req) {
+		return
+	}
+	self.rebalance(w)
+}
+
+func (self *ShardsAPI) rebalance(w http.ResponseWriter) {
+	moved, err := self.client.Rebalance()
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprintf(w, "Error rebalancing the shards (moved %d devices): %s\n", moved, err.Error())
+		return
+	}
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"moved":  moved,
+		"shards": self.shards(),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// Returns the shard of a gateway
+func (self *ShardsAPI) Locate(w http.ResponseWriter, req *http.Request) {
+	dgwid := mux.Vars(req)["dgwid"]
+	b, _ := json.Marshal(map[string]string{
+		"dgwid":    dgwid,
+		"endpoint": self.client.ShardFor(dgwid),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// Responds with 403 Forbidden if the principal of the request may not manage the shards
+func authorizeAdmin(w http.ResponseWriter, req *http.Request) bool {
+	err := auth.AuthorizeAdmin(req)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "Not allowed to manage the shards: %s\n", err.Error())
+		return false
+	}
+	return true
+}
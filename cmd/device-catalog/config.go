@@ -7,32 +7,82 @@ import (
 	"strings"
 
 	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+	"github.com/patchwork-toolkit/patchwork/catalog/replication"
+	"github.com/patchwork-toolkit/patchwork/discovery"
 )
 
 type Config struct {
-	Description    string           `json:"description"`
-	PublicAddr     string           `json:"publicAddr"`
-	BindAddr       string           `json:"bindAddr"`
-	BindPort       int              `json:"bindPort"`
-	DnssdEnabled   bool             `json:"dnssdEnabled"`
-	StaticDir      string           `json:"staticDir"`
-	ApiLocation    string           `json:"apiLocation"`
-	Storage        StorageConfig    `json:"storage"`
-	ServiceCatalog []ServiceCatalog `json:"serviceCatalog"`
+	Description    string                   `json:"description"`
+	PublicAddr     string                   `json:"publicAddr"`
+	BindAddr       string                   `json:"bindAddr"`
+	BindPort       int                      `json:"bindPort"`
+	DnssdEnabled   bool                     `json:"dnssdEnabled"`
+	StaticDir      string                   `json:"staticDir"`
+	ApiLocation    string                   `json:"apiLocation"`
+	Storage        StorageConfig            `json:"storage"`
+	ServiceCatalog []ServiceCatalog         `json:"serviceCatalog"`
+	CoreRD         CoreRDConfig             `json:"coreRd"`
+	Auth           auth.Config              `json:"auth"`
+	TLS            utils.TLSConfig          `json:"tls"`
+	Limits         utils.LimitsConfig       `json:"limits"`
+	Federation     FederationConfig         `json:"federation"`
+	Replication    replication.Config       `json:"replication"`
+	Discovery      discovery.ProviderConfig `json:"discovery"`
+	Announce       utils.AnnounceConfig     `json:"announce"`
+
+	// provider of the discovered catalogs
+	provider discovery.Provider
 }
 
 type ServiceCatalog struct {
 	Discover bool
 	Endpoint string
-	Ttl      int
+	// Equivalent endpoints of the catalog, used in order after Endpoint
+	Endpoints []string
+	// Address of discovered catalogs: hostname (default), ipv4 or ipv6
+	Prefer string
+	// Discover only catalogs served over TLS
+	RequireTLS bool
+	Ttl        int
+	Auth       *auth.Credentials
+}
+
+// Returns the options of the catalog discovery using the provider (nil if disabled)
+func (c *ServiceCatalog) DiscoveryOptions(provider discovery.Provider) *utils.DiscoveryOptions {
+	if !c.Discover {
+		return nil
+	}
+	prefer, _ := discovery.ParseAddressPreference(c.Prefer)
+	return &utils.DiscoveryOptions{
+		Provider: provider,
+		Require:  discovery.Requirements{TLS: c.RequireTLS},
+		Prefer:   prefer,
+	}
+}
+
+// Returns the static endpoints of the catalog in order of preference
+func (c *ServiceCatalog) AllEndpoints() []string {
+	endpoints := []string{}
+	if c.Endpoint != "" {
+		endpoints = append(endpoints, c.Endpoint)
+	}
+	return append(endpoints, c.Endpoints...)
 }
 
 type StorageConfig struct {
 	Type string `json:"type"`
 }
 
+// CoRE Resource Directory interface config
+type CoreRDConfig struct {
+	Enabled       bool   `json:"enabled"`
+	DefaultSector string `json:"defaultSector"`
+}
+
 var supportedBackends = map[string]bool{
-	utils.CatalogBackendMemory: true,
+	utils.CatalogBackendMemory:     true,
+	utils.CatalogBackendFederation: true,
 }
 
 func (c *Config) Validate() error {
@@ -55,10 +105,50 @@ func (c *Config) Validate() error {
 	if strings.HasSuffix(c.StaticDir, "/") {
 		err = fmt.Errorf("staticDir must not have a training slash")
 	}
+	if strings.Contains(c.CoreRD.DefaultSector, "/") {
+		err = fmt.Errorf("coreRd defaultSector must not contain slashes")
+	}
+	if e := c.Auth.Validate(); e != nil {
+		err = e
+	}
+	if e := c.TLS.Validate(); e != nil {
+		err = e
+	}
+	if e := c.Limits.Validate(); e != nil {
+		err = e
+	}
+	if e := c.Replication.Validate(); e != nil {
+		err = e
+	}
+	if e := c.Discovery.Validate(); e != nil {
+		err = e
+	}
+	if e := c.Announce.Validate(); e != nil {
+		err = e
+	}
+	if c.Storage.Type == utils.CatalogBackendFederation {
+		if c.Replication.Enabled {
+			err = fmt.Errorf("replication is not supported by the read-only federation")
+		}
+		if len(c.Federation.Upstreams) == 0 && !c.Federation.Discover {
+			err = fmt.Errorf("federation must have either upstreams or the discover flag defined")
+		}
+		for _, u := range c.Federation.Upstreams {
+			if u.Endpoint == "" {
+				err = fmt.Errorf("All federation upstreams must have an endpoint defined")
+			}
+		}
+		if c.CoreRD.Enabled {
+			err = fmt.Errorf("coreRd is not supported by the read-only federation")
+		}
+	}
 	for _, cat := range c.ServiceCatalog {
-		if cat.Endpoint == "" && cat.Discover == false {
+		if len(cat.AllEndpoints()) == 0 && cat.Discover == false {
 			err = fmt.Errorf("All ServiceCatalog entries must have either endpoint or a discovery flag defined")
 		}
+		if _, e := discovery.ParseAddressPreference(cat.Prefer); e != nil {
+			err = e
+		}
 		if cat.Ttl <= 0 {
 			err = fmt.Errorf("All ServiceCatalog entries must have TTL >= 0")
 		}
@@ -81,5 +171,9 @@ func loadConfig(path string) (*Config, error) {
 	if err = c.Validate(); err != nil {
 		return nil, err
 	}
+	c.provider, err = c.Discovery.Provider()
+	if err != nil {
+		return nil, err
+	}
 	return c, nil
 }
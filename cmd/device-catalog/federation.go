@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	catalog "github.com/patchwork-toolkit/patchwork/catalog/device"
+	"github.com/patchwork-toolkit/patchwork/discovery"
+)
+
+const (
+	// DNS-SD TXT record marking a federated catalog (excluded from discovered upstreams)
+	federationTxtKey = "federation"
+	federationTxt    = federationTxtKey + "=true"
+
+	defaultFederationRefresh = 30
+	defaultFederationTimeout = 10
+)
+
+// Federation of upstream device catalogs (storage type "federation")
+type FederationConfig struct {
+	Upstreams []catalog.FederationUpstream `json:"upstreams"`
+	// Discover upstreams using DNS-SD in addition to the configured ones
+	Discover bool `json:"discover"`
+	// Interval of the upstreams refresh (seconds)
+	RefreshInterval int `json:"refreshInterval"`
+	// Timeout of fetching the upstreams (seconds)
+	Timeout int `json:"timeout"`
+}
+
+func (c *FederationConfig) refreshInterval() time.Duration {
+	if c.RefreshInterval > 0 {
+		return time.Duration(c.RefreshInterval) * time.Second
+	}
+	return defaultFederationRefresh * time.Second
+}
+
+func (c *FederationConfig) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return time.Duration(c.Timeout) * time.Second
+	}
+	return defaultFederationTimeout * time.Second
+}
+
+// Creates the federated storage and starts the discovery of upstreams if enabled
+func setupFederation(config *Config) *catalog.FederatedStorage {
+	conf := config.Federation
+	storage := catalog.NewFederatedStorage(conf.Upstreams, conf.refreshInterval(), conf.timeout())
+	if conf.Discover {
+		go func() {
+			for {
+				discovered := discoverUpstreams(config.provider, config.Description, conf.timeout())
+				storage.SetUpstreams(mergeUpstreams(conf.Upstreams, discovered))
+				time.Sleep(conf.refreshInterval())
+			}
+		}()
+	}
+	return storage
+}
+
+// Browses device catalogs announced via DNS-SD for the given duration.
+// The own instance and other federations are skipped
+func discoverUpstreams(provider discovery.Provider, self string, timeout time.Duration) []catalog.FederationUpstream {
+	upstreams := []catalog.FederationUpstream{}
+	seen := make(map[string]bool)
+	var mutex sync.Mutex
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := provider.Browse(ctx, catalog.DNSSDServiceType, "", func(instance discovery.Instance) {
+		if federated, _ := instance.TxtValue(federationTxtKey); instance.Name == self || federated == "true" {
+			return
+		}
+		endpoint := instance.Endpoint(discovery.PreferHostname)
+		mutex.Lock()
+		defer mutex.Unlock()
+		if seen[endpoint] {
+			return
+		}
+		seen[endpoint] = true
+		upstreams = append(upstreams, catalog.FederationUpstream{Name: instance.Name, Endpoint: endpoint})
+	})
+	if err != nil {
+		logger.Println("Failed to browse DNS-SD services:", err.Error())
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	return upstreams
+}
+
+// Configured upstreams take precedence over discovered ones with the same endpoint
+func mergeUpstreams(configured, discovered []catalog.FederationUpstream) []catalog.FederationUpstream {
+	merged := make([]catalog.FederationUpstream, 0, len(configured)+len(discovered))
+	known := make(map[string]bool)
+	for _, u := range configured {
+		known[u.Endpoint] = true
+		merged = append(merged, u)
+	}
+	for _, u := range discovered {
+		if !known[u.Endpoint] {
+			merged = append(merged, u)
+		}
+	}
+	return merged
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"mime"
@@ -8,15 +9,18 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
-	"sync"
 	"syscall"
 
 	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/codegangsta/negroni"
 	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
 	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/oleksandr/bonjour"
 	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
 	catalog "github.com/patchwork-toolkit/patchwork/catalog/device"
+	"github.com/patchwork-toolkit/patchwork/catalog/registrar"
+	"github.com/patchwork-toolkit/patchwork/catalog/replication"
 	sc "github.com/patchwork-toolkit/patchwork/catalog/service"
+	"github.com/patchwork-toolkit/patchwork/discovery"
 )
 
 var (
@@ -31,7 +35,7 @@ func main() {
 		logger.Fatalf("Error reading config file %v:%v", *confPath, err)
 	}
 
-	r, err := setupRouter(config)
+	r, node, err := setupRouter(config)
 	if err != nil {
 		logger.Fatal(err.Error())
 	}
@@ -43,7 +47,7 @@ func main() {
 			catalog.DNSSDServiceType,
 			"",
 			config.BindPort,
-			[]string{fmt.Sprintf("uri=%s", config.ApiLocation)},
+			dnssdTxt(config),
 			nil)
 		if err != nil {
 			logger.Printf("Failed to register DNS-SD service: %s", err.Error())
@@ -56,8 +60,8 @@ func main() {
 	}
 
 	// Register in the configured Service Catalogs
-	regChannels := make([]chan bool, 0, len(config.ServiceCatalog))
-	var wg sync.WaitGroup
+	reg := registrar.NewRegistrar()
+	r.Methods("GET").Path(registrar.DefaultLocation).Handler(reg).Name("registrations")
 	if len(config.ServiceCatalog) > 0 {
 		logger.Println("Will now register in the configured Service Catalogs")
 		service, err := registrationFromConfig(config)
@@ -69,12 +73,9 @@ func main() {
 		for _, cat := range config.ServiceCatalog {
 			// Set TTL
 			service.Ttl = cat.Ttl
-			sigCh := make(chan bool)
-			go sc.RegisterServiceWithKeepalive(cat.Endpoint, cat.Discover, *service, sigCh, &wg)
-			regChannels = append(regChannels, sigCh)
-			wg.Add(1)
+			reg.Add(sc.NewFailoverRegistration(cat.AllEndpoints(), cat.DiscoveryOptions(config.provider), *service, cat.Auth))
 		}
-
+		reg.Start()
 	}
 
 	// Setup signal catcher for the server's proper shutdown
@@ -90,14 +91,7 @@ func main() {
 
 			//TODO: put here the last will logic
 			// Unregister in the service catalog(s)
-			for _, sigCh := range regChannels {
-				// Notify if the routine hasn't returned already
-				select {
-				case sigCh <- true:
-				default:
-				}
-			}
-			wg.Wait()
+			reg.Stop()
 
 			logger.Println("Stopped")
 			os.Exit(0)
@@ -119,41 +113,125 @@ func main() {
 			IndexFile: "index.html",
 		},
 	)
+	// Authenticate requests to the API
+	if config.Auth.Enabled {
+		authenticator, err := auth.NewAuthenticator(config.Auth)
+		if err != nil {
+			logger.Fatalf("Error configuring authentication: %v", err)
+		}
+		n.Use(authenticator)
+	}
+	// Enforce request limits (after authentication to rate limit by principal)
+	n.Use(utils.NewLimiter(config.Limits))
+	// Forward writes of a replica to the primary
+	if node != nil {
+		n.Use(node)
+	}
 	// Mount router
 	n.UseHandler(r)
 
 	// Start listener
 	endpoint := fmt.Sprintf("%s:%s", config.BindAddr, strconv.Itoa(config.BindPort))
-	logger.Printf("Starting standalone Device Catalog at %v%v", endpoint, config.ApiLocation)
-	n.Run(endpoint)
+	logger.Printf("Starting standalone Device Catalog at %v://%v%v", config.TLS.Scheme(), endpoint, config.ApiLocation)
+	err = utils.ListenAndServe(endpoint, n, &config.TLS)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
 }
 
-func setupRouter(config *Config) (*mux.Router, error) {
-	// Create catalog API object
-	var api *catalog.WritableCatalogAPI
+func setupRouter(config *Config) (*mux.Router, *replication.Node, error) {
+	// Create catalog storage
+	var (
+		storage   catalog.CatalogStorage
+		federated *catalog.FederatedStorage
+		node      *replication.Node
+	)
 	if config.Storage.Type == utils.CatalogBackendMemory {
-		api = catalog.NewWritableCatalogAPI(
-			catalog.NewMemoryStorage(),
-			config.ApiLocation,
-			utils.StaticLocation,
-			config.Description,
-		)
+		memory := catalog.NewMemoryStorage()
+		storage = memory
+		if config.Replication.Enabled {
+			log := replication.NewLog(config.Replication.LogSize)
+			replicated := catalog.NewReplicatedStorage(memory, log)
+			var err error
+			node, err = replication.NewNode(config.Replication, replicated, log, replication.DefaultLocation)
+			if err != nil {
+				return nil, nil, err
+			}
+			storage = replicated
+		}
+		if config.Limits.Quota != (utils.QuotaConfig{}) {
+			storage = catalog.NewQuotaStorage(storage, config.Limits.Quota)
+		}
+	} else if config.Storage.Type == utils.CatalogBackendFederation {
+		federated = setupFederation(config)
+		storage = federated
+	}
+	if storage == nil {
+		return nil, nil, fmt.Errorf("Could not create catalog API structure. Unsupported storage type: %v", config.Storage.Type)
 	}
-	if api == nil {
-		return nil, fmt.Errorf("Could not create catalog API structure. Unsupported storage type: %v", config.Storage.Type)
+
+	// Announce the registered resources over multicast DNS-SD (by the primary only)
+	if config.Announce.Enabled {
+		announcer := catalog.NewAnnouncer(storage, config.Announce)
+		if node != nil {
+			announcer.Active = func() bool { return node.Role() == replication.RolePrimary }
+		}
+		announcer.Start()
 	}
 
-	// Configure routers
+	// Configure routers (a federation is read-only)
 	r := mux.NewRouter().StrictSlash(true)
-	r.Methods("GET").Path(config.ApiLocation).HandlerFunc(api.List).Name("list")
-	r.Methods("POST").Path(config.ApiLocation + "/").HandlerFunc(api.Add).Name("add")
-	r.Methods("GET").Path(config.ApiLocation + "/{type}/{path}/{op}/{value}").HandlerFunc(api.Filter).Name("filter")
+	catalog.Mount(r, storage, catalog.HandlerOptions{
+		Location:    config.ApiLocation,
+		Description: config.Description,
+		Writable:    federated == nil,
+		OpenAPI:     true,
+	})
+
+	// Replication endpoints
+	if node != nil {
+		node.Mount(r)
+	}
+
+	// Status of the federated upstreams
+	if federated != nil {
+		r.Methods("GET").Path(config.ApiLocation + "/federation").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			b, _ := json.Marshal(federated.Status())
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(b)
+		}).Name("federation")
+	}
+
+	// CoRE Resource Directory interfaces
+	if config.CoreRD.Enabled {
+		rd := catalog.NewResourceDirectoryAPI(storage, config.CoreRD.DefaultSector)
+		// a federation is read-only
+		rd.ReadOnly = federated != nil
+		r.Methods("GET").Path(catalog.RDWellKnownLocation).HandlerFunc(rd.WellKnownCore).Name("rd-wellknown")
+		rdUrl := catalog.RDLocation + "/{dgwid}/{regid}"
+		r.Methods("GET").Path(rdUrl).HandlerFunc(rd.Get).Name("rd-get")
+		if !rd.ReadOnly {
+			r.Methods("POST").Path(catalog.RDLocation).HandlerFunc(rd.Register).Name("rd-register")
+			r.Methods("POST").Path(rdUrl).HandlerFunc(rd.Update).Name("rd-update")
+			r.Methods("DELETE").Path(rdUrl).HandlerFunc(rd.Delete).Name("rd-delete")
+		}
+		r.Methods("GET").Path(catalog.RDLookupLocation + "/{type}").HandlerFunc(rd.Lookup).Name("rd-lookup")
+	}
 
-	url := config.ApiLocation + "/{dgwid}/{regid}"
-	r.Methods("GET").Path(url).HandlerFunc(api.Get).Name("get")
-	r.Methods("PUT").Path(url).HandlerFunc(api.Update).Name("update")
-	r.Methods("DELETE").Path(url).HandlerFunc(api.Delete).Name("delete")
-	r.Methods("GET").Path(url + "/{resname}").HandlerFunc(api.GetResource).Name("details")
+	return r, node, nil
+}
 
-	return r, nil
+// TXT records of the DNS-SD announcement
+func dnssdTxt(config *Config) []string {
+	txt := discovery.Txt(map[string]string{
+		discovery.TxtUri:        config.ApiLocation,
+		discovery.TxtApiVersion: catalog.ApiVersion,
+		discovery.TxtApiType:    catalog.ApiCollectionType,
+		discovery.TxtScheme:     config.TLS.Scheme(),
+		discovery.TxtId:         discovery.DefaultInstanceId(config.BindPort),
+	})
+	if config.Storage.Type == utils.CatalogBackendFederation {
+		txt = append(txt, federationTxt)
+	}
+	return txt
 }
@@ -53,7 +53,7 @@ func registrationFromConfig(conf *Config) (*sc.Service, error) {
 
 	// protocols
 	// port from the bind port, address from the public address
-	c.Protocols[0].Endpoint["url"] = fmt.Sprintf("http://%v:%v%v", conf.PublicAddr, conf.BindPort, conf.ApiLocation)
+	c.Protocols[0].Endpoint["url"] = fmt.Sprintf("%v://%v:%v%v", conf.TLS.Scheme(), conf.PublicAddr, conf.BindPort, conf.ApiLocation)
 
 	return c.GetService()
 }
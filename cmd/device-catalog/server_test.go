@@ -16,7 +16,7 @@ func TestDemo(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	router, err := setupRouter(config)
+	router, _, err := setupRouter(config)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -10,6 +10,11 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+	"github.com/patchwork-toolkit/patchwork/catalog/registrar"
+	"github.com/patchwork-toolkit/patchwork/discovery"
 )
 
 //
@@ -89,6 +94,10 @@ func loadConfig(confPath string) (*Config, error) {
 	if err = config.Validate(); err != nil {
 		return nil, err
 	}
+	config.provider, err = config.Discovery.Provider()
+	if err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
@@ -96,15 +105,20 @@ func loadConfig(confPath string) (*Config, error) {
 // Main configuration container
 //
 type Config struct {
-	Id           string                       `json:"id"`
-	Description  string                       `json:"description"`
-	DnssdEnabled bool                         `json:"dnssdEnabled"`
-	PublicAddr   string                       `json:"publicAddr"`
-	StaticDir    string                       `json:"staticDir`
-	Catalog      []Catalog                    `json:"catalog"`
-	Http         HttpConfig                   `json:"http"`
-	Protocols    map[ProtocolType]interface{} `json:"protocols"`
-	Devices      []Device                     `json:"devices"`
+	Id             string                       `json:"id"`
+	Description    string                       `json:"description"`
+	DnssdEnabled   bool                         `json:"dnssdEnabled"`
+	PublicAddr     string                       `json:"publicAddr"`
+	StaticDir      string                       `json:"staticDir`
+	Catalog        []Catalog                    `json:"catalog"`
+	ServiceCatalog ServiceCatalogConfig         `json:"serviceCatalog"`
+	Http           HttpConfig                   `json:"http"`
+	Protocols      map[ProtocolType]interface{} `json:"protocols"`
+	Devices        []Device                     `json:"devices"`
+	Discovery      discovery.ProviderConfig     `json:"discovery"`
+
+	// provider of the discovered catalogs and brokers
+	provider discovery.Provider
 }
 
 // Validates the loaded configuration
@@ -143,6 +157,19 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Check if the embedded service catalog config is valid
+	restConf, _ := c.Protocols[ProtocolTypeREST].(RestProtocol)
+	err = c.ServiceCatalog.Validate(restConf.Location)
+	if err != nil {
+		return err
+	}
+
+	// Check if the discovery config is valid
+	err = c.Discovery.Validate()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -164,28 +191,106 @@ func (c *Config) FindResource(resourceId string) (*Resource, bool) {
 type Catalog struct {
 	Discover bool   `json:"discover"`
 	Endpoint string `json:"endpoint"`
+	// Equivalent endpoints of the catalog, used in order after endpoint
+	Endpoints []string `json:"endpoints"`
+	// Address of discovered catalogs: hostname (default), ipv4 or ipv6
+	Prefer string `json:"prefer"`
+	// Discover only catalogs served over TLS
+	RequireTLS bool              `json:"requireTls"`
+	Auth       *auth.Credentials `json:"auth"`
 }
 
 func (c *Catalog) Validate() error {
-	if c.Endpoint == "" && c.Discover == false {
+	if len(c.AllEndpoints()) == 0 && c.Discover == false {
 		return fmt.Errorf("Catalog must have either endpoint or discovery flag defined")
 	}
+	if _, err := discovery.ParseAddressPreference(c.Prefer); err != nil {
+		return err
+	}
 	return nil
 }
 
+// Returns the options of the catalog discovery using the provider (nil if disabled)
+func (c *Catalog) DiscoveryOptions(provider discovery.Provider) *utils.DiscoveryOptions {
+	if !c.Discover {
+		return nil
+	}
+	prefer, _ := discovery.ParseAddressPreference(c.Prefer)
+	return &utils.DiscoveryOptions{
+		Provider: provider,
+		Require:  discovery.Requirements{TLS: c.RequireTLS},
+		Prefer:   prefer,
+	}
+}
+
+// Returns the static endpoints of the catalog in order of preference
+func (c *Catalog) AllEndpoints() []string {
+	endpoints := []string{}
+	if c.Endpoint != "" {
+		endpoints = append(endpoints, c.Endpoint)
+	}
+	return append(endpoints, c.Endpoints...)
+}
+
+//
+// Embedded service catalog config
+//
+type ServiceCatalogConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Location string `json:"location"`
+	// Services may be registered through the API (read-only by default)
+	Writable bool `json:"writable"`
+	// Authentication and request limits of the API
+	Auth   auth.Config        `json:"auth"`
+	Limits utils.LimitsConfig `json:"limits"`
+}
+
+// Validates the config given the location of the REST API of the resources
+func (c *ServiceCatalogConfig) Validate(restLocation string) error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Location == "" {
+		c.Location = ServiceCatalogLocation
+	}
+	if !strings.HasPrefix(c.Location, "/") || c.Location == "/" {
+		return fmt.Errorf("Service catalog location %s is invalid", c.Location)
+	}
+	reserved := []string{CatalogLocation, StaticLocation, DashboardLocation, utils.OpenAPILocation, registrar.DefaultLocation}
+	if restLocation != "" {
+		reserved = append(reserved, restLocation)
+	}
+	for _, location := range reserved {
+		if overlaps(c.Location, location) {
+			return fmt.Errorf("Service catalog location %s is used by another API (%s)", c.Location, location)
+		}
+	}
+	if err := c.Auth.Validate(); err != nil {
+		return err
+	}
+	return c.Limits.Validate()
+}
+
+// Checks if one of the locations is the other one or below it
+func overlaps(a, b string) bool {
+	a, b = strings.TrimSuffix(a, "/"), strings.TrimSuffix(b, "/")
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
 //
 // Http config (for protocols using it)
 //
 type HttpConfig struct {
-	BindAddr string `json:"bindAddr"`
-	BindPort int    `json:"bindPort"`
+	BindAddr string          `json:"bindAddr"`
+	BindPort int             `json:"bindPort"`
+	TLS      utils.TLSConfig `json:"tls"`
 }
 
 func (h *HttpConfig) Validate() error {
 	if h.BindAddr == "" || h.BindPort == 0 {
 		return fmt.Errorf("HTTP bindAddr and bindPort have to be defined")
 	}
-	return nil
+	return h.TLS.Validate()
 }
 
 //
@@ -211,6 +316,9 @@ type MqttProtocol struct {
 	CaFile   string `json:"caFile"`
 	CertFile string `json:"certFile"`
 	KeyFile  string `json:"keyFile"`
+
+	// Credentials of the service catalog the broker is discovered in
+	CatalogAuth *auth.Credentials `json:"catalogAuth"`
 }
 
 func (p *MqttProtocol) Validate() error {
@@ -241,6 +349,13 @@ func (p *MqttProtocol) Validate() error {
 			return fmt.Errorf("MQTT client key file %s does not exist", p.KeyFile)
 		}
 	}
+
+	// Check that the CA file of the service catalog exists
+	if p.CatalogAuth != nil && p.CatalogAuth.CAFile != "" {
+		if _, err := os.Stat(p.CatalogAuth.CAFile); os.IsNotExist(err) {
+			return fmt.Errorf("Service catalog CA file %s does not exist", p.CatalogAuth.CAFile)
+		}
+	}
 	return nil
 }
 
@@ -8,13 +8,25 @@ const (
 	// Use to invalidate cache during the requests for agent's data
 	AgentResponseCacheTTL time.Duration = time.Duration(3) * time.Second
 
+	// Maximum duration of the discovery of the Service Catalog of the MQTT broker
+	BrokerDiscoveryTimeout = 30 * time.Second
+
 	// DNS-SD service name (type)
 	DNSSDServiceTypeDGW  = "_pw-dgw._tcp"
 	DNSSDServiceTypeMQTT = "_mqtt._tcp"
 
+	// API type published in the DNS-SD TXT records
+	ApiType = "DeviceGateway"
+
 	// Static resources URL mounting point
 	StaticLocation = "/static"
 
 	// Device Catalog URL mounting point
 	CatalogLocation = "/dc"
+
+	// Default mounting point of the embedded Service Catalog
+	ServiceCatalogLocation = "/sc"
+
+	// Dashboard configuration URL mounting point
+	DashboardLocation = "/dashboard"
 )
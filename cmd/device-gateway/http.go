@@ -10,7 +10,11 @@ import (
 
 	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/codegangsta/negroni"
 	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
+	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
 	catalog "github.com/patchwork-toolkit/patchwork/catalog/device"
+	"github.com/patchwork-toolkit/patchwork/catalog/registrar"
+	"github.com/patchwork-toolkit/patchwork/catalog/service"
 )
 
 // errorResponse used to serialize errors into JSON for RESTful responses
@@ -40,13 +44,20 @@ func newRESTfulAPI(conf *Config, dataCh chan<- DataRequest) *RESTfulAPI {
 	return api
 }
 
-// Setup all routers, handlers and start a HTTP server (blocking call)
-func (api *RESTfulAPI) start(catalogStorage catalog.CatalogStorage) {
+// Setup all routers, handlers and start a HTTP server (blocking call).
+// serviceStorage is the storage of the embedded service catalog (nil if disabled),
+// reg keeps the registrations in the remote catalogs
+func (api *RESTfulAPI) start(catalogStorage catalog.CatalogStorage, serviceStorage service.CatalogStorage, reg *registrar.Registrar) {
 	api.mountCatalog(catalogStorage)
+	if serviceStorage != nil {
+		api.mountServiceCatalog(serviceStorage)
+	}
+	api.router.Methods("GET").Path(registrar.DefaultLocation).Handler(reg)
 	api.mountResources()
 
-	api.router.Methods("GET", "POST").Path("/dashboard").HandlerFunc(api.dashboardHandler(*confPath))
+	api.router.Methods("GET", "POST").Path(DashboardLocation).HandlerFunc(api.dashboardHandler(*confPath))
 	api.router.Methods("GET").Path(api.restConfig.Location).HandlerFunc(api.indexHandler())
+	api.router.Methods("GET").Path(utils.OpenAPILocation).HandlerFunc(utils.NewOpenAPIHandler(api.openAPIDocument()))
 
 	err := mime.AddExtensionType(".jsonld", "application/ld+json")
 	if err != nil {
@@ -68,8 +79,11 @@ func (api *RESTfulAPI) start(catalogStorage catalog.CatalogStorage) {
 
 	// Start the listener
 	addr := fmt.Sprintf("%v:%v", api.config.Http.BindAddr, api.config.Http.BindPort)
-	logger.Printf("RESTfulAPI.start() Starting server at http://%v%v", addr, api.restConfig.Location)
-	n.Run(addr)
+	logger.Printf("RESTfulAPI.start() Starting server at %v://%v%v", api.config.Http.TLS.Scheme(), addr, api.restConfig.Location)
+	err = utils.ListenAndServe(addr, n, &api.config.Http.TLS)
+	if err != nil {
+		logger.Fatalf("RESTfulAPI.start() ERROR: %v", err)
+	}
 }
 
 // Create a HTTP handler to serve and update dashboard configuration
@@ -148,21 +162,44 @@ func (api *RESTfulAPI) mountResources() {
 }
 
 func (api *RESTfulAPI) mountCatalog(catalogStorage catalog.CatalogStorage) {
-	catalogAPI := catalog.NewReadableCatalogAPI(
-		catalogStorage,
-		CatalogLocation,
-		StaticLocation,
-		fmt.Sprintf("Local catalog at %s", api.config.Description),
-	)
-
-	api.router.Methods("GET").Path(CatalogLocation + "/{type}/{path}/{op}/{value}").HandlerFunc(catalogAPI.Filter).Name("filter")
-	api.router.Methods("GET").Path(CatalogLocation + "/{dgwid}/{regid}/{resname}").HandlerFunc(catalogAPI.GetResource).Name("details")
-	api.router.Methods("GET").Path(CatalogLocation + "/{dgwid}/{regid}").HandlerFunc(catalogAPI.Get).Name("get")
-	api.router.Methods("GET").Path(CatalogLocation).HandlerFunc(catalogAPI.List).Name("list")
+	catalog.Mount(api.router, catalogStorage, catalog.HandlerOptions{
+		Location:       CatalogLocation,
+		StaticLocation: StaticLocation,
+		Description:    fmt.Sprintf("Local catalog at %s", api.config.Description),
+		Name:           "dc",
+	})
 
 	logger.Printf("RESTfulAPI.mountCatalog() Mounted local catalog at %v", CatalogLocation)
 }
 
+// Mounts the embedded service catalog behind its own authentication and request limits
+func (api *RESTfulAPI) mountServiceCatalog(serviceStorage service.CatalogStorage) {
+	config := api.config.ServiceCatalog
+	r := mux.NewRouter().StrictSlash(true)
+	service.Mount(r, serviceStorage, service.HandlerOptions{
+		Location:       config.Location,
+		StaticLocation: StaticLocation,
+		Description:    fmt.Sprintf("Service catalog at %s", api.config.Description),
+		Writable:       config.Writable,
+		Name:           "sc",
+	})
+
+	n := negroni.New()
+	if config.Auth.Enabled {
+		authenticator, err := auth.NewAuthenticator(config.Auth)
+		if err != nil {
+			logger.Fatalf("RESTfulAPI.mountServiceCatalog() Error configuring authentication: %v", err)
+		}
+		n.Use(authenticator)
+	}
+	n.Use(utils.NewLimiter(config.Limits))
+	n.UseHandler(r)
+	api.router.Path(config.Location).Handler(n)
+	api.router.PathPrefix(config.Location + "/").Handler(n)
+
+	logger.Printf("RESTfulAPI.mountServiceCatalog() Mounted service catalog at %v (writable: %v)", config.Location, config.Writable)
+}
+
 func (api *RESTfulAPI) createResourceGetHandler(resourceId string) http.HandlerFunc {
 	return func(rw http.ResponseWriter, req *http.Request) {
 		logger.Printf("RESTfulAPI.createResourceGetHandler() %s %s", req.Method, req.RequestURI)
@@ -2,13 +2,16 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/oleksandr/bonjour"
+	utils "github.com/patchwork-toolkit/patchwork/catalog"
 	catalog "github.com/patchwork-toolkit/patchwork/catalog/device"
+	"github.com/patchwork-toolkit/patchwork/catalog/registrar"
+	"github.com/patchwork-toolkit/patchwork/catalog/service"
+	"github.com/patchwork-toolkit/patchwork/discovery"
 )
 
 var (
@@ -42,17 +45,26 @@ func main() {
 	// Start agents
 	go agentManager.start()
 
-	// Expose device's resources via REST (include statics and local catalog)
+	// Expose device's resources via REST (include statics, local catalog and
+	// the embedded service catalog if enabled)
 	restServer := newRESTfulAPI(config, agentManager.DataRequestInbox())
 	catalogStorage := catalog.NewMemoryStorage()
-	go restServer.start(catalogStorage)
+	var serviceStorage service.CatalogStorage
+	if config.ServiceCatalog.Enabled {
+		serviceStorage = service.NewMemoryStorage()
+		if config.ServiceCatalog.Limits.Quota != (utils.QuotaConfig{}) {
+			serviceStorage = service.NewQuotaStorage(serviceStorage, config.ServiceCatalog.Limits.Quota)
+		}
+	}
+	reg := registrar.NewRegistrar()
+	go restServer.start(catalogStorage, serviceStorage, reg)
 
 	// Parse device configurations
 	devices := configureDevices(config)
 	// register in local catalog
 	registerInLocalCatalog(devices, config, catalogStorage)
 	// register in remote catalogs
-	regChannels, wg := registerInRemoteCatalog(devices, config)
+	registerInRemoteCatalog(devices, config, reg)
 
 	// Register this gateway as a service via DNS-SD
 	var bonjourCh chan<- bool
@@ -62,7 +74,13 @@ func main() {
 			DNSSDServiceTypeDGW,
 			"",
 			config.Http.BindPort,
-			[]string{fmt.Sprintf("uri=%s", restConfig.Location)},
+			discovery.Txt(map[string]string{
+				discovery.TxtUri:        restConfig.Location,
+				discovery.TxtApiVersion: catalog.ApiVersion,
+				discovery.TxtApiType:    ApiType,
+				discovery.TxtScheme:     config.Http.TLS.Scheme(),
+				discovery.TxtId:         config.Id,
+			}),
 			nil)
 		if err != nil {
 			logger.Printf("Failed to register DNS-SD service: %s", err.Error())
@@ -97,14 +115,7 @@ func main() {
 	}
 
 	// Unregister in the remote catalog(s)
-	for _, sigCh := range regChannels {
-		// Notify if the routine hasn't returned already
-		select {
-		case sigCh <- true:
-		default:
-		}
-	}
-	wg.Wait()
+	reg.Stop()
 
 	logger.Println("Stopped")
 	os.Exit(0)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	MQTT "github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/git.eclipse.org/gitroot/paho/org.eclipse.paho.mqtt.golang.git"
 	"github.com/patchwork-toolkit/patchwork/catalog"
 	"github.com/patchwork-toolkit/patchwork/catalog/service"
+	"github.com/patchwork-toolkit/patchwork/discovery"
 )
 
 type MQTTPublisher struct {
@@ -18,6 +20,10 @@ type MQTTPublisher struct {
 	clientId string
 	client   *MQTT.MqttClient
 	dataCh   chan AgentResponse
+	// selects among discovered brokers (nil if configured)
+	selector *service.Selector
+	// provider of the discovered service catalog
+	discovery discovery.Provider
 }
 
 func newMQTTPublisher(conf *Config) *MQTTPublisher {
@@ -54,9 +60,10 @@ func newMQTTPublisher(conf *Config) *MQTTPublisher {
 
 	// Create and return publisher
 	publisher := &MQTTPublisher{
-		config:   &config,
-		clientId: fmt.Sprintf("%v-%v", conf.Id, time.Now().Unix()),
-		dataCh:   make(chan AgentResponse),
+		config:    &config,
+		clientId:  fmt.Sprintf("%v-%v", conf.Id, time.Now().Unix()),
+		dataCh:    make(chan AgentResponse),
+		discovery: conf.provider,
 	}
 
 	return publisher
@@ -104,35 +111,28 @@ func (p *MQTTPublisher) start() {
 }
 
 func (p *MQTTPublisher) discoverBrokerEndpoint() error {
-	endpoint, err := catalog.DiscoverCatalogEndpoint(service.DNSSDServiceType)
+	ctx, cancel := context.WithTimeout(context.Background(), BrokerDiscoveryTimeout)
+	defer cancel()
+	endpoint, err := catalog.DiscoverCatalogEndpointContext(ctx, service.DNSSDServiceType, catalog.DiscoveryOptions{Provider: p.discovery})
 	if err != nil {
 		return err
 	}
 
-	rcc := service.NewRemoteCatalogClient(endpoint)
-	res, _, err := rcc.FindServices("meta.serviceType", "equals", DNSSDServiceTypeMQTT, 1, 50)
+	client, err := service.NewRemoteCatalogClientWithOptions(endpoint, catalog.ClientOptions{Credentials: p.config.CatalogAuth})
 	if err != nil {
 		return err
 	}
-	supportsPub := false
-	for _, s := range res {
-		for _, proto := range s.Protocols {
-			for _, m := range proto.Methods {
-				if m == "PUB" {
-					supportsPub = true
-					break
-				}
-			}
-			if !supportsPub {
-				continue
-			}
-			logger.Println(proto.Endpoint["url"])
-			if ProtocolType(proto.Type) == ProtocolTypeMQTT {
-				p.config.URL = proto.Endpoint["url"].(string)
-				break
-			}
-		}
+	p.selector = service.NewSelector(client, service.SelectorConfig{
+		ServiceType: DNSSDServiceTypeMQTT,
+		Protocol:    string(ProtocolTypeMQTT),
+		Method:      "PUB",
+		Strategy:    service.StrategyHealthAware,
+	})
+	broker, err := p.selector.Select()
+	if err != nil {
+		return err
 	}
+	p.config.URL = broker.URL
 
 	err = p.config.Validate()
 	if err != nil {
@@ -141,6 +141,24 @@ func (p *MQTTPublisher) discoverBrokerEndpoint() error {
 	return nil
 }
 
+// Switches to another discovered broker after a connection failure
+func (p *MQTTPublisher) failover() {
+	p.selector.Fail(p.config.URL)
+	broker, err := p.selector.Select()
+	if err != nil || broker.URL == p.config.URL {
+		return
+	}
+	config := *p.config
+	config.URL = broker.URL
+	if config.Validate() != nil {
+		return
+	}
+
+	logger.Printf("MQTTPublisher.failover() switching to the broker %v\n", broker.URL)
+	p.config.URL = broker.URL
+	p.configureMqttConnection()
+}
+
 func (p *MQTTPublisher) stop() {
 	logger.Println("MQTTPublisher.stop()")
 	if p.client != nil && p.client.IsConnected() {
@@ -164,6 +182,9 @@ func (p *MQTTPublisher) connect(backOff int) {
 			break
 		}
 		logger.Printf("MQTTPublisher.connect() failed to connect: %v\n", err.Error())
+		if p.selector != nil {
+			p.failover()
+		}
 		if backOff == 0 {
 			backOff = 10
 		} else if backOff <= 600 {
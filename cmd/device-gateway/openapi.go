@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	catalog "github.com/patchwork-toolkit/patchwork/catalog/device"
+	"github.com/patchwork-toolkit/patchwork/catalog/service"
+)
+
+// Creates an OpenAPI document describing the REST resources of the configured
+// devices, the local (read-only) catalog and the embedded service catalog
+func (api *RESTfulAPI) openAPIDocument() *utils.OpenAPIDocument {
+	doc := utils.NewOpenAPIDocument("Device Gateway", api.config.Description, catalog.ApiVersion)
+	doc.Merge(catalog.NewOpenAPIDocument(CatalogLocation, fmt.Sprintf("Local catalog at %s", api.config.Description), false))
+	if api.config.ServiceCatalog.Enabled {
+		doc.Merge(service.NewOpenAPIDocument(api.config.ServiceCatalog.Location, fmt.Sprintf("Service catalog at %s", api.config.Description), api.config.ServiceCatalog.Writable))
+	}
+
+	for _, device := range api.config.Devices {
+		for _, resource := range device.Resources {
+			for _, protocol := range resource.Protocols {
+				if protocol.Type != ProtocolTypeREST {
+					continue
+				}
+				uri := api.restConfig.Location + "/" + device.Name + "/" + resource.Name
+				rid := device.ResourceId(resource.Name)
+				for _, method := range protocol.Methods {
+					switch method {
+					case "GET":
+						doc.AddOperation(uri, method, &utils.OpenAPIOperation{
+							OperationId: "get-" + rid,
+							Summary:     fmt.Sprintf("Reads resource %s of device %s", resource.Name, device.Name),
+							Responses: map[string]utils.OpenAPIResponse{
+								"200": {
+									Description: "Current value of the resource",
+									Content:     openAPIResourceContent(resource, protocol.ContentTypes),
+								},
+								"415": utils.OpenAPITextResponse("Media type is not supported by this resource"),
+								"500": utils.OpenAPITextResponse("Data not available"),
+							},
+						})
+					case "PUT":
+						doc.AddOperation(uri, method, &utils.OpenAPIOperation{
+							OperationId: "put-" + rid,
+							Summary:     fmt.Sprintf("Writes resource %s of device %s", resource.Name, device.Name),
+							RequestBody: &utils.OpenAPIRequestBody{
+								Required: true,
+								Content:  openAPIResourceContent(resource, protocol.ContentTypes),
+							},
+							Responses: map[string]utils.OpenAPIResponse{
+								"204": utils.OpenAPITextResponse("Value has been written"),
+								"415": utils.OpenAPITextResponse("Media type is not supported by this resource"),
+								"500": utils.OpenAPITextResponse("Failed to write the value"),
+							},
+						})
+					}
+				}
+			}
+		}
+	}
+	return doc
+}
+
+// Media types of a resource with Representation as schema when available.
+// Representation is either keyed by content-type or a single schema for all.
+func openAPIResourceContent(resource Resource, contentTypes []string) map[string]utils.OpenAPIMediaItem {
+	byContentType := false
+	for k := range resource.Representation {
+		if strings.Contains(k, "/") {
+			byContentType = true
+			break
+		}
+	}
+
+	content := make(map[string]utils.OpenAPIMediaItem, len(contentTypes))
+	for _, ct := range contentTypes {
+		var schema map[string]interface{}
+		if byContentType {
+			schema, _ = resource.Representation[ct].(map[string]interface{})
+		} else if len(resource.Representation) > 0 {
+			schema = resource.Representation
+		}
+		if len(schema) == 0 {
+			schema = map[string]interface{}{}
+		}
+		content[ct] = utils.OpenAPIMediaItem{Schema: utils.OpenAPISchema(schema)}
+	}
+	return content
+}
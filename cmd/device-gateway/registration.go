@@ -2,9 +2,9 @@ package main
 
 import (
 	"fmt"
-	"sync"
 
 	catalog "github.com/patchwork-toolkit/patchwork/catalog/device"
+	"github.com/patchwork-toolkit/patchwork/catalog/registrar"
 )
 
 // Parses config into a slice of configured devices
@@ -36,7 +36,8 @@ func configureDevices(config *Config) []catalog.Device {
 				p.ContentTypes = proto.ContentTypes
 				p.Endpoint = map[string]interface{}{}
 				if proto.Type == ProtocolTypeREST {
-					p.Endpoint["url"] = fmt.Sprintf("http://%s:%d%s",
+					p.Endpoint["url"] = fmt.Sprintf("%s://%s:%d%s",
+						config.Http.TLS.Scheme(),
 						config.PublicAddr,
 						config.Http.BindPort,
 						restConfig.Location+"/"+device.Name+"/"+resource.Name)
@@ -65,23 +66,16 @@ func registerInLocalCatalog(devices []catalog.Device, config *Config, catalogSto
 	}
 }
 
-func registerInRemoteCatalog(devices []catalog.Device, config *Config) ([]chan<- bool, *sync.WaitGroup) {
-	regChannels := make([]chan<- bool, 0, len(config.Catalog))
-	var wg sync.WaitGroup
-
+// Registers the devices in the configured remote catalogs and keeps them alive
+func registerInRemoteCatalog(devices []catalog.Device, config *Config, reg *registrar.Registrar) {
 	if len(config.Catalog) > 0 {
 		logger.Println("Will now register in the configured remote catalogs")
 
 		for _, cat := range config.Catalog {
 			for _, d := range devices {
-				sigCh := make(chan bool)
-
-				go catalog.RegisterDeviceWithKeepalive(cat.Endpoint, cat.Discover, d, sigCh, &wg)
-				regChannels = append(regChannels, sigCh)
-				wg.Add(1)
+				reg.Add(catalog.NewFailoverRegistration(cat.AllEndpoints(), cat.DiscoveryOptions(config.provider), d, cat.Auth))
 			}
 		}
 	}
-
-	return regChannels, &wg
+	reg.Start()
 }
@@ -7,16 +7,59 @@ import (
 	"strings"
 
 	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+	"github.com/patchwork-toolkit/patchwork/catalog/replication"
+	catalog "github.com/patchwork-toolkit/patchwork/catalog/service"
+	"github.com/patchwork-toolkit/patchwork/discovery"
 )
 
 type Config struct {
-	Description  string        `json:"description"`
-	DnssdEnabled bool          `json:"dnssdEnabled"`
-	BindAddr     string        `json:"bindAddr"`
-	BindPort     int           `json:"bindPort"`
-	ApiLocation  string        `json:"apiLocation"`
-	StaticDir    string        `json:"staticDir"`
-	Storage      StorageConfig `json:"storage"`
+	Description  string               `json:"description"`
+	DnssdEnabled bool                 `json:"dnssdEnabled"`
+	BindAddr     string               `json:"bindAddr"`
+	BindPort     int                  `json:"bindPort"`
+	ApiLocation  string               `json:"apiLocation"`
+	StaticDir    string               `json:"staticDir"`
+	Storage      StorageConfig        `json:"storage"`
+	Auth         auth.Config          `json:"auth"`
+	TLS          utils.TLSConfig      `json:"tls"`
+	Limits       utils.LimitsConfig   `json:"limits"`
+	Replication  replication.Config   `json:"replication"`
+	HealthCheck  HealthCheckConfig    `json:"healthCheck"`
+	Announce     utils.AnnounceConfig `json:"announce"`
+	DNS          DNSConfig            `json:"dns"`
+	Import       ImportConfig         `json:"import"`
+}
+
+// Import of the services announced via DNS-SD
+type ImportConfig struct {
+	Enabled bool `json:"enabled"`
+	// DNS-SD service types to import (e.g. _mqtt._tcp)
+	ServiceTypes []string `json:"serviceTypes"`
+	// TTL of the imported services (seconds)
+	Ttl int `json:"ttl"`
+	// Address of the imported services: hostname (default), ipv4 or ipv6
+	Prefer string `json:"prefer"`
+	// Provider browsing the service types (mdns by default)
+	Discovery discovery.ProviderConfig `json:"discovery"`
+}
+
+// DNS interface of the catalog
+type DNSConfig struct {
+	Enabled bool `json:"enabled"`
+	// Address (host:port) of the UDP and TCP listeners
+	BindAddr string `json:"bindAddr"`
+	// Domain of the names (e.g. pw.local for mqtt.service.pw.local)
+	Domain string `json:"domain"`
+}
+
+// Health checking of the registered services
+type HealthCheckConfig struct {
+	Enabled bool `json:"enabled"`
+	// Lower bound of the check intervals requested by services (seconds)
+	MinInterval int `json:"minInterval"`
+	// Hosts the checks may connect to
+	Targets catalog.HealthCheckPolicy `json:"targets"`
 }
 
 type StorageConfig struct {
@@ -47,6 +90,44 @@ func (c *Config) Validate() error {
 	if strings.HasSuffix(c.StaticDir, "/") {
 		err = fmt.Errorf("staticDir must not have a training slash")
 	}
+	if e := c.Auth.Validate(); e != nil {
+		err = e
+	}
+	if e := c.TLS.Validate(); e != nil {
+		err = e
+	}
+	if e := c.Limits.Validate(); e != nil {
+		err = e
+	}
+	if e := c.Replication.Validate(); e != nil {
+		err = e
+	}
+	if c.HealthCheck.MinInterval < 0 {
+		err = fmt.Errorf("healthCheck minInterval must not be negative")
+	}
+	if e := c.HealthCheck.Targets.Validate(); e != nil {
+		err = e
+	}
+	if e := c.Announce.Validate(); e != nil {
+		err = e
+	}
+	if c.DNS.Enabled && (c.DNS.BindAddr == "" || c.DNS.Domain == "") {
+		err = fmt.Errorf("dns must have bindAddr and domain defined")
+	}
+	if c.Import.Enabled {
+		if len(c.Import.ServiceTypes) == 0 {
+			err = fmt.Errorf("import must have serviceTypes defined")
+		}
+		if c.Import.Ttl < 0 {
+			err = fmt.Errorf("import ttl must not be negative")
+		}
+		if _, e := discovery.ParseAddressPreference(c.Import.Prefer); e != nil {
+			err = e
+		}
+		if e := c.Import.Discovery.Validate(); e != nil {
+			err = e
+		}
+	}
 	return err
 }
 
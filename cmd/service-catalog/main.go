@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"mime"
@@ -14,7 +15,10 @@ import (
 	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/gorilla/mux"
 	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/oleksandr/bonjour"
 	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+	"github.com/patchwork-toolkit/patchwork/catalog/replication"
 	catalog "github.com/patchwork-toolkit/patchwork/catalog/service"
+	"github.com/patchwork-toolkit/patchwork/discovery"
 )
 
 var (
@@ -29,7 +33,7 @@ func main() {
 		logger.Fatalf("Error reading config file %v: %v", *confPath, err)
 	}
 
-	r, err := setupRouter(config)
+	r, node, err := setupRouter(config)
 	if err != nil {
 		logger.Fatal(err.Error())
 	}
@@ -41,7 +45,13 @@ func main() {
 			catalog.DNSSDServiceType,
 			"",
 			config.BindPort,
-			[]string{fmt.Sprintf("uri=%s", config.ApiLocation)},
+			discovery.Txt(map[string]string{
+				discovery.TxtUri:        config.ApiLocation,
+				discovery.TxtApiVersion: catalog.ApiVersion,
+				discovery.TxtApiType:    catalog.ApiCollectionType,
+				discovery.TxtScheme:     config.TLS.Scheme(),
+				discovery.TxtId:         discovery.DefaultInstanceId(config.BindPort),
+			}),
 			nil)
 		if err != nil {
 			logger.Printf("Failed to register DNS-SD service: %s", err.Error())
@@ -86,40 +96,117 @@ func main() {
 			IndexFile: "index.html",
 		},
 	)
+	// Authenticate requests to the API
+	if config.Auth.Enabled {
+		authenticator, err := auth.NewAuthenticator(config.Auth)
+		if err != nil {
+			logger.Fatalf("Error configuring authentication: %v", err)
+		}
+		n.Use(authenticator)
+	}
+	// Enforce request limits (after authentication to rate limit by principal)
+	n.Use(utils.NewLimiter(config.Limits))
+	// Forward writes of a replica to the primary
+	if node != nil {
+		n.Use(node)
+	}
 	// Mount router
 	n.UseHandler(r)
 
 	// Start listener
 	endpoint := fmt.Sprintf("%s:%s", config.BindAddr, strconv.Itoa(config.BindPort))
-	logger.Printf("Starting standalone Service Catalog at %v%v", endpoint, config.ApiLocation)
-	n.Run(endpoint)
+	logger.Printf("Starting standalone Service Catalog at %v://%v%v", config.TLS.Scheme(), endpoint, config.ApiLocation)
+	err = utils.ListenAndServe(endpoint, n, &config.TLS)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
 }
 
-func setupRouter(config *Config) (*mux.Router, error) {
-	// Create catalog API object
-	var api *catalog.WritableCatalogAPI
+func setupRouter(config *Config) (*mux.Router, *replication.Node, error) {
+	// Create catalog storage
+	var (
+		storage catalog.CatalogStorage
+		node    *replication.Node
+	)
 	if config.Storage.Type == utils.CatalogBackendMemory {
-		api = catalog.NewWritableCatalogAPI(
-			catalog.NewMemoryStorage(),
-			config.ApiLocation,
-			utils.StaticLocation,
-			config.Description,
-		)
+		memory := catalog.NewMemoryStorage()
+		storage = memory
+		if config.Replication.Enabled {
+			log := replication.NewLog(config.Replication.LogSize)
+			replicated := catalog.NewReplicatedStorage(memory, log)
+			var err error
+			node, err = replication.NewNode(config.Replication, replicated, log, replication.DefaultLocation)
+			if err != nil {
+				return nil, nil, err
+			}
+			storage = replicated
+		}
+		if config.Limits.Quota != (utils.QuotaConfig{}) {
+			storage = catalog.NewQuotaStorage(storage, config.Limits.Quota)
+		}
+		if config.HealthCheck.Enabled {
+			checker := catalog.NewHealthChecker(storage, config.HealthCheck.MinInterval)
+			checker.Policy = &config.HealthCheck.Targets
+			if node != nil {
+				// replicas receive the status from the primary
+				checker.Active = func() bool { return node.Role() == replication.RolePrimary }
+			}
+			checker.Start()
+		}
 	}
-	if api == nil {
-		return nil, fmt.Errorf("Could not create catalog API structure. Unsupported storage type: %v", config.Storage.Type)
+	if storage == nil {
+		return nil, nil, fmt.Errorf("Could not create catalog API structure. Unsupported storage type: %v", config.Storage.Type)
+	}
+
+	// Announce the registered services over multicast DNS-SD (by the primary only)
+	if config.Announce.Enabled {
+		announcer := catalog.NewAnnouncer(storage, config.Announce)
+		if node != nil {
+			announcer.Active = func() bool { return node.Role() == replication.RolePrimary }
+		}
+		announcer.Start()
+	}
+
+	// Import the services announced via DNS-SD (by the primary only)
+	if config.Import.Enabled {
+		provider, err := config.Import.Discovery.Provider()
+		if err != nil {
+			return nil, nil, err
+		}
+		prefer, _ := discovery.ParseAddressPreference(config.Import.Prefer)
+		importer := catalog.NewImporter(storage, config.Import.ServiceTypes, catalog.ImporterOptions{
+			Provider: provider,
+			Ttl:      config.Import.Ttl,
+			Prefer:   prefer,
+		})
+		if node != nil {
+			importer.Active = func() bool { return node.Role() == replication.RolePrimary }
+		}
+		go importer.Run(context.Background())
+	}
+
+	// Answer DNS queries of the registered services
+	if config.DNS.Enabled {
+		go func() {
+			logger.Printf("Starting DNS interface at %v for domain %v", config.DNS.BindAddr, config.DNS.Domain)
+			err := catalog.ListenAndServeDNS(config.DNS.BindAddr, catalog.NewDNSHandler(storage, config.DNS.Domain))
+			logger.Fatal(err.Error())
+		}()
 	}
 
 	// Configure routers
 	r := mux.NewRouter().StrictSlash(true)
-	r.Methods("GET").Path(config.ApiLocation).HandlerFunc(api.List).Name("list")
-	r.Methods("POST").Path(config.ApiLocation + "/").HandlerFunc(api.Add).Name("add")
-	r.Methods("GET").Path(config.ApiLocation + "/{type}/{path}/{op}/{value}").HandlerFunc(api.Filter).Name("filter")
-
-	url := config.ApiLocation + "/{hostid}/{regid}"
-	r.Methods("GET").Path(url).HandlerFunc(api.Get).Name("get")
-	r.Methods("PUT").Path(url).HandlerFunc(api.Update).Name("update")
-	r.Methods("DELETE").Path(url).HandlerFunc(api.Delete).Name("delete")
+	catalog.Mount(r, storage, catalog.HandlerOptions{
+		Location:    config.ApiLocation,
+		Description: config.Description,
+		Writable:    true,
+		OpenAPI:     true,
+	})
+
+	// Replication endpoints
+	if node != nil {
+		node.Mount(r)
+	}
 
-	return r, nil
+	return r, node, nil
 }
@@ -8,15 +8,19 @@ import (
 	"os"
 	"os/signal"
 	"strings"
-	"sync"
 
+	utils "github.com/patchwork-toolkit/patchwork/catalog"
+	"github.com/patchwork-toolkit/patchwork/catalog/auth"
+	"github.com/patchwork-toolkit/patchwork/catalog/registrar"
 	catalog "github.com/patchwork-toolkit/patchwork/catalog/service"
 )
 
 var (
-	confPath = flag.String("conf", "", "Path to the service configuration file")
-	endpoint = flag.String("endpoint", "", "Service Catalog endpoint")
-	discover = flag.Bool("discover", false, "Use DNS-SD service discovery to find Service Catalog endpoint")
+	confPath  = flag.String("conf", "", "Path to the service configuration file")
+	endpoint  = flag.String("endpoint", "", "Service Catalog endpoint (comma-separated equivalent endpoints for failover)")
+	discover  = flag.Bool("discover", false, "Use DNS-SD service discovery to find Service Catalog endpoint")
+	token     = flag.String("token", "", "Bearer token for the Service Catalog")
+	tokenFile = flag.String("tokenFile", "", "Path to a file with the bearer token for the Service Catalog")
 )
 
 func main() {
@@ -39,10 +43,21 @@ func main() {
 	}
 
 	// Launch the registration routine
-	var wg sync.WaitGroup
-	regCh := make(chan bool)
-	go catalog.RegisterServiceWithKeepalive(*endpoint, *discover, *service, regCh, &wg)
-	wg.Add(1)
+	var credentials *auth.Credentials
+	if *token != "" || *tokenFile != "" {
+		credentials = &auth.Credentials{Token: *token, TokenFile: *tokenFile}
+	}
+	reg := registrar.NewRegistrar()
+	var endpoints []string
+	if *endpoint != "" {
+		endpoints = strings.Split(*endpoint, ",")
+	}
+	var discoveryOpts *utils.DiscoveryOptions
+	if *discover {
+		discoveryOpts = &utils.DiscoveryOptions{}
+	}
+	reg.Add(catalog.NewFailoverRegistration(endpoints, discoveryOpts, *service, credentials))
+	reg.Start()
 
 	// Ctrl+C handling
 	handler := make(chan os.Signal, 1)
@@ -53,13 +68,8 @@ func main() {
 			break
 		}
 	}
-	// Signal shutdown to the registration routine
-	select {
-	// Notify if the routine hasn't returned already
-	case regCh <- true:
-	default:
-	}
-	wg.Wait()
+	// Unregister the service
+	reg.Stop()
 
 	logger.Println("Stopped")
 	os.Exit(0)
@@ -0,0 +1,377 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Default interval of the synchronization of the announcements
+	DefaultAnnounceInterval = 5 * time.Second
+	// Maximum length of an instance name (a DNS label)
+	maxInstanceName = 63
+	// Maximum length of a TXT record
+	maxTxtRecord = 255
+	// Time the resolved addresses of hosts are cached
+	resolveTTL = time.Minute
+)
+
+// Default ports of the URL schemes
+var schemePorts = map[string]int{
+	"http":  80,
+	"https": 443,
+	"mqtt":  1883,
+	"mqtts": 8883,
+	"coap":  5683,
+	"coaps": 5684,
+	"ws":    80,
+	"wss":   443,
+}
+
+// Announces instances over multicast DNS-SD on behalf of their hosts.
+// The announced instances follow the ones returned by a function, which
+// are announced, updated and withdrawn on every synchronization
+type Announcer struct {
+	// Network interface of the announcements (the default multicast interface if nil)
+	Interface *net.Interface
+	// Interval of the synchronization (defaults to DefaultAnnounceInterval)
+	Interval time.Duration
+	// Instances are announced only while it returns true (e.g. on the primary
+	// of replicated catalogs), always if nil
+	Active func() bool
+
+	// instances to announce by key
+	instances func() (map[string]Instance, error)
+	// registers an instance, returning the function withdrawing it
+	register func(i Instance) (func(), error)
+	// responder of all announced instances (opened on the first one)
+	responder *responder
+	announced map[string]*announcement
+	stopCh    chan bool
+	stopped   chan bool
+	mutex     sync.Mutex
+}
+
+type announcement struct {
+	// announced instance (renamed on conflicts) and the requested name
+	instance Instance
+	name     string
+	withdraw func()
+}
+
+// Creates an announcer of the instances returned by the given function
+// by key (e.g. the id of the catalog entry)
+func NewAnnouncer(instances func() (map[string]Instance, error)) *Announcer {
+	self := &Announcer{
+		instances: instances,
+		announced: make(map[string]*announcement),
+	}
+	self.register = self.registerProxy
+	return self
+}
+
+// Starts synchronizing the announcements in the background
+func (self *Announcer) Start() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.stopCh != nil {
+		return
+	}
+	interval := self.Interval
+	if interval <= 0 {
+		interval = DefaultAnnounceInterval
+	}
+	self.stopCh = make(chan bool)
+	self.stopped = make(chan bool)
+	go func(stopCh, stopped chan bool) {
+		defer close(stopped)
+		self.Sync()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				self.Sync()
+			}
+		}
+	}(self.stopCh, self.stopped)
+}
+
+// Stops synchronizing and withdraws all announcements
+func (self *Announcer) Stop() {
+	self.mutex.Lock()
+	stopCh, stopped := self.stopCh, self.stopped
+	self.stopCh, self.stopped = nil, nil
+	self.mutex.Unlock()
+	if stopCh != nil {
+		close(stopCh)
+		<-stopped
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for key, a := range self.announced {
+		a.withdraw()
+		delete(self.announced, key)
+	}
+	if self.responder != nil {
+		self.responder.close()
+		self.responder = nil
+	}
+}
+
+// Announces new instances, re-announces changed ones and withdraws the
+// ones which are gone
+func (self *Announcer) Sync() error {
+	instances := make(map[string]Instance)
+	if self.Active == nil || self.Active() {
+		var err error
+		instances, err = self.instances()
+		if err != nil {
+			logger.Printf("Announcer.Sync() Error listing the instances: %v", err)
+			return err
+		}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for key, a := range self.announced {
+		if i, ok := instances[key]; !ok || !a.instance.equal(i) || a.name != i.Name || a.instance.Type != i.Type {
+			logger.Printf("Announcer.Sync() Withdrawing %v (%v)", a.instance.Name, key)
+			a.withdraw()
+			delete(self.announced, key)
+		}
+	}
+
+	// announce in the order of the keys to resolve name conflicts consistently
+	keys := make([]string, 0, len(instances))
+	for key := range instances {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	names := make(map[string]bool)
+	for _, key := range keys {
+		if a, ok := self.announced[key]; ok {
+			names[a.instance.conflictKey()] = true
+		}
+	}
+	for _, key := range keys {
+		if _, ok := self.announced[key]; ok {
+			continue
+		}
+		i := uniqueName(instances[key], names)
+		withdraw, err := self.register(i)
+		if err != nil {
+			logger.Printf("Announcer.Sync() Error announcing %v (%v): %v", i.Name, key, err)
+			continue
+		}
+		logger.Printf("Announcer.Sync() Announced %v (%v) at %v:%v", i.Name, key, i.Host, i.Port)
+		names[i.conflictKey()] = true
+		self.announced[key] = &announcement{i, instances[key].Name, withdraw}
+	}
+	return nil
+}
+
+// Returns the announced instances ordered by name
+func (self *Announcer) Announced() []Instance {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	instances := make([]Instance, 0, len(self.announced))
+	for _, a := range self.announced {
+		instances = append(instances, a.instance)
+	}
+	sort.Sort(byName(instances))
+	return instances
+}
+
+// Adds the records of the instance to the responder
+// WARNING: the caller must obtain the lock before calling
+func (self *Announcer) registerProxy(i Instance) (func(), error) {
+	if self.responder == nil {
+		r, err := newResponder(self.Interface)
+		if err != nil {
+			return nil, err
+		}
+		self.responder = r
+	}
+	return self.responder.add(i)
+}
+
+// Key of the instance names which must be unique
+func (self Instance) conflictKey() string {
+	return strings.ToLower(self.Type + "/" + self.Name)
+}
+
+// Returns the instance renamed to "name (2)", "name (3)", etc. if its name is taken
+func uniqueName(i Instance, names map[string]bool) Instance {
+	name := i.Name
+	for n := 2; names[i.conflictKey()]; n++ {
+		i.Name = fmt.Sprintf("%s (%d)", truncate(name, maxInstanceName-len(strconv.Itoa(n))-3), n)
+	}
+	return i
+}
+
+// Truncates the string to at most n bytes without splitting characters
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// Returns the instance announcing the endpoint at the given URL on behalf
+// of its host, resolving the address of the host (see ParseProxyInstance)
+func NewProxyInstance(name, serviceType, rawurl string, records map[string]string) (Instance, error) {
+	i, err := ParseProxyInstance(name, serviceType, rawurl, records)
+	if err != nil || i.IPv4 != nil || i.IPv6 != nil {
+		return i, err
+	}
+	addrs, err := resolver.lookup(i.Host)
+	if err != nil || len(addrs) == 0 {
+		return Instance{}, fmt.Errorf("Could not resolve %v: %v", i.Host, err)
+	}
+	ip := addrs[0]
+	for _, addr := range addrs {
+		if addr.To4() != nil {
+			ip = addr
+			break
+		}
+	}
+	if ip.To4() != nil {
+		i.IPv4 = ip
+	} else {
+		i.IPv6 = ip
+	}
+	return i, nil
+}
+
+// Cache of the addresses of hosts, which are resolved again after resolveTTL
+type hostCache struct {
+	lookupIP func(host string) ([]net.IP, error)
+	entries  map[string]resolvedHost
+	mutex    sync.Mutex
+}
+
+type resolvedHost struct {
+	addrs   []net.IP
+	expires time.Time
+}
+
+var resolver = &hostCache{lookupIP: net.LookupIP, entries: make(map[string]resolvedHost)}
+
+// Returns the addresses of the host. Failed resolutions are not cached
+func (self *hostCache) lookup(host string) ([]net.IP, error) {
+	now := time.Now()
+	key := strings.ToLower(host)
+	self.mutex.Lock()
+	entry, ok := self.entries[key]
+	self.mutex.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := self.lookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	self.mutex.Lock()
+	// remove the expired entries of hosts no longer announced
+	for k, e := range self.entries {
+		if !now.Before(e.expires) {
+			delete(self.entries, k)
+		}
+	}
+	self.entries[key] = resolvedHost{addrs, now.Add(resolveTTL)}
+	self.mutex.Unlock()
+	return addrs, nil
+}
+
+// Returns the instance of the endpoint at the given URL. The service type
+// defaults to the one of the URL scheme (e.g. _http._tcp) and the URL path,
+// if any, is published as the path TXT record in addition to the given
+// records (too long ones are skipped). Only an IP address in the URL is set
+// as the address of the instance, whose host is then named after it
+func ParseProxyInstance(name, serviceType, rawurl string, records map[string]string) (Instance, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return Instance{}, err
+	}
+	if u.Host == "" {
+		return Instance{}, fmt.Errorf("No host in %v", rawurl)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if serviceType == "" {
+		serviceType = SchemeServiceType(scheme)
+	}
+
+	host, portStr, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		// no port
+		host, portStr = strings.Trim(u.Host, "[]"), ""
+	}
+	port, ok := schemePorts[scheme]
+	if portStr != "" {
+		port, err = strconv.Atoi(portStr)
+		if err != nil {
+			return Instance{}, fmt.Errorf("Invalid port in %v", rawurl)
+		}
+	} else if !ok {
+		return Instance{}, fmt.Errorf("No port in %v", rawurl)
+	}
+
+	i := Instance{
+		Name:   truncate(name, maxInstanceName),
+		Type:   serviceType,
+		Domain: DefaultMDNSDomain,
+		Port:   port,
+	}
+	if ip := net.ParseIP(host); ip == nil {
+		i.Host = strings.TrimSuffix(host, ".")
+	} else {
+		// name the host after its address
+		i.Host = strings.NewReplacer(".", "-", ":", "-").Replace(ip.String())
+		if ip.To4() != nil {
+			i.IPv4 = ip
+		} else {
+			i.IPv6 = ip
+		}
+	}
+
+	txt := map[string]string{TxtScheme: scheme}
+	if u.Path != "" {
+		txt["path"] = u.Path
+	}
+	for k, v := range records {
+		if len(k)+len(v)+1 <= maxTxtRecord {
+			txt[k] = v
+		}
+	}
+	i.Text = Txt(txt)
+	i.Meta = ParseTxt(i.Text)
+	return i, nil
+}
+
+// Returns the DNS-SD service type of an URL scheme (e.g. _coap._udp for coap)
+func SchemeServiceType(scheme string) string {
+	switch scheme {
+	case "coap", "coaps":
+		return "_coap._udp"
+	case "https":
+		return "_http._tcp"
+	case "mqtts":
+		return "_mqtt._tcp"
+	}
+	return "_" + scheme + "._tcp"
+}
@@ -0,0 +1,117 @@
+package discovery
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+// Registrations of a fake network
+type fakeRegistry struct {
+	registered map[string]Instance
+	mutex      sync.Mutex
+}
+
+func (self *fakeRegistry) register(i Instance) (func(), error) {
+	self.mutex.Lock()
+	self.registered[i.Name] = i
+	self.mutex.Unlock()
+	return func() {
+		self.mutex.Lock()
+		delete(self.registered, i.Name)
+		self.mutex.Unlock()
+	}, nil
+}
+
+func (self *fakeRegistry) names() map[string]int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	names := make(map[string]int)
+	for name, i := range self.registered {
+		names[name] = i.Port
+	}
+	return names
+}
+
+func TestAnnouncer(t *testing.T) {
+	instances := map[string]Instance{
+		"a": {Name: "printer", Type: "_ipp._tcp", Host: "10-0-0-1", Port: 631, IPv4: net.ParseIP("10.0.0.1")},
+		"b": {Name: "printer", Type: "_ipp._tcp", Host: "10-0-0-2", Port: 631, IPv4: net.ParseIP("10.0.0.2")},
+	}
+	registry := &fakeRegistry{registered: make(map[string]Instance)}
+	announcer := NewAnnouncer(func() (map[string]Instance, error) {
+		return instances, nil
+	})
+	announcer.register = registry.register
+
+	announcer.Sync()
+	// conflicting names are resolved in the order of the keys
+	if announced := announcer.Announced(); len(announced) != 2 || announced[0].Name != "printer" || announced[1].Name != "printer (2)" {
+		t.Fatalf("Unexpected announced instances: %+v", announced)
+	}
+
+	// update and withdraw
+	b := instances["b"]
+	b.Port = 8631
+	instances = map[string]Instance{"b": b}
+	announcer.Sync()
+	if announced := announcer.Announced(); len(announced) != 1 || announced[0].Name != "printer" || announced[0].Port != 8631 {
+		t.Fatalf("Unexpected announced instances: %+v", announced)
+	}
+
+	announcer.Stop()
+	if announced := announcer.Announced(); len(announced) != 0 {
+		t.Errorf("Expected all instances to be withdrawn, got %+v", announced)
+	}
+}
+
+func TestAnnouncerActive(t *testing.T) {
+	registry := &fakeRegistry{registered: make(map[string]Instance)}
+	announcer := NewAnnouncer(func() (map[string]Instance, error) {
+		return map[string]Instance{"a": {Name: "printer", Type: "_ipp._tcp", Host: "10-0-0-1", Port: 631}}, nil
+	})
+	announcer.register = registry.register
+	active := false
+	announcer.Active = func() bool { return active }
+
+	announcer.Sync()
+	if n := len(registry.names()); n != 0 {
+		t.Errorf("Expected no announcements while inactive, got %v", n)
+	}
+	active = true
+	announcer.Sync()
+	if n := len(registry.names()); n != 1 {
+		t.Errorf("Expected the instance to be announced once active, got %v", n)
+	}
+	// withdrawn once inactive again
+	active = false
+	announcer.Sync()
+	if n := len(registry.names()); n != 0 {
+		t.Errorf("Expected the instance to be withdrawn, got %v", n)
+	}
+}
+
+func TestNewProxyInstance(t *testing.T) {
+	i, err := NewProxyInstance("Lamp", "", "coap://192.168.1.20/lamp/state", map[string]string{"rt": "light"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Type != "_coap._udp" || i.Port != 5683 || i.Host != "192-168-1-20" || !i.IPv4.Equal(net.ParseIP("192.168.1.20")) {
+		t.Errorf("Unexpected instance: %+v", i)
+	}
+	if len(i.Text) != 3 || i.Meta["path"] != "/lamp/state" || i.Meta["rt"] != "light" || i.Meta[TxtScheme] != "coap" {
+		t.Errorf("Unexpected TXT records: %v", i.Text)
+	}
+
+	i, err = NewProxyInstance("Broker", "_pw-mqtt._tcp", "mqtt://[::1]:1884", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Type != "_pw-mqtt._tcp" || i.Port != 1884 || i.IPv6 == nil {
+		t.Errorf("Unexpected instance: %+v", i)
+	}
+
+	if _, err := NewProxyInstance("x", "", "foo://10.0.0.1/x", nil); err == nil {
+		t.Error("Expected an error for an URL without a port")
+	}
+}
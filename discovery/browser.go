@@ -0,0 +1,266 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/oleksandr/bonjour"
+)
+
+const (
+	// Default interval between browse queries
+	DefaultBrowseInterval = 30 * time.Second
+)
+
+// Type of a change of the discovered instances
+type EventType int
+
+const (
+	EventAdd EventType = iota
+	EventUpdate
+	EventRemove
+)
+
+func (self EventType) String() string {
+	switch self {
+	case EventAdd:
+		return "add"
+	case EventUpdate:
+		return "update"
+	case EventRemove:
+		return "remove"
+	}
+	return "unknown"
+}
+
+// Discovered instance of a service
+type Instance struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Domain string   `json:"domain"`
+	Host   string   `json:"host"`
+	Port   int      `json:"port"`
+	Text   []string `json:"text"`
+	// TXT records by key (see ParseTxt)
+	Meta map[string]string `json:"meta"`
+	IPv4 net.IP            `json:"ipv4,omitempty"`
+	IPv6 net.IP            `json:"ipv6,omitempty"`
+	// TTL of the service records (seconds)
+	TTL uint32 `json:"ttl"`
+	// Time the instance is removed unless it is seen again
+	Expires time.Time `json:"expires"`
+}
+
+// Returns the instance of a bonjour service entry
+func NewInstance(e *bonjour.ServiceEntry) Instance {
+	return Instance{
+		Name:   e.Instance,
+		Type:   e.Service,
+		Domain: e.Domain,
+		Host:   e.HostName,
+		Port:   e.Port,
+		Text:   append([]string{}, e.Text...),
+		Meta:   ParseTxt(e.Text),
+		IPv4:   e.AddrIPv4,
+		IPv6:   e.AddrIPv6,
+		TTL:    e.TTL,
+	}
+}
+
+// Returns the instance as a bonjour service entry
+func (self Instance) ServiceEntry() *bonjour.ServiceEntry {
+	e := bonjour.NewServiceEntry(self.Name, self.Type, self.Domain)
+	e.HostName = self.Host
+	e.Port = self.Port
+	e.Text = self.Text
+	e.TTL = self.TTL
+	e.AddrIPv4 = self.IPv4
+	e.AddrIPv6 = self.IPv6
+	return e
+}
+
+// Returns whether the instance announces the same service as other
+func (self Instance) equal(other Instance) bool {
+	return self.Host == other.Host && self.Port == other.Port &&
+		reflect.DeepEqual(self.Text, other.Text) &&
+		self.IPv4.Equal(other.IPv4) && self.IPv6.Equal(other.IPv6)
+}
+
+// Change of the discovered instances
+type Event struct {
+	Type     EventType
+	Instance Instance
+}
+
+// Options of a Browser
+type BrowserOptions struct {
+	// Provider of the instances (defaults to multicast DNS)
+	Provider Provider
+	// Domain of the services (defaults to the domain of the provider)
+	Domain string
+	// Interval between browse queries (defaults to DefaultBrowseInterval)
+	Interval time.Duration
+	// Requirements on the instances, others are ignored
+	Require Requirements
+	// Called with every change of the instances by the browsing routine
+	// (must not block)
+	Handler func(Event)
+}
+
+// Keeps browsing for the instances of a service type using a Provider.
+// Instances are removed when they are not seen again within their TTL
+// (at least two browse intervals)
+type Browser struct {
+	serviceType string
+	opts        BrowserOptions
+	instances   map[string]*Instance
+	// closed and replaced on every change
+	changed chan struct{}
+	mutex   sync.Mutex
+}
+
+func NewBrowser(serviceType string, opts BrowserOptions) *Browser {
+	if opts.Provider == nil {
+		opts.Provider = &MDNSProvider{}
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultBrowseInterval
+	}
+	return &Browser{
+		serviceType: serviceType,
+		opts:        opts,
+		instances:   make(map[string]*Instance),
+		changed:     make(chan struct{}),
+	}
+}
+
+// Browses until ctx is done (blocking call)
+func (self *Browser) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		round, cancel := context.WithTimeout(ctx, self.opts.Interval)
+		err := self.opts.Provider.Browse(round, self.serviceType, self.opts.Domain, self.found)
+		if err != nil {
+			logger.Printf("Browser.Run() Error browsing %v: %v", self.serviceType, err)
+			// wait for the next round
+			<-round.Done()
+		}
+		cancel()
+		self.expire(time.Now())
+	}
+}
+
+// Returns the discovered instances ordered by name
+func (self *Browser) Instances() []Instance {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	instances := make([]Instance, 0, len(self.instances))
+	for _, i := range self.instances {
+		instances = append(instances, *i)
+	}
+	sort.Sort(byName(instances))
+	return instances
+}
+
+// Waits until at least one instance is discovered and returns the instances
+func (self *Browser) Wait(ctx context.Context) ([]Instance, error) {
+	for {
+		self.mutex.Lock()
+		changed := self.changed
+		n := len(self.instances)
+		self.mutex.Unlock()
+		if n > 0 {
+			return self.Instances(), nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Adds or refreshes an instance from an answer
+func (self *Browser) found(i Instance) {
+	if i.Host == "" || i.Port == 0 {
+		// incomplete answer
+		return
+	}
+	if i.Meta == nil {
+		i.Meta = ParseTxt(i.Text)
+	}
+	i.Expires = time.Now().Add(self.lifetime(i.TTL))
+
+	self.mutex.Lock()
+	old, ok := self.instances[i.Name]
+	var events []Event
+	if !self.opts.Require.Match(i) {
+		// no longer meets the requirements
+		if ok {
+			delete(self.instances, i.Name)
+			events = append(events, Event{EventRemove, *old})
+		}
+		self.mutex.Unlock()
+		self.notify(events)
+		return
+	}
+	self.instances[i.Name] = &i
+	if !ok {
+		events = append(events, Event{EventAdd, i})
+	} else if !old.equal(i) {
+		events = append(events, Event{EventUpdate, i})
+	}
+	self.mutex.Unlock()
+	self.notify(events)
+}
+
+// Removes the instances expired at the given time
+func (self *Browser) expire(now time.Time) {
+	self.mutex.Lock()
+	var events []Event
+	for name, i := range self.instances {
+		if i.Expires.Before(now) {
+			delete(self.instances, name)
+			events = append(events, Event{EventRemove, *i})
+		}
+	}
+	self.mutex.Unlock()
+	self.notify(events)
+}
+
+// Wakes up the waiting routines and calls the handler with the events
+func (self *Browser) notify(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	self.mutex.Lock()
+	close(self.changed)
+	self.changed = make(chan struct{})
+	self.mutex.Unlock()
+
+	for _, e := range events {
+		logger.Printf("Browser.notify() %v %v (%v:%v)", e.Type, e.Instance.Name, e.Instance.Host, e.Instance.Port)
+		if self.opts.Handler != nil {
+			self.opts.Handler(e)
+		}
+	}
+}
+
+// Returns the time an instance is kept without being seen again
+func (self *Browser) lifetime(ttl uint32) time.Duration {
+	d := time.Duration(ttl) * time.Second
+	if d < 2*self.opts.Interval {
+		d = 2 * self.opts.Interval
+	}
+	return d
+}
+
+type byName []Instance
+
+func (self byName) Len() int           { return len(self) }
+func (self byName) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+func (self byName) Less(i, j int) bool { return self[i].Name < self[j].Name }
@@ -0,0 +1,118 @@
+package discovery
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/oleksandr/bonjour"
+)
+
+// Announced services answering every browse query
+type fakeNetwork struct {
+	entries map[string]*bonjour.ServiceEntry
+	mutex   sync.Mutex
+}
+
+func (self *fakeNetwork) announce(name, host string, port int) {
+	e := bonjour.NewServiceEntry(name, "_test._tcp", "local")
+	e.HostName = host
+	e.Port = port
+	e.Text = []string{"uri=/test"}
+	self.mutex.Lock()
+	self.entries[name] = e
+	self.mutex.Unlock()
+}
+
+func (self *fakeNetwork) withdraw(name string) {
+	self.mutex.Lock()
+	delete(self.entries, name)
+	self.mutex.Unlock()
+}
+
+func (self *fakeNetwork) Browse(ctx context.Context, serviceType, domain string, found func(Instance)) error {
+	self.mutex.Lock()
+	names := make([]string, 0, len(self.entries))
+	for name := range self.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]*bonjour.ServiceEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, self.entries[name])
+	}
+	self.mutex.Unlock()
+	for _, e := range entries {
+		found(NewInstance(e))
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func TestBrowser(t *testing.T) {
+	network := &fakeNetwork{entries: make(map[string]*bonjour.ServiceEntry)}
+	network.announce("a", "host-a.local.", 8080)
+	network.announce("b", "host-b.local.", 8080)
+	// incomplete answers are ignored
+	network.announce("c", "", 0)
+
+	events := make(chan Event, 10)
+	browser := NewBrowser("_test._tcp", BrowserOptions{
+		Provider: network,
+		Interval: 20 * time.Millisecond,
+		Handler:  func(e Event) { events <- e },
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		browser.Run(ctx)
+		close(stopped)
+	}()
+
+	instances, err := browser.Wait(ctx)
+	if err != nil || len(instances) == 0 {
+		t.Fatalf("Unexpected result of wait: %v (%v)", instances, err)
+	}
+	expectEvent(t, events, EventAdd, "a")
+	expectEvent(t, events, EventAdd, "b")
+	if instances := browser.Instances(); len(instances) != 2 || instances[0].Name != "a" || instances[0].Text[0] != "uri=/test" {
+		t.Errorf("Unexpected instances: %+v", instances)
+	}
+
+	network.announce("b", "host-b.local.", 9090)
+	expectEvent(t, events, EventUpdate, "b")
+	network.withdraw("a")
+	expectEvent(t, events, EventRemove, "a")
+	if instances := browser.Instances(); len(instances) != 1 || instances[0].Port != 9090 {
+		t.Errorf("Unexpected instances: %+v", instances)
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("The browser did not stop")
+	}
+}
+
+func TestBrowserWaitCancel(t *testing.T) {
+	browser := NewBrowser("_test._tcp", BrowserOptions{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := browser.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the deadline to be exceeded, got %v", err)
+	}
+}
+
+func expectEvent(t *testing.T, events <-chan Event, eventType EventType, name string) {
+	select {
+	case e := <-events:
+		if e.Type != eventType || e.Instance.Name != name {
+			t.Errorf("Expected %v of %v, got %v of %v", eventType, name, e.Type, e.Instance.Name)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for %v of %v", eventType, name)
+	}
+}
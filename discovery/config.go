@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"fmt"
+	"time"
+)
+
+// Types of discovery providers
+const (
+	ProviderMDNS   = "mdns"
+	ProviderDNS    = "dns"
+	ProviderStatic = "static"
+)
+
+// Discovery provider of a daemon
+type ProviderConfig struct {
+	// Type of the provider: mdns (default), dns or static
+	Type string `json:"type"`
+	// DNS server (host:port) of the dns provider
+	Server string `json:"server"`
+	// Domain of the services of the dns provider
+	Domain string `json:"domain"`
+	// Timeout of the queries of the dns provider (seconds)
+	Timeout int `json:"timeout"`
+	// JSON file with the instances of the static provider (see LoadStaticProvider)
+	File string `json:"file"`
+	// Environment variable with the instances of the static provider (see StaticProviderFromEnv)
+	Env string `json:"env"`
+}
+
+func (c *ProviderConfig) Validate() error {
+	switch c.Type {
+	case "", ProviderMDNS, ProviderDNS:
+	case ProviderStatic:
+		if c.File == "" && c.Env == "" {
+			return fmt.Errorf("Static discovery requires a file or an environment variable")
+		}
+	default:
+		return fmt.Errorf("Unknown discovery provider type: %v", c.Type)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("Discovery timeout must be >= 0")
+	}
+	return nil
+}
+
+// Creates the configured provider
+func (c *ProviderConfig) Provider() (Provider, error) {
+	switch c.Type {
+	case "", ProviderMDNS:
+		return &MDNSProvider{}, nil
+	case ProviderDNS:
+		return &UnicastProvider{
+			Server:  c.Server,
+			Domain:  c.Domain,
+			Timeout: time.Duration(c.Timeout) * time.Second,
+		}, nil
+	case ProviderStatic:
+		static := &StaticProvider{}
+		if c.File != "" {
+			p, err := LoadStaticProvider(c.File)
+			if err != nil {
+				return nil, err
+			}
+			static.Instances = append(static.Instances, p.Instances...)
+		}
+		if c.Env != "" {
+			p, err := StaticProviderFromEnv(c.Env)
+			if err != nil {
+				return nil, err
+			}
+			static.Instances = append(static.Instances, p.Instances...)
+		}
+		return static, nil
+	}
+	return nil, fmt.Errorf("Unknown discovery provider type: %v", c.Type)
+}
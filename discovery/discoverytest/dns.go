@@ -0,0 +1,192 @@
+package discoverytest
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/patchwork-toolkit/patchwork/discovery"
+)
+
+// TTL of the records of announced instances without a TTL
+const DefaultTTL = 120
+
+// DNS server on the loopback interface answering the DNS-SD queries
+// of the announced instances over UDP and TCP. UDP responses larger than
+// the size of the request (512 bytes or its EDNS0 size) are truncated
+type DNSServer struct {
+	// Address (host:port) of the server
+	Addr string
+	// Domain of the announced instances
+	Domain string
+
+	udp     *dns.Server
+	tcp     *dns.Server
+	records map[string][]dns.RR
+	mutex   sync.Mutex
+}
+
+// Starts a server of the instances in the given domain
+func NewDNSServer(domain string) (*DNSServer, error) {
+	conn, listener, err := listen()
+	if err != nil {
+		return nil, err
+	}
+	s := &DNSServer{
+		Addr:    conn.LocalAddr().String(),
+		Domain:  domain,
+		records: make(map[string][]dns.RR),
+	}
+	// short read timeout for a quick shutdown
+	s.udp = &dns.Server{PacketConn: conn, Handler: s, ReadTimeout: 100 * time.Millisecond}
+	s.tcp = &dns.Server{Listener: listener, Handler: s, ReadTimeout: 100 * time.Millisecond}
+	go s.udp.ActivateAndServe()
+	go s.tcp.ActivateAndServe()
+	return s, nil
+}
+
+// Listens on the same UDP and TCP port of the loopback interface
+func listen() (net.PacketConn, net.Listener, error) {
+	var err error
+	for attempt := 0; attempt < 10; attempt++ {
+		var conn net.PacketConn
+		conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return nil, nil, err
+		}
+		var listener net.Listener
+		listener, err = net.Listen("tcp", conn.LocalAddr().String())
+		if err == nil {
+			return conn, listener, nil
+		}
+		// the port is taken for TCP
+		conn.Close()
+	}
+	return nil, nil, err
+}
+
+// Returns a provider browsing the instances of the server
+func (self *DNSServer) Provider() *discovery.UnicastProvider {
+	return &discovery.UnicastProvider{Server: self.Addr, Domain: self.Domain}
+}
+
+// Announces the instance with PTR, SRV, TXT and address records
+func (self *DNSServer) Announce(i discovery.Instance) {
+	ttl := i.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	service, name, host := self.names(i)
+	header := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.remove(service, name)
+	self.records[key(service)] = append(self.records[key(service)], &dns.PTR{Hdr: header(service, dns.TypePTR), Ptr: name})
+	self.records[key(name)] = []dns.RR{
+		&dns.SRV{Hdr: header(name, dns.TypeSRV), Port: uint16(i.Port), Target: host},
+		&dns.TXT{Hdr: header(name, dns.TypeTXT), Txt: i.Text},
+	}
+	var addrs []dns.RR
+	if i.IPv4 != nil {
+		addrs = append(addrs, &dns.A{Hdr: header(host, dns.TypeA), A: i.IPv4})
+	}
+	if i.IPv6 != nil {
+		addrs = append(addrs, &dns.AAAA{Hdr: header(host, dns.TypeAAAA), AAAA: i.IPv6})
+	}
+	self.records[key(host)] = addrs
+}
+
+// Removes the records of the instance
+func (self *DNSServer) Withdraw(i discovery.Instance) {
+	service, name, _ := self.names(i)
+	self.mutex.Lock()
+	self.remove(service, name)
+	self.mutex.Unlock()
+}
+
+// Stops the server
+func (self *DNSServer) Close() {
+	self.udp.Shutdown()
+	self.tcp.Shutdown()
+}
+
+func (self *DNSServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = true
+
+	self.mutex.Lock()
+	for _, q := range req.Question {
+		records, ok := self.records[key(q.Name)]
+		if !ok {
+			m.Rcode = dns.RcodeNameError
+			continue
+		}
+		for _, rr := range records {
+			if rr.Header().Rrtype != q.Qtype {
+				continue
+			}
+			m.Answer = append(m.Answer, rr)
+			// addresses of the target in the additional section
+			if srv, ok := rr.(*dns.SRV); ok {
+				m.Extra = append(m.Extra, self.records[key(srv.Target)]...)
+			}
+		}
+	}
+	self.mutex.Unlock()
+
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		size := dns.MinMsgSize
+		if opt := req.IsEdns0(); opt != nil && int(opt.UDPSize()) > size {
+			size = int(opt.UDPSize())
+		}
+		if b, err := m.Pack(); err == nil && len(b) > size {
+			m.Truncated = true
+			m.Answer, m.Extra = nil, nil
+		}
+	}
+	w.WriteMsg(m)
+}
+
+// Returns the service, instance and host names of the instance
+func (self *DNSServer) names(i discovery.Instance) (string, string, string) {
+	service := dns.Fqdn(i.Type + "." + self.Domain)
+	return service, escapeLabel(i.Name) + "." + service, dns.Fqdn(i.Host)
+}
+
+// Returns the instance name as a label in presentation format
+func escapeLabel(name string) string {
+	var b []byte
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; c {
+		case '.', ' ', '\\', '(', ')', ';', '"', '@':
+			b = append(b, '\\', c)
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+// Returns the key of the records of a name (names are case-insensitive)
+func key(name string) string {
+	return strings.ToLower(name)
+}
+
+// Removes the PTR record and the records of the instance
+// WARNING: the caller must obtain the lock before calling
+func (self *DNSServer) remove(service, name string) {
+	var ptrs []dns.RR
+	for _, rr := range self.records[key(service)] {
+		if !strings.EqualFold(rr.(*dns.PTR).Ptr, name) {
+			ptrs = append(ptrs, rr)
+		}
+	}
+	self.records[key(service)] = ptrs
+	delete(self.records, key(name))
+}
@@ -0,0 +1,4 @@
+// Package discovery/discoverytest provides an in-process unicast DNS server
+// announcing service instances for testing the discovery of services with
+// the DNS-SD provider.
+package discoverytest
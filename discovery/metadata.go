@@ -0,0 +1,198 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Keys of the TXT records published by the services
+const (
+	// Location of the API
+	TxtUri = "uri"
+	// Version of the API
+	TxtApiVersion = "apiVersion"
+	// Id of the service instance
+	TxtId = "id"
+	// Scheme of the API (http or https)
+	TxtScheme = "scheme"
+	// Type of the API (e.g. DeviceCatalog)
+	TxtApiType = "apiType"
+)
+
+// Returns TXT records of the given key/value pairs ordered by key
+func Txt(records map[string]string) []string {
+	txt := make([]string, 0, len(records))
+	for k, v := range records {
+		txt = append(txt, k+"="+v)
+	}
+	sort.Strings(txt)
+	return txt
+}
+
+// Parses TXT records of key=value pairs (or keys without a value).
+// Keys are case-insensitive and returned in lower case; the first
+// record of a key is used
+func ParseTxt(txt []string) map[string]string {
+	records := make(map[string]string, len(txt))
+	for _, t := range txt {
+		k, v := t, ""
+		if i := strings.Index(t, "="); i >= 0 {
+			k, v = t[:i], t[i+1:]
+		}
+		k = strings.ToLower(k)
+		if _, ok := records[k]; k != "" && !ok {
+			records[k] = v
+		}
+	}
+	return records
+}
+
+// Returns the value of a TXT key of the instance
+func (self Instance) TxtValue(key string) (string, bool) {
+	v, ok := self.Meta[strings.ToLower(key)]
+	return v, ok
+}
+
+// Returns an id of the service instance on this host listening on the given port
+func DefaultInstanceId(port int) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s:%d", host, port)
+}
+
+// Address used in the endpoints of discovered instances
+type AddressPreference int
+
+const (
+	// Host name of the instance
+	PreferHostname AddressPreference = iota
+	// IPv4 address, falling back to the IPv6 address and the host name
+	PreferIPv4
+	// IPv6 address, falling back to the IPv4 address and the host name
+	PreferIPv6
+)
+
+// Parses an address preference: "hostname" (or empty), "ipv4" or "ipv6"
+func ParseAddressPreference(s string) (AddressPreference, error) {
+	switch strings.ToLower(s) {
+	case "", "hostname":
+		return PreferHostname, nil
+	case "ipv4":
+		return PreferIPv4, nil
+	case "ipv6":
+		return PreferIPv6, nil
+	}
+	return PreferHostname, fmt.Errorf("Unknown address preference: %v", s)
+}
+
+// Returns the host of the instance to connect to
+func (self Instance) Address(prefer AddressPreference) string {
+	var addrs []net.IP
+	switch prefer {
+	case PreferIPv4:
+		addrs = []net.IP{self.IPv4, self.IPv6}
+	case PreferIPv6:
+		addrs = []net.IP{self.IPv6, self.IPv4}
+	}
+	for _, ip := range addrs {
+		if ip != nil {
+			return ip.String()
+		}
+	}
+	return strings.TrimSuffix(self.Host, ".")
+}
+
+// Returns the endpoint of the API of the instance, using the scheme
+// and uri from its TXT records
+func (self Instance) Endpoint(prefer AddressPreference) string {
+	scheme, ok := self.TxtValue(TxtScheme)
+	if !ok || scheme == "" {
+		scheme = "http"
+	}
+	uri, _ := self.TxtValue(TxtUri)
+	host := net.JoinHostPort(self.Address(prefer), strconv.Itoa(self.Port))
+	return fmt.Sprintf("%s://%s%s", scheme, host, uri)
+}
+
+// Requirements on discovered instances
+type Requirements struct {
+	// Required type of the API
+	ApiType string
+	// Required compatible version of the API (see CompatibleVersion)
+	ApiVersion string
+	// Instances announcing no API type or version (e.g. of older releases)
+	// meet the ApiType and ApiVersion requirements
+	AllowUnannounced bool
+	// Require an API served over TLS
+	TLS bool
+	// Other required TXT values
+	Txt map[string]string
+}
+
+// Returns whether the instance meets the requirements
+func (self Requirements) Match(i Instance) bool {
+	if self.ApiType != "" {
+		if v, ok := i.TxtValue(TxtApiType); v != self.ApiType && !(!ok && self.AllowUnannounced) {
+			return false
+		}
+	}
+	if self.ApiVersion != "" {
+		if v, ok := i.TxtValue(TxtApiVersion); !CompatibleVersion(v, self.ApiVersion) && !(!ok && self.AllowUnannounced) {
+			return false
+		}
+	}
+	if self.TLS {
+		if v, _ := i.TxtValue(TxtScheme); v != "https" {
+			return false
+		}
+	}
+	for k, v := range self.Txt {
+		if value, ok := i.TxtValue(k); !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns whether an API of the given version can be used by a client
+// requiring the version required: the major versions match (the minor
+// versions for major version 0) and version is not older than required
+func CompatibleVersion(version, required string) bool {
+	v, err := parseVersion(version)
+	if err != nil {
+		return false
+	}
+	r, err := parseVersion(required)
+	if err != nil {
+		return false
+	}
+	if v[0] != r[0] || (r[0] == 0 && v[1] != r[1]) {
+		return false
+	}
+	for i := range v {
+		if v[i] != r[i] {
+			return v[i] > r[i]
+		}
+	}
+	return true
+}
+
+// Parses a major.minor.patch version (minor and patch default to 0)
+func parseVersion(s string) ([3]int, error) {
+	var v [3]int
+	parts := strings.SplitN(s, ".", 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("Invalid version: %v", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
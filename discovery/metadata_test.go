@@ -0,0 +1,111 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseTxt(t *testing.T) {
+	meta := ParseTxt([]string{"uri=/dc", "apiVersion=0.2.1", "URI=/other", "federation", "query=a=b"})
+	expected := map[string]string{"uri": "/dc", "apiversion": "0.2.1", "federation": "", "query": "a=b"}
+	if len(meta) != len(expected) {
+		t.Errorf("Unexpected records: %v", meta)
+	}
+	for k, v := range expected {
+		if meta[k] != v {
+			t.Errorf("Expected %v=%v, got %v", k, v, meta[k])
+		}
+	}
+
+	txt := Txt(map[string]string{TxtUri: "/dc", TxtApiType: "DeviceCatalog"})
+	if len(txt) != 2 || txt[0] != "apiType=DeviceCatalog" || txt[1] != "uri=/dc" {
+		t.Errorf("Unexpected TXT records: %v", txt)
+	}
+}
+
+func TestCompatibleVersion(t *testing.T) {
+	for _, c := range []struct {
+		version, required string
+		compatible        bool
+	}{
+		{"0.2.1", "0.2.1", true},
+		{"0.2.3", "0.2.1", true},
+		{"0.2.0", "0.2.1", false},
+		{"0.3.0", "0.2.1", false},
+		{"1.4", "1.2.0", true},
+		{"2.0.0", "1.2.0", false},
+		{"", "0.2.1", false},
+		{"x.y", "0.2.1", false},
+	} {
+		if CompatibleVersion(c.version, c.required) != c.compatible {
+			t.Errorf("Compatibility of %v with %v: expected %v", c.version, c.required, c.compatible)
+		}
+	}
+}
+
+func TestRequirements(t *testing.T) {
+	i := NewInstance(Instance{
+		Name: "dc",
+		Host: "host.local.",
+		Port: 8080,
+		Text: []string{"uri=/dc", "apiVersion=0.2.1", "apiType=DeviceCatalog", "scheme=https"},
+	}.ServiceEntry())
+
+	if !(Requirements{ApiType: "DeviceCatalog", ApiVersion: "0.2.0", TLS: true}).Match(i) {
+		t.Error("Expected the instance to meet the requirements")
+	}
+	for _, r := range []Requirements{
+		{ApiType: "ServiceCatalog"},
+		{ApiVersion: "0.3.0"},
+		{Txt: map[string]string{"federation": "true"}},
+	} {
+		if r.Match(i) {
+			t.Errorf("Expected the instance not to meet %+v", r)
+		}
+	}
+	if (Requirements{TLS: true}).Match(Instance{}) {
+		t.Error("Expected an instance without scheme not to meet the TLS requirement")
+	}
+
+	// instances of older releases announce no API type and version
+	old := NewInstance(Instance{Name: "dc", Host: "host.local.", Port: 8080, Text: []string{"uri=/dc"}}.ServiceEntry())
+	if (Requirements{ApiType: "DeviceCatalog", ApiVersion: "0.2.0"}).Match(old) {
+		t.Error("Expected an instance without API type and version not to meet the requirements")
+	}
+	if !(Requirements{ApiType: "DeviceCatalog", ApiVersion: "0.2.0", AllowUnannounced: true}).Match(old) {
+		t.Error("Expected an instance without API type and version to be allowed")
+	}
+	if (Requirements{ApiType: "ServiceCatalog", ApiVersion: "0.2.0", AllowUnannounced: true}).Match(i) {
+		t.Error("Expected an instance announcing another API type not to be allowed")
+	}
+}
+
+func TestInstanceEndpoint(t *testing.T) {
+	i := Instance{
+		Host: "host.local.",
+		Port: 8080,
+		Meta: ParseTxt([]string{"uri=/dc"}),
+		IPv4: net.ParseIP("192.168.1.10"),
+		IPv6: net.ParseIP("fe80::1"),
+	}
+	for prefer, expected := range map[AddressPreference]string{
+		PreferHostname: "http://host.local:8080/dc",
+		PreferIPv4:     "http://192.168.1.10:8080/dc",
+		PreferIPv6:     "http://[fe80::1]:8080/dc",
+	} {
+		if e := i.Endpoint(prefer); e != expected {
+			t.Errorf("Expected %v, got %v", expected, e)
+		}
+	}
+
+	// falls back to the other address family and uses the published scheme
+	i.IPv6 = nil
+	i.Meta[TxtScheme] = "https"
+	if e := i.Endpoint(PreferIPv6); e != "https://192.168.1.10:8080/dc" {
+		t.Errorf("Unexpected endpoint: %v", e)
+	}
+
+	if _, err := ParseAddressPreference("ipx"); err == nil {
+		t.Error("Expected an error for an unknown address preference")
+	}
+}
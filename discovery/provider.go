@@ -0,0 +1,61 @@
+package discovery
+
+import (
+	"context"
+	"net"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/oleksandr/bonjour"
+)
+
+// Default domain of the multicast DNS services
+const DefaultMDNSDomain = "local"
+
+// Source of discovered service instances
+type Provider interface {
+	// Browses for the instances of the service type in the domain (the
+	// default domain of the provider if empty) until ctx is done, calling
+	// found with every answer
+	Browse(ctx context.Context, serviceType, domain string, found func(Instance)) error
+}
+
+// Provider browsing using multicast DNS
+type MDNSProvider struct {
+	// Network interface to browse on (all if nil)
+	Interface *net.Interface
+}
+
+func (self *MDNSProvider) Browse(ctx context.Context, serviceType, domain string, found func(Instance)) error {
+	if domain == "" {
+		domain = DefaultMDNSDomain
+	}
+	resolver, err := bonjour.NewResolver(self.Interface)
+	if err != nil {
+		return err
+	}
+	results := make(chan *bonjour.ServiceEntry, 16)
+	err = resolver.Browse(serviceType, domain, results)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case e := <-results:
+			found(NewInstance(e))
+		case <-ctx.Done():
+			// keep reading the answers until the resolver exits
+			exited := make(chan struct{})
+			go func() {
+				resolver.Exit <- true
+				close(exited)
+			}()
+			for {
+				select {
+				case <-results:
+				case <-exited:
+					return nil
+				}
+			}
+		}
+	}
+}
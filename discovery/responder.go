@@ -0,0 +1,301 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/miekg/dns"
+)
+
+const (
+	// TTL of the announced service records (seconds)
+	mdnsServiceTTL = 4500
+	// TTL of the announced address records (seconds)
+	mdnsHostTTL = 120
+	// Interval of the repeated announcement of a new instance
+	mdnsRepeat = time.Second
+)
+
+var (
+	mdnsGroupIPv4 = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	mdnsGroupIPv6 = &net.UDPAddr{IP: net.ParseIP("ff02::fb"), Port: 5353}
+)
+
+// Multicast DNS responder (RFC 6762) of the records of several instances,
+// answering the queries of all of them on a single pair of sockets
+type responder struct {
+	conns []*net.UDPConn
+	// records by lower-case owner name and by value, with the number
+	// of instances sharing them (e.g. the address of a host)
+	records map[string]map[string]*sharedRecord
+	closed  bool
+	mutex   sync.Mutex
+}
+
+type sharedRecord struct {
+	rr   dns.RR
+	refs int
+}
+
+// Opens the mDNS sockets on the interface (the default multicast interface if nil)
+func newResponder(iface *net.Interface) (*responder, error) {
+	self := &responder{records: make(map[string]map[string]*sharedRecord)}
+	if c, err := net.ListenMulticastUDP("udp4", iface, mdnsGroupIPv4); err == nil {
+		self.conns = append(self.conns, c)
+	} else {
+		logger.Printf("newResponder() Error listening on IPv4: %v", err)
+	}
+	if c, err := net.ListenMulticastUDP("udp6", iface, mdnsGroupIPv6); err == nil {
+		self.conns = append(self.conns, c)
+	} else {
+		logger.Printf("newResponder() Error listening on IPv6: %v", err)
+	}
+	if len(self.conns) == 0 {
+		return nil, fmt.Errorf("Could not listen for mDNS queries")
+	}
+	for _, c := range self.conns {
+		go self.serve(c)
+	}
+	return self, nil
+}
+
+// Adds and announces the records of the instance. Returns the function withdrawing them
+func (self *responder) add(i Instance) (func(), error) {
+	records, err := instanceRecords(i)
+	if err != nil {
+		return nil, err
+	}
+	self.mutex.Lock()
+	for _, rr := range records {
+		name, value := strings.ToLower(rr.Header().Name), rr.String()
+		if self.records[name] == nil {
+			self.records[name] = make(map[string]*sharedRecord)
+		}
+		if r, ok := self.records[name][value]; ok {
+			r.refs++
+		} else {
+			self.records[name][value] = &sharedRecord{rr: rr, refs: 1}
+		}
+	}
+	self.mutex.Unlock()
+
+	// announced twice (RFC 6762 section 8.3)
+	self.announce(records)
+	time.AfterFunc(mdnsRepeat, func() {
+		self.mutex.Lock()
+		current := self.records[strings.ToLower(records[0].Header().Name)][records[0].String()] != nil
+		self.mutex.Unlock()
+		if current {
+			self.announce(records)
+		}
+	})
+
+	var once sync.Once
+	return func() { once.Do(func() { self.remove(records) }) }, nil
+}
+
+// Removes the records of an instance, sending goodbyes of the ones no longer shared
+func (self *responder) remove(records []dns.RR) {
+	var goodbyes []dns.RR
+	self.mutex.Lock()
+	for _, rr := range records {
+		name, value := strings.ToLower(rr.Header().Name), rr.String()
+		r, ok := self.records[name][value]
+		if !ok {
+			continue
+		}
+		if r.refs--; r.refs > 0 {
+			continue
+		}
+		delete(self.records[name], value)
+		if len(self.records[name]) == 0 {
+			delete(self.records, name)
+		}
+		goodbye := dns.Copy(rr)
+		goodbye.Header().Ttl = 0
+		goodbyes = append(goodbyes, goodbye)
+	}
+	self.mutex.Unlock()
+	self.announce(goodbyes)
+}
+
+// Stops answering queries
+func (self *responder) close() {
+	self.mutex.Lock()
+	self.closed = true
+	self.mutex.Unlock()
+	for _, c := range self.conns {
+		c.Close()
+	}
+}
+
+// Multicasts an unsolicited response with the records
+func (self *responder) announce(records []dns.RR) {
+	if len(records) == 0 {
+		return
+	}
+	m := new(dns.Msg)
+	m.Response = true
+	m.Authoritative = true
+	m.Answer = records
+	self.send(m, nil)
+}
+
+// Sends the message to the address or multicasts it (if nil)
+func (self *responder) send(m *dns.Msg, to *net.UDPAddr) {
+	b, err := m.Pack()
+	if err != nil {
+		logger.Printf("responder.send() Error packing a response: %v", err)
+		return
+	}
+	for _, c := range self.conns {
+		addr := to
+		if addr == nil {
+			addr = mdnsGroupIPv4
+			if c.LocalAddr().(*net.UDPAddr).IP.To4() == nil {
+				addr = mdnsGroupIPv6
+			}
+		} else if (addr.IP.To4() == nil) != (c.LocalAddr().(*net.UDPAddr).IP.To4() == nil) {
+			continue
+		}
+		c.WriteToUDP(b, addr)
+	}
+}
+
+// Answers the queries received on the connection until closed
+func (self *responder) serve(c *net.UDPConn) {
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := c.ReadFromUDP(buf)
+		if err != nil {
+			self.mutex.Lock()
+			closed := self.closed
+			self.mutex.Unlock()
+			if closed {
+				return
+			}
+			continue
+		}
+		var query dns.Msg
+		if err := query.Unpack(buf[:n]); err != nil || query.Response || query.Opcode != dns.OpcodeQuery {
+			continue
+		}
+		m := self.answer(&query)
+		if len(m.Answer) == 0 {
+			continue
+		}
+		if from.Port != mdnsGroupIPv4.Port {
+			// legacy unicast query (RFC 6762 section 6.7)
+			m.Id = query.Id
+			m.Question = query.Question
+			self.send(m, from)
+			continue
+		}
+		self.send(m, nil)
+	}
+}
+
+// Returns the response to the questions of the query, with the records
+// describing the answered instances in the additional section
+func (self *responder) answer(query *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.Response = true
+	m.Authoritative = true
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	seen := make(map[string]bool)
+	add := func(section *[]dns.RR, rr dns.RR) {
+		if v := rr.String(); !seen[v] {
+			seen[v] = true
+			*section = append(*section, rr)
+		}
+	}
+	for _, q := range query.Question {
+		for _, r := range self.records[strings.ToLower(q.Name)] {
+			if q.Qtype == r.rr.Header().Rrtype || q.Qtype == dns.TypeANY {
+				add(&m.Answer, r.rr)
+			}
+		}
+	}
+	for k := 0; k < len(m.Answer)+len(m.Extra); k++ {
+		var rr dns.RR
+		if k < len(m.Answer) {
+			rr = m.Answer[k]
+		} else {
+			rr = m.Extra[k-len(m.Answer)]
+		}
+		var target string
+		switch rr := rr.(type) {
+		case *dns.PTR:
+			target = rr.Ptr
+		case *dns.SRV:
+			target = rr.Target
+		}
+		for _, r := range self.records[strings.ToLower(target)] {
+			if r.rr.Header().Rrtype != dns.TypePTR {
+				add(&m.Extra, r.rr)
+			}
+		}
+	}
+	return m
+}
+
+// Returns the PTR, SRV, TXT and address records of the instance
+func instanceRecords(i Instance) ([]dns.RR, error) {
+	if i.Name == "" || i.Type == "" || i.Host == "" || i.Port == 0 {
+		return nil, fmt.Errorf("Incomplete instance %+v", i)
+	}
+	if i.IPv4 == nil && i.IPv6 == nil {
+		return nil, fmt.Errorf("No address of %v", i.Host)
+	}
+	domain := strings.Trim(i.Domain, ".")
+	if domain == "" {
+		domain = DefaultMDNSDomain
+	}
+	service := dns.Fqdn(i.Type + "." + domain)
+	name := escapeLabel(i.Name) + "." + service
+	host := dns.Fqdn(strings.TrimSuffix(i.Host, "."))
+	if !dns.IsSubDomain(dns.Fqdn(domain), host) {
+		host = dns.Fqdn(strings.TrimSuffix(i.Host, ".") + "." + domain)
+	}
+	header := func(name string, rrtype uint16, ttl uint32) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+	}
+
+	text := i.Text
+	if len(text) == 0 {
+		// a TXT record has at least one string
+		text = []string{""}
+	}
+	records := []dns.RR{
+		&dns.PTR{Hdr: header(service, dns.TypePTR, mdnsServiceTTL), Ptr: name},
+		&dns.SRV{Hdr: header(name, dns.TypeSRV, mdnsServiceTTL), Port: uint16(i.Port), Target: host},
+		&dns.TXT{Hdr: header(name, dns.TypeTXT, mdnsServiceTTL), Txt: text},
+		&dns.PTR{Hdr: header("_services._dns-sd._udp."+dns.Fqdn(domain), dns.TypePTR, mdnsServiceTTL), Ptr: service},
+	}
+	if ip := i.IPv4.To4(); ip != nil {
+		records = append(records, &dns.A{Hdr: header(host, dns.TypeA, mdnsHostTTL), A: ip})
+	}
+	if i.IPv6 != nil && i.IPv6.To4() == nil {
+		records = append(records, &dns.AAAA{Hdr: header(host, dns.TypeAAAA, mdnsHostTTL), AAAA: i.IPv6})
+	}
+	return records, nil
+}
+
+// Returns the instance name as a label in presentation format (e.g. My\ Catalog)
+func escapeLabel(name string) string {
+	var b []byte
+	for k := 0; k < len(name); k++ {
+		switch c := name[k]; c {
+		case '.', ' ', '\\', '(', ')', ';', '"', '@':
+			b = append(b, '\\', c)
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,79 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/miekg/dns"
+)
+
+func query(r *responder, name string, qtype uint16) *dns.Msg {
+	q := new(dns.Msg)
+	q.SetQuestion(name, qtype)
+	return r.answer(q)
+}
+
+func TestResponder(t *testing.T) {
+	// without sockets
+	r := &responder{records: make(map[string]map[string]*sharedRecord)}
+	printer := Instance{Name: "My Printer", Type: "_ipp._tcp", Host: "10-0-0-1", Port: 631, IPv4: net.ParseIP("10.0.0.1"), Text: []string{"rp=queue"}}
+	scanner := Instance{Name: "scanner", Type: "_scan._tcp", Host: "10-0-0-1", Port: 8080, IPv4: net.ParseIP("10.0.0.1")}
+	withdrawPrinter, err := r.add(printer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withdrawScanner, err := r.add(scanner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := query(r, "_ipp._tcp.local.", dns.TypePTR)
+	if len(m.Answer) != 1 || m.Answer[0].(*dns.PTR).Ptr != `My\ Printer._ipp._tcp.local.` {
+		t.Fatalf("Unexpected answer: %v", m.Answer)
+	}
+	// SRV, TXT and the address of the host
+	if len(m.Extra) != 3 {
+		t.Errorf("Unexpected additional records: %v", m.Extra)
+	}
+	if m := query(r, "_services._dns-sd._udp.local.", dns.TypePTR); len(m.Answer) != 2 {
+		t.Errorf("Expected both service types to be enumerated, got %v", m.Answer)
+	}
+
+	// the address shared by the instances is kept until both are withdrawn
+	withdrawPrinter()
+	withdrawPrinter()
+	if m := query(r, "_ipp._tcp.local.", dns.TypePTR); len(m.Answer) != 0 {
+		t.Errorf("Expected the withdrawn instance not to be answered, got %v", m.Answer)
+	}
+	if m := query(r, "10-0-0-1.local.", dns.TypeA); len(m.Answer) != 1 {
+		t.Errorf("Expected the address of the scanner, got %v", m.Answer)
+	}
+	withdrawScanner()
+	if len(r.records) != 0 {
+		t.Errorf("Expected no records, got %v", r.records)
+	}
+
+	if _, err := r.add(Instance{Name: "x", Type: "_x._tcp", Host: "x", Port: 1}); err == nil {
+		t.Error("Expected an error for an instance without address")
+	}
+}
+
+func TestHostCache(t *testing.T) {
+	lookups := 0
+	c := &hostCache{
+		lookupIP: func(host string) ([]net.IP, error) {
+			lookups++
+			return []net.IP{net.ParseIP("10.0.0.1")}, nil
+		},
+		entries: make(map[string]resolvedHost),
+	}
+	for k := 0; k < 3; k++ {
+		if addrs, err := c.lookup("Host.example"); err != nil || len(addrs) != 1 {
+			t.Fatalf("Unexpected resolution: %v (%v)", addrs, err)
+		}
+	}
+	c.lookup("host.example")
+	if lookups != 1 {
+		t.Errorf("Expected a single resolution, got %v", lookups)
+	}
+}
@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Provider of a fixed list of instances
+type StaticProvider struct {
+	Instances []Instance
+}
+
+// Returns the provider of the instances at the given URLs by service type.
+// The scheme and path of an URL are published as TXT records and so are
+// its query parameters (e.g. http://host:8080/dc?apiVersion=0.2.1)
+func NewStaticProvider(urls map[string][]string) (*StaticProvider, error) {
+	p := &StaticProvider{}
+	for serviceType, list := range urls {
+		for _, u := range list {
+			i, err := ParseStaticInstance(serviceType, u)
+			if err != nil {
+				return nil, err
+			}
+			p.Instances = append(p.Instances, i)
+		}
+	}
+	return p, nil
+}
+
+// Loads the static provider from a JSON file with the URLs by service type,
+// e.g. {"_pw-dc._tcp": ["http://dc1:8081/dc", "http://dc2:8081/dc"]}
+func LoadStaticProvider(path string) (*StaticProvider, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var urls map[string][]string
+	err = json.Unmarshal(b, &urls)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing %v: %v", path, err)
+	}
+	return NewStaticProvider(urls)
+}
+
+// Returns the static provider of the URLs in the environment variable
+// name, as whitespace-separated serviceType=URL pairs
+func StaticProviderFromEnv(name string) (*StaticProvider, error) {
+	urls := make(map[string][]string)
+	for _, pair := range strings.Fields(os.Getenv(name)) {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("Invalid %v entry: %v", name, pair)
+		}
+		urls[pair[:i]] = append(urls[pair[:i]], pair[i+1:])
+	}
+	return NewStaticProvider(urls)
+}
+
+// Returns the instance of a service type at the given URL
+func ParseStaticInstance(serviceType, rawurl string) (Instance, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return Instance{}, err
+	}
+	host, portStr, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return Instance{}, fmt.Errorf("Invalid instance URL %v: %v", rawurl, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return Instance{}, fmt.Errorf("Invalid instance URL %v: %v", rawurl, err)
+	}
+
+	records := map[string]string{TxtScheme: u.Scheme}
+	if u.Path != "" {
+		records[TxtUri] = u.Path
+	}
+	for k, v := range u.Query() {
+		records[k] = v[0]
+	}
+	i := Instance{
+		Name: u.Host,
+		Type: serviceType,
+		Host: host,
+		Port: port,
+		Text: Txt(records),
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil {
+			i.IPv4 = ip
+		} else {
+			i.IPv6 = ip
+		}
+	}
+	i.Meta = ParseTxt(i.Text)
+	return i, nil
+}
+
+func (self *StaticProvider) Browse(ctx context.Context, serviceType, domain string, found func(Instance)) error {
+	for _, i := range self.Instances {
+		if strings.Trim(i.Type, ".") == strings.Trim(serviceType, ".") {
+			found(i)
+		}
+	}
+	<-ctx.Done()
+	return nil
+}
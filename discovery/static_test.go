@@ -0,0 +1,82 @@
+package discovery
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseStaticInstance(t *testing.T) {
+	i, err := ParseStaticInstance("_pw-dc._tcp", "https://10.0.0.5:8081/dc?apiVersion=0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Host != "10.0.0.5" || i.Port != 8081 || i.IPv4 == nil {
+		t.Errorf("Unexpected instance: %+v", i)
+	}
+	if v, _ := i.TxtValue(TxtApiVersion); v != "0.2.1" {
+		t.Errorf("Expected the apiVersion TXT record, got %v", i.Text)
+	}
+	if e := i.Endpoint(PreferHostname); e != "https://10.0.0.5:8081/dc" {
+		t.Errorf("Unexpected endpoint: %v", e)
+	}
+
+	for _, u := range []string{"http://host/dc", "http://host:port/dc"} {
+		if _, err := ParseStaticInstance("_pw-dc._tcp", u); err == nil {
+			t.Errorf("Expected an error parsing %v", u)
+		}
+	}
+}
+
+func TestStaticProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "instances.json")
+	err = ioutil.WriteFile(path, []byte(`{"_pw-dc._tcp": ["http://dc1:8081/dc"], "_pw-sc._tcp": ["http://sc:8082/sc"]}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("TEST_DISCOVERY", "_pw-dc._tcp=http://dc2:8081/dc")
+	defer os.Unsetenv("TEST_DISCOVERY")
+
+	conf := ProviderConfig{Type: ProviderStatic, File: path, Env: "TEST_DISCOVERY"}
+	if err := conf.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := conf.Provider()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hosts []string
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	provider.Browse(ctx, "_pw-dc._tcp.", "", func(i Instance) {
+		hosts = append(hosts, i.Host)
+	})
+	if len(hosts) != 2 || hosts[0] != "dc1" || hosts[1] != "dc2" {
+		t.Errorf("Unexpected instances: %v", hosts)
+	}
+}
+
+func TestProviderConfigValidate(t *testing.T) {
+	for _, c := range []ProviderConfig{
+		{Type: "bluetooth"},
+		{Type: ProviderStatic},
+		{Type: ProviderDNS, Timeout: -1},
+	} {
+		if c.Validate() == nil {
+			t.Errorf("Expected %+v to be invalid", c)
+		}
+	}
+	os.Setenv("TEST_DISCOVERY", "http://dc:8081/dc")
+	defer os.Unsetenv("TEST_DISCOVERY")
+	if _, err := StaticProviderFromEnv("TEST_DISCOVERY"); err == nil {
+		t.Error("Expected an error for an entry without a service type")
+	}
+}
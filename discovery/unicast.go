@@ -0,0 +1,202 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/miekg/dns"
+)
+
+const (
+	// Default timeout of the unicast DNS queries
+	DefaultDNSTimeout = 2 * time.Second
+	resolvConf        = "/etc/resolv.conf"
+)
+
+// Provider browsing using unicast DNS-SD (RFC 6763): the instances are
+// listed by the PTR records of the service type in the domain and described
+// by their SRV, TXT and address records
+type UnicastProvider struct {
+	// Address (host:port) of the DNS server. Defaults to the first
+	// nameserver of /etc/resolv.conf
+	Server string
+	// Domain of the services. Defaults to the first search domain
+	// of /etc/resolv.conf
+	Domain string
+	// Timeout of each query (defaults to DefaultDNSTimeout)
+	Timeout time.Duration
+}
+
+func (self *UnicastProvider) Browse(ctx context.Context, serviceType, domain string, found func(Instance)) error {
+	server, domain, err := self.resolver(domain)
+	if err != nil {
+		return err
+	}
+	service := dns.Fqdn(serviceType + "." + domain)
+	ptrs, _, err := self.query(server, service, dns.TypePTR)
+	if err != nil {
+		return err
+	}
+
+	for _, rr := range ptrs {
+		ptr, ok := rr.(*dns.PTR)
+		if !ok || ctx.Err() != nil {
+			continue
+		}
+		i, err := self.lookup(server, ptr.Ptr)
+		if err != nil {
+			logger.Printf("UnicastProvider.Browse() Error looking up %v: %v", ptr.Ptr, err)
+			continue
+		}
+		i.Name = unescapeLabel(strings.TrimSuffix(ptr.Ptr, "."+service))
+		i.Type = serviceType
+		i.Domain = domain
+		if ptr.Hdr.Ttl < i.TTL {
+			i.TTL = ptr.Hdr.Ttl
+		}
+		found(i)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// Returns the instance described by the records of the given name
+func (self *UnicastProvider) lookup(server, name string) (Instance, error) {
+	var i Instance
+	answers, extra, err := self.query(server, name, dns.TypeSRV)
+	if err != nil {
+		return i, err
+	}
+	for _, rr := range answers {
+		if srv, ok := rr.(*dns.SRV); ok {
+			i.Host = srv.Target
+			i.Port = int(srv.Port)
+			i.TTL = srv.Hdr.Ttl
+			break
+		}
+	}
+	if i.Host == "" {
+		return i, fmt.Errorf("No SRV record")
+	}
+
+	answers, _, err = self.query(server, name, dns.TypeTXT)
+	if err != nil {
+		return i, err
+	}
+	for _, rr := range answers {
+		if txt, ok := rr.(*dns.TXT); ok {
+			i.Text = append(i.Text, txt.Txt...)
+		}
+	}
+	i.Meta = ParseTxt(i.Text)
+
+	// addresses from the additional records of the SRV answer or queried
+	self.addresses(&i, extra)
+	if i.IPv4 == nil {
+		if answers, _, err := self.query(server, i.Host, dns.TypeA); err == nil {
+			self.addresses(&i, answers)
+		}
+	}
+	if i.IPv6 == nil {
+		if answers, _, err := self.query(server, i.Host, dns.TypeAAAA); err == nil {
+			self.addresses(&i, answers)
+		}
+	}
+	return i, nil
+}
+
+// Sets the addresses of the instance host from the records
+func (self *UnicastProvider) addresses(i *Instance, records []dns.RR) {
+	for _, rr := range records {
+		switch rr := rr.(type) {
+		case *dns.A:
+			if i.IPv4 == nil && strings.EqualFold(rr.Hdr.Name, i.Host) {
+				i.IPv4 = rr.A
+			}
+		case *dns.AAAA:
+			if i.IPv6 == nil && strings.EqualFold(rr.Hdr.Name, i.Host) {
+				i.IPv6 = rr.AAAA
+			}
+		}
+	}
+}
+
+// Returns the label in presentation format (e.g. My\ Catalog) as text
+func unescapeLabel(label string) string {
+	var b []byte
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if c == '\\' && i+1 < len(label) {
+			i++
+			c = label[i]
+			// escaped byte value (\DDD)
+			if i+2 < len(label) && isDigit(c) && isDigit(label[i+1]) && isDigit(label[i+2]) {
+				c = (c-'0')*100 + (label[i+1]-'0')*10 + (label[i+2] - '0')
+				i += 2
+			}
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Queries the records of the given name and type, returning the answers
+// and the additional records
+func (self *UnicastProvider) query(server, name string, qtype uint16) ([]dns.RR, []dns.RR, error) {
+	timeout := self.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDNSTimeout
+	}
+	client := &dns.Client{DialTimeout: timeout, ReadTimeout: timeout, WriteTimeout: timeout}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	// larger UDP responses, e.g. of services with many instances
+	m.SetEdns0(dns.DefaultMsgSize, false)
+	r, _, err := client.Exchange(m, server)
+	if err == nil && r.Truncated {
+		// the complete response over TCP
+		client.Net = "tcp"
+		r, _, err = client.Exchange(m, server)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, nil, fmt.Errorf("%v query of %v failed: %v", dns.TypeToString[qtype], name, dns.RcodeToString[r.Rcode])
+	}
+	return r.Answer, r.Extra, nil
+}
+
+// Returns the DNS server and the domain to browse
+func (self *UnicastProvider) resolver(domain string) (string, string, error) {
+	server := self.Server
+	if domain == "" {
+		domain = self.Domain
+	}
+	if server == "" || domain == "" {
+		conf, err := dns.ClientConfigFromFile(resolvConf)
+		if err != nil {
+			return "", "", err
+		}
+		if server == "" && len(conf.Servers) > 0 {
+			server = net.JoinHostPort(conf.Servers[0], conf.Port)
+		}
+		if domain == "" && len(conf.Search) > 0 {
+			domain = conf.Search[0]
+		}
+	}
+	if server == "" {
+		return "", "", fmt.Errorf("No DNS server configured")
+	}
+	if domain == "" {
+		return "", "", fmt.Errorf("No DNS-SD domain configured")
+	}
+	return server, domain, nil
+}
@@ -0,0 +1,151 @@
+package discovery_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/patchwork-toolkit/patchwork/discovery"
+	"github.com/patchwork-toolkit/patchwork/discovery/discoverytest"
+)
+
+func TestUnicastProvider(t *testing.T) {
+	server, err := discoverytest.NewDNSServer("example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	dc := discovery.Instance{
+		Name: "Device Catalog",
+		Type: "_pw-dc._tcp",
+		Host: "dc.example.test",
+		Port: 8081,
+		Text: []string{"uri=/dc", "apiVersion=0.2.1"},
+		IPv4: net.ParseIP("10.0.0.5"),
+	}
+	server.Announce(dc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	i, err := discovery.DiscoverFirst(ctx, dc.Type, discovery.BrowserOptions{
+		Provider: server.Provider(),
+		Require:  discovery.Requirements{ApiVersion: "0.2.0"},
+	})
+	if err != nil {
+		t.Fatal("Failed to discover the instance:", err)
+	}
+	if i.Name != dc.Name || i.Domain != "example.test" || i.Port != dc.Port || !i.IPv4.Equal(dc.IPv4) {
+		t.Errorf("Unexpected instance: %+v", i)
+	}
+	if e := i.Endpoint(discovery.PreferHostname); e != "http://dc.example.test:8081/dc" {
+		t.Errorf("Unexpected endpoint: %v", e)
+	}
+	if e := i.Endpoint(discovery.PreferIPv4); e != "http://10.0.0.5:8081/dc" {
+		t.Errorf("Unexpected endpoint: %v", e)
+	}
+}
+
+func TestUnicastProviderManyInstances(t *testing.T) {
+	server, err := discoverytest.NewDNSServer("example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// more PTR records than fit in a UDP response
+	const n = 300
+	for k := 0; k < n; k++ {
+		server.Announce(discovery.Instance{
+			Name: fmt.Sprintf("Service Instance %03d", k),
+			Type: "_test._tcp",
+			Host: fmt.Sprintf("host%03d.example.test", k),
+			Port: 8080,
+			IPv4: net.ParseIP("10.0.0.5"),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	found := map[string]bool{}
+	err = server.Provider().Browse(ctx, "_test._tcp", "", func(i discovery.Instance) {
+		found[i.Name] = true
+		if len(found) == n {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatal("Failed to browse the instances:", err)
+	}
+	if len(found) != n {
+		t.Errorf("Expected %d instances, found %d", n, len(found))
+	}
+}
+
+func TestUnicastProviderWithdraw(t *testing.T) {
+	server, err := discoverytest.NewDNSServer("example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// withdrawn instances are removed when their records expire
+	a := discovery.Instance{Name: "a", Type: "_test._tcp", Host: "a.example.test", Port: 8080, TTL: 1}
+	b := discovery.Instance{Name: "b", Type: "_test._tcp", Host: "b.example.test", Port: 8080, TTL: 1}
+	server.Announce(a)
+	server.Announce(b)
+
+	events := make(chan discovery.Event, 10)
+	browser := discovery.NewBrowser("_test._tcp", discovery.BrowserOptions{
+		Provider: server.Provider(),
+		Interval: 20 * time.Millisecond,
+		Handler:  func(e discovery.Event) { events <- e },
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go browser.Run(ctx)
+
+	added := map[string]bool{}
+	for len(added) < 2 {
+		e := nextEvent(t, events)
+		if e.Type != discovery.EventAdd {
+			t.Fatalf("Unexpected %v of %v", e.Type, e.Instance.Name)
+		}
+		added[e.Instance.Name] = true
+	}
+
+	server.Withdraw(a)
+	if e := nextEvent(t, events); e.Type != discovery.EventRemove || e.Instance.Name != "a" {
+		t.Errorf("Expected the removal of a, got %v of %v", e.Type, e.Instance.Name)
+	}
+	if instances := browser.Instances(); len(instances) != 1 || instances[0].Name != "b" {
+		t.Errorf("Unexpected instances: %+v", instances)
+	}
+}
+
+func TestUnicastProviderUnknownService(t *testing.T) {
+	server, err := discoverytest.NewDNSServer("example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	err = server.Provider().Browse(context.Background(), "_none._tcp", "", func(i discovery.Instance) {
+		t.Errorf("Unexpected instance: %+v", i)
+	})
+	if err == nil {
+		t.Error("Expected an error browsing an unknown service type")
+	}
+}
+
+func nextEvent(t *testing.T, events <-chan discovery.Event) discovery.Event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+	return discovery.Event{}
+}
@@ -4,7 +4,9 @@
 package discovery
 
 import (
+	"context"
 	"log"
+	"sync"
 
 	"github.com/patchwork-toolkit/patchwork/Godeps/_workspace/src/github.com/oleksandr/bonjour"
 )
@@ -17,29 +19,36 @@ type DiscoverHandler func(service *bonjour.ServiceEntry)
 func DiscoverAndExecute(serviceType string, handler DiscoverHandler) {
 	log.Println("Discovering catalog via DNS-SD...")
 
-	services := make(chan *bonjour.ServiceEntry)
-	resolver, err := bonjour.NewResolver(nil)
-	if err != nil {
-		log.Println("Failed to create DNS-SD resolver:", err.Error())
-		return
-	}
-
-	go func(services chan *bonjour.ServiceEntry, exitCh chan<- bool) {
-		for service := range services {
-			log.Println("Catalog discovered:", service.ServiceInstanceName())
-
-			// stop resolver
-			exitCh <- true
-
-			// executing the handler
-			handler(service)
+	ctx, cancel := context.WithCancel(context.Background())
+	var once sync.Once
+	browser := NewBrowser(serviceType, BrowserOptions{
+		Handler: func(e Event) {
+			if e.Type != EventAdd {
+				return
+			}
+			once.Do(func() {
+				log.Println("Catalog discovered:", e.Instance.Name)
+				// stop browsing
+				cancel()
+				// executing the handler
+				go handler(e.Instance.ServiceEntry())
+			})
+		},
+	})
+	go browser.Run(ctx)
+}
 
-			// exit the loop
-			break
-		}
-	}(services, resolver.Exit)
+// Browses for a service by a given type until an instance is discovered
+// or ctx is done
+func DiscoverFirst(ctx context.Context, serviceType string, opts BrowserOptions) (Instance, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	browser := NewBrowser(serviceType, opts)
+	go browser.Run(ctx)
 
-	if err := resolver.Browse(serviceType, "", services); err != nil {
-		log.Printf("Failed to browse services using type %s", serviceType)
+	instances, err := browser.Wait(ctx)
+	if err != nil {
+		return Instance{}, err
 	}
+	return instances[0], nil
 }